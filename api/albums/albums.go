@@ -0,0 +1,315 @@
+package albums
+
+import (
+	"blog/app"
+	"blog/db/albums"
+	"blog/db/images"
+	"blog/logging"
+	albums_service "blog/service/albums"
+	"blog/util"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// handler serves the album endpoints of an App.
+type handler struct {
+	app *app.App
+}
+
+// @Summary Create an album
+// @Description Album names are unique for each user and up to 100 characters long.
+// @Tags albums
+// @Accept json
+// @Produce json
+// @Param album body albums.Album true "Album"
+// @Param Authorization header string true "Auth Token"
+// @Success 200 {object} albums.Album
+// @Failure 400 "Bad Request"
+// @Failure 401 "Invalid Auth Token"
+// @Failure 409 "Album Already Exists"
+// @Failure 500 "Internal Error"
+// @Router /api/albums/ [post]
+func (h handler) add(w http.ResponseWriter, r *http.Request) {
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
+		return
+	}
+	name, ok := h.readName(w, r)
+	if !ok {
+		return
+	}
+
+	album, err := albums_service.Add(h.app, r.Context(), userId, name)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	h.write(w, r, album)
+}
+
+// @Summary Get your albums
+// @Description Albums of the user of the token, sorted by name.
+// @Tags albums
+// @Produce json
+// @Param Authorization header string true "Auth Token"
+// @Success 200 {object} []albums.Album
+// @Failure 401 "Invalid Auth Token"
+// @Failure 500 "Internal Error"
+// @Router /api/albums/ [get]
+func (h handler) list(w http.ResponseWriter, r *http.Request) {
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
+		return
+	}
+
+	albumList, err := albums_service.ForUser(h.app, r.Context(), userId)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	h.write(w, r, albumList)
+}
+
+// @Summary Get an album
+// @Tags albums
+// @Produce json
+// @Param id path int true "Album ID"
+// @Success 200 {object} albums.Album
+// @Failure 400 "Bad Request"
+// @Failure 404 "Album Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/albums/{id} [get]
+func (h handler) get(w http.ResponseWriter, r *http.Request) {
+	albumId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	album, err := albums_service.Get(h.app, r.Context(), albumId)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	h.write(w, r, album)
+}
+
+// @Summary Get the images in an album
+// @Description Images are returned in the order they were added, newest first.
+// @Tags albums
+// @Produce json
+// @Param id path int true "Album ID"
+// @Success 200 {object} []images.Image
+// @Failure 400 "Bad Request"
+// @Failure 404 "Album Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/albums/{id}/images [get]
+func (h handler) albumImages(w http.ResponseWriter, r *http.Request) {
+	albumId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	imageList, err := albums_service.Images(h.app, r.Context(), albumId)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	if imageList == nil {
+		imageList = make([]images.Image, 0)
+	}
+	h.write(w, r, imageList)
+}
+
+// @Summary Rename an album
+// @Tags albums
+// @Accept json
+// @Param id path int true "Album ID"
+// @Param album body albums.Album true "Album"
+// @Param Authorization header string true "Auth Token"
+// @Success 200
+// @Failure 400 "Bad Request"
+// @Failure 401 "Invalid Auth Token"
+// @Failure 403 "No Access To Album"
+// @Failure 404 "Album Not Found"
+// @Failure 409 "Album Already Exists"
+// @Failure 500 "Internal Error"
+// @Router /api/albums/{id} [put]
+func (h handler) update(w http.ResponseWriter, r *http.Request) {
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
+		return
+	}
+	albumId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	name, ok := h.readName(w, r)
+	if !ok {
+		return
+	}
+
+	err := albums_service.Rename(h.app, r.Context(), userId, albumId, name)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("album successfully renamed"))
+}
+
+// @Summary Delete an album
+// @Description The images in the album are kept.
+// @Tags albums
+// @Param id path int true "Album ID"
+// @Param Authorization header string true "Auth Token"
+// @Success 200
+// @Failure 400 "Bad Request"
+// @Failure 401 "Invalid Auth Token"
+// @Failure 403 "No Access To Album"
+// @Failure 404 "Album Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/albums/{id} [delete]
+func (h handler) delete(w http.ResponseWriter, r *http.Request) {
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
+		return
+	}
+	albumId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	err := albums_service.Delete(h.app, r.Context(), userId, albumId)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("album successfully deleted"))
+}
+
+// @Summary Add an image to an album
+// @Description Any image can be added, not only the images of the album's
+// @Description author. Adding an image that is already in the album does nothing.
+// @Tags albums
+// @Param id path int true "Album ID"
+// @Param image path int true "Image ID"
+// @Param Authorization header string true "Auth Token"
+// @Success 200
+// @Failure 400 "Bad Request"
+// @Failure 401 "Invalid Auth Token"
+// @Failure 403 "No Access To Album"
+// @Failure 404 "Album Or Image Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/albums/{id}/images/{image} [put]
+func (h handler) addImage(w http.ResponseWriter, r *http.Request) {
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
+		return
+	}
+	albumId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	imageId, ok := pathId(w, r, "image")
+	if !ok {
+		return
+	}
+	err := albums_service.AddImage(h.app, r.Context(), userId, albumId, imageId)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("image successfully added"))
+}
+
+// @Summary Remove an image from an album
+// @Description The image itself is kept.
+// @Tags albums
+// @Param id path int true "Album ID"
+// @Param image path int true "Image ID"
+// @Param Authorization header string true "Auth Token"
+// @Success 200
+// @Failure 400 "Bad Request"
+// @Failure 401 "Invalid Auth Token"
+// @Failure 403 "No Access To Album"
+// @Failure 404 "Album Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/albums/{id}/images/{image} [delete]
+func (h handler) removeImage(w http.ResponseWriter, r *http.Request) {
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
+		return
+	}
+	albumId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	imageId, ok := pathId(w, r, "image")
+	if !ok {
+		return
+	}
+	err := albums_service.RemoveImage(h.app, r.Context(), userId, albumId, imageId)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("image successfully removed"))
+}
+
+// pathId returns the ID in the path value with the name. It writes the
+// error response and reports false if it is not a number.
+func pathId(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue(name))
+	if err != nil {
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// readName returns the album name in the request body. It writes the
+// error response and reports false if the body is not an album.
+func (h handler) readName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("failed to read request body", "err", err)
+		return "", false
+	}
+	defer r.Body.Close()
+
+	var album albums.Album
+	err = json.Unmarshal(body, &album)
+	if err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return "", false
+	}
+	return album.Name, true
+}
+
+func (h handler) write(w http.ResponseWriter, r *http.Request, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("failed to marshal JSON", "err", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func ServeMux(a *app.App) *http.ServeMux {
+	h := handler{a}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /", h.add)
+	mux.HandleFunc("GET /", h.list)
+	mux.HandleFunc("GET /{id}", h.get)
+	mux.HandleFunc("PUT /{id}", h.update)
+	mux.HandleFunc("DELETE /{id}", h.delete)
+	mux.HandleFunc("GET /{id}/images", h.albumImages)
+	mux.HandleFunc("PUT /{id}/images/{image}", h.addImage)
+	mux.HandleFunc("DELETE /{id}/images/{image}", h.removeImage)
+	return mux
+}
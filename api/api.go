@@ -1,22 +1,48 @@
 package api
 
 import (
+	"blog/api/albums"
 	"blog/api/auth"
 	"blog/api/comments"
 	"blog/api/images"
 	"blog/api/posts"
+	"blog/api/users"
+	"blog/app"
+	"blog/ratelimit"
+	"blog/util"
 	"net/http"
+	"strconv"
 )
 
-func ServeMux() *http.ServeMux {
+// user returns the rate limiting key of a request with a valid access
+// token.
+func user(a *app.App) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if userId := util.Viewer(a, r); userId != 0 {
+			return strconv.Itoa(userId)
+		}
+		return ""
+	}
+}
+
+// limit applies the write rate limit of the App to the handler.
+func limit(a *app.App, next http.Handler) http.Handler {
+	return ratelimit.Middleware(a.Limiter, a.Proxies, user(a), next)
+}
+
+func ServeMux(a *app.App) *http.ServeMux {
 	mux := http.NewServeMux()
-	postsMux := posts.ServeMux()
-	authMux := auth.ServeMux()
-	commentsMux := comments.ServeMux()
-	imagesMux := images.ServeMux()
-	mux.Handle("/posts/", http.StripPrefix("/posts", postsMux))
-	mux.Handle("/auth/", http.StripPrefix("/auth", authMux))
-	mux.Handle("/comments/", http.StripPrefix("/comments", commentsMux))
-	mux.Handle("/images/", http.StripPrefix("/images", imagesMux))
+	postsMux := posts.ServeMux(a)
+	authMux := auth.ServeMux(a)
+	commentsMux := comments.ServeMux(a)
+	imagesMux := images.ServeMux(a)
+	usersMux := users.ServeMux(a)
+	albumsMux := albums.ServeMux(a)
+	mux.Handle("/posts/", limit(a, http.StripPrefix("/posts", postsMux)))
+	mux.Handle("/auth/", limit(a, http.StripPrefix("/auth", authMux)))
+	mux.Handle("/comments/", limit(a, http.StripPrefix("/comments", commentsMux)))
+	mux.Handle("/images/", limit(a, http.StripPrefix("/images", imagesMux)))
+	mux.Handle("/users/", limit(a, http.StripPrefix("/users", usersMux)))
+	mux.Handle("/albums/", limit(a, http.StripPrefix("/albums", albumsMux)))
 	return mux
 }
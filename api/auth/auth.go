@@ -1,19 +1,21 @@
 package auth
 
 import (
-	"blog/config"
+	"blog/app"
 	"blog/db/auth"
-	"crypto/sha256"
-	"database/sql"
-	"encoding/hex"
+	"blog/logging"
+	auth_service "blog/service/auth"
+	"blog/util"
 	"encoding/json"
 	"io"
-	"log"
 	"net/http"
-
-	"github.com/golang-jwt/jwt"
 )
 
+// handler serves the authentication endpoints of an App.
+type handler struct {
+	app *app.App
+}
+
 // @Summary register a new user
 // @Tags auth
 // @Accept json
@@ -24,132 +26,369 @@ import (
 // @Failure 409 "User Already Exists"
 // @Failure 500 "Internal Error"
 // @Router /api/auth/register [post]
-func register(w http.ResponseWriter, r *http.Request) {
+func (h handler) register(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	body, err := io.ReadAll(r.Body)
+	var user auth.User
+	if !h.read(w, r, &user) {
+		return
+	}
+
+	err := auth_service.Register(h.app, r.Context(), user.Username, user.Password)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to read request body:", err)
+		util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("user successfully registered"))
+}
+
+// @Summary Get access and refresh tokens for the user
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param user body User true "User"
+// @Success 200 {object} util.TokenPair
+// @Failure 400 "Bad Request"
+// @Failure 401 "Invalid Password"
+// @Failure 404 "User Not Found"
+// @Failure 405 "Method Not Allowed"
+// @Failure 429 "Too Many Failed Logins"
+// @Failure 500 "Internal Erorr"
+// @Router /api/auth/token [get]
+func (h handler) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	defer r.Body.Close()
 
 	var user auth.User
-	err = json.Unmarshal(body, &user)
+	if !h.read(w, r, &user) {
+		return
+	}
+
+	tokens, err := auth_service.Login(h.app, r.Context(), user.Username, user.Password)
 	if err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		util.WriteError(w, r, err)
 		return
 	}
-	if user.Username == "" || user.Password == "" {
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+	h.write(w, r, tokens)
+}
+
+// @Summary Exchange a refresh token for a new token pair
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body util.TokenPair true "Refresh Token"
+// @Success 200 {object} util.TokenPair
+// @Failure 400 "Bad Request"
+// @Failure 401 "Invalid Refresh Token"
+// @Failure 405 "Method Not Allowed"
+// @Failure 500 "Internal Error"
+// @Router /api/auth/refresh [post]
+func (h handler) refresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	h := sha256.New()
-	h.Write([]byte(user.Password))
-	user.Password = hex.EncodeToString(h.Sum(nil))
+	var tokens util.TokenPair
+	if !h.read(w, r, &tokens) {
+		return
+	}
 
-	databaseUser, err := auth.GetUser(config.DB, config.Ctx, user.Username)
-	if err != nil && err != sql.ErrNoRows {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+	tokens, err := auth_service.Refresh(h.app, r.Context(), tokens.RefreshToken)
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
-	if databaseUser.Id != 0 {
-		http.Error(w, "User already exists", http.StatusConflict)
+	h.write(w, r, tokens)
+}
+
+// @Summary Revoke the token family of the current session
+// @Tags auth
+// @Accept json
+// @Param token body util.TokenPair false "Refresh Token"
+// @Param Authorization header string false "Auth Token"
+// @Success 200
+// @Failure 400 "Bad Request"
+// @Failure 401 "Invalid Token"
+// @Failure 405 "Method Not Allowed"
+// @Failure 500 "Internal Error"
+// @Router /api/auth/logout [post]
+func (h handler) logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	err = auth.AddUser(config.DB, config.Ctx, user)
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("failed to read request body", "err", err)
+		return
+	}
+	defer r.Body.Close()
+
+	var tokens util.TokenPair
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &tokens)
+		if err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var family string
+	if tokens.RefreshToken != "" {
+		family, err = auth_service.Family(h.app, r.Context(), tokens.RefreshToken)
+		if err != nil {
+			util.WriteError(w, r, err)
+			return
+		}
+	} else {
+		token, err := util.ParseAuthHeader(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		claims, err := util.ParseClaims(h.app, r.Context(), token)
+		if err != nil {
+			http.Error(w, "Invalid Token", http.StatusUnauthorized)
+			return
+		}
+		family, _ = claims["fam"].(string)
+	}
+
+	err = auth_service.Logout(h.app, r.Context(), family)
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("user successfully registered"))
+	w.Write([]byte("session successfully revoked"))
 }
 
-// @Summary Get auth token for the user
+// @Summary Change the role of a user
 // @Tags auth
 // @Accept json
-// @Produce json
-// @Param user body User true "User"
-// @Success 200 {object} string
+// @Param user body User true "Username and Role"
+// @Param Authorization header string true "Auth Token"
+// @Success 200
 // @Failure 400 "Bad Request"
-// @Failure 401 "Invalid Password"
+// @Failure 401 "Invalid Auth Token"
+// @Failure 403 "Not An Admin"
 // @Failure 404 "User Not Found"
 // @Failure 405 "Method Not Allowed"
-// @Failure 500 "Internal Erorr"
-// @Router /api/auth/token [get]
-func token(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// @Failure 500 "Internal Error"
+// @Router /api/auth/role [put]
+func (h handler) role(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to read request body:", err)
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
 		return
 	}
-	defer r.Body.Close()
 
 	var user auth.User
-	err = json.Unmarshal(body, &user)
+	if !h.read(w, r, &user) {
+		return
+	}
+
+	err := auth_service.SetRole(h.app, r.Context(), userId, user.Username, user.Role)
 	if err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("role successfully changed"))
+}
+
+// PasswordChange is the body of a password change request.
+type PasswordChange struct {
+	OldPassword string
+	NewPassword string
+}
+
+// @Summary Change the password of the current user
+// @Description Other sessions of the user are signed out.
+// @Tags auth
+// @Accept json
+// @Param passwords body PasswordChange true "Old and New Password"
+// @Param Authorization header string true "Auth Token"
+// @Success 200
+// @Failure 400 "Bad Request"
+// @Failure 401 "Invalid Auth Token or Password"
+// @Failure 405 "Method Not Allowed"
+// @Failure 500 "Internal Error"
+// @Router /api/auth/password [put]
+func (h handler) password(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	if user.Username == "" || user.Password == "" {
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+
+	token, err := util.ParseAuthHeader(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	claims, err := util.ParseClaims(h.app, r.Context(), token)
+	if err != nil {
+		http.Error(w, "Invalid Token", http.StatusUnauthorized)
+		return
+	}
+	userId, err := util.ParseToken(h.app, r.Context(), token)
+	if err != nil {
+		http.Error(w, "Invalid Token", http.StatusUnauthorized)
 		return
 	}
 
-	dbUser, err := auth.GetUser(config.DB, config.Ctx, user.Username)
-	if err != nil && err != sql.ErrNoRows {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+	var change PasswordChange
+	if !h.read(w, r, &change) {
 		return
 	}
-	if dbUser.Id == 0 {
-		http.Error(w, "User Not Found", http.StatusNotFound)
+
+	family, _ := claims["fam"].(string)
+	err = auth_service.ChangePassword(h.app, r.Context(), userId, family,
+		change.OldPassword, change.NewPassword)
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
 
-	h := sha256.New()
-	h.Write([]byte(user.Password))
-	data := h.Sum(nil)
-	passwordHash := hex.EncodeToString(data)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("password successfully changed"))
+}
 
-	if passwordHash != dbUser.Password {
-		http.Error(w, "Invalid Password", http.StatusUnauthorized)
+// @Summary Change the username of the current user
+// @Tags auth
+// @Accept json
+// @Param user body User true "New Username"
+// @Param Authorization header string true "Auth Token"
+// @Success 200
+// @Failure 400 "Bad Request"
+// @Failure 401 "Invalid Auth Token"
+// @Failure 405 "Method Not Allowed"
+// @Failure 409 "User Already Exists"
+// @Failure 500 "Internal Error"
+// @Router /api/auth/username [put]
+func (h handler) username(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
 		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": dbUser.Id,
-	})
-	tokenString, err := token.SignedString(config.Secret)
+	var user auth.User
+	if !h.read(w, r, &user) {
+		return
+	}
+
+	err := auth_service.Rename(h.app, r.Context(), userId, user.Username)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to sign token:", err)
+		util.WriteError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(tokenString))
+	w.Write([]byte("username successfully changed"))
+}
+
+// @Summary Delete the account of the current user
+// @Description With mode=anonymize the posts, comments and images of the
+// @Description user are kept under the [deleted] account, with mode=cascade
+// @Description they are deleted too.
+// @Tags auth
+// @Accept json
+// @Param mode query string true "anonymize or cascade"
+// @Param user body User true "Password"
+// @Param Authorization header string true "Auth Token"
+// @Success 200
+// @Failure 400 "Bad Request"
+// @Failure 401 "Invalid Auth Token or Password"
+// @Failure 405 "Method Not Allowed"
+// @Failure 500 "Internal Error"
+// @Router /api/auth/account [delete]
+func (h handler) account(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
+		return
+	}
+
+	var user auth.User
+	if !h.read(w, r, &user) {
+		return
+	}
+
+	err := auth_service.DeleteAccount(h.app, r.Context(), userId, user.Password, r.URL.Query().Get("mode"))
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("account successfully deleted"))
+}
+
+// read decodes the JSON request body into v. It writes the error
+// response and reports false if the body is not valid JSON.
+func (h handler) read(w http.ResponseWriter, r *http.Request, v any) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("failed to read request body", "err", err)
+		return false
+	}
+	defer r.Body.Close()
+
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (h handler) write(w http.ResponseWriter, r *http.Request, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("failed to marshal JSON", "err", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
 }
 
-func ServeMux() *http.ServeMux {
+func ServeMux(a *app.App) *http.ServeMux {
+	h := handler{a}
 	mux := http.NewServeMux()
-	mux.HandleFunc("/register", register)
-	mux.HandleFunc("/token", token)
+	mux.HandleFunc("/register", h.register)
+	mux.HandleFunc("/token", h.token)
+	mux.HandleFunc("/refresh", h.refresh)
+	mux.HandleFunc("/logout", h.logout)
+	mux.HandleFunc("/role", h.role)
+	mux.HandleFunc("/password", h.password)
+	mux.HandleFunc("/username", h.username)
+	mux.HandleFunc("/account", h.account)
 	return mux
 }
@@ -1,18 +1,22 @@
 package comments
 
 import (
-	"blog/config"
+	"blog/app"
 	"blog/db/comments"
-	"blog/db/posts"
+	"blog/logging"
+	comments_service "blog/service/comments"
 	"blog/util"
-	"database/sql"
 	"encoding/json"
 	"io"
-	"log"
 	"net/http"
 	"strconv"
 )
 
+// handler serves the comment endpoints of an App.
+type handler struct {
+	app *app.App
+}
+
 // @Summary Add a comment to the post
 // @Tags comments
 // @Accept json
@@ -25,49 +29,75 @@ import (
 // @Failure 404 "Post Not Found"
 // @Failure 405 "Method Not Allowed"
 // @Router /api/comments/{id} [post]
-func add(w http.ResponseWriter, r *http.Request) {
+func (h handler) add(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	token, err := util.ParseAuthHeader(r)
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
+		return
+	}
+	postId, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
-	userId, err := util.ParseToken(token)
+
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Invalid Token", http.StatusUnauthorized)
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("failed to read request body", "err", err)
 		return
 	}
+	defer r.Body.Close()
 
-	pathVal := r.PathValue("id")
-	if pathVal == "" {
-		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
+	var comment comments.Comment
+	err = json.Unmarshal(body, &comment)
+	if err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-	postId, err := strconv.Atoi(pathVal)
+
+	_, err = comments_service.Add(h.app, r.Context(), userId, postId, comment.Text)
 	if err != nil {
-		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
+		util.WriteError(w, r, err)
 		return
 	}
 
-	_, err = posts.GetPost(config.DB, config.Ctx, postId)
-	if err != nil && err != sql.ErrNoRows {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("post successfully commented"))
+}
+
+// @Summary Reply to a comment
+// @Description Replies can be nested up to the configured depth (4 by default).
+// @Tags comments
+// @Accept json
+// @Param id path int true "Comment ID"
+// @Param Authorization header string true "Auth Token"
+// @Param comment body Comment true "Comment"
+// @Success 200
+// @Failure 400 "Bad Request"
+// @Failure 401 "Invalid Auth Header"
+// @Failure 404 "Comment Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/comments/{id}/reply [post]
+func (h handler) reply(w http.ResponseWriter, r *http.Request) {
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
 		return
 	}
-	if err == sql.ErrNoRows {
-		http.Error(w, "Not Found", http.StatusNotFound)
+	parentId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to read request body:", err)
+		logging.FromContext(r.Context()).Error("failed to read request body", "err", err)
 		return
 	}
 	defer r.Body.Close()
@@ -78,22 +108,15 @@ func add(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-	if comment.Text == "" {
-		http.Error(w, "Bad Request", http.StatusBadRequest)
-		return
-	}
-	comment.AuthorId = userId
-	comment.PostId = postId
 
-	err = comments.AddComment(config.DB, config.Ctx, comment)
+	_, err = comments_service.Reply(h.app, r.Context(), userId, parentId, comment.Text)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		util.WriteError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("post successfully commented"))
+	w.Write([]byte("comment successfully replied"))
 }
 
 // @Summary Get the comment by ID
@@ -106,43 +129,24 @@ func add(w http.ResponseWriter, r *http.Request) {
 // @Failure 405 "Method Not Allowed"
 // @Failure 500 "Internal Error"
 // @Router /api/comments/{id} [get]
-func get(w http.ResponseWriter, r *http.Request) {
+func (h handler) get(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	pathVal := r.PathValue("id")
-	if pathVal == "" {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
-		return
-	}
-	commentId, err := strconv.Atoi(pathVal)
+	commentId, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
-		return
-	}
-
-	comment, err := comments.GetComment(config.DB, config.Ctx, commentId)
-	if err != nil && err != sql.ErrNoRows {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-	if err == sql.ErrNoRows {
-		http.Error(w, "Not Found", http.StatusNotFound)
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
 
-	data, err := json.Marshal(comment)
+	comment, err := comments_service.Get(h.app, r.Context(), util.Viewer(h.app, r), commentId)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to marshal JSON:", err)
+		util.WriteError(w, r, err)
 		return
 	}
-
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+	h.write(w, r, comment)
 }
 
 // @Summary Update the comment
@@ -158,38 +162,26 @@ func get(w http.ResponseWriter, r *http.Request) {
 // @Failure 405 "Method Not Allowed"
 // @Failure 500 "Internal Error"
 // @Router /api/comments/{id} [put]
-func update(w http.ResponseWriter, r *http.Request) {
+func (h handler) update(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	pathVal := r.PathValue("id")
-	if pathVal == "" {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
-		return
-	}
-	commentId, err := strconv.Atoi(pathVal)
-	if err != nil {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
-		return
-	}
-
-	token, err := util.ParseAuthHeader(r)
+	commentId, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
-	userId, err := util.ParseToken(token)
-	if err != nil {
-		http.Error(w, "Invalid Token", http.StatusUnauthorized)
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
 		return
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to read body:", err)
+		logging.FromContext(r.Context()).Error("failed to read request body", "err", err)
 		return
 	}
 	defer r.Body.Close()
@@ -200,30 +192,10 @@ func update(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-	if comment.Text == "" {
-		http.Error(w, "Bad Request", http.StatusBadRequest)
-		return
-	}
-
-	dbComment, err := comments.GetComment(config.DB, config.Ctx, commentId)
-	if err != nil && err != sql.ErrNoRows {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-	if err == sql.ErrNoRows {
-		http.Error(w, "Not Found", http.StatusNotFound)
-		return
-	}
-	if userId != dbComment.AuthorId {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	}
 
-	err = comments.UpdateComment(config.DB, config.Ctx, commentId, comment)
+	err = comments_service.Update(h.app, r.Context(), userId, commentId, comment.Text)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		util.WriteError(w, r, err)
 		return
 	}
 
@@ -243,65 +215,142 @@ func update(w http.ResponseWriter, r *http.Request) {
 // @Failure 405 "Method Not Allowed"
 // @Failure 500 "Internal Error"
 // @Router /api/comments/{id} [delete]
-func delete(w http.ResponseWriter, r *http.Request) {
+func (h handler) delete(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	pathVal := r.PathValue("id")
-	if pathVal == "" {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
+	commentId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
+		return
+	}
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
 		return
 	}
-	commentId, err := strconv.Atoi(pathVal)
+
+	err = comments_service.Delete(h.app, r.Context(), userId, commentId)
 	if err != nil {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		util.WriteError(w, r, err)
 		return
 	}
 
-	token, err := util.ParseAuthHeader(r)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("comment successfully deleted"))
+}
+
+// @Summary Like a comment
+// @Description Liking a comment again takes the like back.
+// @Tags comments
+// @Param id path int true "Comment ID"
+// @Param Authorization header string true "Auth Token"
+// @Success 200
+// @Failure 400 "Bad Request"
+// @Failure 401 "Invalid Auth Header"
+// @Failure 404 "Comment Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/comments/{id}/like [post]
+func (h handler) like(w http.ResponseWriter, r *http.Request) {
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
+		return
+	}
+	commentId, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
-	userId, err := util.ParseToken(token)
+
+	err = comments_service.Vote(h.app, r.Context(), userId, commentId, "like")
 	if err != nil {
-		http.Error(w, "Invalid Token", http.StatusUnauthorized)
+		util.WriteError(w, r, err)
 		return
 	}
 
-	dbComment, err := comments.GetComment(config.DB, config.Ctx, commentId)
-	if err != nil && err != sql.ErrNoRows {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("comment successfully liked"))
+}
+
+// @Summary Dislike a comment
+// @Description Disliking a comment again takes the dislike back.
+// @Tags comments
+// @Param id path int true "Comment ID"
+// @Param Authorization header string true "Auth Token"
+// @Success 200
+// @Failure 400 "Bad Request"
+// @Failure 401 "Invalid Auth Header"
+// @Failure 404 "Comment Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/comments/{id}/dislike [post]
+func (h handler) dislike(w http.ResponseWriter, r *http.Request) {
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
+		return
+	}
+	commentId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
+		return
+	}
+
+	err = comments_service.Vote(h.app, r.Context(), userId, commentId, "dislike")
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
-	if err == sql.ErrNoRows {
-		http.Error(w, "Not Found", http.StatusNotFound)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("comment successfully disliked"))
+}
+
+// @Summary Get the score of a comment
+// @Description The score is the number of likes minus the number of dislikes.
+// @Tags comments
+// @Produce json
+// @Param id path int true "Comment ID"
+// @Success 200 {object} int
+// @Failure 400 "Bad Request"
+// @Failure 404 "Comment Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/comments/{id}/likes [get]
+func (h handler) commentLikes(w http.ResponseWriter, r *http.Request) {
+	commentId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
-	if userId != dbComment.AuthorId {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+
+	score, err := comments_service.Score(h.app, r.Context(), util.Viewer(h.app, r), commentId)
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
+	h.write(w, r, score)
+}
 
-	err = comments.DeleteComment(config.DB, config.Ctx, commentId)
+func (h handler) write(w http.ResponseWriter, r *http.Request, v any) {
+	data, err := json.Marshal(v)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("failed to marshal JSON", "err", err)
 		return
 	}
-
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("comment successfully deleted"))
+	w.Write(data)
 }
 
-func ServeMux() *http.ServeMux {
+func ServeMux(a *app.App) *http.ServeMux {
+	h := handler{a}
 	mux := http.NewServeMux()
-	mux.HandleFunc("GET /{id}", get)
-	mux.HandleFunc("POST /{id}", add)
-	mux.HandleFunc("PUT /{id}", update)
-	mux.HandleFunc("DELETE /{id}", delete)
+	mux.HandleFunc("GET /{id}", h.get)
+	mux.HandleFunc("POST /{id}", h.add)
+	mux.HandleFunc("POST /{id}/reply", h.reply)
+	mux.HandleFunc("POST /{id}/like", h.like)
+	mux.HandleFunc("POST /{id}/dislike", h.dislike)
+	mux.HandleFunc("GET /{id}/likes", h.commentLikes)
+	mux.HandleFunc("PUT /{id}", h.update)
+	mux.HandleFunc("DELETE /{id}", h.delete)
 	return mux
 }
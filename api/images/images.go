@@ -1,62 +1,78 @@
 package images
 
 import (
-	"blog/config"
+	"blog/app"
 	"blog/db/images"
+	"blog/logging"
+	images_service "blog/service/images"
+	"blog/storage"
 	"blog/util"
-	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
-	"log"
 	"net/http"
-	"os"
 	"strconv"
 )
 
+// handler serves the image endpoints and files of an App.
+type handler struct {
+	app *app.App
+}
+
+const (
+	// formOverhead is how much larger than the image an upload form
+	// can be, for the headers and boundaries of the form.
+	formOverhead = 64 << 10
+	// formMemory is how much of an upload form is kept in memory
+	// before the rest goes to a temporary file.
+	formMemory = 1 << 20
+)
+
 // @Summary Upload an image
+// @Description The image must be a JPEG, PNG or GIF file. Its metadata is
+// @Description removed and it is stored under a name made from its content;
+// @Description the name it was uploaded with is kept as Original. Uploading
+// @Description one of your images again returns the existing image.
 // @Tags images
 // @Accept multipart/form-data
+// @Produce json
 // @Param image formData file true "Image File"
 // @Param Authorization header string true "Auth Header"
-// @Success 200
+// @Success 200 {object} Image
 // @Failure 400 "Bad Request"
 // @Failure 401 "Invalid Auth Token"
 // @Failure 405 "Method Not Allowed"
+// @Failure 413 "Image Too Large"
+// @Failure 415 "Unsupported Image Type"
 // @Failure 500 "Internal Error"
 // @Router /api/images/ [post]
-func add(w http.ResponseWriter, r *http.Request) {
+func (h handler) add(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	token, err := util.ParseAuthHeader(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-	userId, err := util.ParseToken(token)
-	if err != nil {
-		http.Error(w, "Invalid Token", http.StatusUnauthorized)
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
 		return
 	}
 
-	err = r.ParseMultipartForm(10 << 20)
-	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to parse multipart form:", err)
+	r.Body = http.MaxBytesReader(w, r.Body, h.app.Config.MaxImageSize+formOverhead)
+	err := r.ParseMultipartForm(formMemory)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Image Too Large", http.StatusRequestEntityTooLarge)
 		return
 	}
-
-	if len(r.MultipartForm.File) == 0 {
+	if err != nil {
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
 	file, header, err := r.FormFile("image")
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to get file:", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 	defer file.Close()
@@ -64,45 +80,83 @@ func add(w http.ResponseWriter, r *http.Request) {
 	data, err := io.ReadAll(file)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to read file:", err)
+		logging.FromContext(r.Context()).Error("failed to read file", "err", err)
 		return
 	}
 
-	err = os.WriteFile("static/images/"+header.Filename, data, 0644)
+	image, err := images_service.Upload(h.app, r.Context(), userId, header.Filename, data)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to write file:", err)
+		util.WriteError(w, r, err)
+		return
 	}
+	h.writeImage(w, r, image)
+}
+
+// Image is an image with the addresses it is shown from. Preview is the
+// smallest copy and SrcSet lists every copy for the srcset attribute.
+type Image struct {
+	images.Image
+	URL     string
+	Preview string
+	SrcSet  string
+}
+
+func withURLs(image images.Image) Image {
+	return Image{image, image.URL(), image.Preview(), image.SrcSet()}
+}
 
-	err = images.AddImage(config.DB, config.Ctx, images.Image{Name: header.Filename, AuthorId: userId})
+func (h handler) writeImage(w http.ResponseWriter, r *http.Request, image images.Image) {
+	data, err := json.Marshal(withURLs(image))
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("failed to marshal JSON", "err", err)
 		return
 	}
-
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("image uploaded successfully"))
+	w.Write(data)
 }
 
 // @Summary Get images
+// @Description Images are returned newest first, one page at a time.
+// @Description With name parameters, only the images with those file names
+// @Description are returned, all at once and in no particular order.
 // @Tags images
 // @Produce json
+// @Param limit query int false "Page size"
+// @Param cursor query string false "Page cursor"
+// @Param name query []string false "File names" collectionFormat(multi)
 // @Success 200 {object} []Image
+// @Header 200 {string} Link "Next page"
+// @Failure 400 "Bad Request"
 // @Failure 405 "Method Not Allowed"
 // @Failure 404 "Images Not Found"
 // @Failure 500 "Internal Error"
 // @Router /api/images/ [get]
-func get(w http.ResponseWriter, r *http.Request) {
+func (h handler) get(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	imageList, err := images.GetImages(config.DB, config.Ctx)
+	if names, ok := r.URL.Query()["name"]; ok {
+		imageList, err := images_service.ByName(h.app, r.Context(), names)
+		if err != nil {
+			util.WriteError(w, r, err)
+			return
+		}
+		h.writeImages(w, r, imageList)
+		return
+	}
+
+	after, limit, err := util.ParsePage(r)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	imageList, next, err := images_service.Page(h.app, r.Context(), after, limit)
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
 	if imageList == nil {
@@ -110,13 +164,21 @@ func get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := json.Marshal(imageList)
+	util.SetNextLink(w, r, next, limit)
+	h.writeImages(w, r, imageList)
+}
+
+func (h handler) writeImages(w http.ResponseWriter, r *http.Request, imageList []images.Image) {
+	list := make([]Image, len(imageList))
+	for i, image := range imageList {
+		list[i] = withURLs(image)
+	}
+	data, err := json.Marshal(list)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to marshal JSON:", err)
+		logging.FromContext(r.Context()).Error("failed to marshal JSON", "err", err)
 		return
 	}
-
 	w.WriteHeader(http.StatusOK)
 	w.Write(data)
 }
@@ -129,43 +191,24 @@ func get(w http.ResponseWriter, r *http.Request) {
 // @Failure 400 "Bad Request"
 // @Failure 500 "Internal Error"
 // @Router /api/images/{id} [get]
-func getId(w http.ResponseWriter, r *http.Request) {
+func (h handler) getId(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	pathVal := r.PathValue("id")
-	if pathVal == "" {
-		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
-		return
-	}
-	imageId, err := strconv.Atoi(pathVal)
+	imageId, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
 		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
 
-	image, err := images.GetImage(config.DB, config.Ctx, imageId)
-	if err == sql.ErrNoRows {
-		http.Error(w, "Not Found", http.StatusNotFound)
-		return
-	}
+	image, err := images_service.Get(h.app, r.Context(), imageId)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		util.WriteError(w, r, err)
 		return
 	}
-
-	data, err := json.Marshal(image)
-	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to marshal JSON:", err)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+	h.writeImage(w, r, image)
 }
 
 // @Summary Delete Image
@@ -179,72 +222,111 @@ func getId(w http.ResponseWriter, r *http.Request) {
 // @Failure 404 "Image Not Found"
 // @Failure 500 "Internal Error"
 // @Router /api/images/{id} [delete]
-func delete(w http.ResponseWriter, r *http.Request) {
+func (h handler) delete(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	token, err := util.ParseAuthHeader(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
 		return
 	}
-	userId, err := util.ParseToken(token)
+	imageId, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
-		http.Error(w, "Invalid Token", http.StatusUnauthorized)
-		return
-	}
-
-	pathVal := r.PathValue("id")
-	if pathVal == "" {
 		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
-	imageId, err := strconv.Atoi(pathVal)
+
+	err = images_service.Delete(h.app, r.Context(), userId, imageId)
 	if err != nil {
-		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
+		util.WriteError(w, r, err)
 		return
 	}
 
-	image, err := images.GetImage(config.DB, config.Ctx, imageId)
-	if err == sql.ErrNoRows {
-		http.Error(w, "Image Not Found", http.StatusNotFound)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("image successfully deleted"))
+}
+
+// @Summary Download an image file
+// @Description Serves the file of an image or one of its copies. File
+// @Description names are made from the content, so the files can be cached
+// @Description for good. If the server is set up to sign URLs, it
+// @Description redirects to a temporary address of the file in the storage.
+// @Tags images
+// @Produce image/jpeg,image/png,image/gif
+// @Param name path string true "File Name"
+// @Success 200
+// @Success 302 "Redirect to a signed URL"
+// @Failure 404 "Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/images/files/{name} [get]
+func (h handler) file(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !storage.ValidName(name) {
+		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
-	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+
+	if signer, ok := h.app.Storage.(storage.Signer); ok && h.app.Config.SignedURLs {
+		url, err := signer.SignedURL(name, h.app.Config.SignedURLTTL)
+		if err != nil {
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			logging.FromContext(r.Context()).Error("failed to sign URL", "err", err)
+			return
+		}
+		w.Header().Set("Cache-Control",
+			fmt.Sprintf("private, max-age=%d", int(h.app.Config.SignedURLTTL.Seconds()/2)))
+		http.Redirect(w, r, url, http.StatusFound)
 		return
 	}
-	if image.AuthorId != userId {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+
+	object, err := h.app.Storage.Open(r.Context(), name)
+	if err == storage.ErrNotExist {
+		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
-
-	err = images.DeleteImage(config.DB, config.Ctx, imageId)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("failed to open file", "err", err)
 		return
 	}
+	defer object.Close()
 
-	err = os.Remove("static/images/" + image.Name)
-	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to remove file:", err)
+	header := w.Header()
+	if object.Type != "" {
+		header.Set("Content-Type", object.Type)
+	}
+	header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	header.Set("ETag", `"`+name+`"`)
+	header.Set("X-Content-Type-Options", "nosniff")
+	if seeker, ok := object.ReadCloser.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, name, object.Modified, seeker)
 		return
 	}
-
+	if match := r.Header.Get("If-None-Match"); match == `"`+name+`"` || match == "*" {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if object.Size >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(object.Size, 10))
+	}
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("image successfully deleted"))
+	if r.Method != http.MethodHead {
+		_, err = io.Copy(w, object)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to send file", "err", err)
+		}
+	}
 }
 
-func ServeMux() *http.ServeMux {
+func ServeMux(a *app.App) *http.ServeMux {
+	h := handler{a}
 	mux := http.NewServeMux()
-	mux.HandleFunc("POST /", add)
-	mux.HandleFunc("GET /", get)
-	mux.HandleFunc("GET /{id}", getId)
-	mux.HandleFunc("DELETE /{id}", delete)
+	mux.HandleFunc("POST /", h.add)
+	mux.HandleFunc("GET /", h.get)
+	mux.HandleFunc("GET /{id}", h.getId)
+	mux.HandleFunc("DELETE /{id}", h.delete)
+	mux.HandleFunc("GET /files/{name}", h.file)
 	return mux
 }
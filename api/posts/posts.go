@@ -1,22 +1,32 @@
 package posts
 
 import (
-	"blog/config"
+	"blog/app"
 	"blog/db/comments"
-	"blog/db/likes"
+	"blog/db/images"
 	"blog/db/posts"
-	"blog/db/tags"
+	"blog/logging"
+	"blog/service"
+	comments_service "blog/service/comments"
+	posts_service "blog/service/posts"
 	"blog/util"
-	"database/sql"
 	"encoding/json"
+	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"strconv"
 )
 
+// handler serves the post and tag endpoints of an App.
+type handler struct {
+	app *app.App
+}
+
 // @Summary Add a new post
+// @Description Status is "draft", "scheduled" or "published" (the default).
+// @Description Scheduled posts are published once their PublishAt time has passed.
+// @Description Images lists the ids of the images attached to the post.
 // @Tags posts
 // @Accept json
 // @Param post body Post true "Post"
@@ -27,27 +37,21 @@ import (
 // @Failure 405 "Method Not Allowed"
 // @Failure 500 "Internal Error"
 // @Router /api/posts/ [post]
-func add(w http.ResponseWriter, r *http.Request) {
+func (h handler) add(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	token, err := util.ParseAuthHeader(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-	userId, err := util.ParseToken(token)
-	if err != nil {
-		http.Error(w, "Invalid Token", http.StatusUnauthorized)
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
 		return
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to read request body:", err)
+		logging.FromContext(r.Context()).Error("failed to read request body", "err", err)
 		return
 	}
 	defer r.Body.Close()
@@ -58,86 +62,57 @@ func add(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-	if post.Title == "" || post.Text == "" {
-		http.Error(w, "Bad Request", http.StatusBadRequest)
-		return
-	}
-	post.AuthorId = userId
 
-	postId, err := posts.AddPost(config.DB, config.Ctx, post)
+	_, err = posts_service.Add(h.app, r.Context(), userId, post)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		util.WriteError(w, r, err)
 		return
 	}
 
-	if post.Tags != nil {
-		for _, tag := range post.Tags {
-			if tag.Name == "" {
-				http.Error(w, "Bad Request", http.StatusBadRequest)
-				return
-			}
-		}
-		tagMap := make(map[tags.Tag]bool)
-		tagList := make([]tags.Tag, 0)
-		for _, tag := range post.Tags {
-			tagMap[tag] = true
-		}
-		for _, tag := range post.Tags {
-			_, ok := tagMap[tag]
-			if ok {
-				tagList = append(tagList, tag)
-				delete(tagMap, tag)
-			}
-		}
-		post.Tags = tagList
-		err = tags.AddTags(config.DB, config.Ctx, postId, post.Tags)
-		if err != nil {
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
-			return
-		}
-	}
-
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("post successfully created"))
 }
 
 // @Summary Get post list
+// @Description Posts are returned newest first, one page at a time.
+// @Description The Link header holds the URL of the next page, if any.
 // @Tags posts
 // @Produce json
+// @Param limit query int false "Page size"
+// @Param cursor query string false "Page cursor"
 // @Success 200 {object} []Post
+// @Header 200 {string} Link "Next page"
+// @Header 200 {int} X-Total-Count "Number of posts"
 // @Failure 400 "Bad Request"
 // @Failure 404 "Posts Not Found"
 // @Failure 405 "Method Not Allowed"
 // @Failure 500 "Internal Error"
 // @Router /api/posts/ [get]
-func get(w http.ResponseWriter, r *http.Request) {
+func (h handler) get(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	posts, err := posts.GetPosts(config.DB, config.Ctx)
+	after, limit, err := util.ParsePage(r)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-	if posts == nil {
-		http.Error(w, "Not Found", http.StatusNotFound)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	data, err := json.Marshal(&posts)
+	postPage, err := posts_service.Page(h.app, r.Context(), after, limit)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to marshal JSON:", err)
+		util.WriteError(w, r, err)
+		return
+	}
+	if postPage.Posts == nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+	util.SetNextLink(w, r, postPage.Next, limit)
+	w.Header().Set("X-Total-Count", strconv.Itoa(postPage.Nposts))
+	h.write(w, r, postPage.Posts)
 }
 
 // @Summary Get a post by ID
@@ -150,46 +125,29 @@ func get(w http.ResponseWriter, r *http.Request) {
 // @Failure 405 "Method Not Allowed"
 // @Failure 500 "Internal Error"
 // @Router /api/posts/{id} [get]
-func getId(w http.ResponseWriter, r *http.Request) {
+func (h handler) getId(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	pathVal := r.PathValue("id")
-	if pathVal == "" {
-		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
-		return
-	}
-	postId, err := strconv.Atoi(pathVal)
+	postId, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
 		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
 
-	post, err := posts.GetPost(config.DB, config.Ctx, postId)
-	if err != nil && err != sql.ErrNoRows {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-	if err == sql.ErrNoRows {
-		http.Error(w, "Not Found", http.StatusNotFound)
-		return
-	}
-
-	data, err := json.Marshal(&post)
+	post, err := posts_service.Get(h.app, r.Context(), util.Viewer(h.app, r), postId)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to marshal json:", err)
+		util.WriteError(w, r, err)
 		return
 	}
-
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+	h.write(w, r, post)
 }
 
 // @Summary Update a post
+// @Description Images replaces the images attached to the post; without
+// @Description it they are left as they are.
 // @Tags posts
 // @Accept json
 // @Param id path int true "Post ID"
@@ -203,108 +161,37 @@ func getId(w http.ResponseWriter, r *http.Request) {
 // @Failure 405 "Method Not Allowed"
 // @Failure 500 "Internal Error"
 // @Router /api/posts/{id} [put]
-func update(w http.ResponseWriter, r *http.Request) {
+func (h handler) update(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	token, err := util.ParseAuthHeader(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-	userId, err := util.ParseToken(token)
-	if err != nil {
-		http.Error(w, "Invalid Token", http.StatusUnauthorized)
-		return
-	}
-
-	pathVal := r.PathValue("id")
-	if pathVal == "" {
-		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
 		return
 	}
-	postId, err := strconv.Atoi(pathVal)
+	postId, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
 		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
 
-	post, err := posts.GetPost(config.DB, config.Ctx, postId)
-	if err != nil && err != sql.ErrNoRows {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-	if err == sql.ErrNoRows {
-		http.Error(w, "Not Found", http.StatusNotFound)
-		return
-	}
-	if post.AuthorId != userId {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		log.Println(err)
-		return
-	}
-
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to read request body:", err)
-		return
-	}
-	defer r.Body.Close()
-
-	err = json.Unmarshal(body, &post)
-	if err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
-	}
-	if post.Title == "" || post.Text == "" {
-		http.Error(w, "Bad Request", http.StatusBadRequest)
-		return
-	}
-
-	err = posts.UpdatePost(config.DB, config.Ctx, postId, post)
-	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-
-	if post.Tags == nil {
-		err = tags.DeleteTags(config.DB, config.Ctx, postId)
+	// Fields left out of the body keep their values.
+	err = posts_service.Update(h.app, r.Context(), userId, postId, func(post *posts.Post) error {
+		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			return
-		}
-	} else {
-		for _, tag := range post.Tags {
-			if tag.Name == "" {
-				http.Error(w, "Bad Request", http.StatusBadRequest)
-				return
-			}
-		}
-		tagMap := make(map[tags.Tag]bool)
-		tagList := make([]tags.Tag, 0)
-		for _, tag := range post.Tags {
-			tagMap[tag] = true
+			return fmt.Errorf("failed to read request body: %v", err)
 		}
-		for _, tag := range post.Tags {
-			_, ok := tagMap[tag]
-			if ok {
-				tagList = append(tagList, tag)
-				delete(tagMap, tag)
-			}
+		defer r.Body.Close()
+		if json.Unmarshal(body, post) != nil {
+			return service.Invalid("Invalid JSON")
 		}
-		post.Tags = tagList
-		err = tags.UpdateTags(config.DB, config.Ctx, postId, post.Tags)
-		if err != nil {
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
-			return
-		}
-
+		return nil
+	})
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -323,59 +210,90 @@ func update(w http.ResponseWriter, r *http.Request) {
 // @Failure 405 "Method Not Allowed"
 // @Failure 500 "Internal Error"
 // @Router /api/posts/{id} [delete]
-func deleteId(w http.ResponseWriter, r *http.Request) {
+func (h handler) deleteId(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	token, err := util.ParseAuthHeader(r)
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
+		return
+	}
+	postId, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
-	userId, err := util.ParseToken(token)
+
+	err = posts_service.Delete(h.app, r.Context(), userId, postId)
 	if err != nil {
-		http.Error(w, "Invalid Token", http.StatusUnauthorized)
+		util.WriteError(w, r, err)
 		return
 	}
 
-	pathVal := r.PathValue("id")
-	if pathVal == "" {
-		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("post successfully deleted"))
+}
+
+// @Summary Unpublish a post
+// @Description Turns a published or scheduled post back into a draft.
+// @Tags posts
+// @Param id path int true "Post ID"
+// @Param Authorization header string true "Auth Token"
+// @Success 200
+// @Failure 400 "Bad Request"
+// @Failure 401 "Invalid Auth Token"
+// @Failure 403 "No Access To Post"
+// @Failure 404 "Post Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/posts/{id}/unpublish [post]
+func (h handler) unpublish(w http.ResponseWriter, r *http.Request) {
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
 		return
 	}
-	postId, err := strconv.Atoi(pathVal)
+	postId, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
 		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
 
-	post, err := posts.GetPost(config.DB, config.Ctx, postId)
-	if err != nil && err != sql.ErrNoRows {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-	if err == sql.ErrNoRows {
-		http.Error(w, "Not Found", http.StatusNotFound)
+	err = posts_service.Unpublish(h.app, r.Context(), userId, postId)
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
-	if post.AuthorId != userId {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		log.Println(err)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("post successfully unpublished"))
+}
+
+// @Summary Get drafts and scheduled posts of the user
+// @Tags posts
+// @Produce json
+// @Param Authorization header string true "Auth Token"
+// @Success 200 {object} []posts.Post
+// @Failure 401 "Invalid Auth Token"
+// @Failure 404 "Drafts Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/posts/drafts [get]
+func (h handler) drafts(w http.ResponseWriter, r *http.Request) {
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
 		return
 	}
 
-	err = posts.DeletePost(config.DB, config.Ctx, postId)
+	postList, err := posts_service.Drafts(h.app, r.Context(), userId)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		util.WriteError(w, r, err)
 		return
 	}
-
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("post successfully deleted"))
+	if postList == nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	h.write(w, r, postList)
 }
 
 // @Summary Like a post
@@ -389,49 +307,25 @@ func deleteId(w http.ResponseWriter, r *http.Request) {
 // @Failure 405 "Method Not Allowed"
 // @Failure 500 "Internal Error"
 // @Router /api/posts/{id}/like [post]
-func like(w http.ResponseWriter, r *http.Request) {
+func (h handler) like(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	token, err := util.ParseAuthHeader(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
 		return
 	}
-	userId, err := util.ParseToken(token)
-	if err != nil {
-		http.Error(w, "Invalid Token", http.StatusUnauthorized)
-		return
-	}
-
-	pathVal := r.PathValue("id")
-	if pathVal == "" {
-		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
-		return
-	}
-	postId, err := strconv.Atoi(pathVal)
+	postId, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
 		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
 
-	_, err = posts.GetPost(config.DB, config.Ctx, postId)
-	if err != nil && err != sql.ErrNoRows {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-	if err == sql.ErrNoRows {
-		http.Error(w, "Not Found", http.StatusNotFound)
-		return
-	}
-
-	err = likes.AddLike(config.DB, config.Ctx, userId, postId, "like")
+	err = posts_service.Vote(h.app, r.Context(), userId, postId, "like")
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		util.WriteError(w, r, err)
 		return
 	}
 
@@ -450,49 +344,25 @@ func like(w http.ResponseWriter, r *http.Request) {
 // @Failure 405 "Method Not Allowed"
 // @Failure 500 "Internal Error"
 // @Router /api/posts/{id}/dislike [post]
-func dislike(w http.ResponseWriter, r *http.Request) {
+func (h handler) dislike(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	token, err := util.ParseAuthHeader(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-	userId, err := util.ParseToken(token)
-	if err != nil {
-		http.Error(w, "Invalid Token", http.StatusUnauthorized)
-		return
-	}
-
-	pathVal := r.PathValue("id")
-	if pathVal == "" {
-		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
 		return
 	}
-	postId, err := strconv.Atoi(pathVal)
+	postId, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
 		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
 
-	_, err = posts.GetPost(config.DB, config.Ctx, postId)
-	if err != nil && err != sql.ErrNoRows {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-	if err == sql.ErrNoRows {
-		http.Error(w, "Not Found", http.StatusNotFound)
-		return
-	}
-
-	err = likes.AddLike(config.DB, config.Ctx, userId, postId, "dislike")
+	err = posts_service.Vote(h.app, r.Context(), userId, postId, "dislike")
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		util.WriteError(w, r, err)
 		return
 	}
 
@@ -509,132 +379,101 @@ func dislike(w http.ResponseWriter, r *http.Request) {
 // @Failure 404 "Post Not Found"
 // @Failure 500 "Internal Error"
 // @Router /api/posts/{id}/likes [get]
-func postLikes(w http.ResponseWriter, r *http.Request) {
+func (h handler) postLikes(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	pathVal := r.PathValue("id")
-	if pathVal == "" {
-		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
-		return
-	}
-	postId, err := strconv.Atoi(pathVal)
+	postId, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
 		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
 
-	_, err = posts.GetPost(config.DB, config.Ctx, postId)
-	if err != nil && err != sql.ErrNoRows {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-	if err == sql.ErrNoRows {
-		http.Error(w, "Not Found", http.StatusNotFound)
-		return
-	}
-
-	likes, err := likes.GetLikes(config.DB, config.Ctx, postId)
-	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-
-	data, err := json.Marshal(likes)
+	score, err := posts_service.Score(h.app, r.Context(), util.Viewer(h.app, r), postId)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to marshal JSON")
+		util.WriteError(w, r, err)
 		return
 	}
-
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+	h.write(w, r, score)
 }
 
-// @Summary Search posts by title
+// @Summary Search posts
+// @Description Full-text search over titles, texts, tags and authors.
+// @Description Supports "phrases", prefix*, OR, tag:name and author:name.
 // @Tags posts
-// @Param query path string true "Query"
-// @Success 200 {object} []Post
+// @Produce json
+// @Param q query string true "Query"
+// @Param limit query int false "Maximum number of results"
+// @Success 200 {object} []posts.Result
 // @Failure 400 "Bad Request"
 // @Failure 404 "Post Not Found"
 // @Failure 405 "Method Not Allowed"
 // @Failure 500 "Internal Error"
-// @Router /api/posts/search/q/{query} [get]
-func search(w http.ResponseWriter, r *http.Request) {
+// @Router /api/posts/search [get]
+func (h handler) search(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var err error
-	query := r.PathValue("query")
-	if query == "" {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
-		return
-	}
-	query, err = url.QueryUnescape(query)
+	_, limit, err := util.ParsePage(r)
 	if err != nil {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	postlist, err := posts.FilterQuery(config.DB, config.Ctx, query)
+	results, err := posts_service.Search(h.app, r.Context(), r.URL.Query().Get("q"), limit)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		util.WriteError(w, r, err)
 		return
 	}
-	if postlist == nil {
+	if results == nil {
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
-
-	data, err := json.Marshal(postlist)
-	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+	h.write(w, r, results)
 }
 
 // @Summary Get comments for the post
+// @Description Top-level comments are returned newest first, one page at a time,
+// @Description with their replies nested in Replies, oldest first.
+// @Description With sort=top, comments with the highest score come first.
 // @Tags comments
 // @Produce json
 // @Param id path int true "Post ID"
+// @Param sort query string false "Sort order: new (default) or top"
+// @Param limit query int false "Page size"
+// @Param cursor query string false "Page cursor"
 // @Success 200 {object} []comments.Comment
+// @Header 200 {string} Link "Next page"
 // @Failure 400 "Bad Request"
 // @Failure 404 "Comments Not Found"
 // @Failure 405 "Method Not Allowed"
 // @Failure 500 "Internal Error"
 // @Router /api/posts/{id}/comments [get]
-func postComments(w http.ResponseWriter, r *http.Request) {
+func (h handler) postComments(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	pathVal := r.PathValue("id")
-	if pathVal == "" {
+	postId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
 		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
-	postId, err := strconv.Atoi(pathVal)
+	after, limit, err := util.ParsePage(r)
 	if err != nil {
-		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	commentList, err := comments.GetComments(config.DB, config.Ctx, postId)
+	commentList, next, err := comments_service.Page(h.app, r.Context(), util.Viewer(h.app, r), postId, after, limit,
+		comments.Order(r.URL.Query().Get("sort")))
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		util.WriteError(w, r, err)
 		return
 	}
 	if commentList == nil {
@@ -642,15 +481,8 @@ func postComments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := json.Marshal(&commentList)
-	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to marshal JSON:", err)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+	util.SetNextLink(w, r, next, limit)
+	h.write(w, r, commentList)
 }
 
 // @Summary Get all tags for the post
@@ -663,43 +495,56 @@ func postComments(w http.ResponseWriter, r *http.Request) {
 // @Failure 500 "Internal Error"
 // @Failure 405 "Method Not Allowed"
 // @Router /api/posts/{id}/tags [get]
-func postTags(w http.ResponseWriter, r *http.Request) {
+func (h handler) postTags(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	pathVal := r.PathValue("id")
-	if pathVal == "" {
-		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
-		return
-	}
-	postId, err := strconv.Atoi(pathVal)
+	postId, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
 		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
 
-	tagList, err := tags.GetTags(config.DB, config.Ctx, postId)
+	tagList, err := posts_service.Tags(h.app, r.Context(), util.Viewer(h.app, r), postId)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		util.WriteError(w, r, err)
 		return
 	}
 	if tagList == nil {
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
+	h.write(w, r, tagList)
+}
 
-	data, err := json.Marshal(tagList)
+// @Summary Get the images attached to a post
+// @Description Images are returned in the order they were attached in.
+// @Tags posts
+// @Produce json
+// @Param id path int true "Post ID"
+// @Success 200 {object} []images.Image
+// @Failure 400 "Bad Request"
+// @Failure 404 "Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/posts/{id}/images [get]
+func (h handler) postImages(w http.ResponseWriter, r *http.Request) {
+	postId, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to marshal JSON:", err)
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+	imageList, err := posts_service.Images(h.app, r.Context(), util.Viewer(h.app, r), postId)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	if imageList == nil {
+		imageList = make([]images.Image, 0)
+	}
+	h.write(w, r, imageList)
 }
 
 // @Summary Get posts associated with the tagPosts
@@ -711,54 +556,158 @@ func postTags(w http.ResponseWriter, r *http.Request) {
 // @Failure 404 "Tag Not Found"
 // @Failure 500 "Internal Error"
 // @Router /api/posts/tagPosts/t/{name} [get]
-func tagPosts(w http.ResponseWriter, r *http.Request) {
-	var err error
-	tagName := r.PathValue("name")
-	if tagName == "" {
+func (h handler) tagPosts(w http.ResponseWriter, r *http.Request) {
+	tagName, err := url.QueryUnescape(r.PathValue("name"))
+	if err != nil || tagName == "" {
 		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
-	tagName, err = url.QueryUnescape(tagName)
+
+	postList, err := posts_service.Tagged(h.app, r.Context(), tagName)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	if postList == nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	h.write(w, r, postList)
+}
+
+// @Summary Get revisions of a post
+// @Description Revisions are returned newest first. The first one matches the current post.
+// @Tags posts
+// @Produce json
+// @Param id path int true "Post ID"
+// @Success 200 {object} []revisions.Revision
+// @Failure 400 "Bad Request"
+// @Failure 404 "Post Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/posts/{id}/revisions [get]
+func (h handler) postRevisions(w http.ResponseWriter, r *http.Request) {
+	postId, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
 		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
 
-	postData, err := posts.FilterTag(config.DB, config.Ctx, tags.Tag{Name: tagName})
+	revisionList, err := posts_service.Revisions(h.app, r.Context(), util.Viewer(h.app, r), postId)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		util.WriteError(w, r, err)
 		return
 	}
-	if postData == nil {
-		http.Error(w, "Not Found", http.StatusNotFound)
+	h.write(w, r, revisionList)
+}
+
+// @Summary Get a line diff between two revisions of a post
+// @Tags posts
+// @Produce json
+// @Param id path int true "Post ID"
+// @Param from query int true "Old revision ID"
+// @Param to query int true "New revision ID"
+// @Success 200 {object} posts_service.RevisionDiff
+// @Failure 400 "Bad Request"
+// @Failure 404 "Not Found"
+// @Failure 413 "Revisions Too Large to Compare"
+// @Failure 500 "Internal Error"
+// @Router /api/posts/{id}/revisions/diff [get]
+func (h handler) revisionDiff(w http.ResponseWriter, r *http.Request) {
+	postId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
+		return
+	}
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
-	data, err := json.Marshal(postData)
+	changes, err := posts_service.Diff(h.app, r.Context(), util.Viewer(h.app, r), postId, from, to)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to marshal JSON:", err)
+		util.WriteError(w, r, err)
 		return
 	}
+	h.write(w, r, changes)
+}
 
+// @Summary Restore a revision of a post
+// @Description Sets the title and text of the post to those of the revision,
+// @Description which is recorded as a new revision.
+// @Tags posts
+// @Param id path int true "Post ID"
+// @Param rev path int true "Revision ID"
+// @Param Authorization header string true "Auth Token"
+// @Success 200
+// @Failure 400 "Bad Request"
+// @Failure 401 "Invalid Auth Token"
+// @Failure 403 "No Access To Post"
+// @Failure 404 "Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/posts/{id}/revisions/{rev}/restore [post]
+func (h handler) restore(w http.ResponseWriter, r *http.Request) {
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
+		return
+	}
+	postId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
+		return
+	}
+	revisionId, err := strconv.Atoi(r.PathValue("rev"))
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	err = posts_service.Restore(h.app, r.Context(), userId, postId, revisionId)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("revision successfully restored"))
+}
+
+func (h handler) write(w http.ResponseWriter, r *http.Request, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("failed to marshal JSON", "err", err)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Write(data)
 }
 
-func ServeMux() *http.ServeMux {
+func ServeMux(a *app.App) *http.ServeMux {
+	h := handler{a}
 	mux := http.NewServeMux()
-	mux.HandleFunc("POST /", add)
-	mux.HandleFunc("GET /", get)
-	mux.HandleFunc("GET /{id}", getId)
-	mux.HandleFunc("PUT /{id}", update)
-	mux.HandleFunc("DELETE /{id}", deleteId)
-	mux.HandleFunc("POST /{id}/like", like)
-	mux.HandleFunc("POST /{id}/dislike", dislike)
-	mux.HandleFunc("GET /{id}/likes", postLikes)
-	mux.HandleFunc("GET /{id}/comments", postComments)
-	mux.HandleFunc("GET /{id}/tags", postTags)
-	mux.HandleFunc("GET /tags/t/{name}", tagPosts)
-	mux.HandleFunc("GET /search/q/{query}", search)
+	mux.HandleFunc("POST /", h.add)
+	mux.HandleFunc("GET /", h.get)
+	mux.HandleFunc("GET /drafts", h.drafts)
+	mux.HandleFunc("GET /{id}", h.getId)
+	mux.HandleFunc("PUT /{id}", h.update)
+	mux.HandleFunc("DELETE /{id}", h.deleteId)
+	mux.HandleFunc("POST /{id}/unpublish", h.unpublish)
+	mux.HandleFunc("POST /{id}/like", h.like)
+	mux.HandleFunc("POST /{id}/dislike", h.dislike)
+	mux.HandleFunc("GET /{id}/likes", h.postLikes)
+	mux.HandleFunc("GET /{id}/comments", h.postComments)
+	mux.HandleFunc("GET /{id}/tags", h.postTags)
+	mux.HandleFunc("GET /{id}/images", h.postImages)
+	mux.HandleFunc("GET /{id}/revisions", h.postRevisions)
+	mux.HandleFunc("GET /{id}/revisions/diff", h.revisionDiff)
+	mux.HandleFunc("POST /{id}/revisions/{rev}/restore", h.restore)
+	mux.HandleFunc("GET /tags/t/{name}", h.tagPosts)
+	mux.HandleFunc("GET /search", h.search)
 	return mux
 }
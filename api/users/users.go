@@ -0,0 +1,200 @@
+package users
+
+import (
+	"blog/app"
+	"blog/db/albums"
+	"blog/db/comments"
+	"blog/db/images"
+	"blog/db/posts"
+	"blog/db/profiles"
+	"blog/logging"
+	users_service "blog/service/users"
+	"blog/util"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// handler serves the user endpoints of an App.
+type handler struct {
+	app *app.App
+}
+
+// @Summary Get the profile of a user
+// @Tags users
+// @Produce json
+// @Param username path string true "Username"
+// @Success 200 {object} profiles.Profile
+// @Failure 404 "User Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/users/{username} [get]
+func (h handler) get(w http.ResponseWriter, r *http.Request) {
+	profile, err := users_service.Profile(h.app, r.Context(), r.PathValue("username"))
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	h.write(w, r, profile)
+}
+
+// @Summary Update the profile of a user
+// @Description Only DisplayName, Bio, AvatarId and Website are updated.
+// @Description The avatar must be one of the images uploaded by the user,
+// @Description and an AvatarId of 0 removes it.
+// @Tags users
+// @Accept json
+// @Param username path string true "Username"
+// @Param profile body profiles.Profile true "Profile"
+// @Param Authorization header string true "Auth Token"
+// @Success 200
+// @Failure 400 "Bad Request"
+// @Failure 401 "Invalid Auth Token"
+// @Failure 403 "No Access To Profile"
+// @Failure 404 "User Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/users/{username} [put]
+func (h handler) update(w http.ResponseWriter, r *http.Request) {
+	userId, ok := util.Authenticate(h.app, w, r)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("failed to read request body", "err", err)
+		return
+	}
+	defer r.Body.Close()
+
+	var edited profiles.Profile
+	err = json.Unmarshal(body, &edited)
+	if err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	err = users_service.Update(h.app, r.Context(), userId, r.PathValue("username"), edited)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("profile successfully updated"))
+}
+
+// @Summary Get the posts of a user
+// @Description Published posts are returned newest first.
+// @Tags users
+// @Produce json
+// @Param username path string true "Username"
+// @Success 200 {object} []posts.Post
+// @Failure 404 "User Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/users/{username}/posts [get]
+func (h handler) userPosts(w http.ResponseWriter, r *http.Request) {
+	postList, err := users_service.Posts(h.app, r.Context(), r.PathValue("username"))
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	if postList == nil {
+		postList = make([]posts.Post, 0)
+	}
+	h.write(w, r, postList)
+}
+
+// @Summary Get the comments of a user
+// @Description The newest comments on published posts are returned first.
+// @Tags users
+// @Produce json
+// @Param username path string true "Username"
+// @Param limit query int false "Number of comments"
+// @Success 200 {object} []comments.Comment
+// @Failure 400 "Bad Request"
+// @Failure 404 "User Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/users/{username}/comments [get]
+func (h handler) userComments(w http.ResponseWriter, r *http.Request) {
+	_, limit, err := util.ParsePage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	commentList, err := users_service.Comments(h.app, r.Context(), r.PathValue("username"), limit)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	if commentList == nil {
+		commentList = make([]comments.Comment, 0)
+	}
+	h.write(w, r, commentList)
+}
+
+// @Summary Get the images of a user
+// @Description Images uploaded by the user are returned newest first.
+// @Tags users
+// @Produce json
+// @Param username path string true "Username"
+// @Success 200 {object} []images.Image
+// @Failure 404 "User Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/users/{username}/images [get]
+func (h handler) userImages(w http.ResponseWriter, r *http.Request) {
+	imageList, err := users_service.Images(h.app, r.Context(), r.PathValue("username"))
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	if imageList == nil {
+		imageList = make([]images.Image, 0)
+	}
+	h.write(w, r, imageList)
+}
+
+// @Summary Get the albums of a user
+// @Description Albums are sorted by name.
+// @Tags users
+// @Produce json
+// @Param username path string true "Username"
+// @Success 200 {object} []albums.Album
+// @Failure 404 "User Not Found"
+// @Failure 500 "Internal Error"
+// @Router /api/users/{username}/albums [get]
+func (h handler) userAlbums(w http.ResponseWriter, r *http.Request) {
+	albumList, err := users_service.Albums(h.app, r.Context(), r.PathValue("username"))
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	if albumList == nil {
+		albumList = make([]albums.Album, 0)
+	}
+	h.write(w, r, albumList)
+}
+
+func (h handler) write(w http.ResponseWriter, r *http.Request, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("failed to marshal JSON", "err", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func ServeMux(a *app.App) *http.ServeMux {
+	h := handler{a}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{username}", h.get)
+	mux.HandleFunc("PUT /{username}", h.update)
+	mux.HandleFunc("GET /{username}/posts", h.userPosts)
+	mux.HandleFunc("GET /{username}/comments", h.userComments)
+	mux.HandleFunc("GET /{username}/images", h.userImages)
+	mux.HandleFunc("GET /{username}/albums", h.userAlbums)
+	return mux
+}
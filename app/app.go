@@ -0,0 +1,145 @@
+// Package app holds the dependencies of a blog instance. The API, the web
+// interface, the services and the jobs get them from an *App instead of
+// package variables, so that several instances, each with its own
+// database and storage, can run in one process.
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"blog/config"
+	"blog/logging"
+	"blog/migrations"
+	"blog/password"
+	"blog/ratelimit"
+	"blog/storage"
+)
+
+type App struct {
+	Config config.Config
+	DB     *sql.DB
+	// Secret signs access tokens and CSRF tokens.
+	Secret []byte
+	// Now is the clock of the instance.
+	Now func() time.Time
+	// Logger logs what happens outside of requests. Handlers log with
+	// the logger in the context of their request, see package logging.
+	Logger  *slog.Logger
+	Storage storage.Storage
+	Hasher  password.Hasher
+	Limiter *ratelimit.Limiter
+	Lockout *ratelimit.Lockout
+	Proxies ratelimit.Proxies
+}
+
+// New builds an App from the config. The fields can be replaced before
+// the App is used, for example to give tests a clock of their own.
+func New(cfg config.Config) (*App, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	store, err := NewStorage(cfg)
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := ratelimit.ParseProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	logger, err := logging.New(os.Stderr, cfg.LogFormat)
+	if err != nil {
+		return nil, err
+	}
+	db, err := NewDB(cfg.DBFile, cfg.QueryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &App{
+		Config:  cfg,
+		DB:      db,
+		Secret:  []byte(cfg.Secret),
+		Now:     time.Now,
+		Logger:  logger,
+		Storage: store,
+		Hasher: password.NewChain(
+			password.NewArgon2id(), password.NewBcrypt(), password.SHA256{},
+		),
+		Limiter: ratelimit.NewLimiter(cfg.WriteRate/60, cfg.WriteBurst),
+		Lockout: ratelimit.NewLockout(cfg.LoginAttempts, cfg.LockoutTime),
+		Proxies: proxies,
+	}, nil
+}
+
+// Close closes the database of the App.
+func (a *App) Close() error {
+	return a.DB.Close()
+}
+
+// NewStorage builds the image storage chosen by cfg.StorageBackend.
+func NewStorage(cfg config.Config) (storage.Storage, error) {
+	var store storage.Storage
+	switch cfg.StorageBackend {
+	case "fs":
+		store = storage.NewFS(cfg.StorageDir)
+	case "s3":
+		s3, err := storage.NewS3(cfg.S3)
+		if err != nil {
+			return nil, err
+		}
+		store = s3
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.StorageBackend)
+	}
+	if _, ok := store.(storage.Signer); cfg.SignedURLs && !ok {
+		return nil, fmt.Errorf("%s storage cannot sign URLs", cfg.StorageBackend)
+	}
+	return store, nil
+}
+
+// ErrNoFTS5 is returned by InitDB when the sqlite3 driver was built
+// without the FTS5 extension, which search needs.
+var ErrNoFTS5 = errors.New("SQLite lacks FTS5, build with -tags sqlite_fts5")
+
+// InitDB applies the pending migrations.
+func (a *App) InitDB(ctx context.Context) error {
+	_, err := migrations.Up(a.DB, ctx)
+	if err != nil && strings.Contains(err.Error(), "no such module: fts5") {
+		return fmt.Errorf("failed to migrate database: %w: %v", ErrNoFTS5, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %v", err)
+	}
+	return nil
+}
+
+// Reset empties the database and, with fs storage, the image directory.
+func (a *App) Reset(ctx context.Context) error {
+	_, err := migrations.Down(a.DB, ctx, -1)
+	if err != nil {
+		return fmt.Errorf("failed to reset database: %v", err)
+	}
+	err = a.InitDB(ctx)
+	if err != nil {
+		return err
+	}
+	if a.Config.StorageBackend != "fs" {
+		return nil
+	}
+	err = os.RemoveAll(a.Config.StorageDir)
+	if err != nil {
+		return fmt.Errorf("failed to remove directory: %v", err)
+	}
+	err = os.MkdirAll(a.Config.StorageDir, 0750)
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// NewDB opens the SQLite database in the file, which may carry the
+// parameters of the sqlite3 driver. Every connection enforces foreign
+// keys, and every query gets at most queryTimeout to run, 0 for no limit,
+// on top of the deadline of its context.
+func NewDB(filename string, queryTimeout time.Duration) (*sql.DB, error) {
+	db := sql.OpenDB(connector{filename, &sqlite3.SQLiteDriver{}, queryTimeout})
+	if strings.HasPrefix(filename, ":memory:") {
+		// Every connection to :memory: opens a database of its own.
+		db.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
+
+// conn is what database/sql uses of a SQLite connection.
+type conn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+}
+
+type connector struct {
+	dsn     string
+	driver  *sqlite3.SQLiteDriver
+	timeout time.Duration
+}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	sqliteConn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	// Set here rather than in the DSN, so that its parameters can not
+	// turn it off.
+	_, err = sqliteConn.(conn).ExecContext(ctx, "PRAGMA foreign_keys = ON", nil)
+	if err != nil {
+		sqliteConn.Close()
+		return nil, err
+	}
+	if c.timeout <= 0 {
+		return sqliteConn, nil
+	}
+	return timeoutConn{sqliteConn.(conn), c.timeout}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// timeoutConn cancels the queries of a connection that run longer than
+// timeout. Queries in transactions go through it too.
+type timeoutConn struct {
+	conn
+	timeout time.Duration
+}
+
+func (c timeoutConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.conn.ExecContext(ctx, query, args)
+}
+
+// QueryContext keeps the deadline until the rows are closed, so that it
+// also covers reading them.
+func (c timeoutConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	rows, err := c.conn.QueryContext(ctx, query, args)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return timeoutRows{rows, cancel}, nil
+}
+
+type timeoutRows struct {
+	driver.Rows
+	cancel context.CancelFunc
+}
+
+func (r timeoutRows) Close() error {
+	defer r.cancel()
+	return r.Rows.Close()
+}
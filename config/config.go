@@ -1,71 +1,202 @@
 package config
 
 import (
-	"context"
-	"database/sql"
 	"fmt"
-	"os"
+	"net/url"
+	"strings"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"blog/ratelimit"
+	"blog/storage"
 )
 
-var (
-	DB        *sql.DB         = nil
-	Ctx       context.Context = context.TODO()
-	SecretStr string          = "secret"
-	Secret    []byte          = []byte(SecretStr)
-	IP        string          = "localhost"
-	Port      string          = "8080"
-	Addr      string          = IP + ":" + Port
-	Host      string          = "http://" + Addr
-	DBFile    string          = "blog.db"
-)
+// Config holds the settings of a blog instance. Default returns the
+// settings used when nothing else is given, and Load layers a config
+// file, environment variables and flags on top of them.
+type Config struct {
+	// DevMode allows settings that are only fit for development, such as
+	// the default secret.
+	DevMode bool
+	IP      string
+	Port    string
+	// BaseURL is the address the blog is reached at, which the links in
+	// feeds are made from. It may only be left out in dev mode.
+	BaseURL   string
+	SiteTitle string
+	Secret    string
+	DBFile    string
+	// TemplateDir holds the page templates. StaticDir holds files served
+	// as they are under /static/, empty for none.
+	TemplateDir string
+	StaticDir   string
+	// LogFormat is how logs are written: "text" or "json".
+	LogFormat string
 
-func NewDB(filename string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", filename)
-	if err != nil {
-		return nil, err
-	}
-	return db, nil
+	// RequestTimeout is how long a request may take and QueryTimeout
+	// how long a single database query may take, 0 for no limit.
+	RequestTimeout time.Duration
+	QueryTimeout   time.Duration
+	// ReadHeaderTimeout, ReadTimeout, WriteTimeout and IdleTimeout are
+	// the timeouts of the HTTP server, see http.Server. In-flight
+	// requests get ShutdownTimeout to finish when the server stops.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// RefreshGrace is how long a used refresh token may be presented
+	// again, by a client refreshing twice at once, before it counts as
+	// stolen. It gets the same successor as the first refresh.
+	RefreshGrace    time.Duration
+	PublishInterval time.Duration
+	// CommentDepth is how deeply replies to comments can be nested.
+	CommentDepth int
+	// WriteRate is how many requests that change state a client can make
+	// per minute, with bursts of up to WriteBurst. 0 turns limiting off.
+	WriteRate  float64
+	WriteBurst int
+	// TrustedProxies are the comma-separated addresses and networks of
+	// the reverse proxies whose X-Forwarded-For header tells the client
+	// IP that requests are limited by.
+	TrustedProxies string
+	// LoginAttempts is how many failed logins in a row lock a user out,
+	// for LockoutTime at first and twice as long after every further
+	// failure. 0 turns the lockout off.
+	LoginAttempts int
+	LockoutTime   time.Duration
+	// MaxImageSize is the largest image that can be uploaded in bytes,
+	// and MaxImageDimension its largest width and height in pixels.
+	MaxImageSize      int64
+	MaxImageDimension int
+	// StorageBackend is where image files are kept: "fs" for the
+	// StorageDir directory or "s3" for the S3 bucket below.
+	StorageBackend string
+	StorageDir     string
+	S3             storage.S3Config
+	// SignedURLs makes the API redirect image downloads to signed URLs
+	// of the storage, valid for SignedURLTTL, instead of streaming them.
+	// Only S3 storage can sign URLs.
+	SignedURLs   bool
+	SignedURLTTL time.Duration
+	// GCInterval is how often unused image files are collected, 0 for
+	// never. Files and images younger than GCMinAge are kept.
+	GCInterval time.Duration
+	GCMinAge   time.Duration
 }
 
-func InitDB() error {
-	data, err := os.ReadFile("schema.sql")
-	if err != nil {
-		return fmt.Errorf("failed to open file: %v", err)
-	}
-	schema := string(data)
-	_, err = DB.ExecContext(Ctx, schema)
-	if err != nil {
-		return fmt.Errorf("failed to execute query on database: %v", err)
+// DefaultSecret is the secret of the default config. Anyone can sign
+// tokens with it, so it is only allowed in dev mode.
+const DefaultSecret = "secret"
+
+func Default() Config {
+	return Config{
+		IP:                "localhost",
+		Port:              "8080",
+		SiteTitle:         "My Blog",
+		Secret:            DefaultSecret,
+		DBFile:            "blog.db",
+		TemplateDir:       "templates",
+		LogFormat:         "text",
+		RequestTimeout:    30 * time.Second,
+		QueryTimeout:      5 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       time.Minute,
+		WriteTimeout:      2 * time.Minute,
+		IdleTimeout:       2 * time.Minute,
+		ShutdownTimeout:   10 * time.Second,
+		AccessTokenTTL:    15 * time.Minute,
+		RefreshTokenTTL:   30 * 24 * time.Hour,
+		RefreshGrace:      10 * time.Second,
+		PublishInterval:   time.Minute,
+		CommentDepth:      4,
+		WriteRate:         30,
+		WriteBurst:        10,
+		LoginAttempts:     5,
+		LockoutTime:       time.Minute,
+		MaxImageSize:      10 << 20,
+		MaxImageDimension: 4096,
+		StorageBackend:    "fs",
+		StorageDir:        "static/images",
+		S3:                storage.S3Config{Region: "us-east-1", PathStyle: true},
+		SignedURLTTL:      time.Hour,
+		GCMinAge:          24 * time.Hour,
 	}
-	return nil
 }
 
-func Setup() error {
-	var err error
-	Addr = IP + ":" + Port
-	Host = "http://" + Addr
-	Secret = []byte(SecretStr)
-	DB, err = NewDB(DBFile)
-	if err != nil {
-		return err
+// Addr is the address the server listens on.
+func (c Config) Addr() string {
+	return c.IP + ":" + c.Port
+}
+
+// Host is the base URL of the server, without a trailing slash.
+func (c Config) Host() string {
+	if c.BaseURL != "" {
+		return strings.TrimSuffix(c.BaseURL, "/")
 	}
-	return nil
+	return "http://" + c.Addr()
 }
 
-func Reset() error {
-	err := InitDB()
+// Validate reports the first setting that is out of range.
+func (c Config) Validate() error {
+	if c.Secret == "" {
+		return fmt.Errorf("secret must not be empty")
+	}
+	if c.Secret == DefaultSecret && !c.DevMode {
+		return fmt.Errorf("refusing to run with the default secret outside dev mode, " +
+			"set secret to a random string or enable dev mode")
+	}
+	if c.BaseURL == "" && !c.DevMode {
+		return fmt.Errorf("base URL must be set outside dev mode, " +
+			"set base-url to the address the blog is reached at or enable dev mode")
+	}
+	if c.BaseURL != "" {
+		u, err := url.Parse(c.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("base URL must be an absolute http or https URL: %s", c.BaseURL)
+		}
+	}
+	if c.TemplateDir == "" {
+		return fmt.Errorf("template directory must not be empty")
+	}
+	if c.AccessTokenTTL <= 0 || c.RefreshTokenTTL <= 0 {
+		return fmt.Errorf("token lifetimes must be positive")
+	}
+	if c.RefreshGrace < 0 {
+		return fmt.Errorf("refresh grace must not be negative")
+	}
+	if c.MaxImageSize <= 0 || c.MaxImageDimension <= 0 {
+		return fmt.Errorf("image size limits must be positive")
+	}
+	if c.CommentDepth < 1 {
+		return fmt.Errorf("comment depth must be at least 1")
+	}
+	if c.WriteRate < 0 || c.WriteBurst < 1 {
+		return fmt.Errorf("write rate must not be negative and burst must be at least 1")
+	}
+	for _, timeout := range []time.Duration{
+		c.RequestTimeout, c.QueryTimeout, c.ReadHeaderTimeout, c.ReadTimeout,
+		c.WriteTimeout, c.IdleTimeout, c.ShutdownTimeout,
+	} {
+		if timeout < 0 {
+			return fmt.Errorf("timeouts must not be negative")
+		}
+	}
+	_, err := ratelimit.ParseProxies(c.TrustedProxies)
 	if err != nil {
 		return err
 	}
-	err = os.RemoveAll("static/images")
-	if err != nil {
-		return fmt.Errorf("failed to remove directory: %v", err)
+	switch c.LogFormat {
+	case "text", "json":
+	default:
+		return fmt.Errorf("unknown log format: %s", c.LogFormat)
 	}
-	err = os.Mkdir("static/images", 0750)
-	if err != nil {
-		return fmt.Errorf("failed to create directory: %v", err)
+	switch c.StorageBackend {
+	case "fs", "s3":
+	default:
+		return fmt.Errorf("unknown storage backend: %s", c.StorageBackend)
 	}
 	return nil
 }
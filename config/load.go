@@ -0,0 +1,261 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix starts the names of the environment variables of options,
+// such as BLOG_SECRET for secret and BLOG_STORAGE_DIR for storage-dir.
+const EnvPrefix = "BLOG_"
+
+// legacyEnv are the environment variables that set options before
+// BLOG_* variables did. The BLOG_* variable wins if both are set.
+var legacyEnv = map[string]string{
+	"s3-access-key": "S3_ACCESS_KEY",
+	"s3-secret-key": "S3_SECRET_KEY",
+}
+
+// option is a setting of a Config that can be given in a config file, in
+// an environment variable and as a flag, all under the same name. Value
+// points to the field of the setting.
+type option struct {
+	name  string
+	value any
+	usage string
+}
+
+func (c *Config) options() []option {
+	return []option{
+		{"dev", &c.DevMode, "Run in dev mode, which allows the default secret and no base URL"},
+		{"ip", &c.IP, "IP address to bind to"},
+		{"port", &c.Port, "Port to listen on"},
+		{"base-url", &c.BaseURL, "URL the blog is reached at, such as https://blog.example.com, required outside dev mode"},
+		{"site-title", &c.SiteTitle, "Title of the blog shown on pages and in feeds"},
+		{"secret", &c.Secret, "Secret key for authentication"},
+		{"dbfile", &c.DBFile, "Path to the database file"},
+		{"template-dir", &c.TemplateDir, "Directory of the page templates"},
+		{"static-dir", &c.StaticDir, "Directory of static files served at /static/, empty to serve none"},
+		{"log-format", &c.LogFormat, "Format of the logs: text or json"},
+		{"access-token-ttl", &c.AccessTokenTTL, "How long access tokens are valid"},
+		{"refresh-token-ttl", &c.RefreshTokenTTL, "How long refresh tokens are valid"},
+		{"refresh-grace", &c.RefreshGrace, "How long a used refresh token may be presented again by concurrent refreshes, 0 to disable"},
+		{"publish", &c.PublishInterval, "How often to publish scheduled posts"},
+		{"depth", &c.CommentDepth, "Maximum nesting depth of comment replies"},
+		{"rate", &c.WriteRate, "Requests that change state allowed per minute for an IP or user, 0 to disable"},
+		{"burst", &c.WriteBurst, "Burst size of the write rate limit"},
+		{"trusted-proxies", &c.TrustedProxies, "Comma-separated addresses or networks of reverse proxies trusted to set X-Forwarded-For"},
+		{"attempts", &c.LoginAttempts, "Failed logins in a row before a user is locked out, 0 to disable"},
+		{"lockout", &c.LockoutTime, "How long the first lockout lasts, doubled after every further failure"},
+		{"max-image-size", &c.MaxImageSize, "Largest image that can be uploaded in bytes"},
+		{"max-image-dimension", &c.MaxImageDimension, "Largest width and height of an uploaded image in pixels"},
+		{"storage", &c.StorageBackend, "Where image files are kept: fs or s3"},
+		{"storage-dir", &c.StorageDir, "Directory of the fs image storage"},
+		{"s3-endpoint", &c.S3.Endpoint, "Address of the S3 compatible service"},
+		{"s3-region", &c.S3.Region, "Region of the S3 bucket"},
+		{"s3-bucket", &c.S3.Bucket, "Name of the S3 bucket"},
+		{"s3-prefix", &c.S3.Prefix, "Prefix of the file names in the S3 bucket, such as blog/"},
+		{"s3-access-key", &c.S3.AccessKey, "Access key of the S3 bucket"},
+		{"s3-secret-key", &c.S3.SecretKey, "Secret key of the S3 bucket"},
+		{"s3-path-style", &c.S3.PathStyle, "Put the S3 bucket in the path instead of the host name"},
+		{"signed-urls", &c.SignedURLs, "Redirect image downloads to signed URLs of the storage (s3 only)"},
+		{"signed-url-ttl", &c.SignedURLTTL, "How long signed image URLs are valid"},
+		{"gc-interval", &c.GCInterval, "How often to delete unused image files, 0 to only run \"blog gc\" by hand"},
+		{"gc-age", &c.GCMinAge, "How old unused image files must be before they are deleted"},
+		{"request-timeout", &c.RequestTimeout, "How long a request may take, 0 for no limit"},
+		{"query-timeout", &c.QueryTimeout, "How long a database query may take, 0 for no limit"},
+		{"read-header-timeout", &c.ReadHeaderTimeout, "How long reading the headers of a request may take, 0 for no limit"},
+		{"read-timeout", &c.ReadTimeout, "How long reading a whole request may take, 0 for no limit"},
+		{"write-timeout", &c.WriteTimeout, "How long writing a response may take, 0 for no limit"},
+		{"idle-timeout", &c.IdleTimeout, "How long an idle keep-alive connection is kept open, 0 for no limit"},
+		{"shutdown-timeout", &c.ShutdownTimeout, "How long in-flight requests may take to finish on shutdown, 0 for no limit"},
+	}
+}
+
+// Load builds a Config in layers: the defaults, then the config file at
+// path unless path is empty, then the environment variables looked up
+// with env, then the flags, each overriding the layers before. Flags
+// maps option names to values, as returned by Flags.
+func Load(path string, env func(string) (string, bool), flags map[string]string) (Config, error) {
+	c := Default()
+	if path != "" {
+		err := c.loadFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+	for _, opt := range c.options() {
+		name := EnvPrefix + strings.ToUpper(strings.ReplaceAll(opt.name, "-", "_"))
+		value, ok := env(name)
+		if !ok && legacyEnv[opt.name] != "" {
+			name = legacyEnv[opt.name]
+			value, ok = env(name)
+		}
+		if !ok {
+			continue
+		}
+		err := parse(opt.value, value)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid %s: %v", name, err)
+		}
+	}
+	for name, value := range flags {
+		err := c.set(name, value)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid flag -%s: %v", name, err)
+		}
+	}
+	return c, nil
+}
+
+// Flags defines a flag on fs for every option. Once fs is parsed, the
+// returned map holds the flags that were given, to be passed to Load.
+func Flags(fs *flag.FlagSet) map[string]string {
+	given := make(map[string]string)
+	c := Default()
+	for _, opt := range c.options() {
+		fs.Var(flagValue{opt, given}, opt.name, opt.usage)
+	}
+	return given
+}
+
+// flagValue is the flag.Value of an option. It checks the values it is
+// given and keeps them in given.
+type flagValue struct {
+	option
+	given map[string]string
+}
+
+func (v flagValue) String() string {
+	switch value := v.value.(type) {
+	case *string:
+		return *value
+	case *bool:
+		return strconv.FormatBool(*value)
+	case *int:
+		return strconv.Itoa(*value)
+	case *int64:
+		return strconv.FormatInt(*value, 10)
+	case *float64:
+		return strconv.FormatFloat(*value, 'g', -1, 64)
+	case *time.Duration:
+		return value.String()
+	}
+	return ""
+}
+
+func (v flagValue) Set(s string) error {
+	err := parse(v.value, s)
+	if err != nil {
+		return err
+	}
+	v.given[v.name] = s
+	return nil
+}
+
+func (v flagValue) IsBoolFlag() bool {
+	_, ok := v.value.(*bool)
+	return ok
+}
+
+// set parses the value into the option with the name.
+func (c *Config) set(name, value string) error {
+	for _, opt := range c.options() {
+		if opt.name == name {
+			return parse(opt.value, value)
+		}
+	}
+	return fmt.Errorf("unknown option: %s", name)
+}
+
+// parse parses s into the field that value points to.
+func parse(value any, s string) error {
+	var err error
+	switch value := value.(type) {
+	case *string:
+		*value = s
+	case *bool:
+		*value, err = strconv.ParseBool(s)
+	case *int:
+		*value, err = strconv.Atoi(s)
+	case *int64:
+		*value, err = strconv.ParseInt(s, 10, 64)
+	case *float64:
+		*value, err = strconv.ParseFloat(s, 64)
+	case *time.Duration:
+		*value, err = time.ParseDuration(s)
+	default:
+		return fmt.Errorf("unsupported type %T", value)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value %q", s)
+	}
+	return nil
+}
+
+// loadFile sets the options in the config file at path, which is read
+// as TOML or YAML depending on its extension. Both hold option names
+// as keys, such as
+//
+//	port = "8080"
+//	request-timeout = "30s"
+//
+// in TOML and
+//
+//	port: 8080
+//	request-timeout: 30s
+//
+// in YAML.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	var values map[string]string
+	switch filepath.Ext(path) {
+	case ".toml":
+		values, err = parseTOML(data)
+	case ".yaml", ".yml":
+		values, err = parseYAML(data)
+	default:
+		return fmt.Errorf("config file must be .toml, .yaml or .yml: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	for name, value := range values {
+		err = c.set(name, value)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %v", path, name, err)
+		}
+	}
+	return nil
+}
+
+// parseYAML returns the values of a YAML mapping of option names.
+func parseYAML(data []byte) (map[string]string, error) {
+	var doc map[string]any
+	err := yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(doc))
+	for name, value := range doc {
+		switch value.(type) {
+		case nil:
+			values[name] = ""
+		case string, bool, int, int64, uint64, float64:
+			values[name] = fmt.Sprint(value)
+		default:
+			return nil, fmt.Errorf("%s: value must be a string, a number or a boolean", name)
+		}
+	}
+	return values, nil
+}
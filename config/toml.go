@@ -0,0 +1,122 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML returns the values of a TOML document of option names. Only
+// the part of TOML a flat config file needs is supported: comments and
+// key/value pairs whose values are strings, integers, floats or
+// booleans. Tables and arrays are rejected.
+func parseTOML(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("line %d: tables are not supported", n)
+		}
+		key, rest, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key, err := tomlKey(strings.TrimSpace(key))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		value, err := tomlValue(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %d: %s is defined twice", n, key)
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// tomlKey returns a bare or quoted key.
+func tomlKey(s string) (string, error) {
+	if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "'") {
+		key, rest, err := tomlString(s)
+		if err == nil && rest != "" {
+			err = fmt.Errorf("invalid key: %s", s)
+		}
+		return key, err
+	}
+	if s == "" {
+		return "", fmt.Errorf("missing key")
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return "", fmt.Errorf("invalid key: %s", s)
+		}
+	}
+	return s, nil
+}
+
+// tomlValue returns the value at the start of s, which may only be
+// followed by a comment, in the form the flag of the option takes.
+func tomlValue(s string) (string, error) {
+	if strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{") {
+		return "", fmt.Errorf("arrays and tables are not supported")
+	}
+	if !strings.HasPrefix(s, `"`) && !strings.HasPrefix(s, "'") {
+		value, _, _ := strings.Cut(s, "#")
+		value = strings.TrimSpace(value)
+		switch {
+		case value == "true" || value == "false":
+			return value, nil
+		case isNumber(value):
+			return strings.ReplaceAll(value, "_", ""), nil
+		}
+		return "", fmt.Errorf("invalid value: %s", value)
+	}
+	value, rest, err := tomlString(s)
+	if err != nil {
+		return "", err
+	}
+	rest = strings.TrimSpace(rest)
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf("unexpected %s after value", rest)
+	}
+	return value, nil
+}
+
+// tomlString returns the basic or literal string at the start of s and
+// what follows it.
+func tomlString(s string) (string, string, error) {
+	quote := s[:1]
+	end := 1
+	for end < len(s) && s[end:end+1] != quote {
+		if quote == `"` && s[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end >= len(s) {
+		return "", "", fmt.Errorf("unterminated string: %s", s)
+	}
+	if quote == "'" {
+		return s[1:end], s[end+1:], nil
+	}
+	value, err := strconv.Unquote(s[:end+1])
+	if err != nil {
+		return "", "", fmt.Errorf("invalid string: %s", s[:end+1])
+	}
+	return value, s[end+1:], nil
+}
+
+func isNumber(s string) bool {
+	s = strings.ReplaceAll(s, "_", "")
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
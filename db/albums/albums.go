@@ -0,0 +1,146 @@
+package albums
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxName is the longest album name in characters.
+const MaxName = 100
+
+// Album is a named collection of images put together by its author.
+// Any image can be in the albums of any user. Count is the number of
+// images in the album.
+type Album struct {
+	Id       int
+	AuthorId int
+	Author   string
+	Name     string
+	Created  time.Time
+	Count    int
+}
+
+// ValidName reports whether the album name is not blank, fits MaxName
+// and has no control characters.
+func ValidName(name string) bool {
+	if strings.TrimSpace(name) == "" || utf8.RuneCountInString(name) > MaxName {
+		return false
+	}
+	return strings.IndexFunc(name, unicode.IsControl) == -1
+}
+
+const query = `SELECT albums.id, albums.user_id, users.username, albums.name, albums.created,
+		(SELECT COUNT(*) FROM album_images WHERE album_images.album_id = albums.id)
+	FROM albums JOIN users ON albums.user_id = users.id`
+
+func scanAlbum(row interface{ Scan(...any) error }, album *Album) error {
+	return row.Scan(&album.Id, &album.AuthorId, &album.Author, &album.Name,
+		&album.Created, &album.Count)
+}
+
+// AddAlbum adds the album and returns its id. Names are unique for
+// each author.
+func AddAlbum(db *sql.DB, ctx context.Context, album Album) (int, error) {
+	if album.AuthorId == 0 || !ValidName(album.Name) {
+		return 0, fmt.Errorf("invalid argument")
+	}
+	var albumId int
+	err := db.QueryRowContext(ctx,
+		"INSERT INTO albums (user_id, name) VALUES ($1, $2) RETURNING id",
+		album.AuthorId, album.Name,
+	).Scan(&albumId)
+	if err != nil {
+		return 0, err
+	}
+	return albumId, nil
+}
+
+func GetAlbum(db *sql.DB, ctx context.Context, id int) (Album, error) {
+	var album Album
+	err := scanAlbum(db.QueryRowContext(ctx, query+" WHERE albums.id = $1", id), &album)
+	if err != nil {
+		return Album{}, err
+	}
+	return album, nil
+}
+
+// GetAlbumByName returns the album of the user with the name.
+func GetAlbumByName(db *sql.DB, ctx context.Context, userId int, name string) (Album, error) {
+	var album Album
+	err := scanAlbum(db.QueryRowContext(ctx,
+		query+" WHERE albums.user_id = $1 AND albums.name = $2", userId, name), &album)
+	if err != nil {
+		return Album{}, err
+	}
+	return album, nil
+}
+
+// GetUserAlbums returns the albums of the user sorted by name.
+func GetUserAlbums(db *sql.DB, ctx context.Context, userId int) ([]Album, error) {
+	rows, err := db.QueryContext(ctx,
+		query+" WHERE albums.user_id = $1 ORDER BY albums.name, albums.id", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	albums := make([]Album, 0)
+	for rows.Next() {
+		var album Album
+		err = scanAlbum(rows, &album)
+		if err != nil {
+			return nil, err
+		}
+		albums = append(albums, album)
+	}
+	return albums, rows.Err()
+}
+
+func RenameAlbum(db *sql.DB, ctx context.Context, id int, name string) error {
+	if !ValidName(name) {
+		return fmt.Errorf("invalid argument")
+	}
+	_, err := db.ExecContext(ctx,
+		"UPDATE albums SET name = $1 WHERE id = $2", name, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteAlbum deletes the album. Its images are kept.
+func DeleteAlbum(db *sql.DB, ctx context.Context, id int) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM albums WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// AddImage puts the image in the album. Adding an image that is already
+// in the album does nothing.
+func AddImage(db *sql.DB, ctx context.Context, albumId, imageId int) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO album_images (album_id, image_id) VALUES ($1, $2)
+			ON CONFLICT (album_id, image_id) DO NOTHING`,
+		albumId, imageId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RemoveImage takes the image out of the album.
+func RemoveImage(db *sql.DB, ctx context.Context, albumId, imageId int) error {
+	_, err := db.ExecContext(ctx,
+		"DELETE FROM album_images WHERE album_id = $1 AND image_id = $2",
+		albumId, imageId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
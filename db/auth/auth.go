@@ -4,12 +4,44 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 type User struct {
 	Id       int
 	Username string
 	Password string
+	Role     string
+}
+
+// DeletedUser is the name of the placeholder account that takes over
+// the posts, comments and images of anonymized accounts. It has no
+// password, so nobody can log in as it.
+const DeletedUser = "[deleted]"
+
+const MaxUsername = 32
+
+const (
+	// DeleteAnonymize keeps the content of a deleted account under
+	// the DeletedUser placeholder.
+	DeleteAnonymize = "anonymize"
+	// DeleteCascade removes the content of a deleted account with it.
+	DeleteCascade = "cascade"
+)
+
+// ValidUsername reports whether the name can be used for an account.
+// Usernames appear in URLs, so they can not contain slashes or spaces.
+func ValidUsername(username string) bool {
+	if username == "" || username == DeletedUser ||
+		utf8.RuneCountInString(username) > MaxUsername {
+		return false
+	}
+	return !strings.ContainsFunc(username, func(r rune) bool {
+		return r == '/' || unicode.IsSpace(r) || !unicode.IsPrint(r)
+	})
 }
 
 func AddUser(db *sql.DB, ctx context.Context, user User) error {
@@ -35,9 +67,246 @@ func GetUser(db *sql.DB, ctx context.Context, username string) (User, error) {
 		ctx,
 		"SELECT * FROM users WHERE username = $1",
 		username,
-	).Scan(&user.Id, &user.Username, &user.Password)
+	).Scan(&user.Id, &user.Username, &user.Password, &user.Role)
 	if err != nil {
 		return User{}, err
 	}
 	return user, nil
 }
+
+func GetUserById(db *sql.DB, ctx context.Context, id int) (User, error) {
+	var user User
+	err := db.QueryRowContext(
+		ctx,
+		"SELECT * FROM users WHERE id = $1",
+		id,
+	).Scan(&user.Id, &user.Username, &user.Password, &user.Role)
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+func SetRole(db *sql.DB, ctx context.Context, id int, role string) error {
+	if role == "" {
+		return fmt.Errorf("invalid argument")
+	}
+	_, err := db.ExecContext(ctx,
+		"UPDATE users SET role = $1 WHERE id = $2",
+		role, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func UpdatePassword(db *sql.DB, ctx context.Context, id int, password string) error {
+	if password == "" {
+		return fmt.Errorf("invalid argument")
+	}
+	_, err := db.ExecContext(ctx,
+		"UPDATE users SET password = $1 WHERE id = $2",
+		password, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Rename changes the username of the user. Posts are found by the
+// new name in search, as the post_search_author trigger updates them.
+func Rename(db *sql.DB, ctx context.Context, id int, username string) error {
+	if !ValidUsername(username) {
+		return fmt.Errorf("invalid argument")
+	}
+	_, err := db.ExecContext(ctx,
+		"UPDATE users SET username = $1 WHERE id = $2",
+		username, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteUser deletes the account of the user. With DeleteAnonymize the
+// posts, comments and images of the user are handed over to the
+// DeletedUser placeholder, with DeleteCascade they are deleted along
+// with the replies and likes they received. Likes, sessions and the
+// profile of the user are deleted either way, while the revisions the
+// user made to posts of others stay in their history.
+func DeleteUser(db *sql.DB, ctx context.Context, id int, mode string) error {
+	if mode != DeleteAnonymize && mode != DeleteCascade {
+		return fmt.Errorf("invalid argument")
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT OR IGNORE INTO users (username, password) VALUES ($1, '')",
+		DeletedUser)
+	if err != nil {
+		return err
+	}
+	var placeholder int
+	err = tx.QueryRowContext(ctx,
+		"SELECT id FROM users WHERE username = $1", DeletedUser,
+	).Scan(&placeholder)
+	if err != nil {
+		return err
+	}
+	if id == placeholder {
+		return fmt.Errorf("invalid argument")
+	}
+
+	queries := []string{
+		`UPDATE post_revisions SET user_id = $1 WHERE user_id = $2
+			AND post_id NOT IN (SELECT id FROM posts WHERE user_id = $2)`,
+		"UPDATE posts SET editor_id = $1 WHERE editor_id = $2",
+	}
+	if mode == DeleteAnonymize {
+		queries = append(queries,
+			"UPDATE posts SET user_id = $1 WHERE user_id = $2",
+			"UPDATE post_revisions SET user_id = $1 WHERE user_id = $2",
+			"UPDATE comments SET user_id = $1 WHERE user_id = $2",
+			// The placeholder can have only one image with a name. The
+			// images of the user it already has are deleted with the
+			// account, once their posts and albums have its image.
+			`UPDATE OR IGNORE post_images SET image_id = (SELECT kept.id FROM images kept
+				JOIN images own ON own.name = kept.name
+				WHERE own.id = post_images.image_id AND kept.user_id = $1)
+				WHERE image_id IN (SELECT own.id FROM images own
+					JOIN images kept ON kept.name = own.name AND kept.user_id = $1
+					WHERE own.user_id = $2)`,
+			`UPDATE OR IGNORE album_images SET image_id = (SELECT kept.id FROM images kept
+				JOIN images own ON own.name = kept.name
+				WHERE own.id = album_images.image_id AND kept.user_id = $1)
+				WHERE image_id IN (SELECT own.id FROM images own
+					JOIN images kept ON kept.name = own.name AND kept.user_id = $1
+					WHERE own.user_id = $2)`,
+			"UPDATE OR IGNORE images SET user_id = $1 WHERE user_id = $2",
+		)
+	}
+	for _, query := range queries {
+		_, err = tx.ExecContext(ctx, query, placeholder, id)
+		if err != nil {
+			return err
+		}
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+type RefreshToken struct {
+	Id        int
+	TokenHash string
+	Family    string
+	UserId    int
+	Used      bool
+	Revoked   bool
+	Created   time.Time
+	Expires   time.Time
+	// UsedAt is when the token was used, nil if it was not.
+	UsedAt *time.Time
+}
+
+func AddRefreshToken(db *sql.DB, ctx context.Context, token RefreshToken) error {
+	if token.TokenHash == "" || token.Family == "" || token.UserId == 0 {
+		return fmt.Errorf("invalid argument")
+	}
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO refresh_tokens (token_hash, family, user_id, expires)
+			VALUES ($1, $2, $3, $4)`,
+		token.TokenHash, token.Family, token.UserId, token.Expires.UTC())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetRefreshToken(db *sql.DB, ctx context.Context, tokenHash string) (RefreshToken, error) {
+	if tokenHash == "" {
+		return RefreshToken{}, fmt.Errorf("invalid argument")
+	}
+	var token RefreshToken
+	var usedAt sql.NullTime
+	err := db.QueryRowContext(ctx,
+		`SELECT id, token_hash, family, user_id, used, revoked, created, expires, used_at
+			FROM refresh_tokens WHERE token_hash = $1`,
+		tokenHash,
+	).Scan(&token.Id, &token.TokenHash, &token.Family, &token.UserId,
+		&token.Used, &token.Revoked, &token.Created, &token.Expires, &usedAt)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	return token, nil
+}
+
+// UseRefreshToken marks the token as used at the time. It reports false
+// if the token had already been used, so that only one of concurrent
+// rotations of the same token wins.
+func UseRefreshToken(db *sql.DB, ctx context.Context, id int, now time.Time) (bool, error) {
+	res, err := db.ExecContext(ctx,
+		"UPDATE refresh_tokens SET used = 1, used_at = $1 WHERE id = $2 AND used = 0",
+		now.UTC(), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func RevokeFamily(db *sql.DB, ctx context.Context, family string) error {
+	if family == "" {
+		return fmt.Errorf("invalid argument")
+	}
+	_, err := db.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked = 1 WHERE family = $1", family)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RevokeUserTokens revokes every session of the user except the one
+// with the given token family, which may be empty to revoke them all.
+func RevokeUserTokens(db *sql.DB, ctx context.Context, userId int, keep string) error {
+	_, err := db.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked = 1 WHERE user_id = $1 AND family != $2",
+		userId, keep)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func IsFamilyRevoked(db *sql.DB, ctx context.Context, family string) (bool, error) {
+	var revoked bool
+	err := db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM refresh_tokens
+			WHERE family = $1 AND revoked = 1)`,
+		family,
+	).Scan(&revoked)
+	if err != nil {
+		return false, err
+	}
+	return revoked, nil
+}
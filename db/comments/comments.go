@@ -1,9 +1,12 @@
 package comments
 
 import (
+	"blog/db/page"
 	"context"
 	"database/sql"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -11,31 +14,98 @@ type Comment struct {
 	Id       int
 	AuthorId int
 	PostId   int
+	ParentId int
+	Depth    int
 	Text     string
 	Author   string
+	Score    int
 	Created  time.Time
+	Replies  []Comment
 }
 
-func AddComment(db *sql.DB, ctx context.Context, comment Comment) error {
+// Order is the order of comments in a thread.
+type Order string
+
+const (
+	// OrderNew lists the newest comments first.
+	OrderNew Order = "new"
+	// OrderTop lists the comments with the highest score first.
+	OrderTop Order = "top"
+)
+
+func ValidOrder(order Order) bool {
+	return order == OrderNew || order == OrderTop
+}
+
+const selectComment = `SELECT comments.id, comments.post_id, comments.user_id,
+	COALESCE(comments.parent_id, 0), comments.depth, comments.text,
+	(SELECT COUNT(*) FILTER (WHERE type = 'like') - COUNT(*) FILTER (WHERE type = 'dislike')
+		FROM comment_likes WHERE comment_likes.comment_id = comments.id) AS score,
+	comments.created, users.username
+	FROM comments JOIN users ON comments.user_id = users.id`
+
+func scanComment(row interface{ Scan(...any) error }, comment *Comment) error {
+	return row.Scan(
+		&comment.Id, &comment.PostId, &comment.AuthorId, &comment.ParentId,
+		&comment.Depth, &comment.Text, &comment.Score, &comment.Created, &comment.Author,
+	)
+}
+
+func scanComments(rows *sql.Rows) ([]Comment, error) {
+	defer rows.Close()
+	var comments []Comment
+	for rows.Next() {
+		var comment Comment
+		err := scanComment(rows, &comment)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// AddComment adds a comment to a post and returns its id. A comment
+// with a ParentId is a reply, which must belong to the same post as its
+// parent.
+func AddComment(db *sql.DB, ctx context.Context, comment Comment) (int, error) {
 	if comment.AuthorId == 0 || comment.PostId == 0 || comment.Text == "" {
-		return fmt.Errorf("invalid argument")
+		return 0, fmt.Errorf("invalid argument")
 	}
-	_, err := db.ExecContext(ctx,
-		`INSERT INTO comments (user_id, post_id, text)
-			VALUES ($1, $2, $3)`,
-		comment.AuthorId, comment.PostId,
-		comment.Text)
+	var parentId any
+	var depth int
+	if comment.ParentId != 0 {
+		var postId int
+		err := db.QueryRowContext(ctx,
+			"SELECT post_id, depth FROM comments WHERE id = $1",
+			comment.ParentId).Scan(&postId, &depth)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, err
+		}
+		if err == sql.ErrNoRows || postId != comment.PostId {
+			return 0, fmt.Errorf("invalid argument")
+		}
+		parentId = comment.ParentId
+		depth++
+	}
+	var commentId int
+	err := db.QueryRowContext(ctx,
+		`INSERT INTO comments (user_id, post_id, parent_id, depth, text)
+			VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		comment.AuthorId, comment.PostId, parentId, depth,
+		comment.Text).Scan(&commentId)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	return commentId, nil
 }
 
+// GetComments returns all comments of the post, replies included,
+// as a flat list ordered by date.
 func GetComments(db *sql.DB, ctx context.Context, postId int) ([]Comment, error) {
 	rows, err := db.QueryContext(
 		ctx,
-		`SELECT comments.*, users.username FROM comments
-			JOIN users ON comments.user_id = users.id
+		selectComment+`
 			WHERE comments.post_id = $1
 			ORDER BY comments.created DESC`,
 		postId,
@@ -43,36 +113,177 @@ func GetComments(db *sql.DB, ctx context.Context, postId int) ([]Comment, error)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return scanComments(rows)
+}
 
-	var comments []Comment
-	for rows.Next() {
-		var comment Comment
-		err = rows.Scan(
-			&comment.Id, &comment.PostId, &comment.AuthorId,
-			&comment.Text, &comment.Created, &comment.Author,
+// GetUserComments returns up to limit newest comments of the user
+// on published posts.
+func GetUserComments(db *sql.DB, ctx context.Context, userId, limit int) ([]Comment, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("invalid argument")
+	}
+	rows, err := db.QueryContext(
+		ctx,
+		selectComment+`
+			JOIN posts ON comments.post_id = posts.id
+			WHERE comments.user_id = $1 AND posts.status = 'published'
+			ORDER BY comments.created DESC, comments.id DESC LIMIT $2`,
+		userId, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanComments(rows)
+}
+
+// GetCommentsPage returns up to limit top-level comments of the post
+// following the after cursor in the given order, with their replies
+// nested as in Tree, and the cursor of the next page if there is one.
+func GetCommentsPage(db *sql.DB, ctx context.Context, postId int,
+	after page.Cursor, limit, maxDepth int, order Order) ([]Comment, page.Cursor, error) {
+	if limit <= 0 || maxDepth <= 0 || !ValidOrder(order) {
+		return nil, page.Cursor{}, fmt.Errorf("invalid argument")
+	}
+	// Comments are ranked by score for OrderTop and all rank the same
+	// otherwise, so both orders fall back to the date order.
+	rank, orderBy := "0", ""
+	if order == OrderTop {
+		rank, orderBy = "score", "score DESC, "
+	}
+	rows, err := db.QueryContext(
+		ctx,
+		selectComment+`
+			WHERE comments.post_id = $1 AND comments.parent_id IS NULL AND ($2 = ''
+				OR `+rank+` < $3
+				OR (`+rank+` = $3 AND (comments.created < $2
+					OR (comments.created = $2 AND comments.id > $4))))
+			ORDER BY `+orderBy+`comments.created DESC, comments.id ASC LIMIT $5`,
+		postId, after.Time(), after.Rank, after.Id, limit+1,
+	)
+	if err != nil {
+		return nil, page.Cursor{}, err
+	}
+	comments, err := scanComments(rows)
+	if err != nil {
+		return nil, page.Cursor{}, err
+	}
+
+	var next page.Cursor
+	if len(comments) > limit {
+		comments = comments[:limit]
+		last := comments[limit-1]
+		next = page.Cursor{Created: last.Created, Id: last.Id}
+		if order == OrderTop {
+			next.Rank = last.Score
+		}
+	}
+	if len(comments) == 0 {
+		return comments, next, nil
+	}
+
+	ids := make([]string, len(comments))
+	args := make([]any, len(comments))
+	for i, comment := range comments {
+		ids[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = comment.Id
+	}
+	rows, err = db.QueryContext(
+		ctx,
+		`WITH RECURSIVE thread(id) AS (
+			SELECT id FROM comments WHERE parent_id IN (`+strings.Join(ids, ", ")+`)
+			UNION ALL
+			SELECT comments.id FROM comments JOIN thread ON comments.parent_id = thread.id
 		)
-		if err != nil {
-			return nil, err
+		`+selectComment+`
+			WHERE comments.id IN thread`,
+		args...,
+	)
+	if err != nil {
+		return nil, page.Cursor{}, err
+	}
+	replies, err := scanComments(rows)
+	if err != nil {
+		return nil, page.Cursor{}, err
+	}
+	return Tree(append(comments, replies...), maxDepth, order), next, nil
+}
+
+// Tree nests the replies in the list under their parents and returns
+// the top-level comments in their original order. Replies are listed
+// oldest first, or by score and then oldest first for OrderTop.
+// Replies that would be nested deeper than maxDepth are shown
+// alongside their ancestor at maxDepth instead, and Depth is set to the
+// depth at which each comment is shown.
+func Tree(list []Comment, maxDepth int, order Order) []Comment {
+	var roots []Comment
+	children := make(map[int][]Comment)
+	for _, comment := range list {
+		if comment.ParentId == 0 {
+			roots = append(roots, comment)
+		} else {
+			children[comment.ParentId] = append(children[comment.ParentId], comment)
 		}
-		comments = append(comments, comment)
 	}
+	for _, replies := range children {
+		sortReplies(replies, order)
+	}
+	for i := range roots {
+		roots[i] = nest(roots[i], children, 0, maxDepth, order)
+	}
+	return roots
+}
 
-	return comments, nil
+func nest(comment Comment, children map[int][]Comment, depth, maxDepth int, order Order) Comment {
+	comment.Depth = depth
+	comment.Replies = nil
+	for _, reply := range children[comment.Id] {
+		if depth+1 < maxDepth {
+			comment.Replies = append(comment.Replies, nest(reply, children, depth+1, maxDepth, order))
+		} else {
+			comment.Replies = append(comment.Replies, flatten(reply, children, depth+1)...)
+		}
+	}
+	if depth+1 >= maxDepth {
+		sortReplies(comment.Replies, order)
+	}
+	return comment
+}
+
+func flatten(comment Comment, children map[int][]Comment, depth int) []Comment {
+	comment.Depth = depth
+	comment.Replies = nil
+	list := []Comment{comment}
+	for _, reply := range children[comment.Id] {
+		list = append(list, flatten(reply, children, depth)...)
+	}
+	return list
+}
+
+// Count returns the number of comments in the tree, replies included.
+func Count(tree []Comment) int {
+	n := len(tree)
+	for _, comment := range tree {
+		n += Count(comment.Replies)
+	}
+	return n
+}
+
+func sortReplies(replies []Comment, order Order) {
+	sort.SliceStable(replies, func(i, j int) bool {
+		if order == OrderTop && replies[i].Score != replies[j].Score {
+			return replies[i].Score > replies[j].Score
+		}
+		if !replies[i].Created.Equal(replies[j].Created) {
+			return replies[i].Created.Before(replies[j].Created)
+		}
+		return replies[i].Id < replies[j].Id
+	})
 }
 
 func GetComment(db *sql.DB, ctx context.Context, id int) (Comment, error) {
 	var comment Comment
-	err := db.QueryRowContext(
-		ctx,
-		`SELECT comments.*, users.username FROM comments
-			JOIN users ON comments.user_id = users.id
-			WHERE comments.id = $1`,
-		id,
-	).Scan(
-		&comment.Id, &comment.PostId, &comment.AuthorId,
-		&comment.Text, &comment.Created, &comment.Author,
-	)
+	row := db.QueryRowContext(ctx, selectComment+" WHERE comments.id = $1", id)
+	err := scanComment(row, &comment)
 	if err != nil {
 		return Comment{}, err
 	}
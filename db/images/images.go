@@ -1,26 +1,140 @@
 package images
 
 import (
+	"blog/db/page"
 	"context"
 	"database/sql"
 	"fmt"
+	"regexp"
+	"strings"
 	"time"
+	"unicode"
 )
 
+const (
+	// URLPrefix is the address the image files are served under.
+	URLPrefix = "/api/images/files/"
+	// LegacyURLPrefix is where image files used to be served from. Posts
+	// written back then still link to it, so it redirects to URLPrefix.
+	LegacyURLPrefix = "/web/static/images/"
+)
+
+// link matches the addresses of image files in Markdown, under either
+// prefix and with or without the host of the blog.
+var link = regexp.MustCompile(`(?:` + regexp.QuoteMeta(URLPrefix) + `|` +
+	regexp.QuoteMeta(LegacyURLPrefix) + `)([^\s"'()<>?#\\]+)`)
+
+// References returns the names of the image files the text links to.
+func References(text string) []string {
+	var names []string
+	for _, match := range link.FindAllStringSubmatch(text, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// Image is an uploaded image. Name is the name of the file, which is
+// made by the server from the content of the image, and Original is the
+// name the file was uploaded with, which is only kept for display.
+// Type is the MIME type and Size the size of the file in bytes.
+// Thumbnail and Medium are smaller copies of images wider than them;
+// their Name is empty otherwise.
 type Image struct {
-	Id       int
-	AuthorId int
-	Name     string
-	Created  time.Time
+	Id        int
+	AuthorId  int
+	Name      string
+	Created   time.Time
+	Original  string
+	Type      string
+	Size      int
+	Width     int
+	Height    int
+	Thumbnail Variant
+	Medium    Variant
+}
+
+// Variant is a scaled down copy of an image.
+type Variant struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+// columns are the columns of the images table in the order of Image.
+const columns = `id, user_id, name, created, original, type, size, width, height,
+	thumbnail, thumbnail_width, thumbnail_height, medium, medium_width, medium_height`
+
+// prefixed are the columns prefixed with the table name, for queries
+// that join other tables.
+var prefixed = "images." + strings.Join(strings.FieldsFunc(columns, func(r rune) bool {
+	return r == ',' || unicode.IsSpace(r)
+}), ", images.")
+
+// scanImage scans a row of the images columns.
+func scanImage(row interface{ Scan(...any) error }, image *Image) error {
+	return row.Scan(&image.Id, &image.AuthorId, &image.Name, &image.Created,
+		&image.Original, &image.Type, &image.Size, &image.Width, &image.Height,
+		&image.Thumbnail.Name, &image.Thumbnail.Width, &image.Thumbnail.Height,
+		&image.Medium.Name, &image.Medium.Width, &image.Medium.Height)
+}
+
+// URL is the address of the original image.
+func (i Image) URL() string {
+	return URLPrefix + i.Name
 }
 
+// Preview is the address of the smallest copy of the image.
+func (i Image) Preview() string {
+	if i.Thumbnail.Name != "" {
+		return URLPrefix + i.Thumbnail.Name
+	}
+	return i.URL()
+}
+
+// SrcSet lists the copies of the image with their widths, smallest
+// first, for the srcset attribute of an img element.
+func (i Image) SrcSet() string {
+	var set []string
+	for _, v := range []Variant{i.Thumbnail, i.Medium} {
+		if v.Name != "" {
+			set = append(set, fmt.Sprintf("%s%s %dw", URLPrefix, v.Name, v.Width))
+		}
+	}
+	if i.Width > 0 {
+		set = append(set, fmt.Sprintf("%s %dw", i.URL(), i.Width))
+	}
+	return strings.Join(set, ", ")
+}
+
+// Files are the names of the files of the image and its copies.
+func (i Image) Files() []string {
+	files := []string{i.Name}
+	for _, v := range []Variant{i.Thumbnail, i.Medium} {
+		if v.Name != "" {
+			files = append(files, v.Name)
+		}
+	}
+	return files
+}
+
+// AddImage adds the image. Several users can have an image with the same
+// name, that is with the same content and files, but each only once:
+// adding an image the user already has does nothing, so that uploads of
+// the same file at the same time end with one image.
 func AddImage(db *sql.DB, ctx context.Context, image Image) error {
 	if image.AuthorId == 0 || image.Name == "" {
 		return fmt.Errorf("invalid argument")
 	}
 	_, err := db.ExecContext(ctx,
-		"INSERT OR IGNORE INTO images (name, user_id) VALUES ($1, $2)",
-		image.Name, image.AuthorId)
+		`INSERT INTO images (name, user_id, original, type, size, width, height,
+				thumbnail, thumbnail_width, thumbnail_height,
+				medium, medium_width, medium_height)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			ON CONFLICT (user_id, name) DO NOTHING`,
+		image.Name, image.AuthorId, image.Original, image.Type,
+		image.Size, image.Width, image.Height,
+		image.Thumbnail.Name, image.Thumbnail.Width, image.Thumbnail.Height,
+		image.Medium.Name, image.Medium.Width, image.Medium.Height)
 	if err != nil {
 		return err
 	}
@@ -28,7 +142,7 @@ func AddImage(db *sql.DB, ctx context.Context, image Image) error {
 }
 
 func GetImages(db *sql.DB, ctx context.Context) ([]Image, error) {
-	rows, err := db.QueryContext(ctx, "SELECT * FROM images")
+	rows, err := db.QueryContext(ctx, "SELECT "+columns+" FROM images")
 	if err != nil {
 		return nil, err
 	}
@@ -36,7 +150,7 @@ func GetImages(db *sql.DB, ctx context.Context) ([]Image, error) {
 	images := make([]Image, 0)
 	for rows.Next() {
 		var image Image
-		err = rows.Scan(&image.Id, &image.AuthorId, &image.Name, &image.Created)
+		err = scanImage(rows, &image)
 		if err != nil {
 			return nil, err
 		}
@@ -45,17 +159,249 @@ func GetImages(db *sql.DB, ctx context.Context) ([]Image, error) {
 	return images, nil
 }
 
+// GetImagesPage returns up to limit images following the after cursor,
+// newest first, and the cursor of the next page if there is one.
+func GetImagesPage(db *sql.DB, ctx context.Context,
+	after page.Cursor, limit int) ([]Image, page.Cursor, error) {
+	if limit <= 0 {
+		return nil, page.Cursor{}, fmt.Errorf("invalid argument")
+	}
+	rows, err := db.QueryContext(ctx,
+		`SELECT `+columns+` FROM images
+			WHERE $1 = '' OR created < $1 OR (created = $1 AND id > $2)
+			ORDER BY created DESC, id ASC LIMIT $3`,
+		after.Time(), after.Id, limit+1)
+	if err != nil {
+		return nil, page.Cursor{}, err
+	}
+	defer rows.Close()
+	images := make([]Image, 0)
+	for rows.Next() {
+		var image Image
+		err = scanImage(rows, &image)
+		if err != nil {
+			return nil, page.Cursor{}, err
+		}
+		images = append(images, image)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, page.Cursor{}, err
+	}
+	var next page.Cursor
+	if len(images) > limit {
+		images = images[:limit]
+		last := images[limit-1]
+		next = page.Cursor{Created: last.Created, Id: last.Id}
+	}
+	return images, next, nil
+}
+
+// GetUserImages returns the images uploaded by the user, newest first.
+func GetUserImages(db *sql.DB, ctx context.Context, userId int) ([]Image, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT "+columns+" FROM images WHERE user_id = $1 ORDER BY created DESC, id DESC",
+		userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	images := make([]Image, 0)
+	for rows.Next() {
+		var image Image
+		err = scanImage(rows, &image)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
 func GetImage(db *sql.DB, ctx context.Context, id int) (Image, error) {
 	var image Image
-	err := db.QueryRowContext(ctx,
-		"SELECT * FROM images WHERE id = $1", id,
-	).Scan(&image.Id, &image.AuthorId, &image.Name, &image.Created)
+	err := scanImage(db.QueryRowContext(ctx,
+		"SELECT "+columns+" FROM images WHERE id = $1", id), &image)
+	if err != nil {
+		return Image{}, err
+	}
+	return image, nil
+}
+
+// GetImageByName returns the first image uploaded with the name.
+func GetImageByName(db *sql.DB, ctx context.Context, name string) (Image, error) {
+	var image Image
+	err := scanImage(db.QueryRowContext(ctx,
+		"SELECT "+columns+" FROM images WHERE name = $1 ORDER BY id LIMIT 1", name), &image)
+	if err != nil {
+		return Image{}, err
+	}
+	return image, nil
+}
+
+// GetUserImageByName returns the image of the user with the name.
+func GetUserImageByName(db *sql.DB, ctx context.Context, userId int, name string) (Image, error) {
+	var image Image
+	err := scanImage(db.QueryRowContext(ctx,
+		"SELECT "+columns+" FROM images WHERE user_id = $1 AND name = $2", userId, name), &image)
 	if err != nil {
 		return Image{}, err
 	}
 	return image, nil
 }
 
+// GetImagesByName returns the first image uploaded with each of the
+// names, in no particular order. Names without an image are left out.
+func GetImagesByName(db *sql.DB, ctx context.Context, names []string) ([]Image, error) {
+	images := make([]Image, 0, len(names))
+	if len(names) == 0 {
+		return images, nil
+	}
+	args := make([]any, len(names))
+	params := make([]string, len(names))
+	for i, name := range names {
+		args[i] = name
+		params[i] = fmt.Sprintf("$%d", i+1)
+	}
+	rows, err := db.QueryContext(ctx,
+		`SELECT `+columns+` FROM images WHERE id IN
+			(SELECT MIN(id) FROM images WHERE name IN (`+strings.Join(params, ", ")+`) GROUP BY name)`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var image Image
+		err = scanImage(rows, &image)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+// GetPostImages returns the images attached to the post in the order
+// they were attached in.
+func GetPostImages(db *sql.DB, ctx context.Context, postId int) ([]Image, error) {
+	return queryImages(db, ctx,
+		`SELECT `+prefixed+` FROM images
+			JOIN post_images ON images.id = post_images.image_id
+			WHERE post_images.post_id = $1 ORDER BY post_images.position`,
+		postId)
+}
+
+// SetPostImages replaces the images attached to the post with the
+// images with the ids, in that order. Repeated ids are attached once.
+func SetPostImages(db *sql.DB, ctx context.Context, postId int, ids []int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM post_images WHERE post_id = $1", postId)
+	if err != nil {
+		return err
+	}
+	for i, id := range ids {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO post_images (post_id, image_id, position) VALUES ($1, $2, $3)
+				ON CONFLICT (post_id, image_id) DO NOTHING`,
+			postId, id, i)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetAlbumImages returns the images in the album, the most recently
+// added first.
+func GetAlbumImages(db *sql.DB, ctx context.Context, albumId int) ([]Image, error) {
+	return queryImages(db, ctx,
+		`SELECT `+prefixed+` FROM images
+			JOIN album_images ON images.id = album_images.image_id
+			WHERE album_images.album_id = $1
+			ORDER BY album_images.added DESC, images.id DESC`,
+		albumId)
+}
+
+// queryImages returns the images of a query for the prefixed columns.
+func queryImages(db *sql.DB, ctx context.Context, query string, args ...any) ([]Image, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	images := make([]Image, 0)
+	for rows.Next() {
+		var image Image
+		err = scanImage(rows, &image)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+// GetLinkedImages returns the ids of the images that are in an album,
+// attached to a post or used as an avatar.
+func GetLinkedImages(db *sql.DB, ctx context.Context) (map[int]bool, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT image_id FROM album_images
+			UNION SELECT image_id FROM post_images
+			UNION SELECT avatar_id FROM profiles WHERE avatar_id IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// GetUsedFiles returns which of the file names are files of an image.
+func GetUsedFiles(db *sql.DB, ctx context.Context, names []string) (map[string]bool, error) {
+	used := make(map[string]bool)
+	if len(names) == 0 {
+		return used, nil
+	}
+	args := make([]any, len(names))
+	params := make([]string, len(names))
+	for i, name := range names {
+		args[i] = name
+		params[i] = fmt.Sprintf("$%d", i+1)
+	}
+	list := strings.Join(params, ", ")
+	rows, err := db.QueryContext(ctx,
+		`SELECT name FROM images WHERE name IN (`+list+`)
+			UNION SELECT thumbnail FROM images WHERE thumbnail IN (`+list+`)
+			UNION SELECT medium FROM images WHERE medium IN (`+list+`)`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		used[name] = true
+	}
+	return used, rows.Err()
+}
+
 func DeleteImage(db *sql.DB, ctx context.Context, id int) error {
 	_, err := db.ExecContext(ctx,
 		"DELETE FROM images WHERE id = $1", id)
@@ -5,26 +5,49 @@ import (
 	"database/sql"
 )
 
+// target is a table of likes and the column holding the liked item.
+type target struct {
+	table, column string
+}
+
+var (
+	postLikes    = target{"likes", "post_id"}
+	commentLikes = target{"comment_likes", "comment_id"}
+)
+
+// AddLike toggles the like of the post by the user. Liking a post
+// twice takes the like back, and disliking a liked post replaces
+// the like with a dislike.
 func AddLike(db *sql.DB, ctx context.Context, userId, postId int, likeType string) error {
+	return toggle(db, ctx, postLikes, userId, postId, likeType)
+}
+
+// AddCommentLike toggles the like of the comment by the user,
+// like AddLike does for posts.
+func AddCommentLike(db *sql.DB, ctx context.Context, userId, commentId int, likeType string) error {
+	return toggle(db, ctx, commentLikes, userId, commentId, likeType)
+}
+
+func toggle(db *sql.DB, ctx context.Context, t target, userId, id int, likeType string) error {
 	var dbType string
 	err := db.QueryRowContext(
 		ctx,
-		"SELECT type FROM likes WHERE user_id = $1 AND post_id = $2",
-		userId, postId,
+		"SELECT type FROM "+t.table+" WHERE user_id = $1 AND "+t.column+" = $2",
+		userId, id,
 	).Scan(&dbType)
 	if err != nil && err != sql.ErrNoRows {
 		return err
 	}
 	var query string
 	if err == sql.ErrNoRows {
-		query = "INSERT INTO likes (user_id, post_id, type) VALUES ($1, $2, $3)"
-		_, err = db.ExecContext(ctx, query, userId, postId, likeType)
+		query = "INSERT INTO " + t.table + " (user_id, " + t.column + ", type) VALUES ($1, $2, $3)"
+		_, err = db.ExecContext(ctx, query, userId, id, likeType)
 	} else if likeType == dbType {
-		query = "DELETE FROM likes WHERE user_id = $1 AND post_id = $2 AND type = $3"
-		_, err = db.ExecContext(ctx, query, userId, postId, likeType)
+		query = "DELETE FROM " + t.table + " WHERE user_id = $1 AND " + t.column + " = $2 AND type = $3"
+		_, err = db.ExecContext(ctx, query, userId, id, likeType)
 	} else {
-		query = "UPDATE likes SET type = $1 WHERE user_id = $2 AND post_id = $3"
-		_, err = db.ExecContext(ctx, query, likeType, userId, postId)
+		query = "UPDATE " + t.table + " SET type = $1 WHERE user_id = $2 AND " + t.column + " = $3"
+		_, err = db.ExecContext(ctx, query, likeType, userId, id)
 	}
 	if err != nil {
 		return err
@@ -33,12 +56,22 @@ func AddLike(db *sql.DB, ctx context.Context, userId, postId int, likeType strin
 }
 
 func GetLikes(db *sql.DB, ctx context.Context, id int) (int, error) {
+	return score(db, ctx, postLikes, id)
+}
+
+// GetCommentLikes returns the score of the comment:
+// the number of likes minus the number of dislikes.
+func GetCommentLikes(db *sql.DB, ctx context.Context, id int) (int, error) {
+	return score(db, ctx, commentLikes, id)
+}
+
+func score(db *sql.DB, ctx context.Context, t target, id int) (int, error) {
 	var likes int
 	err := db.QueryRowContext(
 		ctx,
 		`SELECT COUNT(*) FILTER (WHERE type = 'like') -
 			COUNT(*) FILTER (WHERE type = 'dislike')
-			FROM likes WHERE post_id = $1`,
+			FROM `+t.table+` WHERE `+t.column+` = $1`,
 		id,
 	).Scan(&likes)
 	if err != nil {
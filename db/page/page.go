@@ -0,0 +1,89 @@
+package page
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// TimeFormat is the layout SQLite uses for CURRENT_TIMESTAMP. Cursor
+// times are formatted with it so they compare correctly with the
+// created columns, which are stored as text.
+const TimeFormat = "2006-01-02 15:04:05"
+
+// Cursor points at the last row of a page. Listings are ordered by
+// creation time, newest first, with rows created in the same second
+// kept in insertion order, so a row is identified by both fields.
+// Listings sorted by a score, highest first, also keep the score of
+// the row in Rank.
+type Cursor struct {
+	Rank    int
+	Created time.Time
+	Id      int
+}
+
+func (c Cursor) IsZero() bool {
+	return c.Id == 0
+}
+
+// String encodes the cursor as an opaque URL-safe token.
+// The zero cursor encodes as an empty string.
+func (c Cursor) String() string {
+	if c.IsZero() {
+		return ""
+	}
+	raw := fmt.Sprintf("%d.%d", c.Created.Unix(), c.Id)
+	if c.Rank != 0 {
+		raw += fmt.Sprintf(".%d", c.Rank)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// Time returns the creation time of the cursor in TimeFormat,
+// or an empty string for the zero cursor.
+func (c Cursor) Time() string {
+	if c.IsZero() {
+		return ""
+	}
+	return c.Created.UTC().Format(TimeFormat)
+}
+
+// Parse decodes a cursor produced by Cursor.String.
+// An empty string yields the zero cursor, which points at the first page.
+func Parse(s string) (Cursor, error) {
+	if s == "" {
+		return Cursor{}, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor")
+	}
+	parts := strings.Split(string(raw), ".")
+	if len(parts) != 2 && len(parts) != 3 {
+		return Cursor{}, fmt.Errorf("invalid cursor")
+	}
+	unixStr, idStr := parts[0], parts[1]
+	unix, err := strconv.ParseInt(unixStr, 10, 64)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor")
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		return Cursor{}, fmt.Errorf("invalid cursor")
+	}
+	var rank int
+	if len(parts) == 3 {
+		rank, err = strconv.Atoi(parts[2])
+		if err != nil {
+			return Cursor{}, fmt.Errorf("invalid cursor")
+		}
+	}
+	return Cursor{Rank: rank, Created: time.Unix(unix, 0).UTC(), Id: id}, nil
+}
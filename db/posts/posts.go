@@ -1,40 +1,102 @@
 package posts
 
 import (
+	"blog/db/page"
 	"blog/db/tags"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"html"
+	"strings"
 	"time"
+	"unicode"
 )
 
+const (
+	StatusDraft     = "draft"
+	StatusScheduled = "scheduled"
+	StatusPublished = "published"
+)
+
+// Post is a row of post_view. Drafts and scheduled posts are only
+// visible to their authors. Scheduled posts are published by
+// PublishDue once PublishAt has passed. Images are the ids of the
+// images attached to the post; like Tags, they are only read when a
+// post is added or updated.
 type Post struct {
-	Id       int
-	AuthorId int
-	Likes    int
-	Comments int
-	Author   string
-	Title    string
-	Text     string
-	Tags     []tags.Tag
-	Created  time.Time
+	Id        int
+	AuthorId  int
+	Likes     int
+	Comments  int
+	Author    string
+	Title     string
+	Text      string
+	Tags      []tags.Tag
+	Images    []int
+	Created   time.Time
+	Status    string
+	PublishAt *time.Time
 }
 
+// Posts is one page of the post listing. Nposts is the total number
+// of posts and Next points at the following page, if there is one.
 type Posts struct {
 	Posts  []Post
 	Nposts int
+	Next   page.Cursor
+}
+
+// ValidStatus reports whether the post has a known status. An empty
+// status means published, and scheduled posts need a publish time.
+func ValidStatus(post Post) bool {
+	switch post.Status {
+	case "", StatusDraft, StatusPublished:
+		return true
+	case StatusScheduled:
+		return post.PublishAt != nil
+	}
+	return false
+}
+
+// storedStatus returns the status and publish time to store for the post.
+func storedStatus(post Post) (string, any) {
+	switch post.Status {
+	case "":
+		return StatusPublished, nil
+	case StatusScheduled:
+		return post.Status, post.PublishAt.UTC().Format(page.TimeFormat)
+	}
+	return post.Status, nil
+}
+
+// scanPost scans a row of post_view followed by the extra columns.
+func scanPost(row interface{ Scan(...any) error }, post *Post, extra ...any) error {
+	var publishAt sql.NullTime
+	dest := []any{&post.Id, &post.Title, &post.Text, &post.AuthorId,
+		&post.Created, &post.Author, &post.Likes, &post.Comments,
+		&post.Status, &publishAt}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return err
+	}
+	if publishAt.Valid {
+		post.PublishAt = &publishAt.Time
+	}
+	return nil
 }
 
 func AddPost(db *sql.DB, ctx context.Context, post Post) (int, error) {
-	if post.Title == "" || post.Text == "" {
+	if post.Title == "" || post.Text == "" || !ValidStatus(post) {
 		return 0, fmt.Errorf("invalid argument")
 	}
+	status, publishAt := storedStatus(post)
 	var postId int
 	err := db.QueryRowContext(
 		ctx,
-		`INSERT INTO posts (title, text, user_id)
-			VALUES ($1, $2, $3) RETURNING id`,
-		post.Title, post.Text, post.AuthorId,
+		`INSERT INTO posts (title, text, user_id, status, publish_at)
+			VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		post.Title, post.Text, post.AuthorId, status, publishAt,
 	).Scan(&postId)
 	if err != nil {
 		return 0, err
@@ -43,7 +105,8 @@ func AddPost(db *sql.DB, ctx context.Context, post Post) (int, error) {
 }
 
 func GetPosts(db *sql.DB, ctx context.Context) ([]Post, error) {
-	rows, err := db.QueryContext(ctx, "SELECT * FROM post_view;")
+	rows, err := db.QueryContext(ctx,
+		"SELECT * FROM post_view WHERE status = 'published'")
 	if err != nil {
 		return nil, err
 	}
@@ -51,8 +114,7 @@ func GetPosts(db *sql.DB, ctx context.Context) ([]Post, error) {
 	var posts []Post
 	for rows.Next() {
 		var post Post
-		err = rows.Scan(&post.Id, &post.Title, &post.Text, &post.AuthorId,
-			&post.Created, &post.Author, &post.Likes, &post.Comments)
+		err = scanPost(rows, &post)
 		if err != nil {
 			return nil, err
 		}
@@ -61,30 +123,143 @@ func GetPosts(db *sql.DB, ctx context.Context) ([]Post, error) {
 	return posts, nil
 }
 
+// GetPostsPage returns up to limit posts following the after cursor,
+// ordered like post_view. The zero cursor returns the first page.
+func GetPostsPage(db *sql.DB, ctx context.Context, after page.Cursor, limit int) (Posts, error) {
+	if limit <= 0 {
+		return Posts{}, fmt.Errorf("invalid argument")
+	}
+	var result Posts
+	err := db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM posts WHERE status = 'published'").Scan(&result.Nposts)
+	if err != nil {
+		return Posts{}, err
+	}
+	rows, err := db.QueryContext(ctx,
+		`SELECT * FROM post_view
+			WHERE status = 'published'
+				AND ($1 = '' OR created < $1 OR (created = $1 AND id > $2))
+			ORDER BY created DESC, id ASC LIMIT $3`,
+		after.Time(), after.Id, limit+1)
+	if err != nil {
+		return Posts{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var post Post
+		err = scanPost(rows, &post)
+		if err != nil {
+			return Posts{}, err
+		}
+		result.Posts = append(result.Posts, post)
+	}
+	if err = rows.Err(); err != nil {
+		return Posts{}, err
+	}
+	if len(result.Posts) > limit {
+		result.Posts = result.Posts[:limit]
+		last := result.Posts[limit-1]
+		result.Next = page.Cursor{Created: last.Created, Id: last.Id}
+	}
+	return result, nil
+}
+
 func GetPost(db *sql.DB, ctx context.Context, id int) (Post, error) {
 	var post Post
-	err := db.QueryRowContext(ctx, "SELECT * FROM post_view WHERE id = $1", id).Scan(
-		&post.Id, &post.Title, &post.Text, &post.AuthorId, &post.Created,
-		&post.Author, &post.Likes, &post.Comments)
+	row := db.QueryRowContext(ctx, "SELECT * FROM post_view WHERE id = $1", id)
+	err := scanPost(row, &post)
 	if err != nil {
 		return Post{}, err
 	}
 	return post, nil
 }
 
-func UpdatePost(db *sql.DB, ctx context.Context, id int, post Post) error {
-	if post.Title == "" || post.Text == "" {
+// UpdatePost updates the post and its status. Publishing a post that
+// was not published before sets its date to the current time, so that
+// it shows up at the top of the listing. Changes to the title or text
+// are recorded as a revision made by the editor.
+func UpdatePost(db *sql.DB, ctx context.Context, id, editorId int, post Post) error {
+	if post.Title == "" || post.Text == "" || !ValidStatus(post) {
 		return fmt.Errorf("invalid argument")
 	}
+	status, publishAt := storedStatus(post)
+	_, err := db.ExecContext(ctx,
+		`UPDATE posts SET title = $1, text = $2, status = $3, publish_at = $4,
+			editor_id = $5,
+			created = CASE WHEN $3 = 'published' AND status != 'published'
+				THEN CURRENT_TIMESTAMP ELSE created END
+			WHERE id = $6`,
+		post.Title, post.Text, status, publishAt, editorId, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Unpublish turns the post back into a draft.
+func Unpublish(db *sql.DB, ctx context.Context, id int) error {
 	_, err := db.ExecContext(ctx,
-		"UPDATE posts SET title = $1, text = $2 WHERE id = $3",
-		post.Title, post.Text, id)
+		"UPDATE posts SET status = 'draft', publish_at = NULL WHERE id = $1", id)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// PublishDue publishes the scheduled posts whose publish time has
+// passed, dating them at that time, and returns how many there were.
+func PublishDue(db *sql.DB, ctx context.Context) (int64, error) {
+	res, err := db.ExecContext(ctx,
+		`UPDATE posts SET status = 'published', created = publish_at, publish_at = NULL
+			WHERE status = 'scheduled' AND publish_at <= CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetDrafts returns the drafts and scheduled posts of the user.
+func GetDrafts(db *sql.DB, ctx context.Context, userId int) ([]Post, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT * FROM post_view WHERE user_id = $1 AND status != 'published'
+			ORDER BY created DESC, id ASC`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var posts []Post
+	for rows.Next() {
+		var post Post
+		err = scanPost(rows, &post)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// GetTexts returns the Markdown of every post, drafts included, and of
+// their older revisions, which can still be restored.
+func GetTexts(db *sql.DB, ctx context.Context) ([]string, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT text FROM posts UNION SELECT text FROM post_revisions")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var texts []string
+	for rows.Next() {
+		var text string
+		err = rows.Scan(&text)
+		if err != nil {
+			return nil, err
+		}
+		texts = append(texts, text)
+	}
+	return texts, rows.Err()
+}
+
 func DeletePost(db *sql.DB, ctx context.Context, id int) error {
 	_, err := db.ExecContext(ctx, "DELETE FROM posts WHERE id = $1", id)
 	if err != nil {
@@ -100,7 +275,8 @@ func FilterTag(db *sql.DB, ctx context.Context, tag tags.Tag) ([]Post, error) {
 	rows, err := db.QueryContext(ctx,
 		`SELECT post_view.* FROM post_view 
 			JOIN post_tags ON post_view.id = post_tags.post_id
-			JOIN tags ON post_tags.tag_id = tags.id WHERE tags.name = $1
+			JOIN tags ON post_tags.tag_id = tags.id
+			WHERE tags.name = $1 AND post_view.status = 'published'
 			ORDER BY post_view.created DESC`, tag.Name)
 	if err != nil {
 		return nil, err
@@ -109,8 +285,7 @@ func FilterTag(db *sql.DB, ctx context.Context, tag tags.Tag) ([]Post, error) {
 	var posts []Post
 	for rows.Next() {
 		var post Post
-		err = rows.Scan(&post.Id, &post.Title, &post.Text, &post.AuthorId,
-			&post.Created, &post.Author, &post.Likes, &post.Comments)
+		err = scanPost(rows, &post)
 		if err != nil {
 			return nil, err
 		}
@@ -119,9 +294,15 @@ func FilterTag(db *sql.DB, ctx context.Context, tag tags.Tag) ([]Post, error) {
 	return posts, nil
 }
 
-func FilterQuery(db *sql.DB, ctx context.Context, query string) ([]Post, error) {
+// FilterAuthor returns the published posts of the user, newest first.
+func FilterAuthor(db *sql.DB, ctx context.Context, username string) ([]Post, error) {
+	if username == "" {
+		return nil, fmt.Errorf("invalid argument")
+	}
 	rows, err := db.QueryContext(ctx,
-		"SELECT * FROM post_view WHERE title LIKE $1", "%"+query+"%")
+		`SELECT * FROM post_view
+			WHERE username = $1 AND status = 'published'
+			ORDER BY created DESC`, username)
 	if err != nil {
 		return nil, err
 	}
@@ -129,12 +310,229 @@ func FilterQuery(db *sql.DB, ctx context.Context, query string) ([]Post, error)
 	var posts []Post
 	for rows.Next() {
 		var post Post
-		err = rows.Scan(&post.Id, &post.Title, &post.Text, &post.AuthorId,
-			&post.Created, &post.Author, &post.Likes, &post.Comments)
+		err = scanPost(rows, &post)
 		if err != nil {
 			return nil, err
 		}
 		posts = append(posts, post)
 	}
-	return posts, nil
+	return posts, rows.Err()
+}
+
+// Query is a parsed search query. Terms are phrases ready to be
+// used in an FTS MATCH expression, Tags and Author filter the
+// results by exact name.
+type Query struct {
+	Terms  []string
+	Tags   []string
+	Author string
+}
+
+// Result is a post found by Search. Snippet is an HTML-escaped excerpt
+// with the matching terms wrapped in <mark> elements.
+type Result struct {
+	Post
+	Snippet string
+	Rank    float64
+}
+
+// searchWeights are the BM25 weights of the post_search columns:
+// title, text, tags and author.
+const searchWeights = "4.0, 1.0, 2.0, 1.0"
+
+// ParseQuery parses the search syntax: words, "quoted phrases",
+// prefixes ending with *, OR between two terms, and the tag:name and
+// author:name filters. Filter values may be quoted to include spaces.
+func ParseQuery(s string) Query {
+	var query Query
+	for _, token := range splitQuery(s) {
+		switch {
+		case token == "OR":
+			if len(query.Terms) > 0 && query.Terms[len(query.Terms)-1] != "OR" {
+				query.Terms = append(query.Terms, "OR")
+			}
+		case strings.HasPrefix(token, "tag:"):
+			name := strings.TrimSpace(strings.ReplaceAll(token[len("tag:"):], `"`, ""))
+			if name != "" {
+				query.Tags = append(query.Tags, name)
+			}
+		case strings.HasPrefix(token, "author:"):
+			name := strings.TrimSpace(strings.ReplaceAll(token[len("author:"):], `"`, ""))
+			if name != "" {
+				query.Author = name
+			}
+		default:
+			prefix := strings.HasSuffix(token, "*")
+			text := strings.NewReplacer(`"`, "", "*", "").Replace(token)
+			text = strings.TrimSpace(text)
+			if text == "" {
+				continue
+			}
+			text = `"` + text + `"`
+			if prefix {
+				text += "*"
+			}
+			query.Terms = append(query.Terms, text)
+		}
+	}
+	if len(query.Terms) > 0 && query.Terms[len(query.Terms)-1] == "OR" {
+		query.Terms = query.Terms[:len(query.Terms)-1]
+	}
+	return query
+}
+
+// splitQuery splits a query on whitespace outside of double quotes.
+func splitQuery(s string) []string {
+	var tokens []string
+	var token strings.Builder
+	quoted := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			token.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
+			}
+		default:
+			token.WriteRune(r)
+		}
+	}
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	return tokens
+}
+
+func (q Query) IsZero() bool {
+	return len(q.Terms) == 0 && len(q.Tags) == 0 && q.Author == ""
+}
+
+// Match returns the FTS MATCH expression of the query terms.
+func (q Query) Match() string {
+	return strings.Join(q.Terms, " ")
+}
+
+// Search returns up to limit posts matching the query, best matches
+// first. Queries with filters only return the newest posts first.
+func Search(db *sql.DB, ctx context.Context, query Query, limit int) ([]Result, error) {
+	if query.IsZero() || limit <= 0 {
+		return nil, fmt.Errorf("invalid argument")
+	}
+	var args []any
+	conds := []string{"post_view.status = 'published'"}
+	columns := "post_view.*, '', 0"
+	from := "post_view"
+	order := "post_view.created DESC, post_view.id ASC"
+	if len(query.Terms) > 0 {
+		args = append(args, query.Match())
+		// bm25 is lower for better matches, so the rank is negated.
+		columns = fmt.Sprintf(`post_view.*,
+			snippet(post_search, -1, char(2), char(3), '...', 16),
+			-bm25(post_search, %s) AS score`, searchWeights)
+		from = "post_search JOIN post_view ON post_view.id = post_search.rowid"
+		conds = append(conds, "post_search MATCH $1")
+		order = "score DESC, " + order
+	}
+	conds, args = query.filter(conds, args)
+	args = append(args, limit)
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT %s FROM %s WHERE %s ORDER BY %s LIMIT $%d`,
+		columns, from, strings.Join(conds, " AND "), order, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var results []Result
+	for rows.Next() {
+		var result Result
+		var snippet string
+		err = scanPost(rows, &result.Post, &snippet, &result.Rank)
+		if err != nil {
+			return nil, err
+		}
+		result.Snippet = highlight(snippet)
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// filter adds the conditions of the author and tag filters of the
+// query to conds and their values to args.
+func (q Query) filter(conds []string, args []any) ([]string, []any) {
+	if q.Author != "" {
+		args = append(args, q.Author)
+		conds = append(conds, fmt.Sprintf("post_view.username = $%d", len(args)))
+	}
+	for _, tag := range q.Tags {
+		args = append(args, tag)
+		conds = append(conds, fmt.Sprintf(
+			`EXISTS (SELECT 1 FROM post_tags JOIN tags ON post_tags.tag_id = tags.id
+				WHERE post_tags.post_id = post_view.id AND tags.name = $%d)`, len(args)))
+	}
+	return conds, args
+}
+
+// Newest is a post found by GetNewest, with its Tags. Revised is when
+// its content last changed, or the zero time if it has no revisions.
+type Newest struct {
+	Post
+	Revised time.Time
+}
+
+// GetNewest returns up to limit published posts, newest first, that
+// pass the author and tag filters of the query. Its terms are ignored.
+// The tags and revision times of the posts are read in the same query.
+func GetNewest(db *sql.DB, ctx context.Context, query Query, limit int) ([]Newest, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("invalid argument")
+	}
+	conds, args := query.filter([]string{"post_view.status = 'published'"}, nil)
+	args = append(args, limit)
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT post_view.*,
+			(SELECT json_group_array(tags.name) FROM post_tags
+				JOIN tags ON post_tags.tag_id = tags.id
+				WHERE post_tags.post_id = post_view.id),
+			revised.created
+			FROM post_view
+			LEFT JOIN post_revisions AS revised ON revised.id =
+				(SELECT MAX(id) FROM post_revisions WHERE post_id = post_view.id)
+			WHERE %s
+			ORDER BY post_view.created DESC, post_view.id DESC LIMIT $%d`,
+		strings.Join(conds, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var posts []Newest
+	for rows.Next() {
+		var post Newest
+		var tagNames string
+		var revised sql.NullTime
+		err = scanPost(rows, &post.Post, &tagNames, &revised)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		err = json.Unmarshal([]byte(tagNames), &names)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tags: %v", err)
+		}
+		for _, name := range names {
+			post.Tags = append(post.Tags, tags.Tag{Name: name})
+		}
+		post.Revised = revised.Time
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// highlight escapes a snippet and replaces the \x02 and \x03
+// markers around the matching terms with <mark> elements.
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	return strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>").Replace(snippet)
 }
@@ -0,0 +1,114 @@
+package profiles
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"unicode/utf8"
+)
+
+const (
+	MaxDisplayName = 64
+	MaxBio         = 1000
+	MaxWebsite     = 200
+)
+
+// Profile is the public part of a user account. Every user has a
+// profile, which is empty until they edit it. AvatarId is one of the
+// images uploaded by the user and Avatar is the name of its file.
+// Posts, Comments and Likes are statistics and are not editable:
+// the number of published posts and comments of the user, and the
+// total score of their published posts.
+type Profile struct {
+	UserId      int
+	Username    string
+	DisplayName string
+	Bio         string
+	AvatarId    int
+	Avatar      string
+	Website     string
+	Posts       int
+	Comments    int
+	Likes       int
+}
+
+// Name is the name the user is shown with.
+func (p Profile) Name() string {
+	if p.DisplayName != "" {
+		return p.DisplayName
+	}
+	return p.Username
+}
+
+// ValidProfile reports whether the editable fields of the profile fit
+// their limits. The website must be an absolute http or https URL.
+func ValidProfile(profile Profile) bool {
+	if utf8.RuneCountInString(profile.DisplayName) > MaxDisplayName ||
+		utf8.RuneCountInString(profile.Bio) > MaxBio ||
+		len(profile.Website) > MaxWebsite {
+		return false
+	}
+	if profile.Website == "" {
+		return true
+	}
+	u, err := url.Parse(profile.Website)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func GetProfile(db *sql.DB, ctx context.Context, username string) (Profile, error) {
+	if username == "" {
+		return Profile{}, fmt.Errorf("invalid argument")
+	}
+	var profile Profile
+	err := db.QueryRowContext(ctx,
+		`SELECT users.id, users.username,
+			COALESCE(profiles.display_name, ''), COALESCE(profiles.bio, ''),
+			COALESCE(profiles.avatar_id, 0), COALESCE(images.name, ''),
+			COALESCE(profiles.website, ''),
+			(SELECT COUNT(*) FROM posts
+				WHERE posts.user_id = users.id AND posts.status = 'published'),
+			(SELECT COUNT(*) FROM comments JOIN posts ON comments.post_id = posts.id
+				WHERE comments.user_id = users.id AND posts.status = 'published'),
+			(SELECT COUNT(*) FILTER (WHERE likes.type = 'like') -
+				COUNT(*) FILTER (WHERE likes.type = 'dislike')
+				FROM likes JOIN posts ON likes.post_id = posts.id
+				WHERE posts.user_id = users.id AND posts.status = 'published')
+			FROM users
+			LEFT JOIN profiles ON profiles.user_id = users.id
+			LEFT JOIN images ON images.id = profiles.avatar_id
+			WHERE users.username = $1`,
+		username,
+	).Scan(&profile.UserId, &profile.Username, &profile.DisplayName, &profile.Bio,
+		&profile.AvatarId, &profile.Avatar, &profile.Website,
+		&profile.Posts, &profile.Comments, &profile.Likes)
+	if err != nil {
+		return Profile{}, err
+	}
+	return profile, nil
+}
+
+// UpdateProfile replaces the editable fields of the profile of the
+// user. An AvatarId of 0 removes the avatar.
+func UpdateProfile(db *sql.DB, ctx context.Context, userId int, profile Profile) error {
+	if userId == 0 || !ValidProfile(profile) {
+		return fmt.Errorf("invalid argument")
+	}
+	var avatarId any
+	if profile.AvatarId != 0 {
+		avatarId = profile.AvatarId
+	}
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO profiles (user_id, display_name, bio, avatar_id, website)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (user_id) DO UPDATE SET display_name = excluded.display_name,
+				bio = excluded.bio, avatar_id = excluded.avatar_id, website = excluded.website`,
+		userId, profile.DisplayName, profile.Bio, avatarId, profile.Website)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package revisions
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Revision is a version of a post's title and text. Revisions are
+// recorded by the database whenever a post is created or its content
+// changes, so the latest revision matches the current post.
+type Revision struct {
+	Id       int
+	PostId   int
+	EditorId int
+	Editor   string
+	Title    string
+	Text     string
+	Created  time.Time
+}
+
+const selectRevision = `SELECT post_revisions.id, post_id, user_id, username,
+	title, text, post_revisions.created
+	FROM post_revisions JOIN users ON users.id = post_revisions.user_id`
+
+func scanRevision(row interface{ Scan(...any) error }, revision *Revision) error {
+	return row.Scan(
+		&revision.Id, &revision.PostId, &revision.EditorId, &revision.Editor,
+		&revision.Title, &revision.Text, &revision.Created,
+	)
+}
+
+// GetRevisions returns the revisions of the post, newest first.
+func GetRevisions(db *sql.DB, ctx context.Context, postId int) ([]Revision, error) {
+	rows, err := db.QueryContext(ctx,
+		selectRevision+" WHERE post_id = $1 ORDER BY post_revisions.id DESC", postId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var revisions []Revision
+	for rows.Next() {
+		var revision Revision
+		err = scanRevision(rows, &revision)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+func GetRevision(db *sql.DB, ctx context.Context, id int) (Revision, error) {
+	var revision Revision
+	row := db.QueryRowContext(ctx, selectRevision+" WHERE post_revisions.id = $1", id)
+	err := scanRevision(row, &revision)
+	if err != nil {
+		return Revision{}, err
+	}
+	return revision, nil
+}
+
+// LastRevised returns when the content of the post last changed,
+// or the zero time if the post has no revisions.
+func LastRevised(db *sql.DB, ctx context.Context, postId int) (time.Time, error) {
+	var created time.Time
+	err := db.QueryRowContext(ctx,
+		`SELECT created FROM post_revisions WHERE post_id = $1
+			ORDER BY id DESC LIMIT 1`, postId).Scan(&created)
+	if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, err
+	}
+	return created, nil
+}
@@ -85,6 +85,15 @@ func GetTags(db *sql.DB, ctx context.Context, id int) ([]Tag, error) {
 	return tags, nil
 }
 
+// GetTag returns the tag with the name, or sql.ErrNoRows if no post was
+// ever tagged with it.
+func GetTag(db *sql.DB, ctx context.Context, name string) (Tag, error) {
+	var tag Tag
+	err := db.QueryRowContext(ctx,
+		"SELECT name FROM tags WHERE name = $1", name).Scan(&tag.Name)
+	return tag, err
+}
+
 func UpdateTags(db *sql.DB, ctx context.Context, id int, tags []Tag) error {
 	if tags == nil {
 		return fmt.Errorf("invalid argument")
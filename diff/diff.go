@@ -0,0 +1,177 @@
+package diff
+
+import (
+	"errors"
+	"strings"
+)
+
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Insert Op = "insert"
+	Delete Op = "delete"
+)
+
+// MaxLines is the most lines a text compared by Lines may have. The time
+// a diff takes grows with the product of the lengths and the number of
+// changes, so larger texts are refused rather than compared.
+const MaxLines = 10000
+
+var ErrTooLarge = errors.New("text too large to compare")
+
+// Line is a line of a diff. Equal lines are present in both texts,
+// deleted lines only in the old one and inserted lines only in the new one.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Lines returns a line diff between two texts, or ErrTooLarge if either
+// has more than MaxLines lines.
+func Lines(a, b string) ([]Line, error) {
+	linesA, linesB := split(a), split(b)
+	if len(linesA) > MaxLines || len(linesB) > MaxLines {
+		return nil, ErrTooLarge
+	}
+	return Diff(linesA, linesB), nil
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// Diff returns the shortest edit script turning a into b, computed with
+// the linear space variant of the Myers algorithm, which splits the texts
+// at the middle of an optimal path and diffs the halves. Deletions come
+// before insertions within a change.
+func Diff(a, b []string) []Line {
+	lines := diff(a, b, nil)
+	// The halves are diffed separately, so an insertion at the end of one
+	// may meet a deletion at the start of the next.
+	for i := 0; i < len(lines); {
+		j := i
+		for j < len(lines) && lines[j].Op != Equal {
+			j++
+		}
+		sortChange(lines[i:j])
+		i = j + 1
+	}
+	return lines
+}
+
+// sortChange moves the deletions of a change before its insertions.
+func sortChange(change []Line) {
+	var inserted []Line
+	n := 0
+	for _, line := range change {
+		if line.Op == Delete {
+			change[n] = line
+			n++
+		} else {
+			inserted = append(inserted, line)
+		}
+	}
+	copy(change[n:], inserted)
+}
+
+// diff appends the edit script turning a into b to lines.
+func diff(a, b []string, lines []Line) []Line {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		lines = append(lines, Line{Equal, a[prefix]})
+		prefix++
+	}
+	a, b = a[prefix:], b[prefix:]
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	switch {
+	case len(a) == 0:
+		for _, text := range b {
+			lines = append(lines, Line{Insert, text})
+		}
+	case len(b) == 0:
+		for _, text := range a {
+			lines = append(lines, Line{Delete, text})
+		}
+	default:
+		x, y, u, v := middleSnake(a, b)
+		lines = diff(a[:x], b[:y], lines)
+		for _, text := range a[x:u] {
+			lines = append(lines, Line{Equal, text})
+		}
+		lines = diff(a[u:], b[v:], lines)
+	}
+
+	for _, text := range common {
+		lines = append(lines, Line{Equal, text})
+	}
+	return lines
+}
+
+// middleSnake returns the snake from (x, y) to (u, v) in the middle of a
+// shortest edit path from a to b, found by following paths forward from
+// the start and backward from the end until they overlap. It keeps only
+// the furthest point reached on every diagonal, so it takes space linear
+// in the lengths of a and b. Both must be non-empty.
+func middleSnake(a, b []string) (x, y, u, v int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	half := (n + m + 1) / 2
+	offset := half + 1
+	// forward[offset+k] is the furthest x reached on diagonal k = x-y from
+	// the start. backward[offset+k] is the furthest distance reached on
+	// diagonal k from the end, counted on the reversed texts, where
+	// diagonal k is diagonal delta-k of the forward paths.
+	forward := make([]int, 2*offset+1)
+	backward := make([]int, 2*offset+1)
+	for d := 0; d <= half; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			if odd && delta-k >= -(d-1) && delta-k <= d-1 && x+backward[offset+delta-k] >= n {
+				return startX, startY, x, y
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			if !odd && delta-k >= -d && delta-k <= d && x+forward[offset+delta-k] >= n {
+				return n - x, m - y, n - startX, m - startY
+			}
+		}
+	}
+	panic("diff: no middle snake")
+}
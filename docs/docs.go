@@ -15,47 +15,45 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/api/auth/register": {
-            "post": {
-                "consumes": [
+        "/api/albums/": {
+            "get": {
+                "description": "Albums of the user of the token, sorted by name.",
+                "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "albums"
                 ],
-                "summary": "register a new user",
+                "summary": "Get your albums",
                 "parameters": [
                     {
-                        "description": "User",
-                        "name": "user",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/auth.User"
-                        }
+                        "type": "string",
+                        "description": "Auth Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
-                    },
-                    "400": {
-                        "description": "Invalid Request"
-                    },
-                    "405": {
-                        "description": "Method Not Allowed"
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/albums.Album"
+                            }
+                        }
                     },
-                    "409": {
-                        "description": "User Already Exists"
+                    "401": {
+                        "description": "Invalid Auth Token"
                     },
                     "500": {
                         "description": "Internal Error"
                     }
                 }
-            }
-        },
-        "/api/auth/token": {
-            "get": {
+            },
+            "post": {
+                "description": "Album names are unique for each user and up to 100 characters long.",
                 "consumes": [
                     "application/json"
                 ],
@@ -63,58 +61,62 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "albums"
                 ],
-                "summary": "Get auth token for the user",
+                "summary": "Create an album",
                 "parameters": [
                     {
-                        "description": "User",
-                        "name": "user",
+                        "description": "Album",
+                        "name": "album",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/auth.User"
+                            "$ref": "#/definitions/albums.Album"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Auth Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/albums.Album"
                         }
                     },
                     "400": {
                         "description": "Bad Request"
                     },
                     "401": {
-                        "description": "Invalid Password"
-                    },
-                    "404": {
-                        "description": "User Not Found"
+                        "description": "Invalid Auth Token"
                     },
-                    "405": {
-                        "description": "Method Not Allowed"
+                    "409": {
+                        "description": "Album Already Exists"
                     },
                     "500": {
-                        "description": "Internal Erorr"
+                        "description": "Internal Error"
                     }
                 }
             }
         },
-        "/api/comments/{id}": {
+        "/api/albums/{id}": {
             "get": {
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "comments"
+                    "albums"
                 ],
-                "summary": "Get the comment by ID",
+                "summary": "Get an album",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Comment ID",
+                        "description": "Album ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -124,17 +126,14 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/comments.Comment"
+                            "$ref": "#/definitions/albums.Album"
                         }
                     },
                     "400": {
                         "description": "Bad Request"
                     },
                     "404": {
-                        "description": "Comment Not Found"
-                    },
-                    "405": {
-                        "description": "Method Not Allowed"
+                        "description": "Album Not Found"
                     },
                     "500": {
                         "description": "Internal Error"
@@ -146,24 +145,24 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "comments"
+                    "albums"
                 ],
-                "summary": "Update the comment",
+                "summary": "Rename an album",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Comment ID",
+                        "description": "Album ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "Comment",
-                        "name": "comment",
+                        "description": "Album",
+                        "name": "album",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/comments.Comment"
+                            "$ref": "#/definitions/albums.Album"
                         }
                     },
                     {
@@ -185,76 +184,29 @@ const docTemplate = `{
                         "description": "Invalid Auth Token"
                     },
                     "403": {
-                        "description": "No Access To Comment"
+                        "description": "No Access To Album"
                     },
-                    "405": {
-                        "description": "Method Not Allowed"
+                    "404": {
+                        "description": "Album Not Found"
+                    },
+                    "409": {
+                        "description": "Album Already Exists"
                     },
                     "500": {
                         "description": "Internal Error"
                     }
                 }
             },
-            "post": {
-                "consumes": [
-                    "application/json"
-                ],
-                "tags": [
-                    "comments"
-                ],
-                "summary": "Add a comment to the post",
-                "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "Post ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Auth Token",
-                        "name": "Authorization",
-                        "in": "header",
-                        "required": true
-                    },
-                    {
-                        "description": "Comment",
-                        "name": "comment",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/comments.Comment"
-                        }
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK"
-                    },
-                    "400": {
-                        "description": "Bad Request"
-                    },
-                    "401": {
-                        "description": "Invalid Auth Header"
-                    },
-                    "404": {
-                        "description": "Post Not Found"
-                    },
-                    "405": {
-                        "description": "Method Not Allowed"
-                    }
-                }
-            },
             "delete": {
+                "description": "The images in the album are kept.",
                 "tags": [
-                    "comments"
+                    "albums"
                 ],
-                "summary": "Delete the comment",
+                "summary": "Delete an album",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Comment ID",
+                        "description": "Album ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -278,13 +230,10 @@ const docTemplate = `{
                         "description": "Invalid Auth Token"
                     },
                     "403": {
-                        "description": "No Access To Comment"
+                        "description": "No Access To Album"
                     },
                     "404": {
-                        "description": "Comment Not Found"
-                    },
-                    "405": {
-                        "description": "Method Not Allowed"
+                        "description": "Album Not Found"
                     },
                     "500": {
                         "description": "Internal Error"
@@ -292,55 +241,72 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/images/": {
+        "/api/albums/{id}/images": {
             "get": {
+                "description": "Images are returned in the order they were added, newest first.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "images"
+                    "albums"
+                ],
+                "summary": "Get the images in an album",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Album ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Get images",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/images.Image"
+                                "$ref": "#/definitions/blog_db_images.Image"
                             }
                         }
                     },
-                    "404": {
-                        "description": "Images Not Found"
+                    "400": {
+                        "description": "Bad Request"
                     },
-                    "405": {
-                        "description": "Method Not Allowed"
+                    "404": {
+                        "description": "Album Not Found"
                     },
                     "500": {
                         "description": "Internal Error"
                     }
                 }
-            },
-            "post": {
-                "consumes": [
-                    "multipart/form-data"
-                ],
+            }
+        },
+        "/api/albums/{id}/images/{image}": {
+            "put": {
+                "description": "Any image can be added, not only the images of the album's\nauthor. Adding an image that is already in the album does nothing.",
                 "tags": [
-                    "images"
+                    "albums"
                 ],
-                "summary": "Upload an image",
+                "summary": "Add an image to an album",
                 "parameters": [
                     {
-                        "type": "file",
-                        "description": "Image File",
+                        "type": "integer",
+                        "description": "Album ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Image ID",
                         "name": "image",
-                        "in": "formData",
+                        "in": "path",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "Auth Header",
+                        "description": "Auth Token",
                         "name": "Authorization",
                         "in": "header",
                         "required": true
@@ -356,64 +322,41 @@ const docTemplate = `{
                     "401": {
                         "description": "Invalid Auth Token"
                     },
-                    "405": {
-                        "description": "Method Not Allowed"
+                    "403": {
+                        "description": "No Access To Album"
+                    },
+                    "404": {
+                        "description": "Album Or Image Not Found"
                     },
                     "500": {
                         "description": "Internal Error"
                     }
                 }
-            }
-        },
-        "/api/images/{id}": {
-            "get": {
-                "produces": [
-                    "application/json"
-                ],
+            },
+            "delete": {
+                "description": "The image itself is kept.",
                 "tags": [
-                    "images"
+                    "albums"
                 ],
-                "summary": "Get Image by ID",
+                "summary": "Remove an image from an album",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Image ID",
+                        "description": "Album ID",
                         "name": "id",
                         "in": "path",
                         "required": true
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/images.Image"
-                        }
-                    },
-                    "400": {
-                        "description": "Bad Request"
                     },
-                    "500": {
-                        "description": "Internal Error"
-                    }
-                }
-            },
-            "delete": {
-                "tags": [
-                    "images"
-                ],
-                "summary": "Delete Image",
-                "parameters": [
                     {
                         "type": "integer",
                         "description": "Image ID",
-                        "name": "id",
+                        "name": "image",
                         "in": "path",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "Auth Header",
+                        "description": "Auth Token",
                         "name": "Authorization",
                         "in": "header",
                         "required": true
@@ -430,10 +373,10 @@ const docTemplate = `{
                         "description": "Invalid Auth Token"
                     },
                     "403": {
-                        "description": "No Access To Image"
+                        "description": "No Access To Album"
                     },
                     "404": {
-                        "description": "Image Not Found"
+                        "description": "Album Not Found"
                     },
                     "500": {
                         "description": "Internal Error"
@@ -441,30 +384,50 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/posts/": {
-            "get": {
-                "produces": [
+        "/api/auth/account": {
+            "delete": {
+                "description": "With mode=anonymize the posts, comments and images of the\nuser are kept under the [deleted] account, with mode=cascade\nthey are deleted too.",
+                "consumes": [
                     "application/json"
                 ],
                 "tags": [
-                    "posts"
+                    "auth"
                 ],
-                "summary": "Get post list",
-                "responses": {
-                    "200": {
-                        "description": "OK",
+                "summary": "Delete the account of the current user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "anonymize or cascade",
+                        "name": "mode",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "description": "Password",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/posts.Post"
-                            }
+                            "$ref": "#/definitions/auth.User"
                         }
                     },
-                    "400": {
+                    {
+                        "type": "string",
+                        "description": "Auth Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
                         "description": "Bad Request"
                     },
-                    "404": {
-                        "description": "Posts Not Found"
+                    "401": {
+                        "description": "Invalid Auth Token or Password"
                     },
                     "405": {
                         "description": "Method Not Allowed"
@@ -473,31 +436,31 @@ const docTemplate = `{
                         "description": "Internal Error"
                     }
                 }
-            },
+            }
+        },
+        "/api/auth/logout": {
             "post": {
                 "consumes": [
                     "application/json"
                 ],
                 "tags": [
-                    "posts"
+                    "auth"
                 ],
-                "summary": "Add a new post",
+                "summary": "Revoke the token family of the current session",
                 "parameters": [
                     {
-                        "description": "Post",
-                        "name": "post",
+                        "description": "Refresh Token",
+                        "name": "token",
                         "in": "body",
-                        "required": true,
                         "schema": {
-                            "$ref": "#/definitions/posts.Post"
+                            "$ref": "#/definitions/util.TokenPair"
                         }
                     },
                     {
                         "type": "string",
                         "description": "Auth Token",
                         "name": "Authorization",
-                        "in": "header",
-                        "required": true
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -508,7 +471,7 @@ const docTemplate = `{
                         "description": "Bad Request"
                     },
                     "401": {
-                        "description": "Invalid Auth Header"
+                        "description": "Invalid Token"
                     },
                     "405": {
                         "description": "Method Not Allowed"
@@ -519,36 +482,43 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/posts/search/q/{query}": {
-            "get": {
+        "/api/auth/password": {
+            "put": {
+                "description": "Other sessions of the user are signed out.",
+                "consumes": [
+                    "application/json"
+                ],
                 "tags": [
-                    "posts"
+                    "auth"
                 ],
-                "summary": "Search posts by title",
+                "summary": "Change the password of the current user",
                 "parameters": [
+                    {
+                        "description": "Old and New Password",
+                        "name": "passwords",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/auth.PasswordChange"
+                        }
+                    },
                     {
                         "type": "string",
-                        "description": "Query",
-                        "name": "query",
-                        "in": "path",
+                        "description": "Auth Token",
+                        "name": "Authorization",
+                        "in": "header",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
-                        "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/posts.Post"
-                            }
-                        }
+                        "description": "OK"
                     },
                     "400": {
                         "description": "Bad Request"
                     },
-                    "404": {
-                        "description": "Post Not Found"
+                    "401": {
+                        "description": "Invalid Auth Token or Password"
                     },
                     "405": {
                         "description": "Method Not Allowed"
@@ -559,36 +529,44 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/posts/tagPosts/t/{name}": {
-            "get": {
+        "/api/auth/refresh": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "tags"
+                    "auth"
                 ],
-                "summary": "Get posts associated with the tagPosts",
+                "summary": "Exchange a refresh token for a new token pair",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Tag Name",
-                        "name": "name",
-                        "in": "path",
-                        "required": true
+                        "description": "Refresh Token",
+                        "name": "token",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/util.TokenPair"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/posts.Posts"
+                            "$ref": "#/definitions/util.TokenPair"
                         }
                     },
                     "400": {
                         "description": "Bad Request"
                     },
-                    "404": {
-                        "description": "Tag Not Found"
+                    "401": {
+                        "description": "Invalid Refresh Token"
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
                     },
                     "500": {
                         "description": "Internal Error"
@@ -596,71 +574,62 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/posts/{id}": {
-            "get": {
-                "produces": [
+        "/api/auth/register": {
+            "post": {
+                "consumes": [
                     "application/json"
                 ],
                 "tags": [
-                    "posts"
+                    "auth"
                 ],
-                "summary": "Get a post by ID",
+                "summary": "register a new user",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Post ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "User",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/auth.User"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
-                        "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/posts.Post"
-                            }
-                        }
+                        "description": "OK"
                     },
                     "400": {
-                        "description": "Bad Request"
-                    },
-                    "404": {
-                        "description": "Not Found"
+                        "description": "Invalid Request"
                     },
                     "405": {
                         "description": "Method Not Allowed"
                     },
+                    "409": {
+                        "description": "User Already Exists"
+                    },
                     "500": {
                         "description": "Internal Error"
                     }
                 }
-            },
+            }
+        },
+        "/api/auth/role": {
             "put": {
                 "consumes": [
                     "application/json"
                 ],
                 "tags": [
-                    "posts"
+                    "auth"
                 ],
-                "summary": "Update a post",
+                "summary": "Change the role of a user",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Post ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "Post",
-                        "name": "post",
+                        "description": "Username and Role",
+                        "name": "user",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/posts.Post"
+                            "$ref": "#/definitions/auth.User"
                         }
                     },
                     {
@@ -682,10 +651,10 @@ const docTemplate = `{
                         "description": "Invalid Auth Token"
                     },
                     "403": {
-                        "description": "No Access To Post"
+                        "description": "Not An Admin"
                     },
                     "404": {
-                        "description": "Post Not Found"
+                        "description": "User Not Found"
                     },
                     "405": {
                         "description": "Method Not Allowed"
@@ -694,19 +663,77 @@ const docTemplate = `{
                         "description": "Internal Error"
                     }
                 }
-            },
-            "delete": {
+            }
+        },
+        "/api/auth/token": {
+            "get": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "posts"
+                    "auth"
                 ],
-                "summary": "Delete a post",
+                "summary": "Get access and refresh tokens for the user",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Post ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "User",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/auth.User"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/util.TokenPair"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Invalid Password"
+                    },
+                    "404": {
+                        "description": "User Not Found"
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    },
+                    "429": {
+                        "description": "Too Many Failed Logins"
+                    },
+                    "500": {
+                        "description": "Internal Erorr"
+                    }
+                }
+            }
+        },
+        "/api/auth/username": {
+            "put": {
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Change the username of the current user",
+                "parameters": [
+                    {
+                        "description": "New Username",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/auth.User"
+                        }
                     },
                     {
                         "type": "string",
@@ -726,22 +753,19 @@ const docTemplate = `{
                     "401": {
                         "description": "Invalid Auth Token"
                     },
-                    "403": {
-                        "description": "No Access To Post"
-                    },
-                    "404": {
-                        "description": "Post Not Found"
-                    },
                     "405": {
                         "description": "Method Not Allowed"
                     },
+                    "409": {
+                        "description": "User Already Exists"
+                    },
                     "500": {
                         "description": "Internal Error"
                     }
                 }
             }
         },
-        "/api/posts/{id}/comments": {
+        "/api/comments/{id}": {
             "get": {
                 "produces": [
                     "application/json"
@@ -749,11 +773,11 @@ const docTemplate = `{
                 "tags": [
                     "comments"
                 ],
-                "summary": "Get comments for the post",
+                "summary": "Get the comment by ID",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Post ID",
+                        "description": "Comment ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -763,17 +787,14 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/comments.Comment"
-                            }
+                            "$ref": "#/definitions/comments.Comment"
                         }
                     },
                     "400": {
                         "description": "Bad Request"
                     },
                     "404": {
-                        "description": "Comments Not Found"
+                        "description": "Comment Not Found"
                     },
                     "405": {
                         "description": "Method Not Allowed"
@@ -782,31 +803,95 @@ const docTemplate = `{
                         "description": "Internal Error"
                     }
                 }
-            }
-        },
-        "/api/posts/{id}/dislike": {
-            "post": {
+            },
+            "put": {
+                "consumes": [
+                    "application/json"
+                ],
                 "tags": [
-                    "posts"
+                    "comments"
                 ],
-                "summary": "Dislike a post",
+                "summary": "Update the comment",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Post ID",
+                        "description": "Comment ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "Auth Token",
-                        "name": "Authorization",
-                        "in": "header",
-                        "required": true
-                    }
-                ],
-                "responses": {
+                        "description": "Comment",
+                        "name": "comment",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/comments.Comment"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Auth Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Invalid Auth Token"
+                    },
+                    "403": {
+                        "description": "No Access To Comment"
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            },
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "comments"
+                ],
+                "summary": "Add a comment to the post",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Auth Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Comment",
+                        "name": "comment",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/comments.Comment"
+                        }
+                    }
+                ],
+                "responses": {
                     "200": {
                         "description": "OK"
                     },
@@ -819,6 +904,48 @@ const docTemplate = `{
                     "404": {
                         "description": "Post Not Found"
                     },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    }
+                }
+            },
+            "delete": {
+                "tags": [
+                    "comments"
+                ],
+                "summary": "Delete the comment",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Comment ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Auth Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Invalid Auth Token"
+                    },
+                    "403": {
+                        "description": "No Access To Comment"
+                    },
+                    "404": {
+                        "description": "Comment Not Found"
+                    },
                     "405": {
                         "description": "Method Not Allowed"
                     },
@@ -828,16 +955,17 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/posts/{id}/like": {
+        "/api/comments/{id}/dislike": {
             "post": {
+                "description": "Disliking a comment again takes the dislike back.",
                 "tags": [
-                    "posts"
+                    "comments"
                 ],
-                "summary": "Like a post",
+                "summary": "Dislike a comment",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Post ID",
+                        "description": "Comment ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -861,10 +989,49 @@ const docTemplate = `{
                         "description": "Invalid Auth Header"
                     },
                     "404": {
-                        "description": "Post Not Found"
+                        "description": "Comment Not Found"
                     },
-                    "405": {
-                        "description": "Method Not Allowed"
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/comments/{id}/like": {
+            "post": {
+                "description": "Liking a comment again takes the like back.",
+                "tags": [
+                    "comments"
+                ],
+                "summary": "Like a comment",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Comment ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Auth Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Invalid Auth Header"
+                    },
+                    "404": {
+                        "description": "Comment Not Found"
                     },
                     "500": {
                         "description": "Internal Error"
@@ -872,19 +1039,20 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/posts/{id}/likes": {
+        "/api/comments/{id}/likes": {
             "get": {
+                "description": "The score is the number of likes minus the number of dislikes.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "posts"
+                    "comments"
                 ],
-                "summary": "Get likes for the post",
+                "summary": "Get the score of a comment",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Post ID",
+                        "description": "Comment ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -901,7 +1069,7 @@ const docTemplate = `{
                         "description": "Bad Request"
                     },
                     "404": {
-                        "description": "Post Not Found"
+                        "description": "Comment Not Found"
                     },
                     "500": {
                         "description": "Internal Error"
@@ -909,22 +1077,92 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/posts/{id}/tags": {
-            "get": {
-                "produces": [
+        "/api/comments/{id}/reply": {
+            "post": {
+                "description": "Replies can be nested up to the configured depth (4 by default).",
+                "consumes": [
                     "application/json"
                 ],
                 "tags": [
-                    "tags"
+                    "comments"
                 ],
-                "summary": "Get all tags for the post",
+                "summary": "Reply to a comment",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Post ID",
+                        "description": "Comment ID",
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Auth Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Comment",
+                        "name": "comment",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/comments.Comment"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Invalid Auth Header"
+                    },
+                    "404": {
+                        "description": "Comment Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/images/": {
+            "get": {
+                "description": "Images are returned newest first, one page at a time.\nWith name parameters, only the images with those file names\nare returned, all at once and in no particular order.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "images"
+                ],
+                "summary": "Get images",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Page cursor",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "File names",
+                        "name": "name",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -933,7 +1171,13 @@ const docTemplate = `{
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/tags.Tag"
+                                "$ref": "#/definitions/blog_api_images.Image"
+                            }
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "Next page"
                             }
                         }
                     },
@@ -941,7 +1185,7 @@ const docTemplate = `{
                         "description": "Bad Request"
                     },
                     "404": {
-                        "description": "Post Not Found"
+                        "description": "Images Not Found"
                     },
                     "405": {
                         "description": "Method Not Allowed"
@@ -950,23 +1194,1409 @@ const docTemplate = `{
                         "description": "Internal Error"
                     }
                 }
-            }
-        }
-    },
-    "definitions": {
-        "auth.User": {
-            "type": "object",
-            "properties": {
-                "id": {
-                    "type": "integer"
-                },
-                "password": {
-                    "type": "string"
-                },
-                "username": {
-                    "type": "string"
-                }
-            }
+            },
+            "post": {
+                "description": "The image must be a JPEG, PNG or GIF file. Its metadata is\nremoved and it is stored under a name made from its content;\nthe name it was uploaded with is kept as Original. Uploading\none of your images again returns the existing image.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "images"
+                ],
+                "summary": "Upload an image",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "Image File",
+                        "name": "image",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Auth Header",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/blog_api_images.Image"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Invalid Auth Token"
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    },
+                    "413": {
+                        "description": "Image Too Large"
+                    },
+                    "415": {
+                        "description": "Unsupported Image Type"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/images/files/{name}": {
+            "get": {
+                "description": "Serves the file of an image or one of its copies. File\nnames are made from the content, so the files can be cached\nfor good. If the server is set up to sign URLs, it\nredirects to a temporary address of the file in the storage.",
+                "produces": [
+                    "image/jpeg",
+                    "image/png",
+                    "image/gif"
+                ],
+                "tags": [
+                    "images"
+                ],
+                "summary": "Download an image file",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "File Name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "302": {
+                        "description": "Redirect to a signed URL"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/images/{id}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "images"
+                ],
+                "summary": "Get Image by ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Image ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/blog_api_images.Image"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            },
+            "delete": {
+                "tags": [
+                    "images"
+                ],
+                "summary": "Delete Image",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Image ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Auth Header",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Invalid Auth Token"
+                    },
+                    "403": {
+                        "description": "No Access To Image"
+                    },
+                    "404": {
+                        "description": "Image Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/posts/": {
+            "get": {
+                "description": "Posts are returned newest first, one page at a time.\nThe Link header holds the URL of the next page, if any.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Get post list",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Page cursor",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/posts.Post"
+                            }
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "Next page"
+                            },
+                            "X-Total-Count": {
+                                "type": "int",
+                                "description": "Number of posts"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Posts Not Found"
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            },
+            "post": {
+                "description": "Status is \"draft\", \"scheduled\" or \"published\" (the default).\nScheduled posts are published once their PublishAt time has passed.\nImages lists the ids of the images attached to the post.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Add a new post",
+                "parameters": [
+                    {
+                        "description": "Post",
+                        "name": "post",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/posts.Post"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Auth Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Invalid Auth Header"
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/posts/drafts": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Get drafts and scheduled posts of the user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Auth Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/posts.Post"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid Auth Token"
+                    },
+                    "404": {
+                        "description": "Drafts Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/posts/search": {
+            "get": {
+                "description": "Full-text search over titles, texts, tags and authors.\nSupports \"phrases\", prefix*, OR, tag:name and author:name.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Search posts",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Query",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of results",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/posts.Result"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Post Not Found"
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/posts/tagPosts/t/{name}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tags"
+                ],
+                "summary": "Get posts associated with the tagPosts",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tag Name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/posts.Posts"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Tag Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/posts/{id}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Get a post by ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/posts.Post"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            },
+            "put": {
+                "description": "Images replaces the images attached to the post; without\nit they are left as they are.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Update a post",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Post",
+                        "name": "post",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/posts.Post"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Auth Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Invalid Auth Token"
+                    },
+                    "403": {
+                        "description": "No Access To Post"
+                    },
+                    "404": {
+                        "description": "Post Not Found"
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            },
+            "delete": {
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Delete a post",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Auth Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Invalid Auth Token"
+                    },
+                    "403": {
+                        "description": "No Access To Post"
+                    },
+                    "404": {
+                        "description": "Post Not Found"
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/posts/{id}/comments": {
+            "get": {
+                "description": "Top-level comments are returned newest first, one page at a time,\nwith their replies nested in Replies, oldest first.\nWith sort=top, comments with the highest score come first.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "comments"
+                ],
+                "summary": "Get comments for the post",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sort order: new (default) or top",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Page cursor",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/comments.Comment"
+                            }
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "Next page"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Comments Not Found"
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/posts/{id}/dislike": {
+            "post": {
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Dislike a post",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Auth Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Invalid Auth Header"
+                    },
+                    "404": {
+                        "description": "Post Not Found"
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/posts/{id}/images": {
+            "get": {
+                "description": "Images are returned in the order they were attached in.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Get the images attached to a post",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/blog_db_images.Image"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/posts/{id}/like": {
+            "post": {
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Like a post",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Auth Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Invalid Auth Header"
+                    },
+                    "404": {
+                        "description": "Post Not Found"
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/posts/{id}/likes": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Get likes for the post",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "integer"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Post Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/posts/{id}/revisions": {
+            "get": {
+                "description": "Revisions are returned newest first. The first one matches the current post.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Get revisions of a post",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/revisions.Revision"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Post Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/posts/{id}/revisions/diff": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Get a line diff between two revisions of a post",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Old revision ID",
+                        "name": "from",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "New revision ID",
+                        "name": "to",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/posts.RevisionDiff"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "413": {
+                        "description": "Revisions Too Large to Compare"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/posts/{id}/revisions/{rev}/restore": {
+            "post": {
+                "description": "Sets the title and text of the post to those of the revision,\nwhich is recorded as a new revision.",
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Restore a revision of a post",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Revision ID",
+                        "name": "rev",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Auth Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Invalid Auth Token"
+                    },
+                    "403": {
+                        "description": "No Access To Post"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/posts/{id}/tags": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tags"
+                ],
+                "summary": "Get all tags for the post",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/tags.Tag"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Post Not Found"
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/posts/{id}/unpublish": {
+            "post": {
+                "description": "Turns a published or scheduled post back into a draft.",
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Unpublish a post",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Auth Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Invalid Auth Token"
+                    },
+                    "403": {
+                        "description": "No Access To Post"
+                    },
+                    "404": {
+                        "description": "Post Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/users/{username}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Get the profile of a user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/profiles.Profile"
+                        }
+                    },
+                    "404": {
+                        "description": "User Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            },
+            "put": {
+                "description": "Only DisplayName, Bio, AvatarId and Website are updated.\nThe avatar must be one of the images uploaded by the user,\nand an AvatarId of 0 removes it.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Update the profile of a user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Profile",
+                        "name": "profile",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/profiles.Profile"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Auth Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Invalid Auth Token"
+                    },
+                    "403": {
+                        "description": "No Access To Profile"
+                    },
+                    "404": {
+                        "description": "User Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/users/{username}/albums": {
+            "get": {
+                "description": "Albums are sorted by name.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Get the albums of a user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/albums.Album"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "User Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/users/{username}/comments": {
+            "get": {
+                "description": "The newest comments on published posts are returned first.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Get the comments of a user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of comments",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/comments.Comment"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "User Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/users/{username}/images": {
+            "get": {
+                "description": "Images uploaded by the user are returned newest first.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Get the images of a user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/blog_db_images.Image"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "User Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        },
+        "/api/users/{username}/posts": {
+            "get": {
+                "description": "Published posts are returned newest first.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Get the posts of a user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/posts.Post"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "User Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Error"
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "albums.Album": {
+            "type": "object",
+            "properties": {
+                "author": {
+                    "type": "string"
+                },
+                "authorId": {
+                    "type": "integer"
+                },
+                "count": {
+                    "type": "integer"
+                },
+                "created": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "auth.PasswordChange": {
+            "type": "object",
+            "properties": {
+                "newPassword": {
+                    "type": "string"
+                },
+                "oldPassword": {
+                    "type": "string"
+                }
+            }
+        },
+        "auth.User": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "password": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "blog_api_images.Image": {
+            "type": "object",
+            "properties": {
+                "authorId": {
+                    "type": "integer"
+                },
+                "created": {
+                    "type": "string"
+                },
+                "height": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "medium": {
+                    "$ref": "#/definitions/images.Variant"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "original": {
+                    "type": "string"
+                },
+                "preview": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "srcSet": {
+                    "type": "string"
+                },
+                "thumbnail": {
+                    "$ref": "#/definitions/images.Variant"
+                },
+                "type": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                },
+                "width": {
+                    "type": "integer"
+                }
+            }
+        },
+        "blog_db_images.Image": {
+            "type": "object",
+            "properties": {
+                "authorId": {
+                    "type": "integer"
+                },
+                "created": {
+                    "type": "string"
+                },
+                "height": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "medium": {
+                    "$ref": "#/definitions/images.Variant"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "original": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "thumbnail": {
+                    "$ref": "#/definitions/images.Variant"
+                },
+                "type": {
+                    "type": "string"
+                },
+                "width": {
+                    "type": "integer"
+                }
+            }
         },
         "comments.Comment": {
             "type": "object",
@@ -980,31 +2610,81 @@ const docTemplate = `{
                 "created": {
                     "type": "string"
                 },
+                "depth": {
+                    "type": "integer"
+                },
                 "id": {
                     "type": "integer"
                 },
+                "parentId": {
+                    "type": "integer"
+                },
                 "postId": {
                     "type": "integer"
                 },
+                "replies": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/comments.Comment"
+                    }
+                },
+                "score": {
+                    "type": "integer"
+                },
                 "text": {
                     "type": "string"
                 }
             }
         },
-        "images.Image": {
+        "diff.Line": {
             "type": "object",
             "properties": {
-                "authorId": {
+                "op": {
+                    "$ref": "#/definitions/diff.Op"
+                },
+                "text": {
+                    "type": "string"
+                }
+            }
+        },
+        "diff.Op": {
+            "type": "string",
+            "enum": [
+                "equal",
+                "insert",
+                "delete"
+            ],
+            "x-enum-varnames": [
+                "Equal",
+                "Insert",
+                "Delete"
+            ]
+        },
+        "images.Variant": {
+            "type": "object",
+            "properties": {
+                "height": {
                     "type": "integer"
                 },
+                "name": {
+                    "type": "string"
+                },
+                "width": {
+                    "type": "integer"
+                }
+            }
+        },
+        "page.Cursor": {
+            "type": "object",
+            "properties": {
                 "created": {
                     "type": "string"
                 },
                 "id": {
                     "type": "integer"
                 },
-                "name": {
-                    "type": "string"
+                "rank": {
+                    "type": "integer"
                 }
             }
         },
@@ -1026,9 +2706,21 @@ const docTemplate = `{
                 "id": {
                     "type": "integer"
                 },
+                "images": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
                 "likes": {
                     "type": "integer"
                 },
+                "publishAt": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
                 "tags": {
                     "type": "array",
                     "items": {
@@ -1046,6 +2738,9 @@ const docTemplate = `{
         "posts.Posts": {
             "type": "object",
             "properties": {
+                "next": {
+                    "$ref": "#/definitions/page.Cursor"
+                },
                 "nposts": {
                     "type": "integer"
                 },
@@ -1057,6 +2752,143 @@ const docTemplate = `{
                 }
             }
         },
+        "posts.Result": {
+            "type": "object",
+            "properties": {
+                "author": {
+                    "type": "string"
+                },
+                "authorId": {
+                    "type": "integer"
+                },
+                "comments": {
+                    "type": "integer"
+                },
+                "created": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "images": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "likes": {
+                    "type": "integer"
+                },
+                "publishAt": {
+                    "type": "string"
+                },
+                "rank": {
+                    "type": "number"
+                },
+                "snippet": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/tags.Tag"
+                    }
+                },
+                "text": {
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "posts.RevisionDiff": {
+            "type": "object",
+            "properties": {
+                "from": {
+                    "$ref": "#/definitions/revisions.Revision"
+                },
+                "text": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/diff.Line"
+                    }
+                },
+                "title": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/diff.Line"
+                    }
+                },
+                "to": {
+                    "$ref": "#/definitions/revisions.Revision"
+                }
+            }
+        },
+        "profiles.Profile": {
+            "type": "object",
+            "properties": {
+                "avatar": {
+                    "type": "string"
+                },
+                "avatarId": {
+                    "type": "integer"
+                },
+                "bio": {
+                    "type": "string"
+                },
+                "comments": {
+                    "type": "integer"
+                },
+                "displayName": {
+                    "type": "string"
+                },
+                "likes": {
+                    "type": "integer"
+                },
+                "posts": {
+                    "type": "integer"
+                },
+                "userId": {
+                    "type": "integer"
+                },
+                "username": {
+                    "type": "string"
+                },
+                "website": {
+                    "type": "string"
+                }
+            }
+        },
+        "revisions.Revision": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "string"
+                },
+                "editor": {
+                    "type": "string"
+                },
+                "editorId": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "postId": {
+                    "type": "integer"
+                },
+                "text": {
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
         "tags.Tag": {
             "type": "object",
             "properties": {
@@ -1064,6 +2896,20 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "util.TokenPair": {
+            "type": "object",
+            "properties": {
+                "accessToken": {
+                    "type": "string"
+                },
+                "expiresIn": {
+                    "type": "integer"
+                },
+                "refreshToken": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
@@ -0,0 +1,254 @@
+package feed
+
+import (
+	"blog/app"
+	"blog/db/auth"
+	"blog/db/posts"
+	"blog/db/tags"
+	"blog/logging"
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// Size is the number of newest posts in a feed.
+const Size = 20
+
+const (
+	FormatAtom = "atom"
+	FormatRSS  = "rss"
+)
+
+var contentTypes = map[string]string{
+	FormatAtom: "application/atom+xml; charset=utf-8",
+	FormatRSS:  "application/rss+xml; charset=utf-8",
+}
+
+// source is what a feed is built from. Path is the address of the
+// feed without the extension and Link is the page the feed follows.
+type source struct {
+	Title string
+	Path  string
+	Link  string
+	Posts []posts.Newest
+}
+
+// entry is a post ready to be written to a feed. Updated is when
+// the post was created or, if it was edited, last revised.
+type entry struct {
+	Post    posts.Post
+	Content string
+	Updated time.Time
+}
+
+// handler serves the feeds of an App.
+type handler struct {
+	app *app.App
+}
+
+func ServeMux(a *app.App) *http.ServeMux {
+	h := handler{a}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /feed.atom", h.blog(FormatAtom))
+	mux.HandleFunc("GET /feed.rss", h.blog(FormatRSS))
+	mux.HandleFunc("GET /feed/tag/{file}", h.tag)
+	mux.HandleFunc("GET /feed/author/{file}", h.author)
+	return mux
+}
+
+// blog serves the feed of all published posts.
+func (h handler) blog(format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		postList, err := posts.GetNewest(h.app.DB, r.Context(), posts.Query{}, Size)
+		if err != nil {
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
+			return
+		}
+		h.serve(w, r, format, source{
+			Title: h.app.Config.SiteTitle,
+			Path:  "/feed",
+			Link:  "/web/posts/get",
+			Posts: postList,
+		})
+	}
+}
+
+// tag serves the feed of the posts with a tag, e.g. /feed/tag/go.atom.
+func (h handler) tag(w http.ResponseWriter, r *http.Request) {
+	name, format, ok := splitFile(r.PathValue("file"))
+	if !ok {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	_, err := tags.GetTag(h.app.DB, r.Context(), name)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	postList, err := posts.GetNewest(h.app.DB, r.Context(),
+		posts.Query{Tags: []string{name}}, Size)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	h.serve(w, r, format, source{
+		Title: h.app.Config.SiteTitle + " | " + name,
+		Path:  "/feed/tag/" + url.PathEscape(name),
+		Link:  "/web/posts/tag/" + url.PathEscape(name),
+		Posts: postList,
+	})
+}
+
+// author serves the feed of the posts by a user, e.g. /feed/author/alice.rss.
+func (h handler) author(w http.ResponseWriter, r *http.Request) {
+	username, format, ok := splitFile(r.PathValue("file"))
+	if !ok {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	_, err := auth.GetUser(h.app.DB, r.Context(), username)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	postList, err := posts.GetNewest(h.app.DB, r.Context(),
+		posts.Query{Author: username}, Size)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	h.serve(w, r, format, source{
+		Title: h.app.Config.SiteTitle + " | " + username,
+		Path:  "/feed/author/" + url.PathEscape(username),
+		Link:  "/web/users/" + url.PathEscape(username),
+		Posts: postList,
+	})
+}
+
+// splitFile splits a file name like "go.atom" into the name and
+// a known feed format.
+func splitFile(file string) (string, string, bool) {
+	i := strings.LastIndex(file, ".")
+	if i <= 0 {
+		return "", "", false
+	}
+	name, format := file[:i], file[i+1:]
+	if _, ok := contentTypes[format]; !ok {
+		return "", "", false
+	}
+	return name, format, true
+}
+
+// serve writes the feed with an ETag and Last-Modified header, and
+// answers conditional requests with 304 Not Modified.
+func (h handler) serve(w http.ResponseWriter, r *http.Request, format string, src source) {
+	base := h.baseURL(r)
+	entries, updated := load(base, src.Posts)
+
+	var doc any
+	if format == FormatAtom {
+		doc = atom(base, src, entries, updated)
+	} else {
+		doc = rss(base, src, entries, updated)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	err := xml.NewEncoder(&buf).Encode(doc)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	w.Header().Set("Content-Type", contentTypes[format])
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sum[:16]))
+	http.ServeContent(w, r, "", updated, bytes.NewReader(buf.Bytes()))
+}
+
+// load renders the posts and returns them with the time the feed was
+// last updated, which is the zero time for an empty feed.
+func load(base string, postList []posts.Newest) ([]entry, time.Time) {
+	var updated time.Time
+	entries := make([]entry, 0, len(postList))
+	for _, post := range postList {
+		e := entry{
+			Post:    post.Post,
+			Content: render(post.Text, base),
+			Updated: post.Created,
+		}
+		if post.Revised.After(e.Updated) {
+			e.Updated = post.Revised
+		}
+		if e.Updated.After(updated) {
+			updated = e.Updated
+		}
+		entries = append(entries, e)
+	}
+	return entries, updated
+}
+
+// render turns the Markdown of a post into HTML. Relative links are
+// made absolute since feed readers show the content out of the blog.
+func render(text, base string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	renderer := blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+		AbsolutePrefix: base,
+		Flags:          blackfriday.CommonHTMLFlags,
+	})
+	return string(blackfriday.Run(
+		[]byte(text),
+		blackfriday.WithExtensions(
+			blackfriday.CommonExtensions|
+				blackfriday.HardLineBreak,
+		),
+		blackfriday.WithRenderer(renderer),
+	))
+}
+
+// baseURL is the configured base URL of the blog. Only in dev mode,
+// where it may be left out, is the Host header of the request used.
+func (h handler) baseURL(r *http.Request) string {
+	if h.app.Config.BaseURL != "" || !h.app.Config.DevMode {
+		return h.app.Config.Host()
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func postURL(base string, id int) string {
+	return fmt.Sprintf("%s/web/posts/get/%d", base, id)
+}
+
+// feedTime is the time written to a feed, which must not be empty
+// even if the feed has no entries.
+func feedTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Unix(0, 0).UTC()
+	}
+	return t.UTC()
+}
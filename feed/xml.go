@@ -0,0 +1,126 @@
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Atom is an Atom 1.0 feed as defined in RFC 4287.
+type Atom struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []AtomLink  `xml:"link"`
+	Entries []AtomEntry `xml:"entry"`
+}
+
+type AtomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type AtomEntry struct {
+	Id         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     AtomAuthor     `xml:"author"`
+	Link       AtomLink       `xml:"link"`
+	Categories []AtomCategory `xml:"category"`
+	Content    AtomContent    `xml:"content"`
+}
+
+type AtomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type AtomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type AtomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// RSS is an RSS 2.0 feed.
+type RSS struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel RSSChannel `xml:"channel"`
+}
+
+type RSSChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []RSSItem `xml:"item"`
+}
+
+type RSSItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Guid        string   `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+func atom(base string, src source, entries []entry, updated time.Time) Atom {
+	feed := Atom{
+		Id:      base + src.Path + ".atom",
+		Title:   src.Title,
+		Updated: feedTime(updated).Format(time.RFC3339),
+		Links: []AtomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: base + src.Path + ".atom"},
+			{Rel: "alternate", Type: "text/html", Href: base + src.Link},
+		},
+	}
+	for _, e := range entries {
+		item := AtomEntry{
+			Id:        postURL(base, e.Post.Id),
+			Title:     e.Post.Title,
+			Published: feedTime(e.Post.Created).Format(time.RFC3339),
+			Updated:   feedTime(e.Updated).Format(time.RFC3339),
+			Author:    AtomAuthor{Name: e.Post.Author},
+			Link:      AtomLink{Rel: "alternate", Type: "text/html", Href: postURL(base, e.Post.Id)},
+			Content:   AtomContent{Type: "html", Body: e.Content},
+		}
+		for _, tag := range e.Post.Tags {
+			item.Categories = append(item.Categories, AtomCategory{Term: tag.Name})
+		}
+		feed.Entries = append(feed.Entries, item)
+	}
+	return feed
+}
+
+func rss(base string, src source, entries []entry, updated time.Time) RSS {
+	feed := RSS{
+		Version: "2.0",
+		Channel: RSSChannel{
+			Title:         src.Title,
+			Link:          base + src.Link,
+			Description:   src.Title,
+			LastBuildDate: feedTime(updated).Format(time.RFC1123Z),
+		},
+	}
+	for _, e := range entries {
+		item := RSSItem{
+			Title:       e.Post.Title,
+			Link:        postURL(base, e.Post.Id),
+			Guid:        postURL(base, e.Post.Id),
+			PubDate:     feedTime(e.Post.Created).Format(time.RFC1123Z),
+			Creator:     e.Post.Author,
+			Description: e.Content,
+		}
+		for _, tag := range e.Post.Tags {
+			item.Categories = append(item.Categories, tag.Name)
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	return feed
+}
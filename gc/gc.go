@@ -0,0 +1,143 @@
+// Package gc reconciles the images table with the files in the storage
+// and removes what nothing uses any more.
+package gc
+
+import (
+	"blog/db/images"
+	"blog/db/posts"
+	"blog/imaging"
+	"blog/storage"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Report is what a collection found. Stray are files that belong to no
+// image, of those named like the blog names them, Missing are files of images that the storage does not have and
+// Unused are images that no post links to or has attached, that are in
+// no album and that are no one's avatar.
+type Report struct {
+	Stray   []storage.Info
+	Missing []string
+	Unused  []images.Image
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("%d stray files, %d missing files, %d unused images",
+		len(r.Stray), len(r.Missing), len(r.Unused))
+}
+
+// Collect finds the stray files and unused images and, unless dryRun is
+// set, deletes them. Only files that are named after their content or
+// are unfinished uploads can be stray; others may belong to someone else
+// who shares the storage. Files and images younger than minAge are left alone,
+// since they may belong to an upload or a post that is not finished yet.
+// Missing files are only reported. Images are deleted before their files,
+// like the API does, and a failed deletion does not stop the others; the
+// failures are joined in the error.
+func Collect(ctx context.Context, db *sql.DB, store storage.Storage,
+	minAge time.Duration, dryRun bool) (Report, error) {
+	var report Report
+	files, err := store.List(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to list files: %v", err)
+	}
+	imageList, err := images.GetImages(db, ctx)
+	if err != nil {
+		return report, err
+	}
+	linked, err := images.GetLinkedImages(db, ctx)
+	if err != nil {
+		return report, err
+	}
+	texts, err := posts.GetTexts(db, ctx)
+	if err != nil {
+		return report, err
+	}
+	referenced := make(map[string]bool)
+	for _, text := range texts {
+		for _, name := range images.References(text) {
+			referenced[name] = true
+		}
+	}
+	stored := make(map[string]bool, len(files))
+	for _, file := range files {
+		stored[file.Name] = true
+	}
+
+	owned := make(map[string]bool)
+	for _, image := range imageList {
+		used := linked[image.Id]
+		for _, name := range image.Files() {
+			owned[name] = true
+			if !stored[name] {
+				report.Missing = append(report.Missing, name)
+			}
+			used = used || referenced[name]
+		}
+		if !used && time.Since(image.Created) >= minAge {
+			report.Unused = append(report.Unused, image)
+		}
+	}
+	for _, file := range files {
+		if !imaging.ContentName(file.Name) && !strings.HasPrefix(file.Name, storage.TempPrefix) {
+			continue
+		}
+		if !owned[file.Name] && time.Since(file.Modified) >= minAge {
+			report.Stray = append(report.Stray, file)
+		}
+	}
+	if dryRun {
+		return report, nil
+	}
+
+	// Images with the same content share their files, which are only
+	// deleted with the last of them.
+	kept := make(map[string]bool)
+	unused := make(map[int]bool, len(report.Unused))
+	for _, image := range report.Unused {
+		unused[image.Id] = true
+	}
+	for _, image := range imageList {
+		if !unused[image.Id] {
+			for _, name := range image.Files() {
+				kept[name] = true
+			}
+		}
+	}
+
+	var errs []error
+	for _, file := range report.Stray {
+		err = store.Delete(ctx, file.Name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove file %s: %v", file.Name, err))
+		}
+	}
+	var deleted []images.Image
+	for _, image := range report.Unused {
+		err = images.DeleteImage(db, ctx, image.Id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete image %d: %v", image.Id, err))
+			for _, name := range image.Files() {
+				kept[name] = true
+			}
+			continue
+		}
+		deleted = append(deleted, image)
+	}
+	for _, image := range deleted {
+		for _, name := range image.Files() {
+			if kept[name] {
+				continue
+			}
+			err = store.Delete(ctx, name)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to remove file %s: %v", name, err))
+			}
+		}
+	}
+	return report, errors.Join(errs...)
+}
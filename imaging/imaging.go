@@ -0,0 +1,161 @@
+package imaging
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxOriginal is the longest original file name that is kept.
+const MaxOriginal = 255
+
+// Extensions maps the accepted MIME types to the extensions of the files
+// they are stored in.
+var Extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// contentName matches the names Process and Scale give files: the hash
+// of the content, the width of scaled copies and the extension.
+var contentName = regexp.MustCompile(`^[0-9a-f]{64}(?:-[0-9]+)?(\.[a-z]+)$`)
+
+// ContentName reports whether name is made from the content of an image
+// like the names of the files that the blog stores.
+func ContentName(name string) bool {
+	match := contentName.FindStringSubmatch(name)
+	if match == nil {
+		return false
+	}
+	for _, extension := range Extensions {
+		if match[1] == extension {
+			return true
+		}
+	}
+	return false
+}
+
+// formats maps the accepted MIME types to the names of their decoders.
+var formats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+var (
+	ErrType     = errors.New("unsupported image type")
+	ErrTooLarge = errors.New("image too large")
+	ErrInvalid  = errors.New("invalid image")
+)
+
+// Limits are the largest images that are accepted. MaxSize is in bytes
+// and MaxDimension is the largest width and height in pixels.
+type Limits struct {
+	MaxSize      int64
+	MaxDimension int
+}
+
+// Image is an uploaded image that is safe to store and serve. Name is
+// made from the content, so the same image always gets the same name.
+type Image struct {
+	Name   string
+	Type   string
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// Process checks that data is a JPEG, PNG or GIF image within the limits
+// and removes its metadata, such as EXIF, and anything after its end.
+// The type is sniffed from the content, never taken from the client.
+// JPEG images rotated with an EXIF orientation are turned upright, since
+// the orientation is removed along with the rest of the metadata.
+func Process(data []byte, limits Limits) (Image, error) {
+	if int64(len(data)) > limits.MaxSize {
+		return Image{}, ErrTooLarge
+	}
+	mimeType := http.DetectContentType(data)
+	if _, ok := Extensions[mimeType]; !ok {
+		return Image{}, ErrType
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != formats[mimeType] {
+		return Image{}, ErrInvalid
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return Image{}, ErrInvalid
+	}
+	if config.Width > limits.MaxDimension || config.Height > limits.MaxDimension {
+		return Image{}, ErrTooLarge
+	}
+
+	var clean []byte
+	orientation := 1
+	switch mimeType {
+	case "image/jpeg":
+		clean, orientation, err = stripJPEG(data)
+	case "image/png":
+		clean, err = stripPNG(data)
+	case "image/gif":
+		clean, err = stripGIF(data)
+	}
+	if err != nil {
+		return Image{}, ErrInvalid
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(clean))
+	if err != nil {
+		return Image{}, ErrInvalid
+	}
+	if orientation != 1 {
+		var buf bytes.Buffer
+		decoded = orient(decoded, orientation)
+		err = jpeg.Encode(&buf, decoded, &jpeg.Options{Quality: 90})
+		if err != nil {
+			return Image{}, err
+		}
+		clean = buf.Bytes()
+	}
+
+	sum := sha256.Sum256(clean)
+	bounds := decoded.Bounds()
+	return Image{
+		Name:   hex.EncodeToString(sum[:]) + Extensions[mimeType],
+		Type:   mimeType,
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+		Data:   clean,
+	}, nil
+}
+
+// Original returns the base name of an uploaded file without control
+// characters and cut to MaxOriginal runes, so that it is safe to show.
+func Original(filename string) string {
+	filename = filepath.Base(strings.ReplaceAll(filename, "\\", "/"))
+	if filename == "." || filename == "/" {
+		return ""
+	}
+	filename = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || !unicode.IsPrint(r) {
+			return -1
+		}
+		return r
+	}, filename)
+	if utf8.RuneCountInString(filename) > MaxOriginal {
+		filename = string([]rune(filename)[:MaxOriginal])
+	}
+	return filename
+}
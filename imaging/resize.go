@@ -0,0 +1,90 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ThumbnailWidth is the width of the thumbnails in the gallery.
+	ThumbnailWidth = 320
+	// MediumWidth is the width of the images in posts.
+	MediumWidth = 960
+)
+
+// Scale returns a copy of the image scaled down to width, keeping the
+// aspect ratio, and named after the image and the width. It reports
+// false if the image is not wider than width. JPEG images are scaled to
+// JPEG and others to PNG; animated GIFs keep only their first frame.
+func Scale(img Image, width int) (Image, bool, error) {
+	if img.Width <= width {
+		return Image{}, false, nil
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return Image{}, false, ErrInvalid
+	}
+	height := max(1, (img.Height*width+img.Width/2)/img.Width)
+	scaled := resize(decoded, width, height)
+
+	var buf bytes.Buffer
+	mimeType := img.Type
+	if mimeType == "image/jpeg" {
+		err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 85})
+	} else {
+		mimeType = "image/png"
+		err = png.Encode(&buf, scaled)
+	}
+	if err != nil {
+		return Image{}, false, err
+	}
+
+	base := strings.TrimSuffix(img.Name, Extensions[img.Type])
+	return Image{
+		Name:   base + "-" + strconv.Itoa(width) + Extensions[mimeType],
+		Type:   mimeType,
+		Width:  width,
+		Height: height,
+		Data:   buf.Bytes(),
+	}, true, nil
+}
+
+// resize scales src down to width by height pixels. Every pixel of the
+// result is the average of the source pixels it covers, which keeps
+// fine detail from turning into noise the way sampling would.
+func resize(src image.Image, width, height int) image.Image {
+	b := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	sw, sh := b.Dx(), b.Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, max((y+1)*sh/height, y*sh/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, max((x+1)*sw/width, x*sw/width+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					bl += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n), G: uint8(g / n), B: uint8(bl / n), A: uint8(a / n),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,270 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+)
+
+var errFormat = errors.New("malformed image")
+
+// stripJPEG removes the metadata segments of a JPEG image and returns it
+// with its EXIF orientation, or 1 if it has none. JFIF (APP0), ICC
+// profile (APP2) and Adobe (APP14) segments are kept since they affect
+// how the image looks; other application segments and comments go.
+func stripJPEG(data []byte) ([]byte, int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, errFormat
+	}
+	out := []byte{0xFF, 0xD8}
+	orientation := 1
+	i := 2
+	for {
+		if i+1 >= len(data) || data[i] != 0xFF {
+			return nil, 0, errFormat
+		}
+		for i+1 < len(data) && data[i+1] == 0xFF {
+			i++
+		}
+		if i+1 >= len(data) {
+			return nil, 0, errFormat
+		}
+		marker := data[i+1]
+		i += 2
+		if marker == 0xD9 {
+			return append(out, 0xFF, 0xD9), orientation, nil
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out = append(out, 0xFF, marker)
+			continue
+		}
+
+		if i+2 > len(data) {
+			return nil, 0, errFormat
+		}
+		n := int(binary.BigEndian.Uint16(data[i:]))
+		if n < 2 || i+n > len(data) {
+			return nil, 0, errFormat
+		}
+		segment := data[i : i+n]
+		i += n
+		if marker == 0xE1 && bytes.HasPrefix(segment[2:], []byte("Exif\x00\x00")) {
+			orientation = exifOrientation(segment[8:])
+		}
+		isApp := marker >= 0xE0 && marker <= 0xEF
+		if marker == 0xFE || (isApp && marker != 0xE0 && marker != 0xE2 && marker != 0xEE) {
+			continue
+		}
+		out = append(out, 0xFF, marker)
+		out = append(out, segment...)
+
+		if marker == 0xDA {
+			// Entropy-coded data follows the scan header up to the
+			// next marker. 0xFF bytes in it are followed by 0x00 or
+			// a restart marker.
+			start := i
+			for i+1 < len(data) {
+				if data[i] == 0xFF && data[i+1] != 0x00 &&
+					(data[i+1] < 0xD0 || data[i+1] > 0xD7) {
+					break
+				}
+				i++
+			}
+			if i+1 >= len(data) {
+				return nil, 0, errFormat
+			}
+			out = append(out, data[start:i]...)
+		}
+	}
+}
+
+// exifOrientation reads the orientation tag from the TIFF structure of
+// an EXIF segment. It returns 1, upright, if there is no valid tag.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for j := 0; j < count; j++ {
+		entry := offset + 2 + j*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		tag := order.Uint16(tiff[entry:])
+		kind := order.Uint16(tiff[entry+2:])
+		if tag == 0x0112 && kind == 3 {
+			value := int(order.Uint16(tiff[entry+8:]))
+			if value >= 1 && value <= 8 {
+				return value
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orient turns an image with an EXIF orientation upright.
+func orient(src image.Image, orientation int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			dst.Set(x, y, color.RGBAModel.Convert(src.At(b.Min.X+sx, b.Min.Y+sy)))
+		}
+	}
+	return dst
+}
+
+// pngMetadata are the PNG chunks with text, EXIF and time stamps.
+var pngMetadata = map[string]bool{
+	"tEXt": true, "zTXt": true, "iTXt": true, "eXIf": true, "tIME": true,
+}
+
+// stripPNG removes the metadata chunks of a PNG image.
+func stripPNG(data []byte) ([]byte, error) {
+	signature := []byte("\x89PNG\r\n\x1a\n")
+	if !bytes.HasPrefix(data, signature) {
+		return nil, errFormat
+	}
+	out := append([]byte{}, signature...)
+	i := len(signature)
+	for {
+		if i+8 > len(data) {
+			return nil, errFormat
+		}
+		n := int(binary.BigEndian.Uint32(data[i:]))
+		kind := string(data[i+4 : i+8])
+		end := i + 12 + n
+		if n < 0 || end > len(data) {
+			return nil, errFormat
+		}
+		if !pngMetadata[kind] {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+		if kind == "IEND" {
+			return out, nil
+		}
+	}
+}
+
+// stripGIF removes the comments and application extensions of a GIF
+// image, except the ones that make animations loop.
+func stripGIF(data []byte) ([]byte, error) {
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return nil, errFormat
+	}
+	i := 13
+	if data[10]&0x80 != 0 {
+		i += 3 << (data[10]&0x07 + 1)
+	}
+	if i > len(data) {
+		return nil, errFormat
+	}
+	out := append([]byte{}, data[:i]...)
+	for {
+		if i >= len(data) {
+			return nil, errFormat
+		}
+		start := i
+		switch data[i] {
+		case 0x3B:
+			return append(out, 0x3B), nil
+		case 0x21:
+			if i+2 > len(data) {
+				return nil, errFormat
+			}
+			label := data[i+1]
+			end, err := gifBlocks(data, i+2)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			if label == 0xFE {
+				continue
+			}
+			if label == 0xFF && !gifLoop(data[start+2:end]) {
+				continue
+			}
+			out = append(out, data[start:end]...)
+		case 0x2C:
+			if i+10 > len(data) {
+				return nil, errFormat
+			}
+			i += 10
+			if data[i-1]&0x80 != 0 {
+				i += 3 << (data[i-1]&0x07 + 1)
+			}
+			// The LZW minimum code size precedes the data blocks.
+			i++
+			end, err := gifBlocks(data, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			out = append(out, data[start:end]...)
+		default:
+			return nil, errFormat
+		}
+	}
+}
+
+// gifBlocks returns the end of the data sub-blocks starting at i.
+func gifBlocks(data []byte, i int) (int, error) {
+	for {
+		if i >= len(data) {
+			return 0, errFormat
+		}
+		n := int(data[i])
+		i += 1 + n
+		if n == 0 {
+			return i, nil
+		}
+	}
+}
+
+// gifLoop reports whether the sub-blocks of an application extension
+// are the Netscape looping extension.
+func gifLoop(blocks []byte) bool {
+	return len(blocks) >= 12 && blocks[0] == 11 &&
+		(string(blocks[1:12]) == "NETSCAPE2.0" || string(blocks[1:12]) == "ANIMEXTS1.0")
+}
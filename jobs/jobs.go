@@ -0,0 +1,53 @@
+package jobs
+
+import (
+	"blog/app"
+	"blog/db/posts"
+	"blog/gc"
+	"context"
+	"time"
+)
+
+// Every runs the job for the App once and then at every interval until
+// ctx is done. Errors are logged and do not stop the schedule.
+func Every(ctx context.Context, a *app.App, interval time.Duration, name string,
+	job func(ctx context.Context, a *app.App) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := job(ctx, a)
+		if err != nil {
+			a.Logger.Error("job failed", "job", name, "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Publish publishes the scheduled posts that are due.
+func Publish(ctx context.Context, a *app.App) error {
+	n, err := posts.PublishDue(a.DB, ctx)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		a.Logger.Info("published scheduled posts", "count", n)
+	}
+	return nil
+}
+
+// CollectGarbage deletes the image files and images that nothing uses.
+func CollectGarbage(ctx context.Context, a *app.App) error {
+	report, err := gc.Collect(ctx, a.DB, a.Storage, a.Config.GCMinAge, false)
+	if len(report.Stray) > 0 || len(report.Unused) > 0 {
+		a.Logger.Info("collected garbage",
+			"stray_files", len(report.Stray), "unused_images", len(report.Unused))
+	}
+	if len(report.Missing) > 0 {
+		a.Logger.Warn("images are missing files", "files", report.Missing)
+	}
+	return err
+}
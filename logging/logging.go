@@ -0,0 +1,150 @@
+// Package logging logs requests with log/slog. Every request gets an ID,
+// which is sent back in the X-Request-ID header and added to the logger
+// that handlers find in the context of the request, so that what they
+// log can be told apart from what other requests log.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// RequestIDHeader carries the ID of a request. An ID given by a client
+// or a proxy in front of the blog is kept if it is well-formed.
+const RequestIDHeader = "X-Request-ID"
+
+// New returns a logger that writes to w in the format, FormatText or
+// FormatJSON.
+func New(w io.Writer, format string) (*slog.Logger, error) {
+	switch format {
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, nil)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, nil)), nil
+	}
+	return nil, fmt.Errorf("unknown log format: %s", format)
+}
+
+type contextKey struct{}
+
+// request is what the middleware knows about a request. Handlers fill
+// in the user through SetUser.
+type request struct {
+	logger *slog.Logger
+	userId int
+}
+
+// FromContext returns the logger of the request with the context, or
+// the default logger outside of requests.
+func FromContext(ctx context.Context) *slog.Logger {
+	req, ok := ctx.Value(contextKey{}).(*request)
+	if !ok {
+		return slog.Default()
+	}
+	return req.logger
+}
+
+// SetUser records the user a request is made by for its access log.
+func SetUser(ctx context.Context, userId int) {
+	req, ok := ctx.Value(contextKey{}).(*request)
+	if ok {
+		req.userId = userId
+	}
+}
+
+// Middleware gives every request an ID and a logger in its context, and
+// logs the method, path, status, duration and user of the request once
+// it is served. Responses with a 5xx status are logged as errors.
+func Middleware(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if !validID(id) {
+			id = newID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		req := &request{logger: logger.With("request_id", id)}
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), contextKey{}, req)))
+
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("duration", time.Since(start)),
+			slog.Int("bytes", sw.size),
+		}
+		if req.userId != 0 {
+			attrs = append(attrs, slog.Int("user_id", req.userId))
+		}
+		req.logger.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// validID reports whether id is short and only made of letters, digits
+// and -._ so that it is safe to log and send back.
+func validID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '.' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func newID() string {
+	data := make([]byte, 8)
+	rand.Read(data)
+	return hex.EncodeToString(data)
+}
+
+// statusWriter remembers the status and size of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.size += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -1,43 +1,135 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 
-	"blog/api"
+	"blog/app"
 	"blog/config"
-	"blog/web"
+	"blog/db/auth"
+	"blog/gc"
+	"blog/jobs"
+	"blog/migrations"
+	"blog/policy"
+	"blog/server"
+)
 
-	_ "blog/docs"
+func migrate(a *app.App, ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: blog migrate up|down [steps]|status")
+	}
+	switch args[0] {
+	case "up":
+		done, err := migrations.Up(a.DB, ctx)
+		for _, migration := range done {
+			log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			log.Println("Database is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+		}
+		done, err := migrations.Down(a.DB, ctx, steps)
+		for _, migration := range done {
+			log.Printf("Reverted migration %04d_%s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+	case "status":
+		statuses, err := migrations.GetStatus(a.DB, ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.Applied != nil {
+				applied = "applied " + status.Applied.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, applied)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command: %s", args[0])
+	}
+	return nil
+}
 
-	httpSwagger "github.com/swaggo/http-swagger"
-)
+// collect runs the gc command, which reports the image files and images
+// that nothing uses and deletes them unless -dry-run is given.
+func collect(a *app.App, ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("gc", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "Only report what would be deleted")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	pending, err := migrations.Pending(a.DB, ctx)
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return fmt.Errorf("database has %d pending migrations, run \"blog migrate up\" first", pending)
+	}
+	report, err := gc.Collect(ctx, a.DB, a.Storage, a.Config.GCMinAge, *dryRun)
+	for _, file := range report.Stray {
+		fmt.Printf("stray\t%s\t%d bytes\n", file.Name, file.Size)
+	}
+	for _, name := range report.Missing {
+		fmt.Printf("missing\t%s\n", name)
+	}
+	for _, image := range report.Unused {
+		fmt.Printf("unused\t%s\timage %d\n", image.Name, image.Id)
+	}
+	if *dryRun {
+		log.Println("Dry run found", report)
+	} else {
+		log.Println("Deleted", len(report.Stray), "stray files and", len(report.Unused), "unused images")
+	}
+	return err
+}
 
 func main() {
-	ip := flag.String("ip", "localhost", "IP address to bind to")
-	port := flag.String("port", "8080", "Port to listen on")
-	secret := flag.String("secret", "secret", "Secret key for authentication")
-	dbfile := flag.String("dbfile", "blog.db", "Path to the database file")
+	configFile := flag.String("config", os.Getenv("BLOG_CONFIG"),
+		"Path to a TOML or YAML config file, BLOG_CONFIG by default")
 	init := flag.Bool("init", false, "Initialize the application")
-
+	admin := flag.String("admin", "", "Grant the admin role to the user and exit")
+	flags := config.Flags(flag.CommandLine)
 	flag.Parse()
 
-	config.IP = *ip
-	config.Port = *port
-	config.SecretStr = *secret
-	config.DBFile = *dbfile
-
-	err := config.Setup()
+	cfg, err := config.Load(*configFile, os.LookupEnv, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	a, err := app.New(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer config.DB.Close()
+	defer a.Close()
+	// Messages of the log package go to the logger of the App too, so
+	// that all logs have the same format.
+	slog.SetDefault(a.Logger)
 
+	ctx := context.Background()
 	if *init {
-		err = config.Reset()
+		err = a.Reset(ctx)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -45,32 +137,79 @@ func main() {
 		os.Exit(0)
 	}
 
-	var srv http.Server
+	if flag.NArg() > 0 {
+		switch flag.Arg(0) {
+		case "migrate":
+			err = migrate(a, ctx, flag.Args()[1:])
+		case "gc":
+			err = collect(a, ctx, flag.Args()[1:])
+		default:
+			err = fmt.Errorf("unknown command: %s", flag.Arg(0))
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
 
-	rootMux := http.NewServeMux()
-	apiMux := api.ServeMux()
-	webMux := web.ServeMux()
-	rootMux.Handle("/", http.RedirectHandler("/web/posts/get", http.StatusSeeOther))
-	rootMux.Handle("/api/", http.StripPrefix("/api", apiMux))
-	rootMux.Handle("/web/", http.StripPrefix("/web", webMux))
-	rootMux.Handle("/swagger/", httpSwagger.WrapHandler)
+	pending, err := migrations.Pending(a.DB, ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if pending > 0 {
+		log.Fatalf("Database has %d pending migrations, run \"blog migrate up\" first", pending)
+	}
+
+	if *admin != "" {
+		user, err := auth.GetUser(a.DB, ctx, *admin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = auth.SetRole(a.DB, ctx, user.Id, policy.RoleAdmin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("User", user.Username, "is now an admin")
+		os.Exit(0)
+	}
+
+	// Requests get their contexts from baseCtx, which is canceled to
+	// abort their queries if they do not finish in time on shutdown.
+	baseCtx, cancelRequests := context.WithCancel(ctx)
+	defer cancelRequests()
+	srv := server.New(a)
+	srv.BaseContext = func(net.Listener) context.Context { return baseCtx }
+
+	jobCtx, stopJobs := context.WithCancel(ctx)
+	defer stopJobs()
+	go jobs.Every(jobCtx, a, cfg.PublishInterval, "publisher", jobs.Publish)
+	if cfg.GCInterval > 0 {
+		go jobs.Every(jobCtx, a, cfg.GCInterval, "garbage collector", jobs.CollectGarbage)
+	}
 
 	idleClosed := make(chan struct{})
 	go func() {
 		sigint := make(chan os.Signal, 1)
 		signal.Notify(sigint, os.Interrupt)
-		log.Println("Server is running at", config.Host)
+		a.Logger.Info("server is running", "url", cfg.Host())
 		<-sigint
-		err = srv.Shutdown(config.Ctx)
+		stopJobs()
+		shutdownCtx := ctx
+		if cfg.ShutdownTimeout > 0 {
+			var cancel context.CancelFunc
+			shutdownCtx, cancel = context.WithTimeout(ctx, cfg.ShutdownTimeout)
+			defer cancel()
+		}
+		err := srv.Shutdown(shutdownCtx)
 		if err != nil {
-			log.Println(err)
+			a.Logger.Error("requests did not finish in time", "err", err)
+			cancelRequests()
+			srv.Close()
 		}
 		close(idleClosed)
-		log.Println("Server is shutting down")
+		a.Logger.Info("server is shutting down")
 	}()
 
-	srv.Addr = config.Addr
-	srv.Handler = rootMux
 	err = srv.ListenAndServe()
 	if err != nil && err != http.ErrServerClosed {
 		log.Fatal(err)
@@ -0,0 +1,8 @@
+DROP VIEW IF EXISTS post_view;
+DROP TABLE IF EXISTS images;
+DROP TABLE IF EXISTS post_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS likes;
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS users;
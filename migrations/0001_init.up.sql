@@ -1,13 +1,3 @@
-DROP TABLE IF EXISTS users;
-DROP TABLE IF EXISTS posts;
-DROP TABLE IF EXISTS likes;
-DROP TABLE IF EXISTS comments;
-DROP TABLE IF EXISTS tags;
-DROP TABLE IF EXISTS post_tags;
-DROP TABLE IF EXISTS images;
-DROP VIEW IF EXISTS post_view;
-
-PRAGMA foreign_keys = ON;
 
 CREATE TABLE users (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -70,4 +60,4 @@ CREATE TABLE images (
     name TEXT NOT NULL UNIQUE,
     created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (user_id) REFERENCES users(id)
-);
\ No newline at end of file
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS refresh_tokens_family;
+DROP TABLE IF EXISTS refresh_tokens;
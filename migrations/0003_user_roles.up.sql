@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN
+    role TEXT CHECK(role IN ('user', 'moderator', 'admin')) NOT NULL DEFAULT 'user';
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS post_search_author;
+DROP TRIGGER IF EXISTS post_search_tag_delete;
+DROP TRIGGER IF EXISTS post_search_tag_insert;
+DROP TRIGGER IF EXISTS post_search_delete;
+DROP TRIGGER IF EXISTS post_search_update;
+DROP TRIGGER IF EXISTS post_search_insert;
+DROP TABLE IF EXISTS post_search;
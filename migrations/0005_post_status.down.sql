@@ -0,0 +1,12 @@
+DROP VIEW post_view;
+DROP INDEX IF EXISTS posts_scheduled;
+ALTER TABLE posts DROP COLUMN publish_at;
+ALTER TABLE posts DROP COLUMN status;
+
+CREATE VIEW post_view AS
+SELECT posts.*, users.username,
+    (SELECT COUNT(*) FROM likes WHERE likes.post_id = posts.id AND likes.type = 'like') -
+    (SELECT COUNT(*) FROM likes WHERE likes.post_id = posts.id AND likes.type = 'dislike'),
+    (SELECT COUNT(*) FROM comments WHERE comments.post_id = posts.id)
+    FROM posts JOIN users ON posts.user_id = users.id
+    ORDER BY posts.created DESC;
@@ -0,0 +1,15 @@
+ALTER TABLE posts ADD COLUMN
+    status TEXT CHECK(status IN ('draft', 'scheduled', 'published')) NOT NULL DEFAULT 'published';
+ALTER TABLE posts ADD COLUMN publish_at DATETIME;
+
+CREATE INDEX posts_scheduled ON posts (publish_at) WHERE status = 'scheduled';
+
+DROP VIEW post_view;
+CREATE VIEW post_view AS
+SELECT posts.id, posts.title, posts.text, posts.user_id, posts.created, users.username,
+    (SELECT COUNT(*) FROM likes WHERE likes.post_id = posts.id AND likes.type = 'like') -
+    (SELECT COUNT(*) FROM likes WHERE likes.post_id = posts.id AND likes.type = 'dislike'),
+    (SELECT COUNT(*) FROM comments WHERE comments.post_id = posts.id),
+    posts.status, posts.publish_at
+    FROM posts JOIN users ON posts.user_id = users.id
+    ORDER BY posts.created DESC;
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS post_revision_update;
+DROP TRIGGER IF EXISTS post_revision_insert;
+DROP INDEX IF EXISTS post_revisions_post;
+DROP TABLE IF EXISTS post_revisions;
+ALTER TABLE posts DROP COLUMN editor_id;
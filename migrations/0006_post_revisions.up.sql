@@ -0,0 +1,28 @@
+ALTER TABLE posts ADD COLUMN editor_id INT;
+
+CREATE TABLE post_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INT NOT NULL,
+    user_id INT NOT NULL,
+    title TEXT NOT NULL,
+    text TEXT NOT NULL,
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX post_revisions_post ON post_revisions (post_id);
+
+INSERT INTO post_revisions (post_id, user_id, title, text, created)
+SELECT id, user_id, title, text, created FROM posts;
+
+CREATE TRIGGER post_revision_insert AFTER INSERT ON posts BEGIN
+    INSERT INTO post_revisions (post_id, user_id, title, text)
+    VALUES (new.id, new.user_id, new.title, new.text);
+END;
+
+CREATE TRIGGER post_revision_update AFTER UPDATE OF title, text ON posts
+    WHEN old.title != new.title OR old.text != new.text BEGIN
+    INSERT INTO post_revisions (post_id, user_id, title, text)
+    VALUES (new.id, COALESCE(new.editor_id, new.user_id), new.title, new.text);
+END;
@@ -0,0 +1,28 @@
+DROP INDEX IF EXISTS comments_parent;
+
+-- SQLite cannot drop a column used in a foreign key,
+-- so the table is rebuilt without the thread columns.
+DROP VIEW post_view;
+
+CREATE TABLE comments_flat (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INT NOT NULL,
+    user_id INT NOT NULL,
+    text TEXT NOT NULL,
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+INSERT INTO comments_flat (id, post_id, user_id, text, created)
+SELECT id, post_id, user_id, text, created FROM comments;
+DROP TABLE comments;
+ALTER TABLE comments_flat RENAME TO comments;
+
+CREATE VIEW post_view AS
+SELECT posts.id, posts.title, posts.text, posts.user_id, posts.created, users.username,
+    (SELECT COUNT(*) FROM likes WHERE likes.post_id = posts.id AND likes.type = 'like') -
+    (SELECT COUNT(*) FROM likes WHERE likes.post_id = posts.id AND likes.type = 'dislike'),
+    (SELECT COUNT(*) FROM comments WHERE comments.post_id = posts.id),
+    posts.status, posts.publish_at
+    FROM posts JOIN users ON posts.user_id = users.id
+    ORDER BY posts.created DESC;
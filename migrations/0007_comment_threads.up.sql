@@ -0,0 +1,4 @@
+ALTER TABLE comments ADD COLUMN parent_id INT REFERENCES comments(id) ON DELETE CASCADE;
+ALTER TABLE comments ADD COLUMN depth INT NOT NULL DEFAULT 0;
+
+CREATE INDEX comments_parent ON comments (parent_id);
@@ -0,0 +1,8 @@
+CREATE TABLE comment_likes (
+    comment_id INT NOT NULL,
+    user_id INT NOT NULL,
+    type TEXT CHECK(type IN ('like', 'dislike')) NOT NULL,
+    PRIMARY KEY (comment_id, user_id),
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
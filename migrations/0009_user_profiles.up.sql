@@ -0,0 +1,9 @@
+CREATE TABLE profiles (
+    user_id INTEGER PRIMARY KEY,
+    display_name TEXT NOT NULL DEFAULT '',
+    bio TEXT NOT NULL DEFAULT '',
+    avatar_id INT,
+    website TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (avatar_id) REFERENCES images(id) ON DELETE SET NULL
+);
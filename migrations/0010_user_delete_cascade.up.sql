@@ -0,0 +1,158 @@
+-- SQLite cannot change foreign keys in place, so every table that
+-- references users is rebuilt with ON DELETE CASCADE. Migrations run
+-- with foreign keys off, which keeps the rows of the referencing
+-- tables while their parents are rebuilt.
+DROP VIEW post_view;
+DROP TRIGGER post_search_author;
+
+CREATE TABLE posts_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL,
+    text TEXT NOT NULL,
+    user_id INT NOT NULL,
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    status TEXT CHECK(status IN ('draft', 'scheduled', 'published')) NOT NULL DEFAULT 'published',
+    publish_at DATETIME,
+    editor_id INT,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO posts_new (id, title, text, user_id, created, status, publish_at, editor_id)
+SELECT id, title, text, user_id, created, status, publish_at, editor_id FROM posts;
+DROP TABLE posts;
+ALTER TABLE posts_new RENAME TO posts;
+
+CREATE TABLE likes_new (
+    post_id INT NOT NULL,
+    user_id INT NOT NULL,
+    type TEXT CHECK(type IN ('like', 'dislike')) NOT NULL,
+    PRIMARY KEY (post_id, user_id),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO likes_new (post_id, user_id, type)
+SELECT post_id, user_id, type FROM likes;
+DROP TABLE likes;
+ALTER TABLE likes_new RENAME TO likes;
+
+CREATE TABLE comments_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INT NOT NULL,
+    user_id INT NOT NULL,
+    text TEXT NOT NULL,
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    parent_id INT REFERENCES comments(id) ON DELETE CASCADE,
+    depth INT NOT NULL DEFAULT 0,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO comments_new (id, post_id, user_id, text, created, parent_id, depth)
+SELECT id, post_id, user_id, text, created, parent_id, depth FROM comments;
+DROP TABLE comments;
+ALTER TABLE comments_new RENAME TO comments;
+
+CREATE TABLE comment_likes_new (
+    comment_id INT NOT NULL,
+    user_id INT NOT NULL,
+    type TEXT CHECK(type IN ('like', 'dislike')) NOT NULL,
+    PRIMARY KEY (comment_id, user_id),
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO comment_likes_new (comment_id, user_id, type)
+SELECT comment_id, user_id, type FROM comment_likes;
+DROP TABLE comment_likes;
+ALTER TABLE comment_likes_new RENAME TO comment_likes;
+
+CREATE TABLE images_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT NOT NULL,
+    name TEXT NOT NULL UNIQUE,
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO images_new (id, user_id, name, created)
+SELECT id, user_id, name, created FROM images;
+DROP TABLE images;
+ALTER TABLE images_new RENAME TO images;
+
+CREATE TABLE refresh_tokens_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash TEXT NOT NULL UNIQUE,
+    family TEXT NOT NULL,
+    user_id INT NOT NULL,
+    used INT NOT NULL DEFAULT 0,
+    revoked INT NOT NULL DEFAULT 0,
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO refresh_tokens_new (id, token_hash, family, user_id, used, revoked, created, expires)
+SELECT id, token_hash, family, user_id, used, revoked, created, expires FROM refresh_tokens;
+DROP TABLE refresh_tokens;
+ALTER TABLE refresh_tokens_new RENAME TO refresh_tokens;
+
+CREATE TABLE post_revisions_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INT NOT NULL,
+    user_id INT NOT NULL,
+    title TEXT NOT NULL,
+    text TEXT NOT NULL,
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO post_revisions_new (id, post_id, user_id, title, text, created)
+SELECT id, post_id, user_id, title, text, created FROM post_revisions;
+DROP TABLE post_revisions;
+ALTER TABLE post_revisions_new RENAME TO post_revisions;
+
+CREATE INDEX posts_scheduled ON posts (publish_at) WHERE status = 'scheduled';
+CREATE INDEX comments_parent ON comments (parent_id);
+CREATE INDEX refresh_tokens_family ON refresh_tokens(family);
+CREATE INDEX post_revisions_post ON post_revisions (post_id);
+
+CREATE VIEW post_view AS
+SELECT posts.id, posts.title, posts.text, posts.user_id, posts.created, users.username,
+    (SELECT COUNT(*) FROM likes WHERE likes.post_id = posts.id AND likes.type = 'like') -
+    (SELECT COUNT(*) FROM likes WHERE likes.post_id = posts.id AND likes.type = 'dislike'),
+    (SELECT COUNT(*) FROM comments WHERE comments.post_id = posts.id),
+    posts.status, posts.publish_at
+    FROM posts JOIN users ON posts.user_id = users.id
+    ORDER BY posts.created DESC;
+
+CREATE TRIGGER post_search_insert AFTER INSERT ON posts BEGIN
+    INSERT INTO post_search (docid, title, text, tags, author)
+    VALUES (new.id, new.title, new.text, '',
+        (SELECT username FROM users WHERE id = new.user_id));
+END;
+
+CREATE TRIGGER post_search_update AFTER UPDATE OF title, text ON posts BEGIN
+    UPDATE post_search SET title = new.title, text = new.text WHERE docid = new.id;
+END;
+
+CREATE TRIGGER post_search_delete AFTER DELETE ON posts BEGIN
+    DELETE FROM post_search WHERE docid = old.id;
+END;
+
+CREATE TRIGGER post_search_author AFTER UPDATE OF username ON users BEGIN
+    UPDATE post_search SET author = new.username
+        WHERE docid IN (SELECT id FROM posts WHERE user_id = new.id);
+END;
+
+CREATE TRIGGER post_revision_insert AFTER INSERT ON posts BEGIN
+    INSERT INTO post_revisions (post_id, user_id, title, text)
+    VALUES (new.id, new.user_id, new.title, new.text);
+END;
+
+CREATE TRIGGER post_revision_update AFTER UPDATE OF title, text ON posts
+    WHEN old.title != new.title OR old.text != new.text BEGIN
+    INSERT INTO post_revisions (post_id, user_id, title, text)
+    VALUES (new.id, COALESCE(new.editor_id, new.user_id), new.title, new.text);
+END;
+
+-- Posts handed over to another user, such as the placeholder of
+-- deleted accounts, are searchable by the name of their new author.
+CREATE TRIGGER post_search_owner AFTER UPDATE OF user_id ON posts BEGIN
+    UPDATE post_search SET author = (SELECT username FROM users WHERE id = new.user_id)
+        WHERE docid = new.id;
+END;
@@ -0,0 +1,5 @@
+ALTER TABLE images DROP COLUMN height;
+ALTER TABLE images DROP COLUMN width;
+ALTER TABLE images DROP COLUMN size;
+ALTER TABLE images DROP COLUMN type;
+ALTER TABLE images DROP COLUMN original;
@@ -0,0 +1,7 @@
+ALTER TABLE images ADD COLUMN original TEXT NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN type TEXT NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN width INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
+
+UPDATE images SET original = name;
@@ -0,0 +1,6 @@
+ALTER TABLE images DROP COLUMN medium_height;
+ALTER TABLE images DROP COLUMN medium_width;
+ALTER TABLE images DROP COLUMN medium;
+ALTER TABLE images DROP COLUMN thumbnail_height;
+ALTER TABLE images DROP COLUMN thumbnail_width;
+ALTER TABLE images DROP COLUMN thumbnail;
@@ -0,0 +1,6 @@
+ALTER TABLE images ADD COLUMN thumbnail TEXT NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN thumbnail_width INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN thumbnail_height INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN medium TEXT NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN medium_width INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN medium_height INTEGER NOT NULL DEFAULT 0;
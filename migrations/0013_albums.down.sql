@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS post_images;
+DROP TABLE IF EXISTS album_images;
+DROP TABLE IF EXISTS albums;
@@ -0,0 +1,28 @@
+CREATE TABLE images_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT NOT NULL,
+    name TEXT NOT NULL,
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    original TEXT NOT NULL DEFAULT '',
+    type TEXT NOT NULL DEFAULT '',
+    size INTEGER NOT NULL DEFAULT 0,
+    width INTEGER NOT NULL DEFAULT 0,
+    height INTEGER NOT NULL DEFAULT 0,
+    thumbnail TEXT NOT NULL DEFAULT '',
+    thumbnail_width INTEGER NOT NULL DEFAULT 0,
+    thumbnail_height INTEGER NOT NULL DEFAULT 0,
+    medium TEXT NOT NULL DEFAULT '',
+    medium_width INTEGER NOT NULL DEFAULT 0,
+    medium_height INTEGER NOT NULL DEFAULT 0,
+    UNIQUE (user_id, name),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO images_new (id, user_id, name, created, original, type, size, width, height,
+    thumbnail, thumbnail_width, thumbnail_height, medium, medium_width, medium_height)
+SELECT id, user_id, name, created, original, type, size, width, height,
+    thumbnail, thumbnail_width, thumbnail_height, medium, medium_width, medium_height
+FROM images;
+DROP TABLE images;
+ALTER TABLE images_new RENAME TO images;
+
+CREATE INDEX images_name ON images (name);
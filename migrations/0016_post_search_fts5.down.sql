@@ -0,0 +1,56 @@
+DROP TRIGGER IF EXISTS post_search_owner;
+DROP TRIGGER IF EXISTS post_search_author;
+DROP TRIGGER IF EXISTS post_search_tag_delete;
+DROP TRIGGER IF EXISTS post_search_tag_insert;
+DROP TRIGGER IF EXISTS post_search_delete;
+DROP TRIGGER IF EXISTS post_search_update;
+DROP TRIGGER IF EXISTS post_search_insert;
+DROP TABLE IF EXISTS post_search;
+
+CREATE VIRTUAL TABLE post_search USING fts4(title, text, tags, author, tokenize=unicode61);
+
+INSERT INTO post_search (docid, title, text, tags, author)
+SELECT posts.id, posts.title, posts.text,
+    COALESCE((SELECT group_concat(tags.name, ' ') FROM post_tags
+        JOIN tags ON post_tags.tag_id = tags.id
+        WHERE post_tags.post_id = posts.id), ''),
+    users.username
+    FROM posts JOIN users ON posts.user_id = users.id;
+
+CREATE TRIGGER post_search_insert AFTER INSERT ON posts BEGIN
+    INSERT INTO post_search (docid, title, text, tags, author)
+    VALUES (new.id, new.title, new.text, '',
+        (SELECT username FROM users WHERE id = new.user_id));
+END;
+
+CREATE TRIGGER post_search_update AFTER UPDATE OF title, text ON posts BEGIN
+    UPDATE post_search SET title = new.title, text = new.text WHERE docid = new.id;
+END;
+
+CREATE TRIGGER post_search_delete AFTER DELETE ON posts BEGIN
+    DELETE FROM post_search WHERE docid = old.id;
+END;
+
+CREATE TRIGGER post_search_tag_insert AFTER INSERT ON post_tags BEGIN
+    UPDATE post_search SET tags = COALESCE((SELECT group_concat(tags.name, ' ')
+        FROM post_tags JOIN tags ON post_tags.tag_id = tags.id
+        WHERE post_tags.post_id = new.post_id), '')
+        WHERE docid = new.post_id;
+END;
+
+CREATE TRIGGER post_search_tag_delete AFTER DELETE ON post_tags BEGIN
+    UPDATE post_search SET tags = COALESCE((SELECT group_concat(tags.name, ' ')
+        FROM post_tags JOIN tags ON post_tags.tag_id = tags.id
+        WHERE post_tags.post_id = old.post_id), '')
+        WHERE docid = old.post_id;
+END;
+
+CREATE TRIGGER post_search_author AFTER UPDATE OF username ON users BEGIN
+    UPDATE post_search SET author = new.username
+        WHERE docid IN (SELECT id FROM posts WHERE user_id = new.id);
+END;
+
+CREATE TRIGGER post_search_owner AFTER UPDATE OF user_id ON posts BEGIN
+    UPDATE post_search SET author = (SELECT username FROM users WHERE id = new.user_id)
+        WHERE docid = new.id;
+END;
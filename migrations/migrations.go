@@ -0,0 +1,292 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// Migration is a pair of SQL scripts loaded from files named
+// {version}_{name}.up.sql and {version}_{name}.down.sql.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version int
+	Name    string
+	Applied *time.Time
+}
+
+func Load() ([]Migration, error) {
+	names, err := fs.Glob(files, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, filename := range names {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(filename, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration filename: %s", filename)
+		}
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration filename: %s", filename)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version: %s", filename)
+		}
+		data, err := files.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration: %v", err)
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("conflicting migration names for version %d", version)
+		}
+		if direction == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d is missing a script", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// setup creates the schema_migrations table. Databases created from the
+// old schema.sql have the tables of the first migration but no record of
+// it, so it is marked as applied for them instead of failing.
+func setup(db *sql.DB, ctx context.Context) error {
+	_, err := db.ExecContext(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %v", err)
+	}
+	var legacy bool
+	err = db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM sqlite_master
+			WHERE type = 'table' AND name = 'users')
+			AND NOT EXISTS (SELECT 1 FROM schema_migrations)`,
+	).Scan(&legacy)
+	if err != nil {
+		return err
+	}
+	if legacy {
+		_, err = db.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, name) VALUES (1, 'init')")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applied(db *sql.DB, ctx context.Context) (map[int]time.Time, error) {
+	rows, err := db.QueryContext(ctx, "SELECT version, applied FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt
+	}
+	return versions, rows.Err()
+}
+
+// run executes the script and records it in one transaction. Foreign
+// keys are turned off meanwhile, as SQLite needs for rebuilding tables
+// that other tables refer to, and checked before committing instead.
+func run(db *sql.DB, ctx context.Context, script string, record func(tx *sql.Tx) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var foreignKeys bool
+	err = conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys)
+	if err != nil {
+		return err
+	}
+	if foreignKeys {
+		_, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF")
+		if err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return err
+	}
+	err = record(tx)
+	if err != nil {
+		return err
+	}
+	if foreignKeys {
+		rows, err := tx.QueryContext(ctx, "PRAGMA foreign_key_check")
+		if err != nil {
+			return err
+		}
+		violated := rows.Next()
+		rows.Close()
+		if violated {
+			return fmt.Errorf("foreign key constraint failed")
+		}
+	}
+	return tx.Commit()
+}
+
+// Up applies all pending migrations in order and returns
+// the migrations that were applied.
+func Up(db *sql.DB, ctx context.Context) ([]Migration, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	err = setup(db, ctx)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := applied(db, ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, migration := range migrations {
+		if _, ok := versions[migration.Version]; ok {
+			continue
+		}
+		err = run(db, ctx, migration.Up, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)",
+				migration.Version, migration.Name)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("failed to apply migration %04d_%s: %v",
+				migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down reverts up to steps of the most recently applied migrations.
+// A negative number of steps reverts all of them.
+func Down(db *sql.DB, ctx context.Context, steps int) ([]Migration, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	err = setup(db, ctx)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := applied(db, ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(migrations) - 1; i >= 0 && steps != 0; i-- {
+		migration := migrations[i]
+		if _, ok := versions[migration.Version]; !ok {
+			continue
+		}
+		err = run(db, ctx, migration.Down, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx,
+				"DELETE FROM schema_migrations WHERE version = $1",
+				migration.Version)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("failed to revert migration %04d_%s: %v",
+				migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+		steps--
+	}
+	return done, nil
+}
+
+func GetStatus(db *sql.DB, ctx context.Context) ([]Status, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	err = setup(db, ctx)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := applied(db, ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(migrations))
+	for _, migration := range migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := versions[migration.Version]; ok {
+			status.Applied = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Pending reports how many migrations have not been applied yet.
+func Pending(db *sql.DB, ctx context.Context) (int, error) {
+	statuses, err := GetStatus(db, ctx)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, status := range statuses {
+		if status.Applied == nil {
+			pending++
+		}
+	}
+	return pending, nil
+}
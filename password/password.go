@@ -0,0 +1,221 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hasher hashes passwords into a self-describing encoded string
+// and verifies passwords against such strings.
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	Identify(encoded string) bool
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2id hashes passwords using argon2id and encodes them in the
+// PHC string format: $argon2id$v=19$m=65536,t=3,p=4$salt$hash
+type Argon2id struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+func NewArgon2id() Argon2id {
+	return Argon2id{Time: 3, Memory: 64 * 1024, Threads: 4, KeyLen: 32, SaltLen: 16}
+}
+
+func (a Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate salt: %v", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, a.KeyLen)
+	encoded := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Memory, a.Time, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+	return encoded, nil
+}
+
+func (a Argon2id) Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := a.decode(encoded)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(password), salt,
+		params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (a Argon2id) Identify(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (a Argon2id) NeedsRehash(encoded string) bool {
+	params, salt, key, err := a.decode(encoded)
+	if err != nil {
+		return true
+	}
+	return params.Time < a.Time || params.Memory < a.Memory ||
+		params.Threads < a.Threads || uint32(len(key)) < a.KeyLen ||
+		uint32(len(salt)) < a.SaltLen
+}
+
+func (a Argon2id) decode(encoded string) (Argon2id, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2id{}, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return Argon2id{}, nil, nil, fmt.Errorf("invalid argon2id version: %v", err)
+	}
+	if version != argon2.Version {
+		return Argon2id{}, nil, nil, fmt.Errorf("unsupported argon2id version: %d", version)
+	}
+	var params Argon2id
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d",
+		&params.Memory, &params.Time, &params.Threads)
+	if err != nil {
+		return Argon2id{}, nil, nil, fmt.Errorf("invalid argon2id parameters: %v", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2id{}, nil, nil, fmt.Errorf("invalid argon2id salt: %v", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2id{}, nil, nil, fmt.Errorf("invalid argon2id key: %v", err)
+	}
+	return params, salt, key, nil
+}
+
+// Bcrypt hashes passwords using bcrypt. The encoded form
+// carries its own $2a$/$2b$ prefix, cost and salt.
+type Bcrypt struct {
+	Cost int
+}
+
+func NewBcrypt() Bcrypt {
+	return Bcrypt{Cost: bcrypt.DefaultCost}
+}
+
+func (b Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %v", err)
+	}
+	return string(hash), nil
+}
+
+func (b Bcrypt) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to compare password: %v", err)
+	}
+	return true, nil
+}
+
+func (b Bcrypt) Identify(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+func (b Bcrypt) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return true
+	}
+	return cost < b.Cost
+}
+
+// SHA256 verifies the legacy unsalted hex(sha256(password)) hashes.
+// It is kept only so that old rows can be upgraded on login
+// and always reports that its hashes need rehashing.
+type SHA256 struct{}
+
+func (SHA256) Hash(password string) (string, error) {
+	h := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(h[:]), nil
+}
+
+func (s SHA256) Verify(password, encoded string) (bool, error) {
+	hash, _ := s.Hash(password)
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(encoded)) == 1, nil
+}
+
+func (SHA256) Identify(encoded string) bool {
+	if len(encoded) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(encoded)
+	return err == nil
+}
+
+func (SHA256) NeedsRehash(encoded string) bool {
+	return true
+}
+
+// Chain hashes new passwords with Current and verifies existing
+// hashes with whichever of Current or Legacy produced them.
+type Chain struct {
+	Current Hasher
+	Legacy  []Hasher
+}
+
+func NewChain(current Hasher, legacy ...Hasher) Chain {
+	return Chain{Current: current, Legacy: legacy}
+}
+
+func (c Chain) Hash(password string) (string, error) {
+	return c.Current.Hash(password)
+}
+
+func (c Chain) Verify(password, encoded string) (bool, error) {
+	hasher := c.find(encoded)
+	if hasher == nil {
+		return false, fmt.Errorf("unknown password hash format")
+	}
+	return hasher.Verify(password, encoded)
+}
+
+func (c Chain) Identify(encoded string) bool {
+	return c.find(encoded) != nil
+}
+
+func (c Chain) NeedsRehash(encoded string) bool {
+	if !c.Current.Identify(encoded) {
+		return true
+	}
+	return c.Current.NeedsRehash(encoded)
+}
+
+func (c Chain) find(encoded string) Hasher {
+	if c.Current.Identify(encoded) {
+		return c.Current
+	}
+	for _, hasher := range c.Legacy {
+		if hasher.Identify(encoded) {
+			return hasher
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package policy
+
+import (
+	"blog/db/auth"
+	"context"
+	"database/sql"
+	"slices"
+)
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+type Action string
+
+const (
+	EditPost      Action = "post:edit"
+	DeletePost    Action = "post:delete"
+	EditComment   Action = "comment:edit"
+	DeleteComment Action = "comment:delete"
+	DeleteImage   Action = "image:delete"
+	EditAlbum     Action = "album:edit"
+	DeleteAlbum   Action = "album:delete"
+	ManageRoles   Action = "user:role"
+	EditProfile   Action = "user:profile"
+)
+
+// grants lists the actions a role may perform on resources owned by
+// other users. Owners may always edit and delete their own resources.
+var grants = map[string][]Action{
+	RoleUser: {},
+	RoleModerator: {
+		EditPost, DeletePost,
+		EditComment, DeleteComment,
+		DeleteImage, DeleteAlbum,
+	},
+	RoleAdmin: {
+		EditPost, DeletePost,
+		EditComment, DeleteComment,
+		DeleteImage, ManageRoles,
+		EditProfile, EditAlbum, DeleteAlbum,
+	},
+}
+
+func ValidRole(role string) bool {
+	_, ok := grants[role]
+	return ok
+}
+
+// Can reports whether a user with the given id and role may perform
+// the action on a resource owned by ownerId. Pass an ownerId of 0
+// for actions that are not tied to an owned resource.
+func Can(userId int, role string, action Action, ownerId int) bool {
+	if userId == 0 {
+		return false
+	}
+	if ownerId != 0 && userId == ownerId && action != ManageRoles {
+		return true
+	}
+	return slices.Contains(grants[role], action)
+}
+
+// Authorize is like Can, but looks up the role of the user in the
+// database so that role changes take effect immediately.
+func Authorize(db *sql.DB, ctx context.Context, userId int, action Action, ownerId int) (bool, error) {
+	user, err := auth.GetUserById(db, ctx, userId)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return Can(user.Id, user.Role, action, ownerId), nil
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// MaxLockout is the longest a key stays locked.
+const MaxLockout = 24 * time.Hour
+
+// Lockout locks a key, such as a username, after too many failures in
+// a row. Once attempts failures are reached the key is locked for base,
+// and every further failure doubles the time. A success resets the key,
+// and so does going without a failure for MaxLockout. A nil Lockout or 0
+// attempts never locks.
+type Lockout struct {
+	attempts int
+	base     time.Duration
+	mu       sync.Mutex
+	keys     map[string]*lock
+	swept    time.Time
+}
+
+type lock struct {
+	failures int
+	last     time.Time
+	until    time.Time
+}
+
+func NewLockout(attempts int, base time.Duration) *Lockout {
+	return &Lockout{
+		attempts: attempts,
+		base:     base,
+		keys:     make(map[string]*lock),
+		swept:    time.Now(),
+	}
+}
+
+// Attempt reserves an attempt for the key. If the key is locked, it
+// reports false and how long the key stays locked. Otherwise the attempt
+// counts as a failure until the key is Reset, so that attempts made at
+// the same time can not get past the limit, and it reports true and how
+// long the key is locked if the attempt fails, or 0 if it is not.
+func (l *Lockout) Attempt(key string) (bool, time.Duration) {
+	if l == nil || l.attempts <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+	k, ok := l.keys[key]
+	if !ok {
+		k = &lock{}
+		l.keys[key] = k
+	}
+	if now.Before(k.until) {
+		return false, k.until.Sub(now)
+	}
+	k.failures++
+	k.last = now
+	wait := l.wait(k.failures)
+	if wait > 0 {
+		k.until = now.Add(wait)
+	}
+	return true, wait
+}
+
+// wait returns how long a key is locked after failures in a row.
+func (l *Lockout) wait(failures int) time.Duration {
+	if failures < l.attempts {
+		return 0
+	}
+	wait := l.base
+	for i := l.attempts; i < failures && wait < MaxLockout; i++ {
+		wait *= 2
+	}
+	return min(wait, MaxLockout)
+}
+
+// sweep forgets the keys that have gone without a failure for MaxLockout,
+// which are no longer locked either, once every base.
+func (l *Lockout) sweep(now time.Time) {
+	if now.Sub(l.swept) < l.base {
+		return
+	}
+	for key, k := range l.keys {
+		if now.Sub(k.last) >= MaxLockout {
+			delete(l.keys, key)
+		}
+	}
+	l.swept = now
+}
+
+// Reset forgets the failures of the key.
+func (l *Lockout) Reset(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.keys, key)
+}
@@ -0,0 +1,202 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limiter is a set of token buckets, one for every key. A bucket holds
+// up to burst tokens and is refilled at rate tokens per second, and every
+// allowed request takes a token. A nil Limiter or a rate of 0 allows
+// everything.
+type Limiter struct {
+	rate    float64
+	burst   float64
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		swept:   time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of the key. If the bucket is
+// empty, it reports false and how long it takes to get a token.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil || l.rate <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		wait := (1 - b.tokens) / l.rate
+		return false, time.Duration(wait * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets the buckets that have been refilled, which are the same
+// as new ones, once every time it takes to refill a bucket.
+func (l *Limiter) sweep(now time.Time) {
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.swept) < full {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
+
+// Middleware limits the requests that change state (POST, PUT, PATCH and
+// DELETE) by client IP, as proxies tell it, and, if user returns a key for
+// the request, by user. Requests over the limit get 429 Too Many Requests.
+func Middleware(l *Limiter, proxies Proxies, user func(r *http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ok, wait := l.Allow("ip:" + proxies.ClientIP(r).String())
+		if !ok {
+			TooManyRequests(w, "Too Many Requests", wait)
+			return
+		}
+		if user != nil {
+			if key := user(r); key != "" {
+				ok, wait := l.Allow("user:" + key)
+				if !ok {
+					TooManyRequests(w, "Too Many Requests", wait)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// TooManyRequests writes a 429 response telling the client to retry
+// after wait, rounded up to whole seconds.
+func TooManyRequests(w http.ResponseWriter, message string, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, message, http.StatusTooManyRequests)
+}
+
+// Proxies are the networks of the reverse proxies that are trusted to
+// tell the IP of their clients in the X-Forwarded-For header.
+type Proxies []*net.IPNet
+
+// ParseProxies parses a comma-separated list of IP addresses and CIDR
+// networks, such as "127.0.0.1, 10.0.0.0/8".
+func ParseProxies(list string) (Proxies, error) {
+	var proxies Proxies
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !strings.Contains(field, "/") {
+			ip := net.ParseIP(field)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy address: %s", field)
+			}
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 128
+			}
+			field += "/" + strconv.Itoa(bits)
+		}
+		_, network, err := net.ParseCIDR(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy network: %s", field)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+func (p Proxies) trusted(ip net.IP) bool {
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP of the client that made the request. That is
+// the peer of the connection, unless the peer is a trusted proxy. Then it
+// is the last address in X-Forwarded-For that is not a trusted proxy, as
+// addresses before it may have been made up by the client.
+func (p Proxies) ClientIP(r *http.Request) net.IP {
+	ip := peerIP(r)
+	if !p.trusted(ip) {
+		return ip
+	}
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !p.trusted(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+func peerIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return net.IPv4zero
+	}
+	return ip
+}
@@ -0,0 +1,70 @@
+// Package server puts the API, the web interface and the feeds of an App
+// together into one HTTP server.
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"blog/api"
+	"blog/app"
+	"blog/feed"
+	"blog/logging"
+	"blog/web"
+
+	_ "blog/docs"
+
+	httpSwagger "github.com/swaggo/http-swagger"
+)
+
+// Handler returns the root handler of the App. It logs every request
+// and gives it the request timeout of the App.
+func Handler(a *app.App) http.Handler {
+	rootMux := http.NewServeMux()
+	apiMux := api.ServeMux(a)
+	webMux := web.ServeMux(a)
+	feedMux := feed.ServeMux(a)
+	rootMux.Handle("/", http.RedirectHandler("/web/posts/get", http.StatusSeeOther))
+	rootMux.Handle("/api/", http.StripPrefix("/api", apiMux))
+	rootMux.Handle("/web/", http.StripPrefix("/web", webMux))
+	rootMux.Handle("/feed.atom", feedMux)
+	rootMux.Handle("/feed.rss", feedMux)
+	rootMux.Handle("/feed/", feedMux)
+	rootMux.Handle("/swagger/", httpSwagger.WrapHandler)
+	if a.Config.StaticDir != "" {
+		rootMux.Handle("GET /static/", http.StripPrefix("/static",
+			http.FileServer(http.Dir(a.Config.StaticDir))))
+	}
+	return logging.Middleware(a.Logger, Timeout(a.Config.RequestTimeout, rootMux))
+}
+
+// Timeout gives the context of every request a deadline after timeout,
+// 0 for none. The queries of a request that runs out of time fail with
+// context.DeadlineExceeded. Unlike http.TimeoutHandler it does not
+// buffer responses, so downloads are still streamed.
+func Timeout(timeout time.Duration, next http.Handler) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// New returns a server of the App that listens on its configured address
+// with its configured timeouts.
+func New(a *app.App) *http.Server {
+	return &http.Server{
+		Addr:              a.Config.Addr(),
+		Handler:           Handler(a),
+		ReadHeaderTimeout: a.Config.ReadHeaderTimeout,
+		ReadTimeout:       a.Config.ReadTimeout,
+		WriteTimeout:      a.Config.WriteTimeout,
+		IdleTimeout:       a.Config.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(a.Logger.Handler(), slog.LevelError),
+	}
+}
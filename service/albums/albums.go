@@ -0,0 +1,126 @@
+// Package albums performs the operations on albums and the images in
+// them.
+package albums
+
+import (
+	"blog/app"
+	"blog/db/albums"
+	"blog/db/images"
+	"blog/policy"
+	"blog/service"
+	images_service "blog/service/images"
+	"context"
+	"database/sql"
+)
+
+// Add creates an album with the name for the user and returns it.
+func Add(a *app.App, ctx context.Context, userId int, name string) (albums.Album, error) {
+	err := available(a, ctx, userId, name)
+	if err != nil {
+		return albums.Album{}, err
+	}
+	albumId, err := albums.AddAlbum(a.DB, ctx, albums.Album{AuthorId: userId, Name: name})
+	if err != nil {
+		return albums.Album{}, err
+	}
+	return albums.GetAlbum(a.DB, ctx, albumId)
+}
+
+// ForUser returns the albums of the user, sorted by name.
+func ForUser(a *app.App, ctx context.Context, userId int) ([]albums.Album, error) {
+	return albums.GetUserAlbums(a.DB, ctx, userId)
+}
+
+// Get returns the album.
+func Get(a *app.App, ctx context.Context, albumId int) (albums.Album, error) {
+	album, err := albums.GetAlbum(a.DB, ctx, albumId)
+	if err == sql.ErrNoRows {
+		return albums.Album{}, service.NotFound("Album Not Found")
+	}
+	return album, err
+}
+
+// Images returns the images in the album, newest additions first.
+func Images(a *app.App, ctx context.Context, albumId int) ([]images.Image, error) {
+	album, err := Get(a, ctx, albumId)
+	if err != nil {
+		return nil, err
+	}
+	return images.GetAlbumImages(a.DB, ctx, album.Id)
+}
+
+// Rename gives the album a new name.
+func Rename(a *app.App, ctx context.Context, userId, albumId int, name string) error {
+	album, err := authorize(a, ctx, userId, albumId, policy.EditAlbum)
+	if err != nil {
+		return err
+	}
+	if name != album.Name {
+		err = available(a, ctx, album.AuthorId, name)
+		if err != nil {
+			return err
+		}
+	}
+	return albums.RenameAlbum(a.DB, ctx, album.Id, name)
+}
+
+// Delete deletes the album. The images in it are kept.
+func Delete(a *app.App, ctx context.Context, userId, albumId int) error {
+	album, err := authorize(a, ctx, userId, albumId, policy.DeleteAlbum)
+	if err != nil {
+		return err
+	}
+	return albums.DeleteAlbum(a.DB, ctx, album.Id)
+}
+
+// AddImage puts the image into the album. Any image can be added, not
+// only the images of the album's author.
+func AddImage(a *app.App, ctx context.Context, userId, albumId, imageId int) error {
+	album, err := authorize(a, ctx, userId, albumId, policy.EditAlbum)
+	if err != nil {
+		return err
+	}
+	_, err = images_service.Get(a, ctx, imageId)
+	if err != nil {
+		return err
+	}
+	return albums.AddImage(a.DB, ctx, album.Id, imageId)
+}
+
+// RemoveImage takes the image out of the album. The image is kept.
+func RemoveImage(a *app.App, ctx context.Context, userId, albumId, imageId int) error {
+	album, err := authorize(a, ctx, userId, albumId, policy.EditAlbum)
+	if err != nil {
+		return err
+	}
+	return albums.RemoveImage(a.DB, ctx, album.Id, imageId)
+}
+
+// authorize returns the album if the user may perform the action on it.
+func authorize(a *app.App, ctx context.Context, userId, albumId int, action policy.Action) (albums.Album, error) {
+	album, err := Get(a, ctx, albumId)
+	if err != nil {
+		return albums.Album{}, err
+	}
+	err = service.Authorize(a.DB, ctx, userId, action, album.AuthorId)
+	if err != nil {
+		return albums.Album{}, err
+	}
+	return album, nil
+}
+
+// available returns an error unless the name is valid and the user has
+// no album with it.
+func available(a *app.App, ctx context.Context, userId int, name string) error {
+	if !albums.ValidName(name) {
+		return service.Invalid("Bad Request")
+	}
+	_, err := albums.GetAlbumByName(a.DB, ctx, userId, name)
+	if err == nil {
+		return service.Conflict("Album Already Exists")
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+	return nil
+}
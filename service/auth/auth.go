@@ -0,0 +1,287 @@
+// Package auth performs the operations on accounts and sessions: it
+// registers users, signs them in and out and changes their accounts.
+package auth
+
+import (
+	"blog/app"
+	"blog/db/auth"
+	"blog/db/images"
+	"blog/logging"
+	"blog/policy"
+	"blog/service"
+	images_service "blog/service/images"
+	"blog/util"
+	"context"
+	"database/sql"
+	"strconv"
+)
+
+// Register adds a user with the username and password.
+func Register(a *app.App, ctx context.Context, username, password string) error {
+	if !auth.ValidUsername(username) || password == "" {
+		return service.Invalid("Bad Request")
+	}
+	passwordHash, err := a.Hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	_, err = auth.GetUser(a.DB, ctx, username)
+	if err == nil {
+		return service.Conflict("User already exists")
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+	return auth.AddUser(a.DB, ctx, auth.User{Username: username, Password: passwordHash})
+}
+
+// Login checks the password of the user and starts a session. Users are
+// locked out for a while after too many failed logins in a row.
+func Login(a *app.App, ctx context.Context, username, password string) (util.TokenPair, error) {
+	if username == "" || password == "" {
+		return util.TokenPair{}, service.Invalid("Bad Request")
+	}
+	user, err := auth.GetUser(a.DB, ctx, username)
+	if err != nil && err != sql.ErrNoRows {
+		return util.TokenPair{}, err
+	}
+	if user.Id == 0 || user.Username == auth.DeletedUser {
+		return util.TokenPair{}, service.NotFound("User Not Found")
+	}
+	key := strconv.Itoa(user.Id)
+	allowed, wait := a.Lockout.Attempt(key)
+	if !allowed {
+		return util.TokenPair{}, service.TooMany("Too Many Failed Logins", wait)
+	}
+
+	ok, err := a.Hasher.Verify(password, user.Password)
+	if err != nil {
+		return util.TokenPair{}, err
+	}
+	if !ok {
+		if wait > 0 {
+			return util.TokenPair{}, service.TooMany("Too Many Failed Logins", wait)
+		}
+		return util.TokenPair{}, service.Unauthorized("Invalid Password")
+	}
+	a.Lockout.Reset(key)
+
+	if a.Hasher.NeedsRehash(user.Password) {
+		passwordHash, err := a.Hasher.Hash(password)
+		if err == nil {
+			err = auth.UpdatePassword(a.DB, ctx, user.Id, passwordHash)
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to rehash password", "err", err)
+		}
+	}
+	return util.NewTokenPair(a, ctx, user, "")
+}
+
+// Refresh exchanges the refresh token for a new token pair of the same
+// family. A refresh token can only be used once; presenting it again
+// revokes the family, since whoever does so may hold a stolen copy.
+// Clients that refresh twice at once, such as two tabs, are let off for
+// a.Config.RefreshGrace after the first use, see reuse.
+func Refresh(a *app.App, ctx context.Context, refreshToken string) (util.TokenPair, error) {
+	if refreshToken == "" {
+		return util.TokenPair{}, service.Invalid("Bad Request")
+	}
+	token, err := auth.GetRefreshToken(a.DB, ctx, util.HashToken(refreshToken))
+	if err != nil && err != sql.ErrNoRows {
+		return util.TokenPair{}, err
+	}
+	if err == sql.ErrNoRows || token.Revoked || a.Now().After(token.Expires) {
+		return util.TokenPair{}, service.Unauthorized("Invalid Refresh Token")
+	}
+	user, err := auth.GetUserById(a.DB, ctx, token.UserId)
+	if err == sql.ErrNoRows {
+		return util.TokenPair{}, service.Unauthorized("Invalid Refresh Token")
+	}
+	if err != nil {
+		return util.TokenPair{}, err
+	}
+
+	ok, err := auth.UseRefreshToken(a.DB, ctx, token.Id, a.Now())
+	if err != nil {
+		return util.TokenPair{}, err
+	}
+	if !ok {
+		return reuse(a, ctx, user, refreshToken)
+	}
+	return util.RotateTokenPair(a, ctx, user, token.Family, refreshToken)
+}
+
+// reuse answers a refresh token that was presented again after it was
+// used. Within the grace period of the first use, and as long as the
+// successor is unused, the same successor is handed out again with a
+// new access token. Otherwise the token family is revoked.
+func reuse(a *app.App, ctx context.Context, user auth.User, refreshToken string) (util.TokenPair, error) {
+	token, err := auth.GetRefreshToken(a.DB, ctx, util.HashToken(refreshToken))
+	if err != nil {
+		return util.TokenPair{}, err
+	}
+	if token.UsedAt != nil && !a.Now().After(token.UsedAt.Add(a.Config.RefreshGrace)) {
+		// The successor may not be stored yet if the first refresh is
+		// still running.
+		next, err := auth.GetRefreshToken(a.DB, ctx, util.HashToken(util.NextRefreshToken(a, refreshToken)))
+		if err != nil && err != sql.ErrNoRows {
+			return util.TokenPair{}, err
+		}
+		if !token.Revoked && !next.Used && !next.Revoked {
+			return util.ReissueTokenPair(a, user, token.Family, refreshToken)
+		}
+	}
+	err = auth.RevokeFamily(a.DB, ctx, token.Family)
+	if err != nil {
+		return util.TokenPair{}, err
+	}
+	return util.TokenPair{}, service.Unauthorized("Invalid Refresh Token")
+}
+
+// Family returns the token family, that is the session, the refresh
+// token belongs to.
+func Family(a *app.App, ctx context.Context, refreshToken string) (string, error) {
+	token, err := auth.GetRefreshToken(a.DB, ctx, util.HashToken(refreshToken))
+	if err == sql.ErrNoRows {
+		return "", service.Unauthorized("Invalid Refresh Token")
+	}
+	if err != nil {
+		return "", err
+	}
+	return token.Family, nil
+}
+
+// Logout revokes the token family of a session.
+func Logout(a *app.App, ctx context.Context, family string) error {
+	return auth.RevokeFamily(a.DB, ctx, family)
+}
+
+// SetRole gives the user with the username the role. Only admins may
+// change roles.
+func SetRole(a *app.App, ctx context.Context, userId int, username, role string) error {
+	err := service.Authorize(a.DB, ctx, userId, policy.ManageRoles, 0)
+	if err != nil {
+		return err
+	}
+	if username == "" || !policy.ValidRole(role) {
+		return service.Invalid("Bad Request")
+	}
+	user, err := auth.GetUser(a.DB, ctx, username)
+	if err == sql.ErrNoRows {
+		return service.NotFound("User Not Found")
+	}
+	if err != nil {
+		return err
+	}
+	return auth.SetRole(a.DB, ctx, user.Id, role)
+}
+
+// ChangePassword sets a new password for the user if the old one is
+// right, and signs out the sessions of the user but the one of family.
+func ChangePassword(a *app.App, ctx context.Context, userId int, family, oldPassword, newPassword string) error {
+	user, err := current(a, ctx, userId)
+	if err != nil {
+		return err
+	}
+	if oldPassword == "" || newPassword == "" {
+		return service.Invalid("Bad Request")
+	}
+	err = verify(a, user, oldPassword)
+	if err != nil {
+		return err
+	}
+
+	passwordHash, err := a.Hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+	err = auth.UpdatePassword(a.DB, ctx, user.Id, passwordHash)
+	if err != nil {
+		return err
+	}
+	return auth.RevokeUserTokens(a.DB, ctx, user.Id, family)
+}
+
+// Rename changes the username of the user.
+func Rename(a *app.App, ctx context.Context, userId int, username string) error {
+	user, err := current(a, ctx, userId)
+	if err != nil {
+		return err
+	}
+	if !auth.ValidUsername(username) {
+		return service.Invalid("Bad Request")
+	}
+	_, err = auth.GetUser(a.DB, ctx, username)
+	if err == nil {
+		return service.Conflict("User already exists")
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+	return auth.Rename(a.DB, ctx, user.Id, username)
+}
+
+// DeleteAccount deletes the user if the password is right. With
+// auth.DeleteAnonymize the posts, comments and images of the user are
+// kept under the deleted user, with auth.DeleteCascade they are deleted
+// too.
+func DeleteAccount(a *app.App, ctx context.Context, userId int, password, mode string) error {
+	user, err := current(a, ctx, userId)
+	if err != nil {
+		return err
+	}
+	if mode != auth.DeleteAnonymize && mode != auth.DeleteCascade {
+		return service.Invalid("Invalid Mode")
+	}
+	if password == "" {
+		return service.Invalid("Bad Request")
+	}
+	err = verify(a, user, password)
+	if err != nil {
+		return err
+	}
+
+	var imageList []images.Image
+	if mode == auth.DeleteCascade {
+		imageList, err = images.GetUserImages(a.DB, ctx, user.Id)
+		if err != nil {
+			return err
+		}
+	}
+	err = auth.DeleteUser(a.DB, ctx, user.Id, mode)
+	if err != nil {
+		return err
+	}
+	// The account is gone, so files left behind are only logged; the
+	// garbage collector removes them later.
+	for _, image := range imageList {
+		err = images_service.DeleteFiles(a, ctx, image)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to delete image files", "image", image.Id, "err", err)
+		}
+	}
+	return nil
+}
+
+// current returns the user, who must still exist.
+func current(a *app.App, ctx context.Context, userId int) (auth.User, error) {
+	user, err := auth.GetUserById(a.DB, ctx, userId)
+	if err == sql.ErrNoRows {
+		return auth.User{}, service.Unauthorized("Invalid Token")
+	}
+	return user, err
+}
+
+// verify returns an error unless the password of the user is right.
+func verify(a *app.App, user auth.User, password string) error {
+	ok, err := a.Hasher.Verify(password, user.Password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return service.Unauthorized("Invalid Password")
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// Package comments performs the operations on comments and their likes.
+package comments
+
+import (
+	"blog/app"
+	"blog/db/comments"
+	"blog/db/likes"
+	"blog/db/page"
+	"blog/policy"
+	"blog/service"
+	posts_service "blog/service/posts"
+	"context"
+	"database/sql"
+)
+
+// Add adds a top-level comment with the text by the user to the post,
+// which the user must be able to see, and returns its id.
+func Add(a *app.App, ctx context.Context, userId, postId int, text string) (int, error) {
+	_, err := posts_service.Get(a, ctx, userId, postId)
+	if err != nil {
+		return 0, err
+	}
+	if text == "" {
+		return 0, service.Invalid("Bad Request")
+	}
+	return comments.AddComment(a.DB, ctx,
+		comments.Comment{AuthorId: userId, PostId: postId, Text: text})
+}
+
+// Reply adds a reply with the text by the user to the comment and
+// returns its id. Replies can be nested up to CommentDepth levels deep.
+func Reply(a *app.App, ctx context.Context, userId, parentId int, text string) (int, error) {
+	parent, err := Get(a, ctx, userId, parentId)
+	if err != nil {
+		return 0, err
+	}
+	if parent.Depth >= a.Config.CommentDepth {
+		return 0, service.Invalid("Maximum Reply Depth Reached")
+	}
+	if text == "" {
+		return 0, service.Invalid("Bad Request")
+	}
+	return comments.AddComment(a.DB, ctx, comments.Comment{
+		AuthorId: userId, PostId: parent.PostId, ParentId: parent.Id, Text: text,
+	})
+}
+
+// Get returns the comment, which is only found if the user can see its
+// post.
+func Get(a *app.App, ctx context.Context, userId, commentId int) (comments.Comment, error) {
+	comment, err := comments.GetComment(a.DB, ctx, commentId)
+	if err == sql.ErrNoRows {
+		return comments.Comment{}, service.NotFound("Not Found")
+	}
+	if err != nil {
+		return comments.Comment{}, err
+	}
+	_, err = posts_service.Get(a, ctx, userId, comment.PostId)
+	if err != nil {
+		return comments.Comment{}, err
+	}
+	return comment, nil
+}
+
+// Page returns up to limit top-level comments of the post following the
+// after cursor in the order, with their replies, and the cursor of the
+// next page. An empty order lists the newest comments first. The user
+// must be able to see the post.
+func Page(a *app.App, ctx context.Context, userId, postId int, after page.Cursor, limit int,
+	order comments.Order) ([]comments.Comment, page.Cursor, error) {
+	_, err := posts_service.Get(a, ctx, userId, postId)
+	if err != nil {
+		return nil, page.Cursor{}, err
+	}
+	if order == "" {
+		order = comments.OrderNew
+	}
+	if !comments.ValidOrder(order) {
+		return nil, page.Cursor{}, service.Invalid("Invalid Sort Order")
+	}
+	return comments.GetCommentsPage(a.DB, ctx,
+		postId, after, limit, a.Config.CommentDepth, order)
+}
+
+// Update sets the text of the comment.
+func Update(a *app.App, ctx context.Context, userId, commentId int, text string) error {
+	if text == "" {
+		return service.Invalid("Bad Request")
+	}
+	comment, err := Get(a, ctx, userId, commentId)
+	if err != nil {
+		return err
+	}
+	err = service.Authorize(a.DB, ctx, userId, policy.EditComment, comment.AuthorId)
+	if err != nil {
+		return err
+	}
+	return comments.UpdateComment(a.DB, ctx, commentId, comments.Comment{Text: text})
+}
+
+// Delete deletes the comment together with its replies.
+func Delete(a *app.App, ctx context.Context, userId, commentId int) error {
+	comment, err := Get(a, ctx, userId, commentId)
+	if err != nil {
+		return err
+	}
+	err = service.Authorize(a.DB, ctx, userId, policy.DeleteComment, comment.AuthorId)
+	if err != nil {
+		return err
+	}
+	return comments.DeleteComment(a.DB, ctx, commentId)
+}
+
+// Vote likes or dislikes the comment, as likeType says. Voting the same
+// way again takes the vote back.
+func Vote(a *app.App, ctx context.Context, userId, commentId int, likeType string) error {
+	_, err := Get(a, ctx, userId, commentId)
+	if err != nil {
+		return err
+	}
+	return likes.AddCommentLike(a.DB, ctx, userId, commentId, likeType)
+}
+
+// Score returns the number of likes minus the number of dislikes of the
+// comment, which the user must be able to see.
+func Score(a *app.App, ctx context.Context, userId, commentId int) (int, error) {
+	_, err := Get(a, ctx, userId, commentId)
+	if err != nil {
+		return 0, err
+	}
+	return likes.GetCommentLikes(a.DB, ctx, commentId)
+}
@@ -0,0 +1,147 @@
+// Package images performs the operations on uploaded images and their
+// files.
+package images
+
+import (
+	"blog/app"
+	"blog/db/images"
+	"blog/db/page"
+	"blog/imaging"
+	"blog/policy"
+	"blog/service"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Upload processes the image file uploaded by the user under the file
+// name, stores it with its scaled down copies and returns the image.
+// Uploading one of the user's images again returns the existing image.
+// The files are named after their content, so users who upload the same
+// image each get an image of their own that shares the files.
+func Upload(a *app.App, ctx context.Context, userId int, filename string, data []byte) (images.Image, error) {
+	processed, err := imaging.Process(data, imaging.Limits{
+		MaxSize:      a.Config.MaxImageSize,
+		MaxDimension: a.Config.MaxImageDimension,
+	})
+	switch err {
+	case nil:
+	case imaging.ErrTooLarge:
+		return images.Image{}, service.New(service.ErrTooLarge, "Image Too Large")
+	case imaging.ErrType:
+		return images.Image{}, service.New(service.ErrUnsupported, "Unsupported Image Type")
+	case imaging.ErrInvalid:
+		return images.Image{}, service.Invalid("Invalid Image")
+	default:
+		return images.Image{}, err
+	}
+
+	existing, err := images.GetUserImageByName(a.DB, ctx, userId, processed.Name)
+	if err == nil {
+		return existing, nil
+	}
+	if err != sql.ErrNoRows {
+		return images.Image{}, err
+	}
+
+	image := images.Image{
+		AuthorId: userId,
+		Name:     processed.Name,
+		Original: imaging.Original(filename),
+		Type:     processed.Type,
+		Size:     len(processed.Data),
+		Width:    processed.Width,
+		Height:   processed.Height,
+	}
+	files := []imaging.Image{processed}
+	for _, variant := range []struct {
+		width int
+		dest  *images.Variant
+	}{
+		{imaging.ThumbnailWidth, &image.Thumbnail},
+		{imaging.MediumWidth, &image.Medium},
+	} {
+		scaled, ok, err := imaging.Scale(processed, variant.width)
+		if err != nil {
+			return images.Image{}, err
+		}
+		if ok {
+			*variant.dest = images.Variant{Name: scaled.Name, Width: scaled.Width, Height: scaled.Height}
+			files = append(files, scaled)
+		}
+	}
+	for _, file := range files {
+		err = a.Storage.Put(ctx, file.Name, file.Data, file.Type)
+		if err != nil {
+			return images.Image{}, err
+		}
+	}
+
+	err = images.AddImage(a.DB, ctx, image)
+	if err != nil {
+		return images.Image{}, err
+	}
+	return images.GetUserImageByName(a.DB, ctx, userId, processed.Name)
+}
+
+// Page returns up to limit images following the after cursor, newest
+// first, and the cursor of the next page.
+func Page(a *app.App, ctx context.Context, after page.Cursor, limit int) ([]images.Image, page.Cursor, error) {
+	return images.GetImagesPage(a.DB, ctx, after, limit)
+}
+
+// ByName returns the images with the file names, in no particular order.
+func ByName(a *app.App, ctx context.Context, names []string) ([]images.Image, error) {
+	if len(names) > page.MaxLimit {
+		return nil, service.Invalid("Too Many Names")
+	}
+	return images.GetImagesByName(a.DB, ctx, names)
+}
+
+// Get returns the image.
+func Get(a *app.App, ctx context.Context, imageId int) (images.Image, error) {
+	image, err := images.GetImage(a.DB, ctx, imageId)
+	if err == sql.ErrNoRows {
+		return images.Image{}, service.NotFound("Image Not Found")
+	}
+	return image, err
+}
+
+// Delete deletes the image and then its files.
+func Delete(a *app.App, ctx context.Context, userId, imageId int) error {
+	image, err := Get(a, ctx, imageId)
+	if err != nil {
+		return err
+	}
+	err = service.Authorize(a.DB, ctx, userId, policy.DeleteImage, image.AuthorId)
+	if err != nil {
+		return err
+	}
+	err = images.DeleteImage(a.DB, ctx, imageId)
+	if err != nil {
+		return err
+	}
+	return DeleteFiles(a, ctx, image)
+}
+
+// DeleteFiles deletes the files of an image that was deleted, except
+// those that other images still have. A file that can not be deleted
+// does not stop the others; the failures are joined in the error.
+func DeleteFiles(a *app.App, ctx context.Context, image images.Image) error {
+	used, err := images.GetUsedFiles(a.DB, ctx, image.Files())
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, file := range image.Files() {
+		if used[file] {
+			continue
+		}
+		err = a.Storage.Delete(ctx, file)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove file: %v", err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,291 @@
+// Package posts performs the operations on posts, their likes, tags,
+// images and revisions.
+package posts
+
+import (
+	"blog/app"
+	"blog/db/images"
+	"blog/db/likes"
+	"blog/db/page"
+	"blog/db/posts"
+	"blog/db/revisions"
+	"blog/db/tags"
+	"blog/diff"
+	"blog/policy"
+	"blog/service"
+	"context"
+	"database/sql"
+)
+
+// Add adds the post by the user and returns its id.
+func Add(a *app.App, ctx context.Context, userId int, post posts.Post) (int, error) {
+	err := validate(a, ctx, &post)
+	if err != nil {
+		return 0, err
+	}
+	post.AuthorId = userId
+
+	postId, err := posts.AddPost(a.DB, ctx, post)
+	if err != nil {
+		return 0, err
+	}
+	if post.Images != nil {
+		err = images.SetPostImages(a.DB, ctx, postId, post.Images)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if post.Tags != nil {
+		err = tags.AddTags(a.DB, ctx, postId, post.Tags)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return postId, nil
+}
+
+// Page returns up to limit published posts following the after cursor.
+func Page(a *app.App, ctx context.Context, after page.Cursor, limit int) (posts.Posts, error) {
+	return posts.GetPostsPage(a.DB, ctx, after, limit)
+}
+
+// Get returns the post if the user can see it. Drafts and scheduled
+// posts are only visible to their authors.
+func Get(a *app.App, ctx context.Context, userId, postId int) (posts.Post, error) {
+	post, err := posts.GetPost(a.DB, ctx, postId)
+	if err == sql.ErrNoRows {
+		return posts.Post{}, service.NotFound("Not Found")
+	}
+	if err != nil {
+		return posts.Post{}, err
+	}
+	if post.Status != posts.StatusPublished && post.AuthorId != userId {
+		return posts.Post{}, service.NotFound("Not Found")
+	}
+	return post, nil
+}
+
+// authorize returns the post if the user may perform the action on it.
+func authorize(a *app.App, ctx context.Context, userId, postId int, action policy.Action) (posts.Post, error) {
+	post, err := posts.GetPost(a.DB, ctx, postId)
+	if err == sql.ErrNoRows {
+		return posts.Post{}, service.NotFound("Not Found")
+	}
+	if err != nil {
+		return posts.Post{}, err
+	}
+	err = service.Authorize(a.DB, ctx, userId, action, post.AuthorId)
+	if err != nil {
+		return posts.Post{}, err
+	}
+	return post, nil
+}
+
+// Update lets edit change the post, as it is stored, and saves it. An
+// error from edit stops the update. Nil Images keep the attached images
+// as they are, while nil Tags remove the tags.
+func Update(a *app.App, ctx context.Context, userId, postId int, edit func(post *posts.Post) error) error {
+	post, err := authorize(a, ctx, userId, postId, policy.EditPost)
+	if err != nil {
+		return err
+	}
+	err = edit(&post)
+	if err != nil {
+		return err
+	}
+	err = validate(a, ctx, &post)
+	if err != nil {
+		return err
+	}
+
+	err = posts.UpdatePost(a.DB, ctx, postId, userId, post)
+	if err != nil {
+		return err
+	}
+	if post.Images != nil {
+		err = images.SetPostImages(a.DB, ctx, postId, post.Images)
+		if err != nil {
+			return err
+		}
+	}
+	if post.Tags == nil {
+		return tags.DeleteTags(a.DB, ctx, postId)
+	}
+	return tags.UpdateTags(a.DB, ctx, postId, post.Tags)
+}
+
+// validate checks the post before it is saved and removes repeated tags.
+func validate(a *app.App, ctx context.Context, post *posts.Post) error {
+	if post.Title == "" || post.Text == "" || !posts.ValidStatus(*post) {
+		return service.Invalid("Bad Request")
+	}
+	if len(post.Images) > page.MaxLimit {
+		return service.Invalid("Too Many Images")
+	}
+	for _, id := range post.Images {
+		_, err := images.GetImage(a.DB, ctx, id)
+		if err == sql.ErrNoRows {
+			return service.Invalid("Image Not Found")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if post.Tags == nil {
+		return nil
+	}
+	seen := make(map[tags.Tag]bool)
+	tagList := make([]tags.Tag, 0, len(post.Tags))
+	for _, tag := range post.Tags {
+		if tag.Name == "" {
+			return service.Invalid("Bad Request")
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tagList = append(tagList, tag)
+		}
+	}
+	post.Tags = tagList
+	return nil
+}
+
+// Delete deletes the post.
+func Delete(a *app.App, ctx context.Context, userId, postId int) error {
+	_, err := authorize(a, ctx, userId, postId, policy.DeletePost)
+	if err != nil {
+		return err
+	}
+	return posts.DeletePost(a.DB, ctx, postId)
+}
+
+// Unpublish turns a published or scheduled post back into a draft.
+func Unpublish(a *app.App, ctx context.Context, userId, postId int) error {
+	_, err := authorize(a, ctx, userId, postId, policy.EditPost)
+	if err != nil {
+		return err
+	}
+	return posts.Unpublish(a.DB, ctx, postId)
+}
+
+// Drafts returns the drafts and scheduled posts of the user.
+func Drafts(a *app.App, ctx context.Context, userId int) ([]posts.Post, error) {
+	return posts.GetDrafts(a.DB, ctx, userId)
+}
+
+// Vote likes or dislikes the post, as likeType says.
+func Vote(a *app.App, ctx context.Context, userId, postId int, likeType string) error {
+	_, err := Get(a, ctx, userId, postId)
+	if err != nil {
+		return err
+	}
+	return likes.AddLike(a.DB, ctx, userId, postId, likeType)
+}
+
+// Score returns the number of likes minus the number of dislikes of the
+// post, if the user can see it.
+func Score(a *app.App, ctx context.Context, userId, postId int) (int, error) {
+	_, err := Get(a, ctx, userId, postId)
+	if err != nil {
+		return 0, err
+	}
+	return likes.GetLikes(a.DB, ctx, postId)
+}
+
+// Search returns up to limit published posts matching the query, best
+// matches first.
+func Search(a *app.App, ctx context.Context, q string, limit int) ([]posts.Result, error) {
+	query := posts.ParseQuery(q)
+	if query.IsZero() {
+		return nil, service.Invalid("Invalid Query")
+	}
+	return posts.Search(a.DB, ctx, query, limit)
+}
+
+// Tags returns the tags of the post, if the user can see it.
+func Tags(a *app.App, ctx context.Context, userId, postId int) ([]tags.Tag, error) {
+	_, err := Get(a, ctx, userId, postId)
+	if err != nil {
+		return nil, err
+	}
+	return tags.GetTags(a.DB, ctx, postId)
+}
+
+// Tagged returns the published posts with the tag.
+func Tagged(a *app.App, ctx context.Context, name string) ([]posts.Post, error) {
+	return posts.FilterTag(a.DB, ctx, tags.Tag{Name: name})
+}
+
+// Images returns the images attached to the post, in order.
+func Images(a *app.App, ctx context.Context, userId, postId int) ([]images.Image, error) {
+	_, err := Get(a, ctx, userId, postId)
+	if err != nil {
+		return nil, err
+	}
+	return images.GetPostImages(a.DB, ctx, postId)
+}
+
+// Revisions returns the revisions of the post, newest first.
+func Revisions(a *app.App, ctx context.Context, userId, postId int) ([]revisions.Revision, error) {
+	_, err := Get(a, ctx, userId, postId)
+	if err != nil {
+		return nil, err
+	}
+	return revisions.GetRevisions(a.DB, ctx, postId)
+}
+
+// RevisionDiff holds the line diffs of the title and text between two revisions.
+type RevisionDiff struct {
+	From  revisions.Revision
+	To    revisions.Revision
+	Title []diff.Line
+	Text  []diff.Line
+}
+
+// Diff returns the changes between two revisions of the post.
+func Diff(a *app.App, ctx context.Context, userId, postId, fromId, toId int) (RevisionDiff, error) {
+	_, err := Get(a, ctx, userId, postId)
+	if err != nil {
+		return RevisionDiff{}, err
+	}
+	from, err := revision(a, ctx, postId, fromId)
+	if err != nil {
+		return RevisionDiff{}, err
+	}
+	to, err := revision(a, ctx, postId, toId)
+	if err != nil {
+		return RevisionDiff{}, err
+	}
+	title, err := diff.Lines(from.Title, to.Title)
+	if err != nil {
+		return RevisionDiff{}, service.New(service.ErrTooLarge, "Revisions Too Large to Compare")
+	}
+	text, err := diff.Lines(from.Text, to.Text)
+	if err != nil {
+		return RevisionDiff{}, service.New(service.ErrTooLarge, "Revisions Too Large to Compare")
+	}
+	return RevisionDiff{From: from, To: to, Title: title, Text: text}, nil
+}
+
+// Restore sets the title and text of the post to those of the revision,
+// which is recorded as a new revision.
+func Restore(a *app.App, ctx context.Context, userId, postId, revisionId int) error {
+	post, err := authorize(a, ctx, userId, postId, policy.EditPost)
+	if err != nil {
+		return err
+	}
+	rev, err := revision(a, ctx, postId, revisionId)
+	if err != nil {
+		return err
+	}
+	post.Title, post.Text = rev.Title, rev.Text
+	return posts.UpdatePost(a.DB, ctx, postId, userId, post)
+}
+
+// revision returns the revision if it belongs to the post.
+func revision(a *app.App, ctx context.Context, postId, revisionId int) (revisions.Revision, error) {
+	rev, err := revisions.GetRevision(a.DB, ctx, revisionId)
+	if err == sql.ErrNoRows || (err == nil && rev.PostId != postId) {
+		return revisions.Revision{}, service.NotFound("Not Found")
+	}
+	return rev, err
+}
@@ -0,0 +1,84 @@
+// Package service holds the errors of the service layer, which performs
+// the operations of the blog for the JSON API and the web interface.
+// The operations are in the packages below this one. They take the id of
+// the user they are performed for, 0 for no user, check that the user
+// may perform them and report failures that are up to the client as an
+// *Error, so that both interfaces answer them the same way.
+package service
+
+import (
+	"blog/policy"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Kinds of failures. An *Error unwraps to its kind, so callers can
+// check for one with errors.Is.
+var (
+	ErrInvalid      = errors.New("invalid request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrTooLarge     = errors.New("too large")
+	ErrUnsupported  = errors.New("unsupported")
+	ErrTooMany      = errors.New("too many requests")
+)
+
+// Error is a failure caused by the request rather than by the server.
+// Message is shown to the client. RetryAfter tells clients when to try
+// again after an ErrTooMany.
+type Error struct {
+	Kind       error
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// New returns an *Error of the kind with the message.
+func New(kind error, message string) error {
+	return &Error{Kind: kind, Message: message}
+}
+
+func Invalid(message string) error {
+	return New(ErrInvalid, message)
+}
+
+func Unauthorized(message string) error {
+	return New(ErrUnauthorized, message)
+}
+
+func NotFound(message string) error {
+	return New(ErrNotFound, message)
+}
+
+func Conflict(message string) error {
+	return New(ErrConflict, message)
+}
+
+// TooMany returns an ErrTooMany *Error that asks to retry after wait.
+func TooMany(message string, wait time.Duration) error {
+	return &Error{Kind: ErrTooMany, Message: message, RetryAfter: wait}
+}
+
+// Authorize returns an ErrForbidden *Error unless the user may perform
+// the action on a resource owned by ownerId.
+func Authorize(db *sql.DB, ctx context.Context, userId int, action policy.Action, ownerId int) error {
+	allowed, err := policy.Authorize(db, ctx, userId, action, ownerId)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return New(ErrForbidden, "Forbidden")
+	}
+	return nil
+}
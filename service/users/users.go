@@ -0,0 +1,89 @@
+// Package users performs the operations on user profiles and lists what
+// users have published.
+package users
+
+import (
+	"blog/app"
+	"blog/db/albums"
+	"blog/db/comments"
+	"blog/db/images"
+	"blog/db/posts"
+	"blog/db/profiles"
+	"blog/policy"
+	"blog/service"
+	"context"
+	"database/sql"
+)
+
+// Profile returns the profile of the user with the username.
+func Profile(a *app.App, ctx context.Context, username string) (profiles.Profile, error) {
+	profile, err := profiles.GetProfile(a.DB, ctx, username)
+	if err == sql.ErrNoRows {
+		return profiles.Profile{}, service.NotFound("User Not Found")
+	}
+	return profile, err
+}
+
+// Update sets the DisplayName, Bio, AvatarId and Website of the profile
+// of the user with the username. The avatar must be one of the images
+// uploaded by that user, and an AvatarId of 0 removes it.
+func Update(a *app.App, ctx context.Context, userId int, username string, edited profiles.Profile) error {
+	profile, err := Profile(a, ctx, username)
+	if err != nil {
+		return err
+	}
+	err = service.Authorize(a.DB, ctx, userId, policy.EditProfile, profile.UserId)
+	if err != nil {
+		return err
+	}
+	if !profiles.ValidProfile(edited) {
+		return service.Invalid("Bad Request")
+	}
+	if edited.AvatarId != 0 {
+		image, err := images.GetImage(a.DB, ctx, edited.AvatarId)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == sql.ErrNoRows || image.AuthorId != profile.UserId {
+			return service.Invalid("Invalid Avatar")
+		}
+	}
+	return profiles.UpdateProfile(a.DB, ctx, profile.UserId, edited)
+}
+
+// Posts returns the published posts of the user, newest first.
+func Posts(a *app.App, ctx context.Context, username string) ([]posts.Post, error) {
+	profile, err := Profile(a, ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	return posts.FilterAuthor(a.DB, ctx, profile.Username)
+}
+
+// Comments returns up to limit of the newest comments of the user on
+// published posts.
+func Comments(a *app.App, ctx context.Context, username string, limit int) ([]comments.Comment, error) {
+	profile, err := Profile(a, ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	return comments.GetUserComments(a.DB, ctx, profile.UserId, limit)
+}
+
+// Images returns the images uploaded by the user, newest first.
+func Images(a *app.App, ctx context.Context, username string) ([]images.Image, error) {
+	profile, err := Profile(a, ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	return images.GetUserImages(a.DB, ctx, profile.UserId)
+}
+
+// Albums returns the albums of the user, sorted by name.
+func Albums(a *app.App, ctx context.Context, username string) ([]albums.Album, error) {
+	profile, err := Profile(a, ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	return albums.GetUserAlbums(a.DB, ctx, profile.UserId)
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// FS keeps files in a directory of the local filesystem, which is
+// created when the first file is stored.
+type FS struct {
+	dir string
+}
+
+func NewFS(dir string) *FS {
+	return &FS{dir: dir}
+}
+
+// Put writes the file to a temporary file first and renames it, so that
+// readers never see a partly written file.
+func (s *FS) Put(ctx context.Context, name string, data []byte, contentType string) error {
+	if !ValidName(name) {
+		return ErrName
+	}
+	err := os.MkdirAll(s.dir, 0750)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, TempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+}
+
+func (s *FS) Open(ctx context.Context, name string) (*Object, error) {
+	if !ValidName(name) {
+		return nil, ErrNotExist
+	}
+	file, err := os.Open(filepath.Join(s.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, ErrNotExist
+	}
+	return &Object{
+		ReadCloser: file,
+		Type:       mime.TypeByExtension(filepath.Ext(name)),
+		Size:       info.Size(),
+		Modified:   info.ModTime(),
+	}, nil
+}
+
+func (s *FS) Delete(ctx context.Context, name string) error {
+	if !ValidName(name) {
+		return ErrName
+	}
+	err := os.Remove(filepath.Join(s.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List also returns the temporary files of uploads that never finished,
+// so that they can be cleaned up too. A directory that was not created
+// yet is empty.
+func (s *FS) List(ctx context.Context) ([]Info, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	files := make([]Info, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, Info{
+			Name:     entry.Name(),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+		})
+	}
+	return files, nil
+}
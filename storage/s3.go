@@ -0,0 +1,364 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unsignedPayload is the payload hash of presigned requests, whose body
+// is not known when they are signed.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3Config is where an S3 compatible service keeps the files. Endpoint
+// is the address of the service, such as https://s3.amazonaws.com or
+// http://localhost:9000 for MinIO. With PathStyle the bucket is the
+// first part of the path instead of a part of the host name, which is
+// what most self-hosted services expect. Prefix is put before the names
+// of the files, such as "blog/" to keep them in a folder of a bucket that
+// is shared with others.
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+}
+
+// S3 keeps files in a bucket of an S3 compatible service. Requests are
+// signed with AWS Signature Version 4.
+type S3 struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	prefix    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	// Client sends the requests and Now tells the time they are signed
+	// at. Both can be replaced, in tests for example.
+	Client *http.Client
+	Now    func() time.Time
+}
+
+func NewS3(config S3Config) (*S3, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint: %q", config.Endpoint)
+	}
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("S3 bucket is required")
+	}
+	if config.AccessKey == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("S3 access key and secret key are required")
+	}
+	region := config.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3{
+		endpoint:  endpoint,
+		region:    region,
+		bucket:    config.Bucket,
+		prefix:    strings.TrimPrefix(config.Prefix, "/"),
+		accessKey: config.AccessKey,
+		secretKey: config.SecretKey,
+		pathStyle: config.PathStyle,
+		Client:    http.DefaultClient,
+		Now:       time.Now,
+	}, nil
+}
+
+// key is the key of the file in the bucket.
+func (s *S3) key(name string) string {
+	return s.prefix + name
+}
+
+// objectURL is the address of the object with the key in the bucket.
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	base := strings.TrimSuffix(u.Path, "/")
+	if s.pathStyle {
+		u.Path = base + "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = base + "/" + key
+	}
+	u.RawPath = ""
+	u.RawQuery = ""
+	return &u
+}
+
+func (s *S3) Put(ctx context.Context, name string, data []byte, contentType string) error {
+	if !ValidName(name) {
+		return ErrName
+	}
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	res, err := s.do(ctx, http.MethodPut, s.key(name), nil, header, data)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return responseError(res)
+	}
+	return nil
+}
+
+func (s *S3) Open(ctx context.Context, name string) (*Object, error) {
+	if !ValidName(name) {
+		return nil, ErrNotExist
+	}
+	res, err := s.do(ctx, http.MethodGet, s.key(name), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrNotExist
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, responseError(res)
+	}
+	modified, _ := http.ParseTime(res.Header.Get("Last-Modified"))
+	return &Object{
+		ReadCloser: res.Body,
+		Type:       res.Header.Get("Content-Type"),
+		Size:       res.ContentLength,
+		Modified:   modified,
+	}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, name string) error {
+	if !ValidName(name) {
+		return ErrName
+	}
+	res, err := s.do(ctx, http.MethodDelete, s.key(name), nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK &&
+		res.StatusCode != http.StatusNotFound {
+		return responseError(res)
+	}
+	return nil
+}
+
+// SignedURL returns an address that downloads the file without
+// credentials until ttl has passed.
+func (s *S3) SignedURL(name string, ttl time.Duration) (string, error) {
+	if !ValidName(name) {
+		return "", ErrName
+	}
+	seconds := int(ttl / time.Second)
+	if seconds < 1 || seconds > 7*24*60*60 {
+		return "", fmt.Errorf("signed URLs must last from a second to a week, not %v", ttl)
+	}
+	now := s.Now().UTC()
+	u := s.objectURL(s.key(name))
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.Itoa(seconds))
+	query.Set("X-Amz-SignedHeaders", "host")
+	header := http.Header{}
+	header.Set("Host", u.Host)
+	signature := s.signature(now, http.MethodGet, u, query, header, unsignedPayload)
+	u.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+// listResult is the part of a ListObjectsV2 response that List uses.
+type listResult struct {
+	Contents []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// List pages through the keys under the prefix with ListObjectsV2. Keys
+// that are not valid names after the prefix, such as keys in folders,
+// were not stored by the blog and are left out.
+func (s *S3) List(ctx context.Context) ([]Info, error) {
+	var files []Info
+	query := url.Values{}
+	query.Set("list-type", "2")
+	if s.prefix != "" {
+		query.Set("prefix", s.prefix)
+	}
+	for {
+		res, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			defer res.Body.Close()
+			return nil, responseError(res)
+		}
+		var result listResult
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 list response: %v", err)
+		}
+		for _, object := range result.Contents {
+			name, ok := strings.CutPrefix(object.Key, s.prefix)
+			if !ok || !ValidName(name) {
+				continue
+			}
+			files = append(files, Info{
+				Name:     name,
+				Size:     object.Size,
+				Modified: object.LastModified,
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return files, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+// do sends a signed request for the object with the key, or for the
+// bucket if key is empty.
+func (s *S3) do(ctx context.Context, method, key string, query url.Values,
+	header http.Header, body []byte) (*http.Response, error) {
+	u := s.objectURL(key)
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body = http.NoBody
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	now := s.Now().UTC()
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	signed := req.Header.Clone()
+	signed.Set("Host", u.Host)
+	signature := s.signature(now, method, u, query, signed, payload)
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, s.scope(now), signedHeaders(signed), signature))
+	return s.Client.Do(req)
+}
+
+// scope is the date, region and service a signature is valid for.
+func (s *S3) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+// signature signs a request as described in the AWS Signature Version 4
+// documentation.
+func (s *S3) signature(now time.Time, method string, u *url.URL, query url.Values,
+	header http.Header, payload string) string {
+	var canonical strings.Builder
+	canonical.WriteString(method + "\n")
+	canonical.WriteString(escape(u.Path, false) + "\n")
+	canonical.WriteString(canonicalQuery(query) + "\n")
+	names := headerNames(header)
+	for _, name := range names {
+		canonical.WriteString(name + ":" + strings.TrimSpace(header.Get(name)) + "\n")
+	}
+	canonical.WriteString("\n" + strings.Join(names, ";") + "\n")
+	canonical.WriteString(payload)
+
+	sum := sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" +
+		s.scope(now) + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format("20060102"))
+	for _, part := range []string{s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// headerNames are the lower case names of the headers, sorted.
+func headerNames(header http.Header) []string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func signedHeaders(header http.Header) string {
+	return strings.Join(headerNames(header), ";")
+}
+
+// canonicalQuery encodes the query sorted by key, with the escaping
+// that signatures use.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, escape(key, true)+"="+escape(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// escape percent-encodes everything but unreserved characters, and
+// slashes unless slash is set.
+func escape(s string, slash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !slash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// responseError describes a failed request from the error the service
+// sent back.
+func responseError(res *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("S3 request failed: %s: %s", res.Status, strings.TrimSpace(string(body)))
+}
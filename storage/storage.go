@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// TempPrefix starts the names of the files that uploads are written to
+// before they are complete.
+const TempPrefix = ".upload-"
+
+var (
+	ErrNotExist = errors.New("file does not exist")
+	ErrName     = errors.New("invalid file name")
+)
+
+// Storage keeps the files of uploaded images. Names are plain file names
+// without directories. Deleting a file that does not exist is not an
+// error, so that removing an image twice is harmless. List returns every
+// file in the storage, in no particular order.
+type Storage interface {
+	Put(ctx context.Context, name string, data []byte, contentType string) error
+	Open(ctx context.Context, name string) (*Object, error)
+	Delete(ctx context.Context, name string) error
+	List(ctx context.Context) ([]Info, error)
+}
+
+// Signer is a Storage that can hand out temporary addresses for its
+// files, so that clients download them from the storage directly.
+type Signer interface {
+	SignedURL(name string, ttl time.Duration) (string, error)
+}
+
+// Object is an open file. Size is in bytes and is -1 if it is unknown.
+// The reader is also an io.Seeker if the storage allows it.
+type Object struct {
+	io.ReadCloser
+	Type     string
+	Size     int64
+	Modified time.Time
+}
+
+// Info describes a stored file. Size is in bytes.
+type Info struct {
+	Name     string
+	Size     int64
+	Modified time.Time
+}
+
+// ValidName reports whether name is a plain file name that cannot reach
+// outside the storage.
+func ValidName(name string) bool {
+	return name != "" && name != "." && name != ".." &&
+		!strings.ContainsAny(name, "/\\\x00")
+}
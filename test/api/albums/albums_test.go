@@ -0,0 +1,258 @@
+package albums_test
+
+import (
+	albums_api "blog/api/albums"
+	"blog/app"
+	"blog/config"
+	"blog/db/albums"
+	"blog/db/auth"
+	"blog/db/images"
+	"blog/test/testutil"
+	"blog/util"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+var userToken, guestToken string
+
+var a *app.App
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.DevMode = true
+	var err error
+	a, err = app.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	testutil.InitDB(a, ctx)
+	users := []auth.User{
+		{Username: "user", Password: "password"},
+		{Username: "guest", Password: "password"},
+	}
+	for _, user := range users {
+		err = auth.AddUser(a.DB, ctx, user)
+		if err != nil {
+			panic(err)
+		}
+	}
+	for _, name := range []string{"first.png", "second.png"} {
+		err = images.AddImage(a.DB, ctx, images.Image{AuthorId: 2, Name: name})
+		if err != nil {
+			panic(err)
+		}
+	}
+	userToken, err = util.NewAccessToken(a, 1, "user", "test")
+	if err != nil {
+		panic(err)
+	}
+	guestToken, err = util.NewAccessToken(a, 2, "guest", "test")
+	if err != nil {
+		panic(err)
+	}
+	m.Run()
+}
+
+func request(t *testing.T, method, url, token string, body any) *httptest.ResponseRecorder {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			t.Fatalf("test failed: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	albums_api.ServeMux(a).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAddAlbum(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		id     int
+	}{
+		{"Travel", userToken, http.StatusOK, 1},
+		{"Cats", userToken, http.StatusOK, 2},
+		{"Travel", guestToken, http.StatusOK, 3},
+		{"Travel", userToken, http.StatusConflict, 0},
+		{"", userToken, http.StatusBadRequest, 0},
+		{"Travel", "", http.StatusUnauthorized, 0},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			rr := request(t, "POST", "/", test.token, albums.Album{Name: test.name})
+			if rr.Code != test.status {
+				t.Fatalf("test failed: %v %s", rr.Code, rr.Body.String())
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+			var album albums.Album
+			err := json.Unmarshal(rr.Body.Bytes(), &album)
+			if err != nil || album.Id != test.id || album.Name != test.name {
+				t.Fatalf("test failed: %v %v", album, err)
+			}
+		})
+	}
+}
+
+func TestListAlbums(t *testing.T) {
+	rr := request(t, "GET", "/", userToken, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("test failed: %v", rr.Code)
+	}
+	var albumList []albums.Album
+	err := json.Unmarshal(rr.Body.Bytes(), &albumList)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	var names []string
+	for _, album := range albumList {
+		names = append(names, album.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Cats", "Travel"}) {
+		t.Fatalf("test failed: %v", names)
+	}
+
+	rr = request(t, "GET", "/", "", nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("test failed: %v", rr.Code)
+	}
+}
+
+func TestGetAlbum(t *testing.T) {
+	tests := []struct {
+		url    string
+		status int
+	}{
+		{"/1", http.StatusOK},
+		{"/3", http.StatusOK},
+		{"/100", http.StatusNotFound},
+		{"/album", http.StatusBadRequest},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			rr := request(t, "GET", test.url, "", nil)
+			if rr.Code != test.status {
+				t.Fatalf("test failed: %v", rr.Code)
+			}
+		})
+	}
+}
+
+func TestRenameAlbum(t *testing.T) {
+	tests := []struct {
+		url    string
+		name   string
+		token  string
+		status int
+	}{
+		{"/2", "Dogs", userToken, http.StatusOK},
+		{"/2", "Travel", userToken, http.StatusConflict},
+		{"/2", "", userToken, http.StatusBadRequest},
+		{"/2", "Birds", guestToken, http.StatusForbidden},
+		{"/2", "Birds", "", http.StatusUnauthorized},
+		{"/100", "Birds", userToken, http.StatusNotFound},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			rr := request(t, "PUT", test.url, test.token, albums.Album{Name: test.name})
+			if rr.Code != test.status {
+				t.Fatalf("test failed: %v %s", rr.Code, rr.Body.String())
+			}
+		})
+	}
+	album, err := albums.GetAlbum(a.DB, ctx, 2)
+	if err != nil || album.Name != "Dogs" {
+		t.Fatalf("test failed: %v %v", album, err)
+	}
+}
+
+func TestAlbumImages(t *testing.T) {
+	tests := []struct {
+		method string
+		url    string
+		token  string
+		status int
+		names  []string
+	}{
+		{"PUT", "/1/images/1", userToken, http.StatusOK, []string{"first.png"}},
+		{"PUT", "/1/images/2", userToken, http.StatusOK, []string{"second.png", "first.png"}},
+		{"PUT", "/1/images/2", userToken, http.StatusOK, []string{"second.png", "first.png"}},
+		{"PUT", "/1/images/100", userToken, http.StatusNotFound, []string{"second.png", "first.png"}},
+		{"PUT", "/1/images/image", userToken, http.StatusBadRequest, []string{"second.png", "first.png"}},
+		{"PUT", "/1/images/1", guestToken, http.StatusForbidden, []string{"second.png", "first.png"}},
+		{"DELETE", "/1/images/1", guestToken, http.StatusForbidden, []string{"second.png", "first.png"}},
+		{"DELETE", "/1/images/1", userToken, http.StatusOK, []string{"second.png"}},
+		{"DELETE", "/1/images/1", userToken, http.StatusOK, []string{"second.png"}},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			rr := request(t, test.method, test.url, test.token, nil)
+			if rr.Code != test.status {
+				t.Fatalf("test failed: %v %s", rr.Code, rr.Body.String())
+			}
+			rr = request(t, "GET", "/1/images", "", nil)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("test failed: %v", rr.Code)
+			}
+			var imageList []images.Image
+			err := json.Unmarshal(rr.Body.Bytes(), &imageList)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			names := make([]string, 0)
+			for _, image := range imageList {
+				names = append(names, image.Name)
+			}
+			if !reflect.DeepEqual(names, test.names) {
+				t.Fatalf("test failed: %v", names)
+			}
+		})
+	}
+}
+
+func TestDeleteAlbum(t *testing.T) {
+	tests := []struct {
+		url    string
+		token  string
+		status int
+	}{
+		{"/1", guestToken, http.StatusForbidden},
+		{"/1", "", http.StatusUnauthorized},
+		{"/1", userToken, http.StatusOK},
+		{"/1", userToken, http.StatusNotFound},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			rr := request(t, "DELETE", test.url, test.token, nil)
+			if rr.Code != test.status {
+				t.Fatalf("test failed: %v", rr.Code)
+			}
+		})
+	}
+	_, err := images.GetImage(a.DB, ctx, 2)
+	if err != nil {
+		t.Fatalf("test failed: image deleted with album: %v", err)
+	}
+}
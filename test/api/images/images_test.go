@@ -0,0 +1,374 @@
+package images_test
+
+import (
+	images_api "blog/api/images"
+	"blog/app"
+	"blog/config"
+	"blog/db/auth"
+	"blog/db/images"
+	"blog/storage"
+	"blog/test/testutil"
+	"blog/util"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var userToken, guestToken string
+
+var a *app.App
+
+var ctx = context.Background()
+
+// TestMain runs the tests in a temporary directory, since uploads are
+// written to static/images.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "images")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	err = os.Chdir(dir)
+	if err != nil {
+		panic(err)
+	}
+	err = os.MkdirAll("static/images", 0750)
+	if err != nil {
+		panic(err)
+	}
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.DevMode = true
+	cfg.MaxImageSize = 1 << 16
+	cfg.MaxImageDimension = 1000
+	a, err = app.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	testutil.InitDB(a, ctx)
+	for _, user := range []auth.User{
+		{Username: "user", Password: "password"},
+		{Username: "guest", Password: "password"},
+	} {
+		err = auth.AddUser(a.DB, ctx, user)
+		if err != nil {
+			panic(err)
+		}
+	}
+	userToken, err = util.NewAccessToken(a, 1, "user", "test")
+	if err != nil {
+		panic(err)
+	}
+	guestToken, err = util.NewAccessToken(a, 2, "user", "test")
+	if err != nil {
+		panic(err)
+	}
+	m.Run()
+}
+
+func rect(t *testing.T, width, height int, c color.Color) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func upload(t *testing.T, token, filename string, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("image", filename)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	_, err = part.Write(data)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	writer.Close()
+
+	req, err := http.NewRequest("POST", "/", &body)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	mux := images_api.ServeMux(a)
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAdd(t *testing.T) {
+	red := rect(t, 4, 4, color.RGBA{255, 0, 0, 255})
+	blue := rect(t, 8, 8, color.RGBA{0, 0, 255, 255})
+	tests := []struct {
+		token    string
+		filename string
+		data     []byte
+		status   int
+		id       int
+		author   int
+		original string
+	}{
+		{userToken, "red.png", red, http.StatusOK, 1, 1, "red.png"},
+		{userToken, "../../../evil.png", blue, http.StatusOK, 2, 1, "evil.png"},
+		{userToken, "copy.png", red, http.StatusOK, 1, 1, "red.png"},
+		{guestToken, "scarlet.png", red, http.StatusOK, 3, 2, "scarlet.png"},
+		{guestToken, "red.png", red, http.StatusOK, 3, 2, "scarlet.png"},
+		{userToken, "page.png", []byte("<html><script>alert(1)</script></html>"), http.StatusUnsupportedMediaType, 0, 0, ""},
+		{userToken, "big.png", rect(t, 1001, 1, color.White), http.StatusRequestEntityTooLarge, 0, 0, ""},
+		{userToken, "huge.png", make([]byte, a.Config.MaxImageSize+1<<16), http.StatusRequestEntityTooLarge, 0, 0, ""},
+		{userToken, "broken.png", red[:len(red)/2], http.StatusBadRequest, 0, 0, ""},
+		{"", "red.png", red, http.StatusUnauthorized, 0, 0, ""},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			rr := upload(t, test.token, test.filename, test.data)
+			if status := rr.Code; status != test.status {
+				t.Fatalf("test failed: %v %s", status, rr.Body.String())
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+			var image images.Image
+			err := json.Unmarshal(rr.Body.Bytes(), &image)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			if image.Id != test.id || image.Original != test.original ||
+				image.Type != "image/png" || image.AuthorId != test.author {
+				t.Fatalf("test failed: %v", image)
+			}
+			data, err := os.ReadFile("static/images/" + image.Name)
+			if err != nil || len(data) != image.Size {
+				t.Fatalf("test failed: %v", err)
+			}
+		})
+	}
+
+	entries, err := os.ReadDir("static/images")
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("test failed: %v", entries)
+	}
+	if _, err := os.Stat("evil.png"); err == nil {
+		t.Fatalf("test failed: file written outside static/images")
+	}
+
+	// The file of the red image is shared, so it stays while the user
+	// still has the image.
+	req, err := http.NewRequest("DELETE", "/3", nil)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+guestToken)
+	rr := httptest.NewRecorder()
+	images_api.ServeMux(a).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("test failed: %v", rr.Code)
+	}
+	entries, err = os.ReadDir("static/images")
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("test failed: %v", entries)
+	}
+}
+
+func TestConcurrentUpload(t *testing.T) {
+	data := rect(t, 5, 5, color.RGBA{255, 255, 0, 255})
+	ids := make([]int, 4)
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := upload(t, userToken, "yellow.png", data)
+			var image images.Image
+			err := json.Unmarshal(rr.Body.Bytes(), &image)
+			if rr.Code != http.StatusOK || err != nil {
+				t.Errorf("test failed: %v %s", rr.Code, rr.Body.String())
+			}
+			ids[i] = image.Id
+		}()
+	}
+	wg.Wait()
+	for _, id := range ids {
+		if id == 0 || id != ids[0] {
+			t.Fatalf("test failed: %v", ids)
+		}
+	}
+}
+
+func TestVariants(t *testing.T) {
+	tests := []struct {
+		width     int
+		thumbnail int
+		medium    int
+		files     int
+	}{
+		{320, 0, 0, 1},
+		{640, 320, 0, 2},
+		{1000, 320, 960, 3},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			data := rect(t, test.width, 10, color.RGBA{0, byte(i), 0, 255})
+			rr := upload(t, guestToken, "wide.png", data)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("test failed: %v %s", rr.Code, rr.Body.String())
+			}
+			var image images_api.Image
+			err := json.Unmarshal(rr.Body.Bytes(), &image)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			if image.Thumbnail.Width != test.thumbnail || image.Medium.Width != test.medium {
+				t.Fatalf("test failed: %v", image)
+			}
+			if image.URL != images.URLPrefix+image.Name ||
+				image.Preview != image.Image.Preview() || image.SrcSet != image.Image.SrcSet() {
+				t.Fatalf("test failed: %v", image)
+			}
+			if len(image.Files()) != test.files {
+				t.Fatalf("test failed: %v", image.Files())
+			}
+			for _, file := range image.Files() {
+				_, err := os.Stat("static/images/" + file)
+				if err != nil {
+					t.Fatalf("test failed: %v", err)
+				}
+			}
+
+			req, err := http.NewRequest("GET", "/?name="+image.Name+"&name=missing.png", nil)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			rr = httptest.NewRecorder()
+			images_api.ServeMux(a).ServeHTTP(rr, req)
+			var found []images_api.Image
+			err = json.Unmarshal(rr.Body.Bytes(), &found)
+			if err != nil || len(found) != 1 || found[0].Id != image.Id {
+				t.Fatalf("test failed: %v", rr.Body.String())
+			}
+
+			req, err = http.NewRequest("DELETE", fmt.Sprintf("/%d", image.Id), nil)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+guestToken)
+			rr = httptest.NewRecorder()
+			images_api.ServeMux(a).ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("test failed: %v", rr.Code)
+			}
+			for _, file := range image.Files() {
+				_, err := os.Stat("static/images/" + file)
+				if !os.IsNotExist(err) {
+					t.Fatalf("test failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestFile(t *testing.T) {
+	data := rect(t, 6, 6, color.RGBA{0, 255, 0, 255})
+	rr := upload(t, userToken, "green.png", data)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("test failed: %v %s", rr.Code, rr.Body.String())
+	}
+	var image images.Image
+	err := json.Unmarshal(rr.Body.Bytes(), &image)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	stored, err := os.ReadFile("static/images/" + image.Name)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		etag   string
+		status int
+	}{
+		{"/files/" + image.Name, "", http.StatusOK},
+		{"/files/" + image.Name, `"` + image.Name + `"`, http.StatusNotModified},
+		{"/files/missing.png", "", http.StatusNotFound},
+		{"/files/..%2Fimages.db", "", http.StatusNotFound},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			req, err := http.NewRequest("GET", test.path, nil)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			if test.etag != "" {
+				req.Header.Set("If-None-Match", test.etag)
+			}
+			rr := httptest.NewRecorder()
+			images_api.ServeMux(a).ServeHTTP(rr, req)
+			if rr.Code != test.status {
+				t.Fatalf("test failed: %v", rr.Code)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+			if !bytes.Equal(rr.Body.Bytes(), stored) ||
+				rr.Header().Get("Content-Type") != "image/png" ||
+				rr.Header().Get("ETag") != `"`+image.Name+`"` {
+				t.Fatalf("test failed: %v", rr.Header())
+			}
+		})
+	}
+}
+
+func TestSignedFile(t *testing.T) {
+	store, err := storage.NewS3(storage.S3Config{
+		Endpoint:  "http://localhost:9000",
+		Bucket:    "images",
+		AccessKey: "access",
+		SecretKey: "secret",
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	fs := a.Storage
+	a.Storage, a.Config.SignedURLs = store, true
+	defer func() {
+		a.Storage, a.Config.SignedURLs = fs, false
+	}()
+
+	req, err := http.NewRequest("GET", "/files/photo.jpg", nil)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	images_api.ServeMux(a).ServeHTTP(rr, req)
+	location := rr.Header().Get("Location")
+	if rr.Code != http.StatusFound ||
+		!strings.HasPrefix(location, "http://localhost:9000/images/photo.jpg?") ||
+		!strings.Contains(location, "X-Amz-Signature=") {
+		t.Fatalf("test failed: %v %v", rr.Code, location)
+	}
+}
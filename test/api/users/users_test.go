@@ -0,0 +1,199 @@
+package users_test
+
+import (
+	users_api "blog/api/users"
+	"blog/app"
+	"blog/config"
+	"blog/db/auth"
+	"blog/db/comments"
+	"blog/db/images"
+	"blog/db/posts"
+	"blog/db/profiles"
+	"blog/policy"
+	"blog/test/testutil"
+	"blog/util"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+var userToken, guestToken, adminToken string
+
+var a *app.App
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.DevMode = true
+	var err error
+	a, err = app.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	testutil.InitDB(a, ctx)
+	users := []auth.User{
+		{Id: 0, Username: "user", Password: "password"},
+		{Id: 1, Username: "guest", Password: "password"},
+		{Id: 2, Username: "admin", Password: "password"},
+	}
+	for _, user := range users {
+		err = auth.AddUser(a.DB, ctx, user)
+		if err != nil {
+			panic(err)
+		}
+	}
+	err = auth.SetRole(a.DB, ctx, 3, policy.RoleAdmin)
+	if err != nil {
+		panic(err)
+	}
+	for _, image := range []images.Image{{AuthorId: 1, Name: "user.png"}, {AuthorId: 2, Name: "guest.png"}} {
+		err = images.AddImage(a.DB, ctx, image)
+		if err != nil {
+			panic(err)
+		}
+	}
+	id, err := posts.AddPost(a.DB, ctx,
+		posts.Post{AuthorId: 1, Title: "First Post", Text: "Hello, World!"})
+	if err != nil {
+		panic(err)
+	}
+	_, err = comments.AddComment(a.DB, ctx,
+		comments.Comment{AuthorId: 1, PostId: id, Text: "Comment"})
+	if err != nil {
+		panic(err)
+	}
+	userToken, err = util.NewAccessToken(a, 1, "user", "test")
+	if err != nil {
+		panic(err)
+	}
+	guestToken, err = util.NewAccessToken(a, 2, "user", "test")
+	if err != nil {
+		panic(err)
+	}
+	adminToken, err = util.NewAccessToken(a, 3, "admin", "test")
+	if err != nil {
+		panic(err)
+	}
+	m.Run()
+}
+
+func TestUpdateProfile(t *testing.T) {
+	tests := []struct {
+		username string
+		profile  profiles.Profile
+		status   int
+		token    string
+	}{
+		{"user", profiles.Profile{DisplayName: "User", Bio: "Hello", AvatarId: 1}, http.StatusOK, userToken},
+		{"user", profiles.Profile{DisplayName: "User", AvatarId: 2}, http.StatusBadRequest, userToken},
+		{"user", profiles.Profile{DisplayName: "User", AvatarId: 3}, http.StatusBadRequest, userToken},
+		{"user", profiles.Profile{Website: "not a url"}, http.StatusBadRequest, userToken},
+		{"user", profiles.Profile{DisplayName: "Guest"}, http.StatusForbidden, guestToken},
+		{"user", profiles.Profile{}, http.StatusUnauthorized, ""},
+		{"guest", profiles.Profile{Website: "https://example.com", AvatarId: 2}, http.StatusOK, adminToken},
+		{"nobody", profiles.Profile{}, http.StatusNotFound, userToken},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			data, err := json.Marshal(test.profile)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			req, err := http.NewRequest("PUT", "/"+test.username, bytes.NewBuffer(data))
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+test.token)
+			rr := httptest.NewRecorder()
+			mux := users_api.ServeMux(a)
+			mux.ServeHTTP(rr, req)
+			if rr.Code != test.status {
+				t.Fatalf("test failed: %v", rr.Code)
+			}
+		})
+	}
+}
+
+func TestGetProfile(t *testing.T) {
+	tests := []struct {
+		username string
+		profile  profiles.Profile
+		status   int
+	}{
+		{"user", profiles.Profile{UserId: 1, Username: "user", DisplayName: "User", Bio: "Hello",
+			AvatarId: 1, Avatar: "user.png", Posts: 1, Comments: 1}, http.StatusOK},
+		{"guest", profiles.Profile{UserId: 2, Username: "guest", AvatarId: 2, Avatar: "guest.png",
+			Website: "https://example.com"}, http.StatusOK},
+		{"nobody", profiles.Profile{}, http.StatusNotFound},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/"+test.username, nil)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			rr := httptest.NewRecorder()
+			mux := users_api.ServeMux(a)
+			mux.ServeHTTP(rr, req)
+			if rr.Code != test.status {
+				t.Fatalf("test failed: %v", rr.Code)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+			var profile profiles.Profile
+			err = json.Unmarshal(rr.Body.Bytes(), &profile)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			if !reflect.DeepEqual(profile, test.profile) {
+				t.Fatalf("test failed: %v", profile)
+			}
+		})
+	}
+}
+
+func TestUserLists(t *testing.T) {
+	tests := []struct {
+		path   string
+		status int
+		count  int
+	}{
+		{"/user/posts", http.StatusOK, 1},
+		{"/guest/posts", http.StatusOK, 0},
+		{"/user/comments", http.StatusOK, 1},
+		{"/user/comments?limit=0", http.StatusBadRequest, 0},
+		{"/guest/images", http.StatusOK, 1},
+		{"/nobody/posts", http.StatusNotFound, 0},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			req, err := http.NewRequest("GET", test.path, nil)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			rr := httptest.NewRecorder()
+			mux := users_api.ServeMux(a)
+			mux.ServeHTTP(rr, req)
+			if rr.Code != test.status {
+				t.Fatalf("test failed: %v", rr.Code)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+			var list []json.RawMessage
+			err = json.Unmarshal(rr.Body.Bytes(), &list)
+			if err != nil || len(list) != test.count {
+				t.Fatalf("test failed: %v", rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package app_test
+
+import (
+	"blog/app"
+	"blog/config"
+	"blog/logging"
+	"blog/server"
+	"blog/test/testutil"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newApp returns an App with a database of its own, signing tokens with
+// the secret.
+func newApp(t *testing.T, secret string) *app.App {
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.Secret = secret
+	cfg.BaseURL = "https://blog.example.com"
+	cfg.StorageDir = t.TempDir()
+	a, err := app.New(cfg)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	t.Cleanup(func() { a.Close() })
+	testutil.RequireFTS5(t, a.DB)
+	err = a.InitDB(context.Background())
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	return a
+}
+
+func request(t *testing.T, handler http.Handler, method, url, token string, body any) *httptest.ResponseRecorder {
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+// signIn registers the user on the handler and returns an access token.
+func signIn(t *testing.T, handler http.Handler, username string) string {
+	user := map[string]string{"Username": username, "Password": "password"}
+	rr := request(t, handler, "POST", "/api/auth/register", "", user)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("test failed: %v %s", rr.Code, rr.Body)
+	}
+	rr = request(t, handler, "POST", "/api/auth/token", "", user)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("test failed: %v %s", rr.Code, rr.Body)
+	}
+	var tokens struct{ AccessToken string }
+	err := json.Unmarshal(rr.Body.Bytes(), &tokens)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	return tokens.AccessToken
+}
+
+func TestIsolation(t *testing.T) {
+	for i := range 4 {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Parallel()
+			a := newApp(t, fmt.Sprintf("secret %d", i))
+			other := newApp(t, "other")
+			handler := server.Handler(a)
+
+			// Every App has a database of its own, so the same user can
+			// register with both.
+			token := signIn(t, handler, "user")
+			signIn(t, server.Handler(other), "user")
+
+			post := map[string]string{"Title": "Post", "Text": "Text"}
+			rr := request(t, handler, "POST", "/api/posts/", token, post)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("test failed: %v %s", rr.Code, rr.Body)
+			}
+			rr = request(t, server.Handler(other), "POST", "/api/posts/", token, post)
+			if rr.Code != http.StatusUnauthorized {
+				t.Fatalf("test failed: %v", rr.Code)
+			}
+			rr = request(t, server.Handler(other), "GET", "/api/posts/1", "", nil)
+			if rr.Code != http.StatusNotFound {
+				t.Fatalf("test failed: %v", rr.Code)
+			}
+		})
+	}
+}
+
+func TestClock(t *testing.T) {
+	t.Parallel()
+	a := newApp(t, "clock")
+	handler := server.Handler(a)
+
+	// Tokens issued by a clock an hour behind have already expired.
+	a.Now = func() time.Time { return time.Now().Add(-time.Hour) }
+	token := signIn(t, handler, "user")
+	post := map[string]string{"Title": "Post", "Text": "Text"}
+	rr := request(t, handler, "POST", "/api/posts/", token, post)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("test failed: %v", rr.Code)
+	}
+
+	a.Now = time.Now
+	token = signIn(t, handler, "other")
+	rr = request(t, handler, "POST", "/api/posts/", token, post)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("test failed: %v %s", rr.Code, rr.Body)
+	}
+}
+
+func TestForeignKeys(t *testing.T) {
+	t.Parallel()
+	tests := []string{
+		":memory:",
+		":memory:?_busy_timeout=5000",
+		":memory:?_foreign_keys=off",
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			db, err := app.NewDB(test, 0)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			defer db.Close()
+
+			var foreignKeys int
+			err = db.QueryRowContext(context.Background(), "PRAGMA foreign_keys").Scan(&foreignKeys)
+			if err != nil || foreignKeys != 1 {
+				t.Fatalf("test failed: %v %v", err, foreignKeys)
+			}
+		})
+	}
+}
+
+// endless is a query that only stops when it is interrupted.
+const endless = `WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n)
+	SELECT count(*) FROM n`
+
+func TestQueryTimeout(t *testing.T) {
+	t.Parallel()
+	db, err := app.NewDB(":memory:", 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	defer db.Close()
+
+	var count int
+	start := time.Now()
+	err = db.QueryRowContext(context.Background(), endless).Scan(&count)
+	if err == nil || time.Since(start) > 5*time.Second {
+		t.Fatalf("test failed: %v %v", err, time.Since(start))
+	}
+
+	// The connection is still usable after a query was interrupted.
+	err = db.QueryRowContext(context.Background(), "SELECT 1").Scan(&count)
+	if err != nil || count != 1 {
+		t.Fatalf("test failed: %v %v", err, count)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	t.Parallel()
+	db, err := app.NewDB(":memory:", 0)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	defer db.Close()
+
+	// Without a query timeout the deadline of the request stops the query.
+	var queryErr error
+	handler := server.Timeout(50*time.Millisecond, http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var count int
+			queryErr = db.QueryRowContext(r.Context(), endless).Scan(&count)
+			if r.Context().Err() != context.DeadlineExceeded {
+				t.Errorf("test failed: %v", r.Context().Err())
+			}
+		}))
+	start := time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if queryErr == nil || time.Since(start) > 5*time.Second {
+		t.Fatalf("test failed: %v %v", queryErr, time.Since(start))
+	}
+
+	handler = server.Timeout(0, http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := r.Context().Deadline(); ok {
+				t.Errorf("test failed: request has a deadline")
+			}
+		}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestAccessLog(t *testing.T) {
+	t.Parallel()
+	a := newApp(t, "log")
+	var buf bytes.Buffer
+	var err error
+	a.Logger, err = logging.New(&buf, logging.FormatJSON)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	handler := server.Handler(a)
+
+	token := signIn(t, handler, "user")
+	buf.Reset()
+	post := map[string]string{"Title": "Post", "Text": "Text"}
+	rr := request(t, handler, "POST", "/api/posts/", token, post)
+	if rr.Code != http.StatusOK || rr.Header().Get(logging.RequestIDHeader) == "" {
+		t.Fatalf("test failed: %v %v", rr.Code, rr.Header())
+	}
+	var entry struct {
+		Msg       string
+		RequestId string `json:"request_id"`
+		Path      string
+		Status    int
+		UserId    int `json:"user_id"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &entry)
+	if err != nil {
+		t.Fatalf("test failed: %v %s", err, buf.String())
+	}
+	if entry.Msg != "request" || entry.RequestId != rr.Header().Get(logging.RequestIDHeader) ||
+		entry.Path != "/api/posts/" || entry.Status != http.StatusOK || entry.UserId != 1 {
+		t.Fatalf("test failed: %+v", entry)
+	}
+}
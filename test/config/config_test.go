@@ -0,0 +1,201 @@
+package config_test
+
+import (
+	"blog/config"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env returns a lookup function of the environment variables.
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(data), 0600)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	toml := writeFile(t, "blog.toml", `
+# Settings of the blog
+port = "9000"
+site-title = 'Notes # 1' # literal string
+"secret" = "file secret"
+request-timeout = "10s"
+max-image-size = 1_048_576
+signed-urls = true
+`)
+	yaml := writeFile(t, "blog.yaml", `
+# Settings of the blog
+port: 9000
+site-title: "Notes # 1"
+secret: file secret
+request-timeout: 10s
+max-image-size: 1048576
+signed-urls: true
+`)
+	for _, path := range []string{toml, yaml} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			cfg, err := config.Load(path, env(nil), nil)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			want := config.Default()
+			want.Port = "9000"
+			want.SiteTitle = "Notes # 1"
+			want.Secret = "file secret"
+			want.RequestTimeout = 10 * time.Second
+			want.MaxImageSize = 1 << 20
+			want.SignedURLs = true
+			if cfg != want {
+				t.Fatalf("test failed: %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	path := writeFile(t, "blog.toml", `
+port = "9000"
+ip = "0.0.0.0"
+depth = 2
+`)
+	vars := map[string]string{
+		"BLOG_PORT":        "9001",
+		"BLOG_DEPTH":       "3",
+		"BLOG_STORAGE_DIR": "/srv/images",
+		"S3_ACCESS_KEY":    "legacy",
+		"BLOG_S3_BUCKET":   "images",
+		"BLOG_S3_PREFIX":   "blog/",
+	}
+	fs := flag.NewFlagSet("blog", flag.ContinueOnError)
+	flags := config.Flags(fs)
+	err := fs.Parse([]string{"-port", "9002", "-dev", "-gc-age", "1h"})
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	cfg, err := config.Load(path, env(vars), flags)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	tests := []struct {
+		got  any
+		want any
+	}{
+		{cfg.IP, "0.0.0.0"},
+		{cfg.Port, "9002"},
+		{cfg.CommentDepth, 3},
+		{cfg.StorageDir, "/srv/images"},
+		{cfg.S3.AccessKey, "legacy"},
+		{cfg.S3.Bucket, "images"},
+		{cfg.S3.Prefix, "blog/"},
+		{cfg.DevMode, true},
+		{cfg.GCMinAge, time.Hour},
+		{cfg.Secret, config.DefaultSecret},
+	}
+	for i, test := range tests {
+		if test.got != test.want {
+			t.Fatalf("test %d failed: %v", i, test.got)
+		}
+	}
+
+	vars["BLOG_S3_ACCESS_KEY"] = "new"
+	cfg, err = config.Load("", env(vars), nil)
+	if err != nil || cfg.S3.AccessKey != "new" || cfg.Port != "9001" {
+		t.Fatalf("test failed: %v %+v", err, cfg)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		vars map[string]string
+	}{
+		{"blog.toml", `unknown = "value"`, nil},
+		{"blog.toml", `depth = "deep"`, nil},
+		{"blog.toml", "[s3]\nbucket = \"images\"", nil},
+		{"blog.toml", `port = [8080]`, nil},
+		{"blog.toml", `port = "8080`, nil},
+		{"blog.toml", `port = 8080 8081`, nil},
+		{"blog.toml", "port = 8080\nport = 8081", nil},
+		{"blog.yaml", "s3:\n  bucket: images", nil},
+		{"blog.yaml", "port: [8080]", nil},
+		{"blog.json", `{"port": "8080"}`, nil},
+		{"blog.toml", "", map[string]string{"BLOG_RATE": "fast"}},
+		{"blog.toml", "", map[string]string{"BLOG_PUBLISH": "60"}},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			path := writeFile(t, test.name, test.data)
+			_, err := config.Load(path, env(test.vars), nil)
+			if err == nil {
+				t.Fatalf("test failed: %v", err)
+			}
+		})
+	}
+
+	_, err := config.Load(filepath.Join(t.TempDir(), "missing.toml"), env(nil), nil)
+	if err == nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	fs := flag.NewFlagSet("blog", flag.ContinueOnError)
+	fs.SetOutput(&strings.Builder{})
+	config.Flags(fs)
+	err = fs.Parse([]string{"-depth", "deep"})
+	if err == nil {
+		t.Fatalf("test failed: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		change func(*config.Config)
+		valid  bool
+	}{
+		{func(c *config.Config) {}, false},
+		{func(c *config.Config) { c.DevMode = true }, true},
+		{func(c *config.Config) { c.Secret = "random" }, false},
+		{func(c *config.Config) { c.Secret, c.BaseURL = "random", "https://blog.example.com" }, true},
+		{func(c *config.Config) { c.Secret, c.DevMode = "", true }, false},
+		{func(c *config.Config) { c.DevMode, c.BaseURL = true, "https://blog.example.com/" }, true},
+		{func(c *config.Config) { c.DevMode, c.BaseURL = true, "blog.example.com" }, false},
+		{func(c *config.Config) { c.DevMode, c.BaseURL = true, "ftp://blog.example.com" }, false},
+		{func(c *config.Config) { c.DevMode, c.TemplateDir = true, "" }, false},
+		{func(c *config.Config) { c.DevMode, c.AccessTokenTTL = true, 0 }, false},
+		{func(c *config.Config) { c.DevMode, c.MaxImageSize = true, -1 }, false},
+		{func(c *config.Config) { c.DevMode, c.QueryTimeout = true, -time.Second }, false},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			cfg := config.Default()
+			test.change(&cfg)
+			err := cfg.Validate()
+			if (err == nil) != test.valid {
+				t.Fatalf("test failed: %v", err)
+			}
+		})
+	}
+
+	cfg := config.Default()
+	if cfg.Host() != "http://localhost:8080" {
+		t.Fatalf("test failed: %v", cfg.Host())
+	}
+	cfg.BaseURL = "https://blog.example.com/"
+	if cfg.Host() != "https://blog.example.com" {
+		t.Fatalf("test failed: %v", cfg.Host())
+	}
+}
@@ -0,0 +1,222 @@
+package albums_test
+
+import (
+	"blog/app"
+	"blog/config"
+	"blog/db/albums"
+	"blog/db/auth"
+	"blog/db/images"
+	"blog/test/testutil"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var a *app.App
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.DevMode = true
+	var err error
+	a, err = app.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	testutil.InitDB(a, ctx)
+	for _, user := range []auth.User{
+		{Username: "user", Password: "password"},
+		{Username: "guest", Password: "password"},
+	} {
+		err = auth.AddUser(a.DB, ctx, user)
+		if err != nil {
+			panic(err)
+		}
+	}
+	for _, image := range []images.Image{
+		{AuthorId: 1, Name: "first.png"},
+		{AuthorId: 2, Name: "second.png"},
+		{AuthorId: 2, Name: "third.png"},
+	} {
+		err = images.AddImage(a.DB, ctx, image)
+		if err != nil {
+			panic(err)
+		}
+	}
+	m.Run()
+}
+
+func TestValidName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"Holidays", true},
+		{"Café 2024", true},
+		{strings.Repeat("é", albums.MaxName), true},
+		{strings.Repeat("a", albums.MaxName+1), false},
+		{"", false},
+		{"   ", false},
+		{"tab\tname", false},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			if albums.ValidName(test.name) != test.valid {
+				t.Fatalf("test failed: %q", test.name)
+			}
+		})
+	}
+}
+
+func TestAddAlbum(t *testing.T) {
+	tests := []struct {
+		album albums.Album
+		id    int
+		error bool
+	}{
+		{albums.Album{AuthorId: 1, Name: "Travel"}, 1, false},
+		{albums.Album{AuthorId: 1, Name: "Cats"}, 2, false},
+		{albums.Album{AuthorId: 2, Name: "Travel"}, 3, false},
+		{albums.Album{AuthorId: 1, Name: "Travel"}, 0, true},
+		{albums.Album{AuthorId: 1, Name: ""}, 0, true},
+		{albums.Album{AuthorId: 3, Name: "Nobody"}, 0, true},
+		{albums.Album{Name: "Nobody"}, 0, true},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			id, err := albums.AddAlbum(a.DB, ctx, test.album)
+			if (err != nil) != test.error || id != test.id {
+				t.Fatalf("test failed: %v %v", id, err)
+			}
+		})
+	}
+}
+
+func TestGetUserAlbums(t *testing.T) {
+	albumList, err := albums.GetUserAlbums(a.DB, ctx, 1)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	var names []string
+	for _, album := range albumList {
+		if album.AuthorId != 1 || album.Author != "user" {
+			t.Fatalf("test failed: %v", album)
+		}
+		names = append(names, album.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Cats", "Travel"}) {
+		t.Fatalf("test failed: %v", names)
+	}
+
+	album, err := albums.GetAlbumByName(a.DB, ctx, 2, "Travel")
+	if err != nil || album.Id != 3 {
+		t.Fatalf("test failed: %v %v", album, err)
+	}
+	_, err = albums.GetAlbumByName(a.DB, ctx, 2, "Cats")
+	if err == nil {
+		t.Fatalf("test failed: album of another user found")
+	}
+}
+
+func TestAlbumImages(t *testing.T) {
+	steps := []struct {
+		add    []int
+		remove []int
+		ids    []int
+	}{
+		{[]int{1, 2}, nil, []int{2, 1}},
+		{[]int{1, 3}, nil, []int{3, 2, 1}},
+		{nil, []int{2, 4}, []int{3, 1}},
+	}
+	for i, step := range steps {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			for _, id := range step.add {
+				err := albums.AddImage(a.DB, ctx, 1, id)
+				if err != nil {
+					t.Fatalf("test failed: %v", err)
+				}
+			}
+			for _, id := range step.remove {
+				err := albums.RemoveImage(a.DB, ctx, 1, id)
+				if err != nil {
+					t.Fatalf("test failed: %v", err)
+				}
+			}
+			imageList, err := images.GetAlbumImages(a.DB, ctx, 1)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			var ids []int
+			for _, image := range imageList {
+				ids = append(ids, image.Id)
+			}
+			if !reflect.DeepEqual(ids, step.ids) {
+				t.Fatalf("test failed: %v", ids)
+			}
+			album, err := albums.GetAlbum(a.DB, ctx, 1)
+			if err != nil || album.Count != len(step.ids) {
+				t.Fatalf("test failed: %v %v", album, err)
+			}
+		})
+	}
+
+	err := albums.AddImage(a.DB, ctx, 1, 100)
+	if err == nil {
+		t.Fatalf("test failed: missing image added")
+	}
+	err = images.DeleteImage(a.DB, ctx, 3)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	album, err := albums.GetAlbum(a.DB, ctx, 1)
+	if err != nil || album.Count != 1 {
+		t.Fatalf("test failed: %v %v", album, err)
+	}
+}
+
+func TestRenameAlbum(t *testing.T) {
+	err := albums.RenameAlbum(a.DB, ctx, 2, "Dogs")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	album, err := albums.GetAlbum(a.DB, ctx, 2)
+	if err != nil || album.Name != "Dogs" {
+		t.Fatalf("test failed: %v %v", album, err)
+	}
+	err = albums.RenameAlbum(a.DB, ctx, 2, "Travel")
+	if err == nil {
+		t.Fatalf("test failed: duplicate name")
+	}
+	err = albums.RenameAlbum(a.DB, ctx, 2, "")
+	if err == nil {
+		t.Fatalf("test failed: empty name")
+	}
+}
+
+func TestDeleteAlbum(t *testing.T) {
+	err := albums.DeleteAlbum(a.DB, ctx, 1)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	_, err = albums.GetAlbum(a.DB, ctx, 1)
+	if err == nil {
+		t.Fatalf("test failed: album not deleted")
+	}
+	_, err = images.GetImage(a.DB, ctx, 1)
+	if err != nil {
+		t.Fatalf("test failed: image deleted with album: %v", err)
+	}
+
+	err = auth.DeleteUser(a.DB, ctx, 2, auth.DeleteAnonymize)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	albumList, err := albums.GetUserAlbums(a.DB, ctx, 2)
+	if err != nil || len(albumList) != 0 {
+		t.Fatalf("test failed: %v %v", albumList, err)
+	}
+}
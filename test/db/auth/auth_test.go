@@ -1,27 +1,36 @@
 package auth_test
 
 import (
+	"blog/app"
 	"blog/config"
 	"blog/db/auth"
+	"blog/db/comments"
+	"blog/db/images"
+	"blog/db/likes"
+	"blog/db/posts"
+	"blog/db/revisions"
+	"blog/test/testutil"
+	"context"
+	"database/sql"
 	"fmt"
-	"os"
 	"testing"
+	"time"
 )
 
+var a *app.App
+
+var ctx = context.Background()
+
 func TestMain(m *testing.M) {
-	err := os.Chdir("../../..")
-	if err != nil {
-		panic(err)
-	}
-	config.DBFile = ":memory:"
-	err = config.Setup()
-	if err != nil {
-		panic(err)
-	}
-	err = config.InitDB()
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.DevMode = true
+	var err error
+	a, err = app.New(cfg)
 	if err != nil {
 		panic(err)
 	}
+	testutil.InitDB(a, ctx)
 	m.Run()
 }
 
@@ -39,7 +48,7 @@ func TestAddUser(t *testing.T) {
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			err := auth.AddUser(config.DB, config.Ctx, test.user)
+			err := auth.AddUser(a.DB, ctx, test.user)
 			if (err != nil) != test.error {
 				t.Fatalf("test failed: %v", err)
 			}
@@ -52,23 +61,308 @@ func TestGetUser(t *testing.T) {
 		user  auth.User
 		error bool
 	}{
-		{auth.User{Id: 1, Username: "user", Password: "password"}, false},
-		{auth.User{Id: 2, Username: "guest", Password: "password"}, false},
+		{auth.User{Id: 1, Username: "user", Password: "password", Role: "user"}, false},
+		{auth.User{Id: 2, Username: "guest", Password: "password", Role: "user"}, false},
 		{auth.User{Id: 3, Username: "johndoe"}, true},
 		{auth.User{Id: 1}, true},
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			user, err := auth.GetUser(config.DB, config.Ctx, test.user.Username)
+			user, err := auth.GetUser(a.DB, ctx, test.user.Username)
+			if (err != nil) != test.error {
+				t.Fatalf("test failed: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if user != test.user {
+				t.Fatalf("test failed: %v", user)
+			}
+		})
+	}
+}
+
+func TestUpdatePassword(t *testing.T) {
+	tests := []struct {
+		user  auth.User
+		error bool
+	}{
+		{auth.User{Id: 1, Username: "user", Password: "new password", Role: "user"}, false},
+		{auth.User{Id: 2, Username: "guest"}, true},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			err := auth.UpdatePassword(a.DB, ctx, test.user.Id, test.user.Password)
+			if (err != nil) != test.error {
+				t.Fatalf("test failed: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			user, err := auth.GetUser(a.DB, ctx, test.user.Username)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			if user != test.user {
+				t.Fatalf("test failed: %v", user)
+			}
+		})
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	token := auth.RefreshToken{TokenHash: "hash", Family: "family", UserId: 1,
+		Expires: time.Now().Add(time.Hour)}
+	err := auth.AddRefreshToken(a.DB, ctx, token)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	err = auth.AddRefreshToken(a.DB, ctx, auth.RefreshToken{Family: "family", UserId: 1})
+	if err == nil {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	dbToken, err := auth.GetRefreshToken(a.DB, ctx, "hash")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	if dbToken.Family != "family" || dbToken.UserId != 1 || dbToken.Used || dbToken.Revoked || dbToken.UsedAt != nil {
+		t.Fatalf("test failed: %v", dbToken)
+	}
+
+	usedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i, expected := range []bool{true, false} {
+		ok, err := auth.UseRefreshToken(a.DB, ctx, dbToken.Id, usedAt.Add(time.Duration(i)*time.Minute))
+		if err != nil || ok != expected {
+			t.Fatalf("test failed: %d %v", i, err)
+		}
+	}
+	dbToken, err = auth.GetRefreshToken(a.DB, ctx, "hash")
+	if err != nil || !dbToken.Used || dbToken.UsedAt == nil || !dbToken.UsedAt.Equal(usedAt) {
+		t.Fatalf("test failed: %v %v", err, dbToken)
+	}
+
+	revoked, err := auth.IsFamilyRevoked(a.DB, ctx, "family")
+	if err != nil || revoked {
+		t.Fatalf("test failed: %v", err)
+	}
+	err = auth.RevokeFamily(a.DB, ctx, "family")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	revoked, err = auth.IsFamilyRevoked(a.DB, ctx, "family")
+	if err != nil || !revoked {
+		t.Fatalf("test failed: %v", err)
+	}
+}
+
+func TestSetRole(t *testing.T) {
+	tests := []struct {
+		user  auth.User
+		error bool
+	}{
+		{auth.User{Id: 2, Username: "guest", Password: "password", Role: "moderator"}, false},
+		{auth.User{Id: 2, Username: "guest", Password: "password", Role: "owner"}, true},
+		{auth.User{Id: 2, Username: "guest", Password: "password"}, true},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			err := auth.SetRole(a.DB, ctx, test.user.Id, test.user.Role)
 			if (err != nil) != test.error {
 				t.Fatalf("test failed: %v", err)
 			}
 			if err != nil {
 				return
 			}
+			user, err := auth.GetUserById(a.DB, ctx, test.user.Id)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
 			if user != test.user {
 				t.Fatalf("test failed: %v", user)
 			}
 		})
 	}
 }
+
+func TestValidUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		valid    bool
+	}{
+		{"user", true},
+		{"jane.doe-42", true},
+		{"", false},
+		{auth.DeletedUser, false},
+		{"john doe", false},
+		{"john/doe", false},
+		{"abcdefghijklmnopqrstuvwxyz1234567", false},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			valid := auth.ValidUsername(test.username)
+			if valid != test.valid {
+				t.Fatalf("test failed: %v", valid)
+			}
+		})
+	}
+}
+
+func TestRename(t *testing.T) {
+	err := auth.Rename(a.DB, ctx, 2, "renamed")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	user, err := auth.GetUserById(a.DB, ctx, 2)
+	if err != nil || user.Username != "renamed" {
+		t.Fatalf("test failed: %v", user)
+	}
+	err = auth.Rename(a.DB, ctx, 2, "user")
+	if err == nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	err = auth.Rename(a.DB, ctx, 2, auth.DeletedUser)
+	if err == nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	err = auth.Rename(a.DB, ctx, 2, "guest")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	for _, family := range []string{"first", "second"} {
+		err := auth.AddRefreshToken(a.DB, ctx, auth.RefreshToken{
+			TokenHash: "user-" + family, Family: family, UserId: 1,
+			Expires: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("test failed: %v", err)
+		}
+	}
+	err := auth.RevokeUserTokens(a.DB, ctx, 1, "second")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	revoked, err := auth.IsFamilyRevoked(a.DB, ctx, "first")
+	if err != nil || !revoked {
+		t.Fatalf("test failed: %v", err)
+	}
+	revoked, err = auth.IsFamilyRevoked(a.DB, ctx, "second")
+	if err != nil || revoked {
+		t.Fatalf("test failed: %v", err)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	tests := []struct {
+		username string
+		mode     string
+		kept     bool
+		error    bool
+	}{
+		{"anonymous", auth.DeleteAnonymize, true, false},
+		{"anonymized", auth.DeleteAnonymize, true, false},
+		{"cascaded", auth.DeleteCascade, false, false},
+		{"unknown", "archive", false, true},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			err := auth.AddUser(a.DB, ctx,
+				auth.User{Username: test.username, Password: "password"})
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			user, err := auth.GetUser(a.DB, ctx, test.username)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+
+			postId, err := posts.AddPost(a.DB, ctx,
+				posts.Post{AuthorId: user.Id, Title: "Post", Text: "Text"})
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			otherId, err := posts.AddPost(a.DB, ctx,
+				posts.Post{AuthorId: 1, Title: "Other", Text: "Text"})
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			err = posts.UpdatePost(a.DB, ctx, otherId, user.Id,
+				posts.Post{Title: "Other", Text: "Edited"})
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			_, err = comments.AddComment(a.DB, ctx,
+				comments.Comment{AuthorId: user.Id, PostId: otherId, Text: "Comment"})
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			err = likes.AddLike(a.DB, ctx, user.Id, otherId, "like")
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			// Every user uploads the same image, which the placeholder
+			// can only have once.
+			err = images.AddImage(a.DB, ctx,
+				images.Image{AuthorId: user.Id, Name: "shared.png"})
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			image, err := images.GetUserImageByName(a.DB, ctx, user.Id, "shared.png")
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			err = images.SetPostImages(a.DB, ctx, otherId, []int{image.Id})
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+
+			err = auth.DeleteUser(a.DB, ctx, user.Id, test.mode)
+			if (err != nil) != test.error {
+				t.Fatalf("test failed: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			_, err = auth.GetUserById(a.DB, ctx, user.Id)
+			if err != sql.ErrNoRows {
+				t.Fatalf("test failed: %v", err)
+			}
+
+			post, err := posts.GetPost(a.DB, ctx, postId)
+			if test.kept && (err != nil || post.Author != auth.DeletedUser) {
+				t.Fatalf("test failed: %v, %v", post, err)
+			}
+			if !test.kept && err != sql.ErrNoRows {
+				t.Fatalf("test failed: %v", err)
+			}
+			other, err := posts.GetPost(a.DB, ctx, otherId)
+			if err != nil || other.Likes != 0 || (other.Comments == 1) != test.kept {
+				t.Fatalf("test failed: %v, %v", other, err)
+			}
+			userImages, err := images.GetUserImages(a.DB, ctx, user.Id)
+			if err != nil || len(userImages) != 0 {
+				t.Fatalf("test failed: %v", userImages)
+			}
+			attached, err := images.GetPostImages(a.DB, ctx, otherId)
+			if err != nil || (len(attached) == 1) != test.kept {
+				t.Fatalf("test failed: %v %v", attached, err)
+			}
+			revisionList, err := revisions.GetRevisions(a.DB, ctx, otherId)
+			if err != nil || len(revisionList) != 2 || revisionList[0].Editor != auth.DeletedUser {
+				t.Fatalf("test failed: %v", revisionList)
+			}
+		})
+	}
+
+	placeholder, err := auth.GetUser(a.DB, ctx, auth.DeletedUser)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	err = auth.DeleteUser(a.DB, ctx, placeholder.Id, auth.DeleteCascade)
+	if err == nil {
+		t.Fatalf("test failed: %v", err)
+	}
+}
@@ -1,37 +1,41 @@
 package comments_test
 
 import (
+	"blog/app"
 	"blog/config"
 	"blog/db/auth"
 	"blog/db/comments"
+	"blog/db/likes"
+	"blog/db/page"
 	"blog/db/posts"
+	"blog/test/testutil"
+	"context"
 	"fmt"
-	"os"
 	"reflect"
 	"testing"
 	"time"
 )
 
+var a *app.App
+
+var ctx = context.Background()
+
 func TestMain(m *testing.M) {
-	err := os.Chdir("../../..")
-	if err != nil {
-		panic(err)
-	}
-	config.DBFile = ":memory:"
-	err = config.Setup()
-	if err != nil {
-		panic(err)
-	}
-	err = config.InitDB()
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.DevMode = true
+	var err error
+	a, err = app.New(cfg)
 	if err != nil {
 		panic(err)
 	}
+	testutil.InitDB(a, ctx)
 	users := []auth.User{
 		{Id: 1, Username: "user", Password: "password"},
 		{Id: 2, Username: "guest", Password: "password"},
 	}
 	for _, user := range users {
-		err = auth.AddUser(config.DB, config.Ctx, user)
+		err = auth.AddUser(a.DB, ctx, user)
 		if err != nil {
 			panic(err)
 		}
@@ -41,7 +45,7 @@ func TestMain(m *testing.M) {
 		{AuthorId: 2, Title: "New Post", Text: "Post Text"},
 	}
 	for _, post := range postList {
-		_, err = posts.AddPost(config.DB, config.Ctx, post)
+		_, err = posts.AddPost(a.DB, ctx, post)
 		if err != nil {
 			panic(err)
 		}
@@ -68,7 +72,7 @@ func TestAddComment(t *testing.T) {
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			err := comments.AddComment(config.DB, config.Ctx, test.comment)
+			_, err := comments.AddComment(a.DB, ctx, test.comment)
 			if (err != nil) != test.error {
 				t.Fatalf("test failed: %v", err)
 			}
@@ -93,7 +97,7 @@ func TestGetComments(t *testing.T) {
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			commentList, err := comments.GetComments(config.DB, config.Ctx, test.postid)
+			commentList, err := comments.GetComments(a.DB, ctx, test.postid)
 			if err != nil {
 				t.Fatalf("test failed: %v", err)
 			}
@@ -121,7 +125,7 @@ func TestGetComment(t *testing.T) {
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			comment, err := comments.GetComment(config.DB, config.Ctx, test.comment.Id)
+			comment, err := comments.GetComment(a.DB, ctx, test.comment.Id)
 			if (err != nil) != test.error {
 				t.Fatalf("test failed: %v", err)
 			}
@@ -130,7 +134,7 @@ func TestGetComment(t *testing.T) {
 			}
 			var zero time.Time
 			comment.Created = zero
-			if comment != test.comment {
+			if !reflect.DeepEqual(comment, test.comment) {
 				t.Fatalf("test failed: %v", comment)
 			}
 		})
@@ -148,30 +152,175 @@ func TestUpdateComment(t *testing.T) {
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			err := comments.UpdateComment(config.DB, config.Ctx, test.comment.Id, test.comment)
+			err := comments.UpdateComment(a.DB, ctx, test.comment.Id, test.comment)
 			if err != nil {
 				t.Fatalf("test failed: %v", err)
 			}
-			comment, err := comments.GetComment(config.DB, config.Ctx, test.comment.Id)
+			comment, err := comments.GetComment(a.DB, ctx, test.comment.Id)
 			if err != nil {
 				t.Fatalf("test failed: %v", err)
 			}
 			var zero time.Time
 			comment.Created = zero
-			if comment != test.comment {
+			if !reflect.DeepEqual(comment, test.comment) {
 				t.Fatalf("test failed: %v", comment)
 			}
 		})
 	}
 }
 
+func TestReplies(t *testing.T) {
+	tests := []struct {
+		comment comments.Comment
+		error   bool
+	}{
+		{comments.Comment{AuthorId: 2, PostId: 1, ParentId: 1, Text: "First Reply"}, false},
+		{comments.Comment{AuthorId: 1, PostId: 1, ParentId: 5, Text: "Second Reply"}, false},
+		{comments.Comment{AuthorId: 2, PostId: 1, ParentId: 6, Text: "Third Reply"}, false},
+		{comments.Comment{AuthorId: 1, PostId: 1, ParentId: 3, Text: "Wrong Post"}, true},
+		{comments.Comment{AuthorId: 1, PostId: 1, ParentId: 100, Text: "No Parent"}, true},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			_, err := comments.AddComment(a.DB, ctx, test.comment)
+			if (err != nil) != test.error {
+				t.Fatalf("test failed: %v", err)
+			}
+		})
+	}
+
+	reply, err := comments.GetComment(a.DB, ctx, 7)
+	if err != nil || reply.ParentId != 6 || reply.Depth != 3 {
+		t.Fatalf("test failed: %v", reply)
+	}
+
+	depths := []struct {
+		maxDepth int
+		ids      [][]int
+	}{
+		{4, [][]int{{1, 0}, {5, 1}, {6, 2}, {7, 3}}},
+		{2, [][]int{{1, 0}, {5, 1}, {6, 2}, {7, 2}}},
+		{1, [][]int{{1, 0}, {5, 1}, {6, 1}, {7, 1}}},
+	}
+	for i, test := range depths {
+		t.Run(fmt.Sprintf("depth %d", i), func(t *testing.T) {
+			tree, _, err := comments.GetCommentsPage(a.DB, ctx, 1,
+				page.Cursor{}, 1, test.maxDepth, comments.OrderNew)
+			if err != nil || len(tree) != 1 || comments.Count(tree) != 4 {
+				t.Fatalf("test failed: %v, %v", tree, err)
+			}
+			var ids [][]int
+			var walk func([]comments.Comment)
+			walk = func(list []comments.Comment) {
+				for _, comment := range list {
+					ids = append(ids, []int{comment.Id, comment.Depth})
+					walk(comment.Replies)
+				}
+			}
+			walk(tree)
+			if !reflect.DeepEqual(ids, test.ids) {
+				t.Fatalf("test failed: %v", ids)
+			}
+		})
+	}
+}
+
+func TestTree(t *testing.T) {
+	now := time.Now()
+	list := []comments.Comment{
+		{Id: 3, ParentId: 1, Created: now.Add(2 * time.Second)},
+		{Id: 2, Created: now},
+		{Id: 4, ParentId: 1, Created: now.Add(time.Second)},
+		{Id: 1, Created: now},
+		{Id: 5, ParentId: 4, Created: now.Add(3 * time.Second)},
+	}
+	tree := comments.Tree(list, 1, comments.OrderNew)
+	if len(tree) != 2 || tree[0].Id != 2 || tree[1].Id != 1 {
+		t.Fatalf("test failed: %v", tree)
+	}
+	var ids []int
+	for _, reply := range tree[1].Replies {
+		if reply.Replies != nil || reply.Depth != 1 {
+			t.Fatalf("test failed: %v", reply)
+		}
+		ids = append(ids, reply.Id)
+	}
+	if !reflect.DeepEqual(ids, []int{4, 3, 5}) {
+		t.Fatalf("test failed: %v", ids)
+	}
+}
+
+func TestTopComments(t *testing.T) {
+	_, err := comments.AddComment(a.DB, ctx,
+		comments.Comment{AuthorId: 1, PostId: 2, Text: "Fifth Comment"})
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	votes := []struct {
+		userId, commentId int
+		likeType          string
+	}{
+		{1, 4, "like"},
+		{2, 4, "like"},
+		{1, 3, "dislike"},
+	}
+	for _, vote := range votes {
+		err = likes.AddCommentLike(a.DB, ctx, vote.userId, vote.commentId, vote.likeType)
+		if err != nil {
+			t.Fatalf("test failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		order  comments.Order
+		ids    []int
+		scores []int
+	}{
+		{comments.OrderNew, []int{3, 4, 8}, []int{-1, 2, 0}},
+		{comments.OrderTop, []int{4, 8, 3}, []int{2, 0, -1}},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			var ids, scores []int
+			var after page.Cursor
+			for {
+				list, next, err := comments.GetCommentsPage(a.DB, ctx, 2,
+					after, 1, 1, test.order)
+				if err != nil {
+					t.Fatalf("test failed: %v", err)
+				}
+				for _, comment := range list {
+					ids = append(ids, comment.Id)
+					scores = append(scores, comment.Score)
+				}
+				if next.IsZero() {
+					break
+				}
+				after, err = page.Parse(next.String())
+				if err != nil || after != next {
+					t.Fatalf("test failed: %v, %v", after, err)
+				}
+			}
+			if !reflect.DeepEqual(ids, test.ids) || !reflect.DeepEqual(scores, test.scores) {
+				t.Fatalf("test failed: %v, %v", ids, scores)
+			}
+		})
+	}
+}
+
 func TestDeleteComment(t *testing.T) {
 	for i := range 5 {
-		err := comments.DeleteComment(config.DB, config.Ctx, i+1)
+		err := comments.DeleteComment(a.DB, ctx, i+1)
 		if err != nil {
 			t.Fatalf("test failed: %v", err)
 		}
-		comment, err := comments.GetComment(config.DB, config.Ctx, i+1)
+		comment, err := comments.GetComment(a.DB, ctx, i+1)
+		if err == nil {
+			t.Fatalf("test failed: %v", comment)
+		}
+	}
+	for _, id := range []int{6, 7} {
+		comment, err := comments.GetComment(a.DB, ctx, id)
 		if err == nil {
 			t.Fatalf("test failed: %v", comment)
 		}
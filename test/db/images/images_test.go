@@ -1,36 +1,41 @@
 package images_test
 
 import (
+	"blog/app"
 	"blog/config"
 	"blog/db/auth"
 	"blog/db/images"
+	"blog/db/page"
+	"blog/db/posts"
+	"blog/test/testutil"
+	"context"
 	"fmt"
-	"os"
 	"reflect"
+	"sort"
 	"testing"
 	"time"
 )
 
+var a *app.App
+
+var ctx = context.Background()
+
 func TestMain(m *testing.M) {
-	err := os.Chdir("../../..")
-	if err != nil {
-		panic(err)
-	}
-	config.DBFile = ":memory:"
-	err = config.Setup()
-	if err != nil {
-		panic(err)
-	}
-	err = config.InitDB()
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.DevMode = true
+	var err error
+	a, err = app.New(cfg)
 	if err != nil {
 		panic(err)
 	}
+	testutil.InitDB(a, ctx)
 	users := []auth.User{
 		{Id: 1, Username: "user", Password: "password"},
 		{Id: 2, Username: "guest", Password: "password"},
 	}
 	for _, user := range users {
-		err = auth.AddUser(config.DB, config.Ctx, user)
+		err = auth.AddUser(a.DB, ctx, user)
 		if err != nil {
 			panic(err)
 		}
@@ -43,18 +48,21 @@ func TestAddImage(t *testing.T) {
 		image images.Image
 		error bool
 	}{
-		{images.Image{AuthorId: 1, Name: "photo.jpg"}, false},
-		{images.Image{AuthorId: 1, Name: "photo.jpg"}, false},
+		{images.Image{AuthorId: 1, Name: "photo.jpg", Original: "Photo.JPG",
+			Type: "image/jpeg", Size: 2048, Width: 640, Height: 480}, false},
 		{images.Image{AuthorId: 1, Name: "picture.jpg"}, false},
 		{images.Image{AuthorId: 2, Name: "picture.png"}, false},
-		{images.Image{AuthorId: 2, Name: "landscape.jpg"}, false},
+		{images.Image{AuthorId: 2, Name: "landscape.jpg", Width: 1200, Height: 800,
+			Thumbnail: images.Variant{Name: "landscape-320.jpg", Width: 320, Height: 213},
+			Medium:    images.Variant{Name: "landscape-960.jpg", Width: 960, Height: 640}}, false},
+		{images.Image{AuthorId: 1, Name: "photo.jpg"}, false},
 		{images.Image{AuthorId: 3, Name: "ethereal.jpg"}, true},
 		{images.Image{AuthorId: 1}, true},
 		{images.Image{}, true},
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			err := images.AddImage(config.DB, config.Ctx, test.image)
+			err := images.AddImage(a.DB, ctx, test.image)
 			if (err != nil) != test.error {
 				t.Fatalf("test failed: %v", err)
 			}
@@ -64,12 +72,15 @@ func TestAddImage(t *testing.T) {
 
 func TestGetImages(t *testing.T) {
 	imageList := []images.Image{
-		{Id: 1, AuthorId: 1, Name: "photo.jpg"},
-		{Id: 3, AuthorId: 1, Name: "picture.jpg"},
-		{Id: 4, AuthorId: 2, Name: "picture.png"},
-		{Id: 5, AuthorId: 2, Name: "landscape.jpg"},
+		{Id: 1, AuthorId: 1, Name: "photo.jpg", Original: "Photo.JPG",
+			Type: "image/jpeg", Size: 2048, Width: 640, Height: 480},
+		{Id: 2, AuthorId: 1, Name: "picture.jpg"},
+		{Id: 3, AuthorId: 2, Name: "picture.png"},
+		{Id: 4, AuthorId: 2, Name: "landscape.jpg", Width: 1200, Height: 800,
+			Thumbnail: images.Variant{Name: "landscape-320.jpg", Width: 320, Height: 213},
+			Medium:    images.Variant{Name: "landscape-960.jpg", Width: 960, Height: 640}},
 	}
-	dbImages, err := images.GetImages(config.DB, config.Ctx)
+	dbImages, err := images.GetImages(a.DB, ctx)
 	if err != nil {
 		t.Fatalf("test failed: %v", err)
 	}
@@ -82,21 +93,62 @@ func TestGetImages(t *testing.T) {
 	}
 }
 
+func TestGetImagesPage(t *testing.T) {
+	_, err := a.DB.ExecContext(ctx,
+		"UPDATE images SET created = datetime('2024-01-01', '+' || id || ' days')")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	tests := []struct {
+		ids  []int
+		last bool
+	}{
+		{[]int{4, 3, 2}, false},
+		{[]int{1}, true},
+	}
+	var after page.Cursor
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			imageList, next, err := images.GetImagesPage(a.DB, ctx, after, 3)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			var ids []int
+			for _, image := range imageList {
+				ids = append(ids, image.Id)
+			}
+			if !reflect.DeepEqual(ids, test.ids) {
+				t.Fatalf("test failed: %v", ids)
+			}
+			if next.IsZero() != test.last {
+				t.Fatalf("test failed: %v", next)
+			}
+			after, err = page.Parse(next.String())
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+		})
+	}
+}
+
 func TestGetImage(t *testing.T) {
 	tests := []struct {
 		image images.Image
 		error bool
 	}{
-		{images.Image{Id: 1, AuthorId: 1, Name: "photo.jpg"}, false},
-		{images.Image{Id: 3, AuthorId: 1, Name: "picture.jpg"}, false},
-		{images.Image{Id: 4, AuthorId: 2, Name: "picture.png"}, false},
-		{images.Image{Id: 5, AuthorId: 2, Name: "landscape.jpg"}, false},
-		{images.Image{Id: 6, AuthorId: 1}, true},
-		{images.Image{Id: 7}, true},
+		{images.Image{Id: 1, AuthorId: 1, Name: "photo.jpg", Original: "Photo.JPG",
+			Type: "image/jpeg", Size: 2048, Width: 640, Height: 480}, false},
+		{images.Image{Id: 2, AuthorId: 1, Name: "picture.jpg"}, false},
+		{images.Image{Id: 3, AuthorId: 2, Name: "picture.png"}, false},
+		{images.Image{Id: 4, AuthorId: 2, Name: "landscape.jpg", Width: 1200, Height: 800,
+			Thumbnail: images.Variant{Name: "landscape-320.jpg", Width: 320, Height: 213},
+			Medium:    images.Variant{Name: "landscape-960.jpg", Width: 960, Height: 640}}, false},
+		{images.Image{Id: 5, AuthorId: 1}, true},
+		{images.Image{Id: 6}, true},
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			image, err := images.GetImage(config.DB, config.Ctx, test.image.Id)
+			image, err := images.GetImage(a.DB, ctx, test.image.Id)
 			if (err != nil) != test.error {
 				t.Fatalf("test failed: %v", err)
 			}
@@ -112,13 +164,215 @@ func TestGetImage(t *testing.T) {
 	}
 }
 
+func TestGetImagesByName(t *testing.T) {
+	tests := []struct {
+		names []string
+		ids   []int
+	}{
+		{[]string{"photo.jpg", "landscape.jpg"}, []int{1, 4}},
+		{[]string{"landscape.jpg", "missing.jpg"}, []int{4}},
+		{[]string{"landscape-320.jpg"}, nil},
+		{nil, nil},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			imageList, err := images.GetImagesByName(a.DB, ctx, test.names)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			var ids []int
+			for _, image := range imageList {
+				ids = append(ids, image.Id)
+			}
+			sort.Ints(ids)
+			if !reflect.DeepEqual(ids, test.ids) {
+				t.Fatalf("test failed: %v", ids)
+			}
+		})
+	}
+}
+
+func TestGetImageByName(t *testing.T) {
+	tests := []struct {
+		name  string
+		id    int
+		error bool
+	}{
+		{"photo.jpg", 1, false},
+		{"landscape.jpg", 4, false},
+		{"Photo.JPG", 0, true},
+		{"", 0, true},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			image, err := images.GetImageByName(a.DB, ctx, test.name)
+			if (err != nil) != test.error {
+				t.Fatalf("test failed: %v", err)
+			}
+			if image.Id != test.id {
+				t.Fatalf("test failed: %v", image)
+			}
+		})
+	}
+}
+
+func TestImageOwners(t *testing.T) {
+	err := images.AddImage(a.DB, ctx, images.Image{AuthorId: 2, Name: "photo.jpg"})
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	tests := []struct {
+		userId int
+		error  bool
+	}{
+		{1, false},
+		{2, false},
+		{3, true},
+	}
+	ids := make(map[int]int)
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			image, err := images.GetUserImageByName(a.DB, ctx, test.userId, "photo.jpg")
+			if (err != nil) != test.error {
+				t.Fatalf("test failed: %v", err)
+			}
+			if err == nil && (image.AuthorId != test.userId || image.Name != "photo.jpg") {
+				t.Fatalf("test failed: %v", image)
+			}
+			ids[test.userId] = image.Id
+		})
+	}
+	if ids[1] != 1 || ids[2] == ids[1] {
+		t.Fatalf("test failed: %v", ids)
+	}
+
+	imageList, err := images.GetImagesByName(a.DB, ctx, []string{"photo.jpg"})
+	if err != nil || len(imageList) != 1 || imageList[0].Id != 1 {
+		t.Fatalf("test failed: %v %v", err, imageList)
+	}
+	used, err := images.GetUsedFiles(a.DB, ctx,
+		[]string{"photo.jpg", "landscape-960.jpg", "landscape-640.jpg"})
+	if err != nil || !reflect.DeepEqual(used, map[string]bool{"photo.jpg": true, "landscape-960.jpg": true}) {
+		t.Fatalf("test failed: %v %v", err, used)
+	}
+	err = images.DeleteImage(a.DB, ctx, ids[2])
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+}
+
+func TestImageURLs(t *testing.T) {
+	tests := []struct {
+		image   images.Image
+		preview string
+		srcset  string
+		files   []string
+	}{
+		{
+			images.Image{Name: "a.png", Width: 200},
+			"/api/images/files/a.png",
+			"/api/images/files/a.png 200w",
+			[]string{"a.png"},
+		},
+		{
+			images.Image{Name: "b.jpg", Width: 2000,
+				Thumbnail: images.Variant{Name: "b-320.jpg", Width: 320, Height: 240},
+				Medium:    images.Variant{Name: "b-960.jpg", Width: 960, Height: 720}},
+			"/api/images/files/b-320.jpg",
+			"/api/images/files/b-320.jpg 320w, /api/images/files/b-960.jpg 960w, /api/images/files/b.jpg 2000w",
+			[]string{"b.jpg", "b-320.jpg", "b-960.jpg"},
+		},
+		{
+			images.Image{Name: "legacy.png"},
+			"/api/images/files/legacy.png",
+			"",
+			[]string{"legacy.png"},
+		},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			if test.image.URL() != images.URLPrefix+test.image.Name {
+				t.Fatalf("test failed: %v", test.image.URL())
+			}
+			if preview := test.image.Preview(); preview != test.preview {
+				t.Fatalf("test failed: %v", preview)
+			}
+			if srcset := test.image.SrcSet(); srcset != test.srcset {
+				t.Fatalf("test failed: %v", srcset)
+			}
+			if files := test.image.Files(); !reflect.DeepEqual(files, test.files) {
+				t.Fatalf("test failed: %v", files)
+			}
+		})
+	}
+}
+
+func TestReferences(t *testing.T) {
+	tests := []struct {
+		text  string
+		names []string
+	}{
+		{"![Photo](/api/images/files/a.png)", []string{"a.png"}},
+		{"![Photo](https://blog.example/api/images/files/a.png \"Title\")", []string{"a.png"}},
+		{"<img src=\"/web/static/images/b.jpg\"> and ![](/api/images/files/c.gif?x=1)",
+			[]string{"b.jpg", "c.gif"}},
+		{"/api/images/ and /static/images/a.png", nil},
+		{"", nil},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			names := images.References(test.text)
+			if !reflect.DeepEqual(names, test.names) {
+				t.Fatalf("test failed: %v", names)
+			}
+		})
+	}
+}
+
+func TestPostImages(t *testing.T) {
+	postId, err := posts.AddPost(a.DB, ctx,
+		posts.Post{AuthorId: 1, Title: "Pictures", Text: "See below"})
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	tests := []struct {
+		ids   []int
+		names []string
+		error bool
+	}{
+		{[]int{3, 1, 3}, []string{"picture.png", "photo.jpg"}, false},
+		{[]int{2}, []string{"picture.jpg"}, false},
+		{[]int{1, 100}, []string{"picture.jpg"}, true},
+		{nil, []string{}, false},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			err := images.SetPostImages(a.DB, ctx, postId, test.ids)
+			if (err != nil) != test.error {
+				t.Fatalf("test failed: %v", err)
+			}
+			imageList, err := images.GetPostImages(a.DB, ctx, postId)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			names := make([]string, 0)
+			for _, image := range imageList {
+				names = append(names, image.Name)
+			}
+			if !reflect.DeepEqual(names, test.names) {
+				t.Fatalf("test failed: %v", names)
+			}
+		})
+	}
+}
+
 func TestDeleteImage(t *testing.T) {
 	for i := range 6 {
-		err := images.DeleteImage(config.DB, config.Ctx, i+1)
+		err := images.DeleteImage(a.DB, ctx, i+1)
 		if err != nil {
 			t.Fatalf("test failed: %v", err)
 		}
-		image, err := images.GetImage(config.DB, config.Ctx, i+1)
+		image, err := images.GetImage(a.DB, ctx, i+1)
 		if err == nil {
 			t.Fatalf("test failed: %v", image)
 		}
@@ -1,35 +1,38 @@
 package likes_test
 
 import (
+	"blog/app"
 	"blog/config"
 	"blog/db/auth"
+	"blog/db/comments"
 	"blog/db/likes"
 	"blog/db/posts"
+	"blog/test/testutil"
+	"context"
 	"fmt"
-	"os"
 	"testing"
 )
 
+var a *app.App
+
+var ctx = context.Background()
+
 func TestMain(m *testing.M) {
-	err := os.Chdir("../../..")
-	if err != nil {
-		panic(err)
-	}
-	config.DBFile = ":memory:"
-	err = config.Setup()
-	if err != nil {
-		panic(err)
-	}
-	err = config.InitDB()
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.DevMode = true
+	var err error
+	a, err = app.New(cfg)
 	if err != nil {
 		panic(err)
 	}
+	testutil.InitDB(a, ctx)
 	users := []auth.User{
 		{Id: 1, Username: "user", Password: "password"},
 		{Id: 2, Username: "guest", Password: "password"},
 	}
 	for _, user := range users {
-		err = auth.AddUser(config.DB, config.Ctx, user)
+		err = auth.AddUser(a.DB, ctx, user)
 		if err != nil {
 			panic(err)
 		}
@@ -39,11 +42,16 @@ func TestMain(m *testing.M) {
 		{AuthorId: 2, Title: "New Post", Text: "Post Text"},
 	}
 	for _, post := range postList {
-		_, err = posts.AddPost(config.DB, config.Ctx, post)
+		_, err = posts.AddPost(a.DB, ctx, post)
 		if err != nil {
 			panic(err)
 		}
 	}
+	_, err = comments.AddComment(a.DB, ctx,
+		comments.Comment{AuthorId: 1, PostId: 1, Text: "New Comment"})
+	if err != nil {
+		panic(err)
+	}
 	m.Run()
 }
 
@@ -74,7 +82,7 @@ func TestAddLike(t *testing.T) {
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			err := likes.AddLike(config.DB, config.Ctx,
+			err := likes.AddLike(a.DB, ctx,
 				test.userid, test.postid, test.ltype)
 			if (err != nil) != test.error {
 				t.Fatalf("test failed: %v", err)
@@ -82,7 +90,7 @@ func TestAddLike(t *testing.T) {
 			if err != nil {
 				return
 			}
-			count, err := likes.GetLikes(config.DB, config.Ctx, test.postid)
+			count, err := likes.GetLikes(a.DB, ctx, test.postid)
 			if err != nil {
 				t.Fatalf("test failed: %v", err)
 			}
@@ -103,7 +111,44 @@ func TestGetLikes(t *testing.T) {
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			count, err := likes.GetLikes(config.DB, config.Ctx, test.postid)
+			count, err := likes.GetLikes(a.DB, ctx, test.postid)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			if count != test.count {
+				t.Fatalf("test failed: %v", count)
+			}
+		})
+	}
+}
+
+func TestAddCommentLike(t *testing.T) {
+	tests := []struct {
+		userid, commentid, count int
+		ltype                    string
+		error                    bool
+	}{
+		{1, 1, 1, "like", false},
+		{1, 1, 0, "like", false},
+		{1, 1, -1, "dislike", false},
+		{2, 1, -2, "dislike", false},
+		{2, 1, 0, "like", false},
+		{1, 1, 1, "dislike", false},
+		{1, 1, 1, "invalid", true},
+		{1, 2, 0, "like", true},
+		{3, 1, 0, "like", true},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			err := likes.AddCommentLike(a.DB, ctx,
+				test.userid, test.commentid, test.ltype)
+			if (err != nil) != test.error {
+				t.Fatalf("test failed: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			count, err := likes.GetCommentLikes(a.DB, ctx, test.commentid)
 			if err != nil {
 				t.Fatalf("test failed: %v", err)
 			}
@@ -112,4 +157,8 @@ func TestGetLikes(t *testing.T) {
 			}
 		})
 	}
+	comment, err := comments.GetComment(a.DB, ctx, 1)
+	if err != nil || comment.Score != 1 {
+		t.Fatalf("test failed: %v", comment)
+	}
 }
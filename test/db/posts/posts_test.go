@@ -1,36 +1,41 @@
 package posts_test
 
 import (
+	"blog/app"
 	"blog/config"
 	"blog/db/auth"
+	"blog/db/page"
 	"blog/db/posts"
+	"blog/db/revisions"
+	"blog/db/tags"
+	"blog/test/testutil"
+	"context"
 	"fmt"
-	"os"
 	"reflect"
 	"testing"
 	"time"
 )
 
+var a *app.App
+
+var ctx = context.Background()
+
 func TestMain(m *testing.M) {
-	err := os.Chdir("../../..")
-	if err != nil {
-		panic(err)
-	}
-	config.DBFile = ":memory:"
-	err = config.Setup()
-	if err != nil {
-		panic(err)
-	}
-	err = config.InitDB()
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.DevMode = true
+	var err error
+	a, err = app.New(cfg)
 	if err != nil {
 		panic(err)
 	}
+	testutil.InitDB(a, ctx)
 	users := []auth.User{
 		{Id: 0, Username: "user", Password: "password"},
 		{Id: 1, Username: "guest", Password: "password"},
 	}
 	for _, user := range users {
-		err = auth.AddUser(config.DB, config.Ctx, user)
+		err = auth.AddUser(a.DB, ctx, user)
 		if err != nil {
 			panic(err)
 		}
@@ -53,7 +58,7 @@ func TestAddPost(t *testing.T) {
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			_, err := posts.AddPost(config.DB, config.Ctx, test.post)
+			_, err := posts.AddPost(a.DB, ctx, test.post)
 			if (err != nil) != test.error {
 				t.Fatalf("test failed: %v", err)
 			}
@@ -63,11 +68,11 @@ func TestAddPost(t *testing.T) {
 
 func TestGetPosts(t *testing.T) {
 	postList := []posts.Post{
-		{Id: 1, AuthorId: 1, Author: "user", Title: "First Post", Text: "Hello, World!"},
-		{Id: 2, AuthorId: 1, Author: "user", Title: "Second Post", Text: "Your text here!"},
-		{Id: 3, AuthorId: 2, Author: "guest", Title: "Third Post", Text: "Another post"},
+		{Id: 1, AuthorId: 1, Author: "user", Title: "First Post", Text: "Hello, World!", Status: posts.StatusPublished},
+		{Id: 2, AuthorId: 1, Author: "user", Title: "Second Post", Text: "Your text here!", Status: posts.StatusPublished},
+		{Id: 3, AuthorId: 2, Author: "guest", Title: "Third Post", Text: "Another post", Status: posts.StatusPublished},
 	}
-	dbPostList, err := posts.GetPosts(config.DB, config.Ctx)
+	dbPostList, err := posts.GetPosts(a.DB, ctx)
 	if err != nil {
 		t.Fatalf("test failed: %v", err)
 	}
@@ -80,19 +85,48 @@ func TestGetPosts(t *testing.T) {
 	}
 }
 
+func TestGetPostsPage(t *testing.T) {
+	var ids []int
+	var after page.Cursor
+	for range 3 {
+		postPage, err := posts.GetPostsPage(a.DB, ctx, after, 2)
+		if err != nil {
+			t.Fatalf("test failed: %v", err)
+		}
+		if postPage.Nposts != 3 {
+			t.Fatalf("test failed: %v", postPage.Nposts)
+		}
+		for _, post := range postPage.Posts {
+			ids = append(ids, post.Id)
+		}
+		after = postPage.Next
+		if after.IsZero() {
+			break
+		}
+	}
+	if !reflect.DeepEqual(ids, []int{1, 2, 3}) {
+		t.Fatalf("test failed: %v", ids)
+	}
+
+	_, err := posts.GetPostsPage(a.DB, ctx, page.Cursor{}, 0)
+	if err == nil {
+		t.Fatalf("test failed: %v", err)
+	}
+}
+
 func TestGetPost(t *testing.T) {
 	tests := []struct {
 		post  posts.Post
 		error bool
 	}{
-		{posts.Post{Id: 1, AuthorId: 1, Author: "user", Title: "First Post", Text: "Hello, World!"}, false},
-		{posts.Post{Id: 2, AuthorId: 1, Author: "user", Title: "Second Post", Text: "Your text here!"}, false},
-		{posts.Post{Id: 3, AuthorId: 2, Author: "guest", Title: "Third Post", Text: "Another post"}, false},
+		{posts.Post{Id: 1, AuthorId: 1, Author: "user", Title: "First Post", Text: "Hello, World!", Status: posts.StatusPublished}, false},
+		{posts.Post{Id: 2, AuthorId: 1, Author: "user", Title: "Second Post", Text: "Your text here!", Status: posts.StatusPublished}, false},
+		{posts.Post{Id: 3, AuthorId: 2, Author: "guest", Title: "Third Post", Text: "Another post", Status: posts.StatusPublished}, false},
 		{posts.Post{Id: 4}, true},
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			post, err := posts.GetPost(config.DB, config.Ctx, test.post.Id)
+			post, err := posts.GetPost(a.DB, ctx, test.post.Id)
 			if (err != nil) != test.error {
 				t.Fatalf("test failed: %v", err)
 			}
@@ -112,17 +146,17 @@ func TestUpdatePost(t *testing.T) {
 	tests := []struct {
 		post posts.Post
 	}{
-		{posts.Post{Id: 1, AuthorId: 1, Author: "user", Title: "New First Post", Text: "New Text"}},
-		{posts.Post{Id: 2, AuthorId: 1, Author: "user", Title: "New Second Post", Text: "New Text"}},
-		{posts.Post{Id: 3, AuthorId: 2, Author: "guest", Title: "New Third Post", Text: "New Text"}},
+		{posts.Post{Id: 1, AuthorId: 1, Author: "user", Title: "New First Post", Text: "New Text", Status: posts.StatusPublished}},
+		{posts.Post{Id: 2, AuthorId: 1, Author: "user", Title: "New Second Post", Text: "New Text", Status: posts.StatusPublished}},
+		{posts.Post{Id: 3, AuthorId: 2, Author: "guest", Title: "New Third Post", Text: "New Text", Status: posts.StatusPublished}},
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			err := posts.UpdatePost(config.DB, config.Ctx, test.post.Id, test.post)
+			err := posts.UpdatePost(a.DB, ctx, test.post.Id, test.post.AuthorId, test.post)
 			if err != nil {
 				t.Fatalf("test failed: %v", err)
 			}
-			post, err := posts.GetPost(config.DB, config.Ctx, test.post.Id)
+			post, err := posts.GetPost(a.DB, ctx, test.post.Id)
 			if err != nil {
 				t.Fatalf("test failed: %v", err)
 			}
@@ -135,44 +169,215 @@ func TestUpdatePost(t *testing.T) {
 	}
 }
 
-func TestFilterQuery(t *testing.T) {
+func TestParseQuery(t *testing.T) {
 	tests := []struct {
-		query string
-		posts []posts.Post
+		query  string
+		parsed posts.Query
 	}{
-		{"first", []posts.Post{{Id: 1, AuthorId: 1, Author: "user", Title: "New First Post", Text: "New Text"}}},
-		{"post", []posts.Post{
-			{Id: 1, AuthorId: 1, Author: "user", Title: "New First Post", Text: "New Text"},
-			{Id: 2, AuthorId: 1, Author: "user", Title: "New Second Post", Text: "New Text"},
-			{Id: 3, AuthorId: 2, Author: "guest", Title: "New Third Post", Text: "New Text"},
-		}},
-		{"query", nil},
+		{"first post", posts.Query{Terms: []string{`"first"`, `"post"`}}},
+		{`"new first" pos*`, posts.Query{Terms: []string{`"new first"`, `"pos"*`}}},
+		{"first OR second OR", posts.Query{Terms: []string{`"first"`, "OR", `"second"`}}},
+		{`tag:go tag:"web dev" author:user`, posts.Query{Tags: []string{"go", "web dev"}, Author: "user"}},
+		{`"un"balanced" * ""`, posts.Query{Terms: []string{`"unbalanced"`}}},
+		{"", posts.Query{}},
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			postlist, err := posts.FilterQuery(config.DB, config.Ctx, test.query)
-			if err != nil {
+			parsed := posts.ParseQuery(test.query)
+			if !reflect.DeepEqual(parsed, test.parsed) {
+				t.Fatalf("test failed: %#v", parsed)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		query   string
+		postids []int
+		error   bool
+	}{
+		{"first", []int{1}, false},
+		{"post", []int{1, 2, 3}, false},
+		{"fir*", []int{1}, false},
+		{`"new third"`, []int{3}, false},
+		{`"third new"`, nil, false},
+		{"first OR second", []int{1, 2}, false},
+		{"author:guest", []int{3}, false},
+		{"post author:user", []int{1, 2}, false},
+		{"guest", []int{3}, false},
+		{"query", nil, false},
+		{"", nil, true},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			results, err := posts.Search(a.DB, ctx,
+				posts.ParseQuery(test.query), page.MaxLimit)
+			if (err != nil) != test.error {
 				t.Fatalf("test failed: %v", err)
 			}
-			var zero time.Time
-			for i := range postlist {
-				postlist[i].Created = zero
+			var postids []int
+			for _, result := range results {
+				postids = append(postids, result.Id)
+			}
+			if !reflect.DeepEqual(postids, test.postids) {
+				t.Fatalf("test failed: %v", postids)
+			}
+		})
+	}
+
+	results, err := posts.Search(a.DB, ctx, posts.ParseQuery("first"), 1)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("test failed: %v", err)
+	}
+	if results[0].Snippet != "New <mark>First</mark> Post" || results[0].Rank <= 0 {
+		t.Fatalf("test failed: %v", results[0])
+	}
+
+	// The limit keeps the best matches.
+	all, err := posts.Search(a.DB, ctx, posts.ParseQuery("post"), page.MaxLimit)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	results, err = posts.Search(a.DB, ctx, posts.ParseQuery("post"), 2)
+	if err != nil || !reflect.DeepEqual(results, all[:2]) {
+		t.Fatalf("test failed: %v %v", err, results)
+	}
+}
+
+func TestGetNewest(t *testing.T) {
+	err := tags.UpdateTags(a.DB, ctx, 1, []tags.Tag{{Name: "go"}, {Name: "sql"}})
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	defer tags.DeleteTags(a.DB, ctx, 1)
+
+	tests := []struct {
+		query   posts.Query
+		limit   int
+		postids []int
+		error   bool
+	}{
+		{posts.Query{}, 10, []int{3, 2, 1}, false},
+		{posts.Query{}, 2, []int{3, 2}, false},
+		{posts.Query{Author: "user"}, 10, []int{2, 1}, false},
+		{posts.Query{Author: "nobody"}, 10, nil, false},
+		{posts.Query{Tags: []string{"missing"}}, 10, nil, false},
+		{posts.Query{Tags: []string{"sql"}}, 10, []int{1}, false},
+		{posts.Query{}, 0, nil, true},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			postList, err := posts.GetNewest(a.DB, ctx, test.query, test.limit)
+			if (err != nil) != test.error {
+				t.Fatalf("test failed: %v", err)
+			}
+			var postids []int
+			for _, post := range postList {
+				postids = append(postids, post.Id)
+				// The tags and revision time match those read one by one.
+				tagList, err := tags.GetTags(a.DB, ctx, post.Id)
+				if err != nil || !reflect.DeepEqual(post.Tags, tagList) {
+					t.Fatalf("test failed: %v %v %v", err, post.Tags, tagList)
+				}
+				revised, err := revisions.LastRevised(a.DB, ctx, post.Id)
+				if err != nil || revised.IsZero() || !post.Revised.Equal(revised) {
+					t.Fatalf("test failed: %v %v %v", err, post.Revised, revised)
+				}
 			}
-			if !reflect.DeepEqual(postlist, test.posts) {
-				t.Fatalf("test failed: %v", postlist)
+			if !reflect.DeepEqual(postids, test.postids) {
+				t.Fatalf("test failed: %v", postids)
 			}
 		})
 	}
 }
 
+func TestPostStatus(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		post  posts.Post
+		error bool
+	}{
+		{posts.Post{AuthorId: 1, Title: "Draft", Text: "Draft", Status: posts.StatusDraft}, false},
+		{posts.Post{AuthorId: 1, Title: "Due", Text: "Due", Status: posts.StatusScheduled, PublishAt: &past}, false},
+		{posts.Post{AuthorId: 1, Title: "Later", Text: "Later", Status: posts.StatusScheduled, PublishAt: &future}, false},
+		{posts.Post{AuthorId: 1, Title: "Later", Text: "Later", Status: posts.StatusScheduled}, true},
+		{posts.Post{AuthorId: 1, Title: "Hidden", Text: "Hidden", Status: "hidden"}, true},
+	}
+	var ids []int
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			id, err := posts.AddPost(a.DB, ctx, test.post)
+			if (err != nil) != test.error {
+				t.Fatalf("test failed: %v", err)
+			}
+			if err == nil {
+				ids = append(ids, id)
+			}
+		})
+	}
+
+	postList, err := posts.GetPosts(a.DB, ctx)
+	if err != nil || len(postList) != 3 {
+		t.Fatalf("test failed: %v", postList)
+	}
+	drafts, err := posts.GetDrafts(a.DB, ctx, 1)
+	if err != nil || len(drafts) != 3 {
+		t.Fatalf("test failed: %v", drafts)
+	}
+
+	n, err := posts.PublishDue(a.DB, ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("test failed: %v, %v", n, err)
+	}
+	due, err := posts.GetPost(a.DB, ctx, ids[1])
+	if err != nil || due.Status != posts.StatusPublished || due.PublishAt != nil {
+		t.Fatalf("test failed: %v", due)
+	}
+	if !due.Created.Equal(past.UTC().Truncate(time.Second)) {
+		t.Fatalf("test failed: %v", due.Created)
+	}
+	later, err := posts.GetPost(a.DB, ctx, ids[2])
+	if err != nil || later.Status != posts.StatusScheduled ||
+		!later.PublishAt.Equal(future.UTC().Truncate(time.Second)) {
+		t.Fatalf("test failed: %v", later)
+	}
+
+	err = posts.Unpublish(a.DB, ctx, ids[1])
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	draft := posts.Post{Title: "Draft", Text: "Published", Status: posts.StatusPublished}
+	err = posts.UpdatePost(a.DB, ctx, ids[0], 1, draft)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	drafts, err = posts.GetDrafts(a.DB, ctx, 1)
+	if err != nil || len(drafts) != 2 {
+		t.Fatalf("test failed: %v", drafts)
+	}
+	postList, err = posts.GetPosts(a.DB, ctx)
+	if err != nil || len(postList) != 4 {
+		t.Fatalf("test failed: %v", postList)
+	}
+
+	for _, id := range ids {
+		err = posts.DeletePost(a.DB, ctx, id)
+		if err != nil {
+			t.Fatalf("test failed: %v", err)
+		}
+	}
+}
+
 func TestDeletePost(t *testing.T) {
 	postids := []int{1, 2, 3}
 	for id := range postids {
-		err := posts.DeletePost(config.DB, config.Ctx, id)
+		err := posts.DeletePost(a.DB, ctx, id)
 		if err != nil {
 			t.Fatalf("test failed: %v", err)
 		}
-		_, err = posts.GetPost(config.DB, config.Ctx, id)
+		_, err = posts.GetPost(a.DB, ctx, id)
 		if err == nil {
 			t.Fatalf("test failed: %v", id)
 		}
@@ -0,0 +1,175 @@
+package profiles_test
+
+import (
+	"blog/app"
+	"blog/config"
+	"blog/db/auth"
+	"blog/db/comments"
+	"blog/db/images"
+	"blog/db/likes"
+	"blog/db/posts"
+	"blog/db/profiles"
+	"blog/test/testutil"
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var a *app.App
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.DevMode = true
+	var err error
+	a, err = app.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	testutil.InitDB(a, ctx)
+	users := []auth.User{
+		{Id: 0, Username: "user", Password: "password"},
+		{Id: 1, Username: "guest", Password: "password"},
+	}
+	for _, user := range users {
+		err = auth.AddUser(a.DB, ctx, user)
+		if err != nil {
+			panic(err)
+		}
+	}
+	m.Run()
+}
+
+func TestValidProfile(t *testing.T) {
+	tests := []struct {
+		profile profiles.Profile
+		valid   bool
+	}{
+		{profiles.Profile{}, true},
+		{profiles.Profile{DisplayName: "User", Bio: "Hello", Website: "https://example.com"}, true},
+		{profiles.Profile{Website: "http://example.com/blog"}, true},
+		{profiles.Profile{Website: "javascript:alert(1)"}, false},
+		{profiles.Profile{Website: "example.com"}, false},
+		{profiles.Profile{Website: "https://"}, false},
+		{profiles.Profile{DisplayName: string(make([]rune, profiles.MaxDisplayName+1))}, false},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			valid := profiles.ValidProfile(test.profile)
+			if valid != test.valid {
+				t.Fatalf("test failed: %v", valid)
+			}
+		})
+	}
+}
+
+func TestGetProfile(t *testing.T) {
+	profile, err := profiles.GetProfile(a.DB, ctx, "user")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	if !reflect.DeepEqual(profile, profiles.Profile{UserId: 1, Username: "user"}) {
+		t.Fatalf("test failed: %v", profile)
+	}
+	if profile.Name() != "user" {
+		t.Fatalf("test failed: %v", profile.Name())
+	}
+
+	_, err = profiles.GetProfile(a.DB, ctx, "nobody")
+	if err != sql.ErrNoRows {
+		t.Fatalf("test failed: %v", err)
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	err := images.AddImage(a.DB, ctx, images.Image{AuthorId: 1, Name: "avatar.png"})
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	tests := []struct {
+		profile profiles.Profile
+		error   bool
+	}{
+		{profiles.Profile{DisplayName: "User", Bio: "Hello", AvatarId: 1, Website: "https://example.com"}, false},
+		{profiles.Profile{DisplayName: "New User", AvatarId: 1}, false},
+		{profiles.Profile{Website: "ftp://example.com"}, true},
+		{profiles.Profile{AvatarId: 2}, true},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			err := profiles.UpdateProfile(a.DB, ctx, 1, test.profile)
+			if (err != nil) != test.error {
+				t.Fatalf("test failed: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			profile, err := profiles.GetProfile(a.DB, ctx, "user")
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			want := test.profile
+			want.UserId, want.Username, want.Avatar = 1, "user", "avatar.png"
+			if !reflect.DeepEqual(profile, want) {
+				t.Fatalf("test failed: %v", profile)
+			}
+		})
+	}
+
+	err = images.DeleteImage(a.DB, ctx, 1)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	profile, err := profiles.GetProfile(a.DB, ctx, "user")
+	if err != nil || profile.AvatarId != 0 || profile.Avatar != "" || profile.Name() != "New User" {
+		t.Fatalf("test failed: %v", profile)
+	}
+}
+
+func TestStats(t *testing.T) {
+	postList := []posts.Post{
+		{AuthorId: 2, Title: "First Post", Text: "Hello, World!"},
+		{AuthorId: 2, Title: "Second Post", Text: "Your text here!"},
+		{AuthorId: 2, Title: "Draft", Text: "Draft", Status: posts.StatusDraft},
+	}
+	var ids []int
+	for _, post := range postList {
+		id, err := posts.AddPost(a.DB, ctx, post)
+		if err != nil {
+			t.Fatalf("test failed: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	for _, id := range ids {
+		_, err := comments.AddComment(a.DB, ctx,
+			comments.Comment{AuthorId: 2, PostId: id, Text: "Comment"})
+		if err != nil {
+			t.Fatalf("test failed: %v", err)
+		}
+		err = likes.AddLike(a.DB, ctx, 1, id, "like")
+		if err != nil {
+			t.Fatalf("test failed: %v", err)
+		}
+	}
+	err := likes.AddLike(a.DB, ctx, 2, ids[0], "dislike")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	profile, err := profiles.GetProfile(a.DB, ctx, "guest")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	if profile.Posts != 2 || profile.Comments != 2 || profile.Likes != 1 {
+		t.Fatalf("test failed: %v", profile)
+	}
+
+	commentList, err := comments.GetUserComments(a.DB, ctx, 2, 1)
+	if err != nil || len(commentList) != 1 || commentList[0].PostId != ids[1] {
+		t.Fatalf("test failed: %v", commentList)
+	}
+}
@@ -0,0 +1,122 @@
+package revisions_test
+
+import (
+	"blog/app"
+	"blog/config"
+	"blog/db/auth"
+	"blog/db/posts"
+	"blog/db/revisions"
+	"blog/test/testutil"
+	"context"
+	"fmt"
+	"testing"
+)
+
+var a *app.App
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.DevMode = true
+	var err error
+	a, err = app.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	testutil.InitDB(a, ctx)
+	users := []auth.User{
+		{Id: 1, Username: "user", Password: "password"},
+		{Id: 2, Username: "guest", Password: "password"},
+	}
+	for _, user := range users {
+		err = auth.AddUser(a.DB, ctx, user)
+		if err != nil {
+			panic(err)
+		}
+	}
+	_, err = posts.AddPost(a.DB, ctx, posts.Post{AuthorId: 1, Title: "New Post", Text: "Post Text"})
+	if err != nil {
+		panic(err)
+	}
+	m.Run()
+}
+
+func TestGetRevisions(t *testing.T) {
+	tests := []struct {
+		editorId int
+		post     posts.Post
+		count    int
+	}{
+		{1, posts.Post{Title: "New Post", Text: "Post Text\nMore Text"}, 2},
+		{2, posts.Post{Title: "Edited Post", Text: "Post Text\nMore Text"}, 3},
+		{1, posts.Post{Title: "Edited Post", Text: "Post Text\nMore Text", Status: posts.StatusDraft}, 3},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			err := posts.UpdatePost(a.DB, ctx, 1, test.editorId, test.post)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			revisionList, err := revisions.GetRevisions(a.DB, ctx, 1)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			if len(revisionList) != test.count {
+				t.Fatalf("test failed: %v", revisionList)
+			}
+			latest := revisionList[0]
+			if latest.Title != test.post.Title || latest.Text != test.post.Text {
+				t.Fatalf("test failed: %v", latest)
+			}
+		})
+	}
+	revisionList, err := revisions.GetRevisions(a.DB, ctx, 1)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	editors := []string{"guest", "user", "user"}
+	for i, revision := range revisionList {
+		if revision.Editor != editors[i] || revision.PostId != 1 {
+			t.Fatalf("test failed: %v", revision)
+		}
+	}
+}
+
+func TestGetRevision(t *testing.T) {
+	tests := []struct {
+		id    int
+		title string
+		error bool
+	}{
+		{1, "New Post", false},
+		{3, "Edited Post", false},
+		{4, "", true},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			revision, err := revisions.GetRevision(a.DB, ctx, test.id)
+			if (err != nil) != test.error {
+				t.Fatalf("test failed: %v", err)
+			}
+			if revision.Title != test.title {
+				t.Fatalf("test failed: %v", revision)
+			}
+		})
+	}
+}
+
+func TestDeletePost(t *testing.T) {
+	err := posts.DeletePost(a.DB, ctx, 1)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	revisionList, err := revisions.GetRevisions(a.DB, ctx, 1)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	if len(revisionList) != 0 {
+		t.Fatalf("test failed: %v", revisionList)
+	}
+}
@@ -1,36 +1,38 @@
 package tags_test
 
 import (
+	"blog/app"
 	"blog/config"
 	"blog/db/auth"
 	"blog/db/posts"
 	"blog/db/tags"
+	"blog/test/testutil"
+	"context"
 	"fmt"
-	"os"
 	"reflect"
 	"testing"
 )
 
+var a *app.App
+
+var ctx = context.Background()
+
 func TestMain(m *testing.M) {
-	err := os.Chdir("../../..")
-	if err != nil {
-		panic(err)
-	}
-	config.DBFile = ":memory:"
-	err = config.Setup()
-	if err != nil {
-		panic(err)
-	}
-	err = config.InitDB()
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.DevMode = true
+	var err error
+	a, err = app.New(cfg)
 	if err != nil {
 		panic(err)
 	}
+	testutil.InitDB(a, ctx)
 	users := []auth.User{
 		{Id: 1, Username: "user", Password: "password"},
 		{Id: 2, Username: "guest", Password: "password"},
 	}
 	for _, user := range users {
-		err = auth.AddUser(config.DB, config.Ctx, user)
+		err = auth.AddUser(a.DB, ctx, user)
 		if err != nil {
 			panic(err)
 		}
@@ -41,7 +43,7 @@ func TestMain(m *testing.M) {
 		{AuthorId: 2, Title: "New Post", Text: "Post Text"},
 	}
 	for _, post := range postList {
-		_, err = posts.AddPost(config.DB, config.Ctx, post)
+		_, err = posts.AddPost(a.DB, ctx, post)
 		if err != nil {
 			panic(err)
 		}
@@ -63,7 +65,7 @@ func TestAddTags(t *testing.T) {
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			err := tags.AddTags(config.DB, config.Ctx, test.postid, test.tags)
+			err := tags.AddTags(a.DB, ctx, test.postid, test.tags)
 			if (err != nil) != test.error {
 				t.Fatalf("test failed: %v", err)
 			}
@@ -82,7 +84,7 @@ func TestGetTags(t *testing.T) {
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			tags, err := tags.GetTags(config.DB, config.Ctx, test.postid)
+			tags, err := tags.GetTags(a.DB, ctx, test.postid)
 			if err != nil {
 				t.Fatalf("test failed: %v", err)
 			}
@@ -104,11 +106,11 @@ func TestUpdateTags(t *testing.T) {
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			err := tags.UpdateTags(config.DB, config.Ctx, test.postid, test.tags)
+			err := tags.UpdateTags(a.DB, ctx, test.postid, test.tags)
 			if err != nil {
 				t.Fatalf("test failed: %v", err)
 			}
-			tags, err := tags.GetTags(config.DB, config.Ctx, test.postid)
+			tags, err := tags.GetTags(a.DB, ctx, test.postid)
 			if err != nil {
 				t.Fatalf("test failed: %v", err)
 			}
@@ -119,13 +121,41 @@ func TestUpdateTags(t *testing.T) {
 	}
 }
 
+func TestSearchTags(t *testing.T) {
+	tests := []struct {
+		query   string
+		postids []int
+	}{
+		{"tag:first", []int{1, 2}},
+		{"tag:second tag:third", []int{3}},
+		{"third", []int{2, 3}},
+		{"tag:fourth", nil},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			results, err := posts.Search(a.DB, ctx,
+				posts.ParseQuery(test.query), 10)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			var postids []int
+			for _, result := range results {
+				postids = append(postids, result.Id)
+			}
+			if !reflect.DeepEqual(postids, test.postids) {
+				t.Fatalf("test failed: %v", postids)
+			}
+		})
+	}
+}
+
 func TestDeleteTags(t *testing.T) {
 	for i := range 3 {
-		err := tags.DeleteTags(config.DB, config.Ctx, i+1)
+		err := tags.DeleteTags(a.DB, ctx, i+1)
 		if err != nil {
 			t.Fatalf("test failed: %v", err)
 		}
-		tags, err := tags.GetTags(config.DB, config.Ctx, i+1)
+		tags, err := tags.GetTags(a.DB, ctx, i+1)
 		if err != nil {
 			t.Fatalf("test failed: %v", err)
 		}
@@ -133,4 +163,8 @@ func TestDeleteTags(t *testing.T) {
 			t.Fatalf("test faied: %v", tags)
 		}
 	}
+	results, err := posts.Search(a.DB, ctx, posts.ParseQuery("third"), 10)
+	if err != nil || results != nil {
+		t.Fatalf("test failed: %v", results)
+	}
 }
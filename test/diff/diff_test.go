@@ -0,0 +1,118 @@
+package diff_test
+
+import (
+	"blog/diff"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		lines []diff.Line
+	}{
+		{"", "", nil},
+		{"a\nb", "a\nb", []diff.Line{{Op: diff.Equal, Text: "a"}, {Op: diff.Equal, Text: "b"}}},
+		{"", "a", []diff.Line{{Op: diff.Insert, Text: "a"}}},
+		{"a\n", "", []diff.Line{{Op: diff.Delete, Text: "a"}}},
+		{
+			"a\nb\nc", "a\nx\nc",
+			[]diff.Line{{Op: diff.Equal, Text: "a"}, {Op: diff.Delete, Text: "b"}, {Op: diff.Insert, Text: "x"}, {Op: diff.Equal, Text: "c"}},
+		},
+		{
+			"a\r\nb\r\nc", "b\nc\nd",
+			[]diff.Line{{Op: diff.Delete, Text: "a"}, {Op: diff.Equal, Text: "b"}, {Op: diff.Equal, Text: "c"}, {Op: diff.Insert, Text: "d"}},
+		},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			lines, err := diff.Lines(test.a, test.b)
+			if err != nil || !reflect.DeepEqual(lines, test.lines) {
+				t.Fatalf("test failed: %v", lines)
+			}
+		})
+	}
+}
+
+// apply returns the old and the new text of a diff and its number of
+// insertions and deletions.
+func apply(lines []diff.Line) (a, b []string, edits int) {
+	for _, line := range lines {
+		if line.Op != diff.Insert {
+			a = append(a, line.Text)
+		}
+		if line.Op != diff.Delete {
+			b = append(b, line.Text)
+		}
+		if line.Op != diff.Equal {
+			edits++
+		}
+	}
+	return a, b, edits
+}
+
+// distance returns the fewest insertions and deletions turning a into b.
+func distance(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				cur[j] = prev[j-1]
+			} else {
+				cur[j] = min(prev[j], cur[j-1]) + 1
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestDiff(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		a := make([]string, r.Intn(20))
+		for j := range a {
+			a[j] = string(rune('a' + r.Intn(4)))
+		}
+		b := make([]string, r.Intn(20))
+		for j := range b {
+			b[j] = string(rune('a' + r.Intn(4)))
+		}
+		lines := diff.Diff(a, b)
+		gotA, gotB, edits := apply(lines)
+		if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) || edits != distance(a, b) {
+			t.Fatalf("test failed: %v %v %v", a, b, lines)
+		}
+		for j := 1; j < len(lines); j++ {
+			if lines[j-1].Op == diff.Insert && lines[j].Op == diff.Delete {
+				t.Fatalf("test failed: %v", lines)
+			}
+		}
+	}
+}
+
+func TestLarge(t *testing.T) {
+	a := make([]string, diff.MaxLines)
+	b := make([]string, diff.MaxLines)
+	for i := range a {
+		a[i] = fmt.Sprintf("a%d", i)
+		b[i] = fmt.Sprintf("b%d", i)
+	}
+	lines, err := diff.Lines(strings.Join(a, "\n"), strings.Join(b, "\n"))
+	if err != nil || len(lines) != 2*diff.MaxLines || lines[0].Op != diff.Delete || lines[len(lines)-1].Op != diff.Insert {
+		t.Fatalf("test failed: %v %d", err, len(lines))
+	}
+	_, err = diff.Lines(strings.Join(a, "\n")+"\nmore", "")
+	if err != diff.ErrTooLarge {
+		t.Fatalf("test failed: %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+package feed_test
+
+import (
+	"blog/app"
+	"blog/config"
+	"blog/db/auth"
+	"blog/db/posts"
+	"blog/db/tags"
+	"blog/feed"
+	"blog/test/testutil"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var a *app.App
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.DevMode = true
+	var err error
+	a, err = app.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	testutil.InitDB(a, ctx)
+	users := []auth.User{
+		{Id: 0, Username: "user", Password: "password"},
+		{Id: 1, Username: "guest", Password: "password"},
+		{Id: 2, Username: "empty", Password: "password"},
+	}
+	for _, user := range users {
+		err = auth.AddUser(a.DB, ctx, user)
+		if err != nil {
+			panic(err)
+		}
+	}
+	postList := []posts.Post{
+		{AuthorId: 1, Title: "First Post", Text: "Hello, [World](/web/posts/get/2)!"},
+		{AuthorId: 1, Title: "Second Post", Text: "**Bold** text"},
+		{AuthorId: 2, Title: "Third Post", Text: "Another post"},
+		{AuthorId: 2, Title: "Draft", Text: "Hidden", Status: posts.StatusDraft},
+	}
+	for _, post := range postList {
+		id, err := posts.AddPost(a.DB, ctx, post)
+		if err != nil {
+			panic(err)
+		}
+		tagList := []tags.Tag{{Name: "go"}}
+		if post.Status == posts.StatusDraft {
+			tagList = []tags.Tag{{Name: "drafts"}}
+		}
+		err = tags.UpdateTags(a.DB, ctx, id, tagList)
+		if err != nil {
+			panic(err)
+		}
+	}
+	m.Run()
+}
+
+func get(path string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", path, nil)
+	for key := range header {
+		r.Header.Set(key, header.Get(key))
+	}
+	w := httptest.NewRecorder()
+	feed.ServeMux(a).ServeHTTP(w, r)
+	return w
+}
+
+func TestAtom(t *testing.T) {
+	w := get("/feed.atom", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("test failed: %v", w.Code)
+	}
+	if w.Header().Get("Content-Type") != "application/atom+xml; charset=utf-8" {
+		t.Fatalf("test failed: %v", w.Header())
+	}
+	var doc feed.Atom
+	err := xml.Unmarshal(w.Body.Bytes(), &doc)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	var titles []string
+	for _, entry := range doc.Entries {
+		titles = append(titles, entry.Title)
+	}
+	if !reflect.DeepEqual(titles, []string{"Third Post", "Second Post", "First Post"}) {
+		t.Fatalf("test failed: %v", titles)
+	}
+	if doc.Updated == "" || doc.Entries[0].Updated == "" {
+		t.Fatalf("test failed: %v", doc)
+	}
+	first := doc.Entries[2]
+	if first.Id != "http://example.com/web/posts/get/1" || first.Author.Name != "user" ||
+		!reflect.DeepEqual(first.Categories, []feed.AtomCategory{{Term: "go"}}) {
+		t.Fatalf("test failed: %v", first)
+	}
+	if !strings.Contains(first.Content.Body, `<a href="http://example.com/web/posts/get/2">World</a>`) {
+		t.Fatalf("test failed: %v", first.Content.Body)
+	}
+}
+
+func TestRSS(t *testing.T) {
+	w := get("/feed.rss", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("test failed: %v", w.Code)
+	}
+	var doc feed.RSS
+	err := xml.Unmarshal(w.Body.Bytes(), &doc)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	if doc.Version != "2.0" || len(doc.Channel.Items) != 3 {
+		t.Fatalf("test failed: %v", doc)
+	}
+	second := doc.Channel.Items[1]
+	if second.Title != "Second Post" || second.Creator != "user" ||
+		!strings.Contains(second.Description, "<strong>Bold</strong>") {
+		t.Fatalf("test failed: %v", second)
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	w := get("/feed.atom", nil)
+	etag := w.Header().Get("ETag")
+	modified := w.Header().Get("Last-Modified")
+	if etag == "" || modified == "" {
+		t.Fatalf("test failed: %v", w.Header())
+	}
+	tests := []struct {
+		header http.Header
+		status int
+	}{
+		{http.Header{"If-None-Match": {etag}}, http.StatusNotModified},
+		{http.Header{"If-None-Match": {`"stale"`}}, http.StatusOK},
+		{http.Header{"If-Modified-Since": {modified}}, http.StatusNotModified},
+		{http.Header{"If-Modified-Since": {"Mon, 02 Jan 2006 15:04:05 GMT"}}, http.StatusOK},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			w := get("/feed.atom", test.header)
+			if w.Code != test.status {
+				t.Fatalf("test failed: %v", w.Code)
+			}
+		})
+	}
+}
+
+func TestFilteredFeeds(t *testing.T) {
+	tests := []struct {
+		path   string
+		status int
+		titles []string
+	}{
+		{"/feed/tag/go.atom", http.StatusOK, []string{"Third Post", "Second Post", "First Post"}},
+		{"/feed/tag/go.rss", http.StatusOK, []string{"Third Post", "Second Post", "First Post"}},
+		{"/feed/tag/drafts.atom", http.StatusOK, nil},
+		{"/feed/tag/rust.atom", http.StatusNotFound, nil},
+		{"/feed/tag/go.json", http.StatusNotFound, nil},
+		{"/feed/author/guest.atom", http.StatusOK, []string{"Third Post"}},
+		{"/feed/author/user.rss", http.StatusOK, []string{"Second Post", "First Post"}},
+		{"/feed/author/empty.rss", http.StatusOK, nil},
+		{"/feed/author/nobody.atom", http.StatusNotFound, nil},
+		{"/feed/author/.atom", http.StatusNotFound, nil},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			w := get(test.path, nil)
+			if w.Code != test.status {
+				t.Fatalf("test failed: %v", w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var titles []string
+			if strings.HasSuffix(test.path, ".atom") {
+				var doc feed.Atom
+				err := xml.Unmarshal(w.Body.Bytes(), &doc)
+				if err != nil {
+					t.Fatalf("test failed: %v", err)
+				}
+				for _, entry := range doc.Entries {
+					titles = append(titles, entry.Title)
+				}
+			} else {
+				var doc feed.RSS
+				err := xml.Unmarshal(w.Body.Bytes(), &doc)
+				if err != nil {
+					t.Fatalf("test failed: %v", err)
+				}
+				for _, item := range doc.Channel.Items {
+					titles = append(titles, item.Title)
+				}
+			}
+			if !reflect.DeepEqual(titles, test.titles) {
+				t.Fatalf("test failed: %v", titles)
+			}
+		})
+	}
+}
+
+func TestLinks(t *testing.T) {
+	tests := []struct {
+		path    string
+		devMode bool
+		baseURL string
+		link    string
+	}{
+		{"/feed/author/guest.atom", true, "", "http://proxy.test/web/users/guest"},
+		{"/feed/author/guest.atom", true, "https://blog.example.com/", "https://blog.example.com/web/users/guest"},
+		{"/feed/author/guest.atom", false, "https://blog.example.com", "https://blog.example.com/web/users/guest"},
+		{"/feed.atom", false, "", "http://localhost:8080/web/posts/get"},
+	}
+	defer func(devMode bool, baseURL string) {
+		a.Config.DevMode, a.Config.BaseURL = devMode, baseURL
+	}(a.Config.DevMode, a.Config.BaseURL)
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			a.Config.DevMode, a.Config.BaseURL = test.devMode, test.baseURL
+			r := httptest.NewRequest("GET", test.path, nil)
+			r.Host = "proxy.test"
+			w := httptest.NewRecorder()
+			feed.ServeMux(a).ServeHTTP(w, r)
+			var doc feed.Atom
+			err := xml.Unmarshal(w.Body.Bytes(), &doc)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			var links []string
+			for _, link := range doc.Links {
+				links = append(links, link.Href)
+			}
+			if !slices.Contains(links, test.link) ||
+				(!test.devMode && strings.Contains(w.Body.String(), "proxy.test")) {
+				t.Fatalf("test failed: %v", links)
+			}
+		})
+	}
+}
+
+func TestSize(t *testing.T) {
+	for i := range feed.Size {
+		_, err := posts.AddPost(a.DB, ctx, posts.Post{AuthorId: 2,
+			Title: fmt.Sprintf("Post %d", i), Text: "More"})
+		if err != nil {
+			t.Fatalf("test failed: %v", err)
+		}
+	}
+	tests := []struct {
+		path  string
+		first string
+		last  string
+	}{
+		{"/feed.rss", "Post 19", "Post 0"},
+		{"/feed/author/guest.rss", "Post 19", "Post 0"},
+		{"/feed/tag/go.rss", "Third Post", "First Post"},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			w := get(test.path, nil)
+			var doc feed.RSS
+			err := xml.Unmarshal(w.Body.Bytes(), &doc)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			items := doc.Channel.Items
+			if len(items) > feed.Size || items[0].Title != test.first ||
+				items[len(items)-1].Title != test.last {
+				t.Fatalf("test failed: %v", items)
+			}
+		})
+	}
+}
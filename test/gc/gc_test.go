@@ -0,0 +1,204 @@
+package gc_test
+
+import (
+	"blog/app"
+	"blog/config"
+	"blog/db/albums"
+	"blog/db/auth"
+	"blog/db/images"
+	"blog/db/posts"
+	"blog/db/profiles"
+	"blog/gc"
+	"blog/storage"
+	"blog/test/testutil"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var a *app.App
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.DevMode = true
+	var err error
+	a, err = app.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	testutil.InitDB(a, ctx)
+	for _, user := range []auth.User{
+		{Username: "user", Password: "password"},
+		{Username: "guest", Password: "password"},
+	} {
+		err = auth.AddUser(a.DB, ctx, user)
+		if err != nil {
+			panic(err)
+		}
+	}
+	m.Run()
+}
+
+// names returns the sorted names of the files in the storage.
+func names(t *testing.T, store storage.Storage) []string {
+	files, err := store.List(context.Background())
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func imageNames(report gc.Report) []string {
+	var names []string
+	for _, image := range report.Unused {
+		names = append(names, image.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func strayNames(report gc.Report) []string {
+	var names []string
+	for _, file := range report.Stray {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestCollect(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewFS(t.TempDir())
+	// linked.png is in a post, edited.png only in an older revision of
+	// it, album.png in an album, attached.png attached to the post and
+	// avatar.png an avatar. broken.png is linked but has no file. The
+	// guest has an unused copy of attached.png, whose file stays. Of the
+	// files without an image, only those named like the blog names them
+	// are stray.
+	imageList := []images.Image{
+		{Name: "linked.png"},
+		{Name: "edited.png"},
+		{Name: "album.png"},
+		{Name: "attached.png"},
+		{Name: "avatar.png"},
+		{Name: "broken.png"},
+		{Name: "unused.png", Thumbnail: images.Variant{Name: "unused-320.png", Width: 320}},
+		{Name: "gone.png"},
+	}
+	for i, image := range imageList {
+		image.AuthorId = 1
+		err := images.AddImage(a.DB, ctx, image)
+		if err != nil {
+			t.Fatalf("test failed: %v", err)
+		}
+		imageList[i], err = images.GetImageByName(a.DB, ctx, image.Name)
+		if err != nil {
+			t.Fatalf("test failed: %v", err)
+		}
+		if image.Name == "broken.png" || image.Name == "gone.png" {
+			continue
+		}
+		for _, name := range image.Files() {
+			err = store.Put(ctx, name, []byte(name), "image/png")
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+		}
+	}
+	err := images.AddImage(a.DB, ctx, images.Image{AuthorId: 2, Name: "attached.png"})
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	stray := strings.Repeat("a", 64) + "-320.png"
+	for _, name := range []string{stray, ".upload-123", "notes.txt", "stray.png"} {
+		err := store.Put(ctx, name, []byte(name), "image/png")
+		if err != nil {
+			t.Fatalf("test failed: %v", err)
+		}
+	}
+
+	postId, err := posts.AddPost(a.DB, ctx, posts.Post{AuthorId: 1, Title: "Post",
+		Text: "![Edited](http://localhost:8080/api/images/files/edited.png)"})
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	err = posts.UpdatePost(a.DB, ctx, postId, 1, posts.Post{Title: "Post",
+		Text:   "![Linked](/web/static/images/linked.png \"title\")\n<img src=\"/api/images/files/broken.png\">",
+		Status: posts.StatusPublished})
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	err = images.SetPostImages(a.DB, ctx, postId, []int{imageList[3].Id})
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	albumId, err := albums.AddAlbum(a.DB, ctx, albums.Album{AuthorId: 1, Name: "Album"})
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	err = albums.AddImage(a.DB, ctx, albumId, imageList[2].Id)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	err = profiles.UpdateProfile(a.DB, ctx, 1, profiles.Profile{AvatarId: imageList[4].Id})
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	files := names(t, store)
+	tests := []struct {
+		minAge  time.Duration
+		dryRun  bool
+		stray   []string
+		missing []string
+		unused  []string
+		files   []string
+	}{
+		{time.Hour, false, nil, []string{"broken.png", "gone.png"}, nil, files},
+		{0, true, []string{".upload-123", stray}, []string{"broken.png", "gone.png"},
+			[]string{"attached.png", "gone.png", "unused.png"}, files},
+		{0, false, []string{".upload-123", stray}, []string{"broken.png", "gone.png"},
+			[]string{"attached.png", "gone.png", "unused.png"},
+			[]string{"album.png", "attached.png", "avatar.png", "edited.png", "linked.png", "notes.txt", "stray.png"}},
+		{0, false, nil, []string{"broken.png"}, nil,
+			[]string{"album.png", "attached.png", "avatar.png", "edited.png", "linked.png", "notes.txt", "stray.png"}},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			report, err := gc.Collect(ctx, a.DB, store, test.minAge, test.dryRun)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			if !reflect.DeepEqual(strayNames(report), test.stray) {
+				t.Fatalf("test failed: %v", report.Stray)
+			}
+			sort.Strings(report.Missing)
+			if !reflect.DeepEqual(report.Missing, test.missing) {
+				t.Fatalf("test failed: %v", report.Missing)
+			}
+			if !reflect.DeepEqual(imageNames(report), test.unused) {
+				t.Fatalf("test failed: %v", report.Unused)
+			}
+			if files := names(t, store); !reflect.DeepEqual(files, test.files) {
+				t.Fatalf("test failed: %v", files)
+			}
+		})
+	}
+
+	imageList, err = images.GetImages(a.DB, ctx)
+	if err != nil || len(imageList) != 6 {
+		t.Fatalf("test failed: %v %v", imageList, err)
+	}
+}
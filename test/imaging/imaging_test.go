@@ -0,0 +1,313 @@
+package imaging_test
+
+import (
+	"blog/imaging"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+var limits = imaging.Limits{MaxSize: 1 << 20, MaxDimension: 64}
+
+// halves returns an image with a red left half and a blue right half.
+func halves(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < w/2 {
+				img.Set(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95})
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// withText inserts a tEXt chunk after the IHDR chunk of a PNG image.
+func withText(data []byte, text string) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)))
+	chunk = append(chunk, "tEXt"+text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	out := append([]byte{}, data[:33]...)
+	out = append(out, chunk...)
+	return append(out, data[33:]...)
+}
+
+// withExif inserts an EXIF segment with the orientation and a comment
+// after the start of a JPEG image.
+func withExif(data []byte, orientation int, comment string) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	tiff = append(tiff, 0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01)
+	tiff = append(tiff, 0x00, byte(orientation), 0x00, 0x00)
+	tiff = append(tiff, 0x00, 0x00, 0x00, 0x00)
+	exif := append([]byte("Exif\x00\x00"), tiff...)
+
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(exif)+2))
+	out = append(out, exif...)
+	out = append(out, 0xFF, 0xFE)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(comment)+2))
+	out = append(out, comment...)
+	return append(out, data[2:]...)
+}
+
+func TestProcess(t *testing.T) {
+	plain := encodePNG(t, halves(4, 2))
+	tagged := withText(plain, "Author\x00Jane Doe")
+	photo := encodeJPEG(t, halves(16, 8))
+	var animation bytes.Buffer
+	palette := color.Palette{color.White, color.Black}
+	err := gif.EncodeAll(&animation, &gif.GIF{
+		Image: []*image.Paletted{
+			image.NewPaletted(image.Rect(0, 0, 2, 2), palette),
+			image.NewPaletted(image.Rect(0, 0, 2, 2), palette),
+		},
+		Delay: []int{10, 10},
+	})
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	commented := animation.Bytes()
+	commented = append(commented[:len(commented)-1:len(commented)-1],
+		0x21, 0xFE, 6, 'J', 'a', 'n', 'e', ' ', 'D', 0x00, 0x3B)
+
+	tests := []struct {
+		data   []byte
+		kind   string
+		width  int
+		height int
+		err    error
+	}{
+		{plain, "image/png", 4, 2, nil},
+		{tagged, "image/png", 4, 2, nil},
+		{append(tagged, "<html>"...), "image/png", 4, 2, nil},
+		{photo, "image/jpeg", 16, 8, nil},
+		{withExif(photo, 1, "Jane Doe"), "image/jpeg", 16, 8, nil},
+		{withExif(photo, 6, "Jane Doe"), "image/jpeg", 8, 16, nil},
+		{append(photo, "<html>"...), "image/jpeg", 16, 8, nil},
+		{commented, "image/gif", 2, 2, nil},
+		{[]byte("<html><body>Hello</body></html>"), "", 0, 0, imaging.ErrType},
+		{[]byte("GIF89a"), "", 0, 0, imaging.ErrInvalid},
+		{append([]byte("\x89PNG\r\n\x1a\n"), "garbage"...), "", 0, 0, imaging.ErrInvalid},
+		{plain[:len(plain)-20], "", 0, 0, imaging.ErrInvalid},
+		{encodePNG(t, halves(65, 2)), "", 0, 0, imaging.ErrTooLarge},
+		{make([]byte, limits.MaxSize+1), "", 0, 0, imaging.ErrTooLarge},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			processed, err := imaging.Process(test.data, limits)
+			if err != test.err {
+				t.Fatalf("test failed: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if processed.Type != test.kind || processed.Width != test.width ||
+				processed.Height != test.height {
+				t.Fatalf("test failed: %v %dx%d", processed.Type, processed.Width, processed.Height)
+			}
+			if !strings.HasSuffix(processed.Name, imaging.Extensions[test.kind]) ||
+				len(processed.Name) != 64+len(imaging.Extensions[test.kind]) {
+				t.Fatalf("test failed: %v", processed.Name)
+			}
+			for _, leak := range []string{"Jane D", "Exif", "<html>"} {
+				if bytes.Contains(processed.Data, []byte(leak)) {
+					t.Fatalf("test failed: %q left in image", leak)
+				}
+			}
+			_, _, err = image.Decode(bytes.NewReader(processed.Data))
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestProcessMetadata(t *testing.T) {
+	plain := encodePNG(t, halves(4, 2))
+	first, err := imaging.Process(plain, limits)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	second, err := imaging.Process(withText(plain, "Comment\x00Hello"), limits)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	if first.Name != second.Name || !bytes.Equal(first.Data, plain) {
+		t.Fatalf("test failed: %v, %v", first.Name, second.Name)
+	}
+
+	photo := encodeJPEG(t, halves(16, 8))
+	kept, err := imaging.Process(withExif(photo, 1, "Hello"), limits)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	if !bytes.Equal(kept.Data, photo) {
+		t.Fatalf("test failed: JPEG data changed")
+	}
+
+	rotated, err := imaging.Process(withExif(photo, 6, "Hello"), limits)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(rotated.Data))
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	top, _, topBlue, _ := img.At(4, 2).RGBA()
+	bottom, _, bottomBlue, _ := img.At(4, 13).RGBA()
+	if top < 0xC000 || topBlue > 0x4000 || bottom > 0x4000 || bottomBlue < 0xC000 {
+		t.Fatalf("test failed: image not turned upright")
+	}
+
+	var animation bytes.Buffer
+	err = gif.EncodeAll(&animation, &gif.GIF{
+		Image: []*image.Paletted{
+			image.NewPaletted(image.Rect(0, 0, 2, 2), color.Palette{color.White}),
+			image.NewPaletted(image.Rect(0, 0, 2, 2), color.Palette{color.White}),
+		},
+		Delay: []int{10, 10},
+	})
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	looped, err := imaging.Process(animation.Bytes(), limits)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	if !bytes.Equal(looped.Data, animation.Bytes()) {
+		t.Fatalf("test failed: GIF data changed")
+	}
+}
+
+func TestOriginal(t *testing.T) {
+	tests := []struct {
+		filename string
+		original string
+	}{
+		{"cat.png", "cat.png"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\me\cat.png`, "cat.png"},
+		{"a\x00b\nc.png", "abc.png"},
+		{"", ""},
+		{"/", ""},
+		{strings.Repeat("é", 300), strings.Repeat("é", imaging.MaxOriginal)},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			original := imaging.Original(test.filename)
+			if original != test.original {
+				t.Fatalf("test failed: %q", original)
+			}
+		})
+	}
+}
+
+func TestContentName(t *testing.T) {
+	hash := strings.Repeat("0123456789abcdef", 4)
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{hash + ".png", true},
+		{hash + "-320.jpg", true},
+		{hash + ".gif", true},
+		{hash + ".txt", false},
+		{hash[1:] + ".png", false},
+		{strings.ToUpper(hash) + ".png", false},
+		{hash + "-.png", false},
+		{"cat.png", false},
+		{".upload-123", false},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			if imaging.ContentName(test.name) != test.valid {
+				t.Fatalf("test failed: %q", test.name)
+			}
+		})
+	}
+}
+
+func TestScale(t *testing.T) {
+	var animation bytes.Buffer
+	err := gif.Encode(&animation, image.NewPaletted(image.Rect(0, 0, 400, 100),
+		color.Palette{color.White, color.Black}), nil)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	tests := []struct {
+		data   []byte
+		width  int
+		scaled bool
+		kind   string
+		height int
+	}{
+		{encodePNG(t, halves(400, 200)), 320, true, "image/png", 160},
+		{encodeJPEG(t, halves(400, 200)), 320, true, "image/jpeg", 160},
+		{animation.Bytes(), 320, true, "image/png", 80},
+		{encodePNG(t, halves(401, 3)), 100, true, "image/png", 1},
+		{encodePNG(t, halves(320, 200)), 320, false, "", 0},
+		{encodePNG(t, halves(40, 20)), 320, false, "", 0},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			img, err := imaging.Process(test.data, imaging.Limits{MaxSize: 1 << 20, MaxDimension: 1000})
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			scaled, ok, err := imaging.Scale(img, test.width)
+			if err != nil || ok != test.scaled {
+				t.Fatalf("test failed: %v, %v", ok, err)
+			}
+			if !ok {
+				return
+			}
+			base := strings.TrimSuffix(img.Name, imaging.Extensions[img.Type])
+			if !imaging.ContentName(img.Name) || !imaging.ContentName(scaled.Name) {
+				t.Fatalf("test failed: %v %v", img.Name, scaled.Name)
+			}
+			if scaled.Type != test.kind || scaled.Width != test.width || scaled.Height != test.height ||
+				scaled.Name != fmt.Sprintf("%s-%d%s", base, test.width, imaging.Extensions[test.kind]) {
+				t.Fatalf("test failed: %v %v %dx%d", scaled.Name, scaled.Type, scaled.Width, scaled.Height)
+			}
+			decoded, _, err := image.Decode(bytes.NewReader(scaled.Data))
+			if err != nil || decoded.Bounds().Dx() != scaled.Width || decoded.Bounds().Dy() != scaled.Height {
+				t.Fatalf("test failed: %v", err)
+			}
+			if test.kind == "image/png" && i == 0 {
+				left, _, _, _ := decoded.At(10, 10).RGBA()
+				_, _, right, _ := decoded.At(310, 10).RGBA()
+				if left != 0xFFFF || right != 0xFFFF {
+					t.Fatalf("test failed: colors not kept")
+				}
+			}
+		})
+	}
+}
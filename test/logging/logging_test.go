@@ -0,0 +1,118 @@
+package logging_test
+
+import (
+	"blog/logging"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// entries decodes the JSON log lines in buf.
+func entries(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var list []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		err := json.Unmarshal([]byte(line), &entry)
+		if err != nil {
+			t.Fatalf("test failed: %v %s", err, line)
+		}
+		list = append(list, entry)
+	}
+	return list
+}
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.FormatJSON)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	handler := logging.Middleware(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.SetUser(r.Context(), 7)
+		logging.FromContext(r.Context()).Error("request failed", "err", "broken")
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/posts/?limit=1", nil))
+	id := rr.Header().Get(logging.RequestIDHeader)
+	if id == "" {
+		t.Fatalf("test failed: %v", rr.Header())
+	}
+	list := entries(t, &buf)
+	if len(list) != 2 {
+		t.Fatalf("test failed: %v", list)
+	}
+	handlerEntry, accessEntry := list[0], list[1]
+	if handlerEntry["msg"] != "request failed" || handlerEntry["request_id"] != id {
+		t.Fatalf("test failed: %v", handlerEntry)
+	}
+	want := map[string]any{
+		"level":      "ERROR",
+		"msg":        "request",
+		"request_id": id,
+		"method":     "POST",
+		"path":       "/api/posts/",
+		"status":     float64(500),
+		"user_id":    float64(7),
+	}
+	for key, value := range want {
+		if accessEntry[key] != value {
+			t.Fatalf("test failed: %s %v", key, accessEntry[key])
+		}
+	}
+	if _, ok := accessEntry["duration"]; !ok {
+		t.Fatalf("test failed: %v", accessEntry)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.FormatText)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	handler := logging.Middleware(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	tests := []struct {
+		header string
+		kept   bool
+	}{
+		{"", false},
+		{"abc-123.DEF_456", true},
+		{"has space", false},
+		{"line\nbreak", false},
+		{strings.Repeat("a", 65), false},
+	}
+	seen := make(map[string]bool)
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(logging.RequestIDHeader, test.header)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			id := rr.Header().Get(logging.RequestIDHeader)
+			if (id == test.header) != test.kept || id == "" || seen[id] {
+				t.Fatalf("test failed: %q", id)
+			}
+			seen[id] = true
+		})
+	}
+	if !strings.Contains(buf.String(), "status=200") || strings.Contains(buf.String(), "user_id") {
+		t.Fatalf("test failed: %s", buf.String())
+	}
+
+	// Outside of the middleware handlers log to the default logger.
+	if logging.FromContext(httptest.NewRequest("GET", "/", nil).Context()) == nil {
+		t.Fatalf("test failed")
+	}
+	_, err = logging.New(&buf, "xml")
+	if err == nil {
+		t.Fatalf("test failed: %v", err)
+	}
+}
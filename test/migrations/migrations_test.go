@@ -0,0 +1,163 @@
+package migrations_test
+
+import (
+	"blog/app"
+	"blog/config"
+	"blog/db/posts"
+	"blog/migrations"
+	"blog/test/testutil"
+	"context"
+	"fmt"
+	"testing"
+)
+
+var a *app.App
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.DevMode = true
+	var err error
+	a, err = app.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	m.Run()
+}
+
+func TestLoad(t *testing.T) {
+	migrationList, err := migrations.Load()
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	if len(migrationList) == 0 || migrationList[0].Name != "init" {
+		t.Fatalf("test failed: %v", migrationList)
+	}
+	for i, migration := range migrationList {
+		if migration.Version != i+1 {
+			t.Fatalf("test failed: %v", migration.Version)
+		}
+		if migration.Up == "" || migration.Down == "" {
+			t.Fatalf("test failed: %v", migration.Version)
+		}
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	testutil.RequireFTS5(t, a.DB)
+	migrationList, err := migrations.Load()
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	done, err := migrations.Up(a.DB, ctx)
+	if err != nil || len(done) != len(migrationList) {
+		t.Fatalf("test failed: %v", err)
+	}
+	pending, err := migrations.Pending(a.DB, ctx)
+	if err != nil || pending != 0 {
+		t.Fatalf("test failed: %v", pending)
+	}
+	done, err = migrations.Up(a.DB, ctx)
+	if err != nil || len(done) != 0 {
+		t.Fatalf("test failed: %v", done)
+	}
+
+	_, err = a.DB.ExecContext(ctx,
+		"INSERT INTO users (username, password) VALUES ('user', 'password')")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	done, err = migrations.Down(a.DB, ctx, 1)
+	if err != nil || len(done) != 1 {
+		t.Fatalf("test failed: %v", err)
+	}
+	pending, err = migrations.Pending(a.DB, ctx)
+	if err != nil || pending != 1 {
+		t.Fatalf("test failed: %v", pending)
+	}
+	done, err = migrations.Up(a.DB, ctx)
+	if err != nil || len(done) != 1 {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	var count int
+	err = a.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
+	if err != nil || count != 1 {
+		t.Fatalf("test failed: %v", count)
+	}
+
+	done, err = migrations.Down(a.DB, ctx, -1)
+	if err != nil || len(done) != len(migrationList) {
+		t.Fatalf("test failed: %v", err)
+	}
+	statuses, err := migrations.GetStatus(a.DB, ctx)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	for _, status := range statuses {
+		if status.Applied != nil {
+			t.Fatalf("test failed: %v", status)
+		}
+	}
+}
+
+// TestSearchUpgrade checks that the posts indexed by FTS4 before the
+// search moved to FTS5 can still be found.
+func TestSearchUpgrade(t *testing.T) {
+	testutil.RequireFTS5(t, a.DB)
+	_, err := migrations.Up(a.DB, ctx)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	_, err = migrations.Down(a.DB, ctx, 1)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	for _, query := range []string{
+		"INSERT INTO users (username, password) VALUES ('writer', 'password')",
+		"INSERT INTO posts (user_id, title, text) VALUES (1, 'Indexed', 'Before the upgrade')",
+		"INSERT INTO tags (name) VALUES ('old')",
+		"INSERT INTO post_tags (post_id, tag_id) VALUES (1, 1)",
+	} {
+		_, err = a.DB.ExecContext(ctx, query)
+		if err != nil {
+			t.Fatalf("test failed: %v", err)
+		}
+	}
+	_, err = migrations.Up(a.DB, ctx)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	_, err = a.DB.ExecContext(ctx,
+		"INSERT INTO posts (user_id, title, text) VALUES (1, 'Added', 'After the upgrade')")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		count int
+	}{
+		{"before", 1},
+		{"upgrade", 2},
+		{"tag:old", 1},
+		{"writer", 2},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			results, err := posts.Search(a.DB, ctx, posts.ParseQuery(test.query), 10)
+			if err != nil || len(results) != test.count {
+				t.Fatalf("test failed: %v %v", err, results)
+			}
+		})
+	}
+
+	_, err = migrations.Down(a.DB, ctx, -1)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package password_test
+
+import (
+	"blog/password"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestHashVerify(t *testing.T) {
+	tests := []struct {
+		hasher password.Hasher
+		prefix string
+	}{
+		{password.Argon2id{Time: 1, Memory: 1024, Threads: 1, KeyLen: 32, SaltLen: 16}, "$argon2id$"},
+		{password.Bcrypt{Cost: 4}, "$2a$"},
+		{password.SHA256{}, ""},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			encoded, err := test.hasher.Hash("password")
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			if !strings.HasPrefix(encoded, test.prefix) {
+				t.Fatalf("test failed: %v", encoded)
+			}
+			if !test.hasher.Identify(encoded) {
+				t.Fatalf("test failed: %v", encoded)
+			}
+			ok, err := test.hasher.Verify("password", encoded)
+			if err != nil || !ok {
+				t.Fatalf("test failed: %v", err)
+			}
+			ok, err = test.hasher.Verify("wrong", encoded)
+			if err != nil || ok {
+				t.Fatalf("test failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestSalt(t *testing.T) {
+	hasher := password.Argon2id{Time: 1, Memory: 1024, Threads: 1, KeyLen: 32, SaltLen: 16}
+	first, err := hasher.Hash("password")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	second, err := hasher.Hash("password")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	if first == second {
+		t.Fatalf("test failed: %v", first)
+	}
+}
+
+func TestChain(t *testing.T) {
+	weak := password.Argon2id{Time: 1, Memory: 1024, Threads: 1, KeyLen: 32, SaltLen: 16}
+	strong := password.Argon2id{Time: 2, Memory: 1024, Threads: 1, KeyLen: 32, SaltLen: 16}
+	chain := password.NewChain(strong, password.Bcrypt{Cost: 4}, password.SHA256{})
+
+	legacy, _ := password.SHA256{}.Hash("password")
+	bcrypted, _ := password.Bcrypt{Cost: 4}.Hash("password")
+	outdated, _ := weak.Hash("password")
+	current, _ := chain.Hash("password")
+
+	tests := []struct {
+		encoded string
+		rehash  bool
+	}{
+		{legacy, true},
+		{bcrypted, true},
+		{outdated, true},
+		{current, false},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			ok, err := chain.Verify("password", test.encoded)
+			if err != nil || !ok {
+				t.Fatalf("test failed: %v", err)
+			}
+			if chain.NeedsRehash(test.encoded) != test.rehash {
+				t.Fatalf("test failed: %v", test.encoded)
+			}
+		})
+	}
+
+	_, err := chain.Verify("password", "plaintext")
+	if err == nil {
+		t.Fatalf("test failed: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package policy_test
+
+import (
+	"blog/policy"
+	"fmt"
+	"testing"
+)
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		userId  int
+		role    string
+		action  policy.Action
+		ownerId int
+		allowed bool
+	}{
+		{1, policy.RoleUser, policy.EditPost, 1, true},
+		{1, policy.RoleUser, policy.DeleteComment, 1, true},
+		{1, policy.RoleUser, policy.EditPost, 2, false},
+		{1, policy.RoleUser, policy.DeleteImage, 2, false},
+		{1, policy.RoleUser, policy.ManageRoles, 0, false},
+		{1, policy.RoleUser, policy.ManageRoles, 1, false},
+		{2, policy.RoleModerator, policy.EditPost, 1, true},
+		{2, policy.RoleModerator, policy.DeletePost, 1, true},
+		{2, policy.RoleModerator, policy.EditComment, 1, true},
+		{2, policy.RoleModerator, policy.DeleteImage, 1, true},
+		{2, policy.RoleModerator, policy.ManageRoles, 0, false},
+		{3, policy.RoleAdmin, policy.DeletePost, 1, true},
+		{3, policy.RoleAdmin, policy.ManageRoles, 0, true},
+		{1, policy.RoleUser, policy.EditProfile, 1, true},
+		{2, policy.RoleModerator, policy.EditProfile, 1, false},
+		{3, policy.RoleAdmin, policy.EditProfile, 1, true},
+		{1, policy.RoleUser, policy.EditAlbum, 1, true},
+		{1, policy.RoleUser, policy.DeleteAlbum, 2, false},
+		{2, policy.RoleModerator, policy.EditAlbum, 1, false},
+		{2, policy.RoleModerator, policy.DeleteAlbum, 1, true},
+		{3, policy.RoleAdmin, policy.EditAlbum, 1, true},
+		{0, policy.RoleAdmin, policy.DeletePost, 0, false},
+		{4, "", policy.EditPost, 1, false},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			allowed := policy.Can(test.userId, test.role, test.action, test.ownerId)
+			if allowed != test.allowed {
+				t.Fatalf("test failed: %v", allowed)
+			}
+		})
+	}
+}
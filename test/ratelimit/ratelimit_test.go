@@ -0,0 +1,223 @@
+package ratelimit_test
+
+import (
+	"blog/ratelimit"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	limiter := ratelimit.NewLimiter(1, 2)
+	tests := []struct {
+		key     string
+		allowed bool
+	}{
+		{"a", true},
+		{"a", true},
+		{"a", false},
+		{"b", true},
+		{"b", true},
+		{"a", false},
+		{"b", false},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			allowed, wait := limiter.Allow(test.key)
+			if allowed != test.allowed {
+				t.Fatalf("test failed: %v", allowed)
+			}
+			if !allowed && (wait <= 0 || wait > time.Second) {
+				t.Fatalf("test failed: %v", wait)
+			}
+		})
+	}
+
+	var disabled *ratelimit.Limiter
+	for i := 0; i < 10; i++ {
+		if allowed, _ := disabled.Allow("a"); !allowed {
+			t.Fatalf("test failed: %v", allowed)
+		}
+	}
+	limiter = ratelimit.NewLimiter(0, 1)
+	for i := 0; i < 10; i++ {
+		if allowed, _ := limiter.Allow("a"); !allowed {
+			t.Fatalf("test failed: %v", allowed)
+		}
+	}
+}
+
+func TestRefill(t *testing.T) {
+	limiter := ratelimit.NewLimiter(20, 1)
+	if allowed, _ := limiter.Allow("a"); !allowed {
+		t.Fatalf("test failed: %v", allowed)
+	}
+	if allowed, _ := limiter.Allow("a"); allowed {
+		t.Fatalf("test failed: %v", allowed)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if allowed, _ := limiter.Allow("a"); !allowed {
+		t.Fatalf("test failed: %v", allowed)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter := ratelimit.NewLimiter(1.0/60, 1)
+	proxies, err := ratelimit.ParseProxies("127.0.0.1, 10.1.0.0/16")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	user := func(r *http.Request) string { return r.Header.Get("User") }
+	handler := ratelimit.Middleware(limiter, proxies, user,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	tests := []struct {
+		method    string
+		addr      string
+		forwarded string
+		user      string
+		status    int
+	}{
+		{"POST", "10.0.0.1:1234", "", "", http.StatusOK},
+		{"POST", "10.0.0.1:1234", "", "", http.StatusTooManyRequests},
+		{"GET", "10.0.0.1:1234", "", "", http.StatusOK},
+		{"DELETE", "10.0.0.2:1234", "", "", http.StatusOK},
+		// Loopback clients are limited like any other.
+		{"PUT", "127.0.0.1:1234", "", "", http.StatusOK},
+		{"PUT", "127.0.0.1:1234", "", "", http.StatusTooManyRequests},
+		// Trusted proxies tell the client IP.
+		{"POST", "127.0.0.1:1234", "10.0.0.4", "", http.StatusOK},
+		{"POST", "127.0.0.1:1234", "10.0.0.4", "", http.StatusTooManyRequests},
+		{"POST", "127.0.0.1:1234", "10.0.0.5, 10.1.2.3", "", http.StatusOK},
+		{"POST", "127.0.0.1:1234", "10.0.0.4, 10.0.0.6", "", http.StatusOK},
+		{"POST", "127.0.0.1:1234", "bogus", "", http.StatusTooManyRequests},
+		// Other clients can not.
+		{"POST", "10.0.0.7:1234", "10.0.0.8", "", http.StatusOK},
+		{"POST", "10.0.0.7:1234", "10.0.0.9", "", http.StatusTooManyRequests},
+		{"POST", "10.0.0.10:1234", "", "1", http.StatusOK},
+		{"POST", "10.0.0.11:1234", "", "1", http.StatusTooManyRequests},
+		{"POST", "10.0.0.12:1234", "", "2", http.StatusOK},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			req, err := http.NewRequest(test.method, "/", nil)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			req.RemoteAddr = test.addr
+			if test.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", test.forwarded)
+			}
+			req.Header.Set("User", test.user)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if status := rr.Code; status != test.status {
+				t.Fatalf("test failed: %v", status)
+			}
+			retry := rr.Header().Get("Retry-After")
+			if rr.Code == http.StatusTooManyRequests && retry != "60" {
+				t.Fatalf("test failed: %v", retry)
+			}
+		})
+	}
+}
+
+func TestParseProxies(t *testing.T) {
+	tests := []struct {
+		list  string
+		count int
+		valid bool
+	}{
+		{"", 0, true},
+		{"127.0.0.1", 1, true},
+		{"127.0.0.1, ::1, 10.0.0.0/8", 3, true},
+		{"localhost", 0, false},
+		{"10.0.0.0/33", 0, false},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			proxies, err := ratelimit.ParseProxies(test.list)
+			if (err == nil) != test.valid || len(proxies) != test.count {
+				t.Fatalf("test failed: %v %v", proxies, err)
+			}
+		})
+	}
+}
+
+func TestLockout(t *testing.T) {
+	lockout := ratelimit.NewLockout(3, 40*time.Millisecond)
+	tests := []struct {
+		reset   bool
+		allowed bool
+		wait    time.Duration
+	}{
+		{false, true, 0},
+		{false, true, 0},
+		{false, true, 40 * time.Millisecond},
+		{false, false, 40 * time.Millisecond},
+		{true, true, 0},
+		{false, true, 0},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			if test.reset {
+				lockout.Reset("user")
+			}
+			allowed, wait := lockout.Attempt("user")
+			if allowed != test.allowed || wait > test.wait || (test.wait > 0 && wait == 0) {
+				t.Fatalf("test failed: %v %v", allowed, wait)
+			}
+		})
+	}
+
+	if allowed, wait := lockout.Attempt("other"); !allowed || wait != 0 {
+		t.Fatalf("test failed: %v %v", allowed, wait)
+	}
+
+	// Every failure after the lockout ends doubles it.
+	lockout.Reset("user")
+	for i := 0; i < 3; i++ {
+		lockout.Attempt("user")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if allowed, wait := lockout.Attempt("user"); !allowed || wait != 80*time.Millisecond {
+		t.Fatalf("test failed: %v %v", allowed, wait)
+	}
+
+	lockout = ratelimit.NewLockout(1, time.Hour)
+	for i := 0; i < 100; i++ {
+		if allowed, wait := lockout.Attempt("user"); wait > ratelimit.MaxLockout {
+			t.Fatalf("test failed: %v %v", allowed, wait)
+		}
+	}
+
+	var disabled *ratelimit.Lockout
+	if allowed, wait := disabled.Attempt("user"); !allowed || wait != 0 {
+		t.Fatalf("test failed: %v %v", allowed, wait)
+	}
+}
+
+func TestConcurrentLockout(t *testing.T) {
+	lockout := ratelimit.NewLockout(3, time.Hour)
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := lockout.Attempt("user"); ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed.Load() != 3 {
+		t.Fatalf("test failed: %v", allowed.Load())
+	}
+}
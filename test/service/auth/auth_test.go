@@ -0,0 +1,156 @@
+package auth_test
+
+import (
+	"blog/app"
+	"blog/config"
+	"blog/service"
+	auth_service "blog/service/auth"
+	"blog/test/testutil"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var a *app.App
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.DevMode = true
+	var err error
+	a, err = app.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	testutil.InitDB(a, ctx)
+	err = auth_service.Register(a, ctx, "user", "password")
+	if err != nil {
+		panic(err)
+	}
+	m.Run()
+}
+
+func TestRegister(t *testing.T) {
+	tests := []struct {
+		username string
+		password string
+		err      error
+	}{
+		{"new", "password", nil},
+		{"user", "password", service.ErrConflict},
+		{"", "password", service.ErrInvalid},
+		{"other", "", service.ErrInvalid},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			err := auth_service.Register(a, ctx, test.username, test.password)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("test failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	tests := []struct {
+		username string
+		password string
+		err      error
+	}{
+		{"user", "password", nil},
+		{"user", "wrong", service.ErrUnauthorized},
+		{"nobody", "password", service.ErrNotFound},
+		{"user", "", service.ErrInvalid},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			tokens, err := auth_service.Login(a, ctx, test.username, test.password)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("test failed: %v", err)
+			}
+			if err == nil && (tokens.AccessToken == "" || tokens.RefreshToken == "") {
+				t.Fatalf("test failed: %+v", tokens)
+			}
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	tokens, err := auth_service.Login(a, ctx, "user", "password")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	renewed, err := auth_service.Refresh(a, ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	// Reusing a refresh token after the grace period revokes its family.
+	now := a.Now
+	defer func() { a.Now = now }()
+	a.Now = func() time.Time { return now().Add(a.Config.RefreshGrace + time.Second) }
+	_, err = auth_service.Refresh(a, ctx, tokens.RefreshToken)
+	if !errors.Is(err, service.ErrUnauthorized) {
+		t.Fatalf("test failed: %v", err)
+	}
+	_, err = auth_service.Refresh(a, ctx, renewed.RefreshToken)
+	if !errors.Is(err, service.ErrUnauthorized) {
+		t.Fatalf("test failed: %v", err)
+	}
+}
+
+func TestRefreshGrace(t *testing.T) {
+	tokens, err := auth_service.Login(a, ctx, "user", "password")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	// Refreshing twice with the same token within the grace period, as
+	// concurrent requests do, gives the same successor both times.
+	first, err := auth_service.Refresh(a, ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	second, err := auth_service.Refresh(a, ctx, tokens.RefreshToken)
+	if err != nil || second.RefreshToken != first.RefreshToken || second.AccessToken == "" {
+		t.Fatalf("test failed: %v %+v %+v", err, first, second)
+	}
+	renewed, err := auth_service.Refresh(a, ctx, second.RefreshToken)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	// Once the successor is used, the old token is reuse even within
+	// the grace period.
+	_, err = auth_service.Refresh(a, ctx, tokens.RefreshToken)
+	if !errors.Is(err, service.ErrUnauthorized) {
+		t.Fatalf("test failed: %v", err)
+	}
+	_, err = auth_service.Refresh(a, ctx, renewed.RefreshToken)
+	if !errors.Is(err, service.ErrUnauthorized) {
+		t.Fatalf("test failed: %v", err)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	tokens, err := auth_service.Login(a, ctx, "user", "password")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	family, err := auth_service.Family(a, ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	err = auth_service.Logout(a, ctx, family)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	_, err = auth_service.Refresh(a, ctx, tokens.RefreshToken)
+	if !errors.Is(err, service.ErrUnauthorized) {
+		t.Fatalf("test failed: %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package posts_test
+
+import (
+	"blog/app"
+	"blog/config"
+	"blog/db/auth"
+	"blog/db/comments"
+	"blog/db/page"
+	"blog/db/posts"
+	"blog/service"
+	comments_service "blog/service/comments"
+	posts_service "blog/service/posts"
+	"blog/test/testutil"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var publishedId, draftId int
+
+var a *app.App
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.DevMode = true
+	var err error
+	a, err = app.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	testutil.InitDB(a, ctx)
+	users := []auth.User{
+		{Username: "user", Password: "password"},
+		{Username: "guest", Password: "password"},
+	}
+	for _, user := range users {
+		err = auth.AddUser(a.DB, ctx, user)
+		if err != nil {
+			panic(err)
+		}
+	}
+	publishedId, err = posts_service.Add(a, ctx, 1,
+		posts.Post{Title: "Published", Text: "Hello, World!"})
+	if err != nil {
+		panic(err)
+	}
+	draftId, err = posts_service.Add(a, ctx, 1,
+		posts.Post{Title: "Draft", Text: "Not yet", Status: posts.StatusDraft})
+	if err != nil {
+		panic(err)
+	}
+	m.Run()
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		post posts.Post
+		err  error
+	}{
+		{posts.Post{Title: "Title", Text: "Text"}, nil},
+		{posts.Post{Title: "Title"}, service.ErrInvalid},
+		{posts.Post{Title: "Title", Text: "Text", Images: []int{100}}, service.ErrInvalid},
+		{posts.Post{Title: "Title", Text: "Text", Status: "unknown"}, service.ErrInvalid},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			_, err := posts_service.Add(a, ctx, 2, test.post)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("test failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		userId int
+		postId int
+		err    error
+	}{
+		{0, publishedId, nil},
+		{2, publishedId, nil},
+		{1, draftId, nil},
+		{2, draftId, service.ErrNotFound},
+		{0, draftId, service.ErrNotFound},
+		{1, 100, service.ErrNotFound},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			post, err := posts_service.Get(a, ctx, test.userId, test.postId)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("test failed: %v", err)
+			}
+			if err == nil && post.Id != test.postId {
+				t.Fatalf("test failed: got post %d", post.Id)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	rename := func(post *posts.Post) error {
+		post.Title = "Renamed"
+		return nil
+	}
+	refuse := func(post *posts.Post) error {
+		return service.Invalid("Invalid JSON")
+	}
+	tests := []struct {
+		userId int
+		postId int
+		edit   func(*posts.Post) error
+		err    error
+	}{
+		{2, publishedId, rename, service.ErrForbidden},
+		{0, publishedId, rename, service.ErrForbidden},
+		{1, 100, rename, service.ErrNotFound},
+		{1, publishedId, refuse, service.ErrInvalid},
+		{1, publishedId, rename, nil},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			err := posts_service.Update(a, ctx, test.userId, test.postId, test.edit)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("test failed: %v", err)
+			}
+		})
+	}
+
+	post, err := posts_service.Get(a, ctx, 1, publishedId)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	if post.Title != "Renamed" {
+		t.Fatalf("test failed: title is %q", post.Title)
+	}
+}
+
+func TestVote(t *testing.T) {
+	err := posts_service.Vote(a, ctx, 2, 100, "like")
+	if !errors.Is(err, service.ErrNotFound) {
+		t.Fatalf("test failed: %v", err)
+	}
+	err = posts_service.Vote(a, ctx, 2, publishedId, "like")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	score, err := posts_service.Score(a, ctx, 2, publishedId)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	if score != 1 {
+		t.Fatalf("test failed: score is %d", score)
+	}
+}
+
+// TestDraftVisibility checks that the post of every operation on a post
+// by id is hidden from other users while it is a draft.
+func TestDraftVisibility(t *testing.T) {
+	comment, err := addComment(draftId)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	tests := []func(userId int) error{
+		func(userId int) error {
+			return posts_service.Vote(a, ctx, userId, draftId, "like")
+		},
+		func(userId int) error {
+			_, err := posts_service.Score(a, ctx, userId, draftId)
+			return err
+		},
+		func(userId int) error {
+			_, err := posts_service.Tags(a, ctx, userId, draftId)
+			return err
+		},
+		func(userId int) error {
+			_, err := comments_service.Add(a, ctx, userId, draftId, "Comment")
+			return err
+		},
+		func(userId int) error {
+			_, err := comments_service.Reply(a, ctx, userId, comment.Id, "Reply")
+			return err
+		},
+		func(userId int) error {
+			_, _, err := comments_service.Page(a, ctx, userId, draftId, page.Cursor{}, 10, "")
+			return err
+		},
+		func(userId int) error {
+			_, err := comments_service.Get(a, ctx, userId, comment.Id)
+			return err
+		},
+		func(userId int) error {
+			return comments_service.Vote(a, ctx, userId, comment.Id, "like")
+		},
+		func(userId int) error {
+			_, err := comments_service.Score(a, ctx, userId, comment.Id)
+			return err
+		},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			for _, userId := range []int{0, 2} {
+				err := test(userId)
+				if !errors.Is(err, service.ErrNotFound) {
+					t.Fatalf("test failed: %d %v", userId, err)
+				}
+			}
+			err := test(1)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+		})
+	}
+}
+
+// addComment adds a comment by the author to the post and returns it.
+func addComment(postId int) (comments.Comment, error) {
+	commentId, err := comments_service.Add(a, ctx, 1, postId, "First")
+	if err != nil {
+		return comments.Comment{}, err
+	}
+	return comments_service.Get(a, ctx, 1, commentId)
+}
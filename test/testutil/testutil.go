@@ -0,0 +1,60 @@
+// Package testutil holds what the test packages share.
+package testutil
+
+import (
+	"blog/app"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+// InitDB applies the migrations for TestMain. Search needs FTS5, which
+// the sqlite3 driver only has with the sqlite_fts5 build tag; without
+// it the tests of the package can not run, so they are skipped and the
+// process exits successfully.
+func InitDB(a *app.App, ctx context.Context) {
+	err := a.InitDB(ctx)
+	if errors.Is(err, app.ErrNoFTS5) {
+		fmt.Println("skipping tests:", err)
+		os.Exit(0)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RequireFTS5 skips the test unless SQLite has FTS5.
+func RequireFTS5(t *testing.T, db *sql.DB) {
+	var ok bool
+	err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&ok)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	if !ok {
+		t.Skip(app.ErrNoFTS5)
+	}
+}
+
+// NextCursor returns the cursor of the rel="next" Link header
+// set by util.SetNextLink, or an empty string on the last page.
+func NextCursor(header http.Header) string {
+	for _, link := range header.Values("Link") {
+		target, params, ok := strings.Cut(link, ";")
+		if !ok || !strings.Contains(params, `rel="next"`) {
+			continue
+		}
+		target = strings.Trim(strings.TrimSpace(target), "<>")
+		next, err := url.Parse(target)
+		if err != nil {
+			continue
+		}
+		return next.Query().Get("cursor")
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package auth_test
+
+import (
+	auth_service "blog/service/auth"
+	"blog/util"
+	"blog/web/auth"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccountToken(t *testing.T) {
+	err := auth_service.Register(a, ctx, "account", "password")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	tokens, err := auth_service.Login(a, ctx, "account", "password")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	family, err := auth_service.Family(a, ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	userId, err := util.ParseToken(a, ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	now := a.Now
+	a.Now = func() time.Time { return time.Now().Add(-time.Hour) }
+	expired, err := util.NewAccessToken(a, userId, "", family)
+	a.Now = now
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	changed := url.Values{"old-password": {"password"}, "password": {"changed"}, "confirm-password": {"changed"}}
+	tests := []struct {
+		method   string
+		path     string
+		token    string
+		form     url.Values
+		status   int
+		location string
+	}{
+		{"GET", "/account", "invalid", nil, http.StatusSeeOther, "/web/auth/login"},
+		{"GET", "/account", expired, nil, http.StatusSeeOther, "/web/auth/login"},
+		{"POST", "/password", "invalid", changed, http.StatusUnauthorized, ""},
+		{"POST", "/password", expired, changed, http.StatusUnauthorized, ""},
+		{"POST", "/username", "invalid", url.Values{"username": {"renamed"}}, http.StatusUnauthorized, ""},
+		{"POST", "/delete", expired, url.Values{"password": {"password"}}, http.StatusUnauthorized, ""},
+		{"POST", "/password", tokens.AccessToken, changed, http.StatusOK, ""},
+	}
+	mux := auth.ServeMux(a)
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			req, err := http.NewRequest(test.method, test.path, strings.NewReader(test.form.Encode()))
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "Token", Value: test.token})
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+			if rr.Code != test.status || rr.Header().Get("Location") != test.location {
+				t.Fatalf("test failed: %v %v %s", rr.Code, rr.Header().Get("Location"), rr.Body)
+			}
+		})
+	}
+}
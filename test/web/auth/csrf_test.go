@@ -0,0 +1,217 @@
+package auth_test
+
+import (
+	"blog/app"
+	"blog/config"
+	auth_service "blog/service/auth"
+	"blog/test/testutil"
+	"blog/web"
+	"blog/web/auth"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var a *app.App
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	cfg := config.Default()
+	cfg.DBFile = ":memory:"
+	cfg.DevMode = true
+	var err error
+	a, err = app.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	testutil.InitDB(a, ctx)
+	m.Run()
+}
+
+func TestCSRF(t *testing.T) {
+	token, err := auth.NewCSRFToken(a.Secret, "")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	other, err := auth.NewCSRFToken(a.Secret, "")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	forged := "forged.signature"
+
+	tests := []struct {
+		method string
+		cookie string
+		header string
+		status int
+		issued bool
+	}{
+		{"GET", "", "", http.StatusOK, true},
+		{"GET", token, "", http.StatusOK, false},
+		{"GET", forged, "", http.StatusOK, true},
+		{"HEAD", "", "", http.StatusOK, true},
+		{"POST", "", "", http.StatusForbidden, true},
+		{"POST", token, "", http.StatusForbidden, false},
+		{"POST", "", token, http.StatusForbidden, true},
+		{"POST", token, other, http.StatusForbidden, false},
+		{"POST", forged, forged, http.StatusForbidden, true},
+		{"POST", token, token, http.StatusOK, false},
+		{"PUT", token, token, http.StatusOK, false},
+		{"DELETE", token, "", http.StatusForbidden, false},
+		{"DELETE", token, token, http.StatusOK, false},
+	}
+	handler := auth.CSRF(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			req, err := http.NewRequest(test.method, "/posts/add", nil)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			if test.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: auth.CSRFCookie, Value: test.cookie})
+			}
+			if test.header != "" {
+				req.Header.Set(auth.CSRFHeader, test.header)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if status := rr.Code; status != test.status {
+				t.Fatalf("test failed: %v", status)
+			}
+
+			var issued *http.Cookie
+			for _, cookie := range rr.Result().Cookies() {
+				if cookie.Name == auth.CSRFCookie {
+					issued = cookie
+				}
+			}
+			if (issued != nil) != test.issued {
+				t.Fatalf("test failed: %v", issued)
+			}
+			if issued != nil && !auth.ValidCSRFToken(a.Secret, "", issued.Value) {
+				t.Fatalf("test failed: %v", issued.Value)
+			}
+		})
+	}
+}
+
+func TestValidCSRFToken(t *testing.T) {
+	token, err := auth.NewCSRFToken(a.Secret, "session")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	tests := []struct {
+		session string
+		token   string
+		valid   bool
+	}{
+		{"session", token, true},
+		{"other", token, false},
+		{"", token, false},
+		{"session", "", false},
+		{"session", "nonce", false},
+		{"session", "." + token, false},
+		{"session", token + "x", false},
+		{"session", "x" + token, false},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			valid := auth.ValidCSRFToken(a.Secret, test.session, test.token)
+			if valid != test.valid {
+				t.Fatalf("test failed: %v", valid)
+			}
+		})
+	}
+}
+
+func TestCSRFSession(t *testing.T) {
+	err := auth_service.Register(a, ctx, "victim", "password")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	tokens, err := auth_service.Login(a, ctx, "victim", "password")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	family, err := auth_service.Family(a, ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	// A token from another session, such as one an attacker got for
+	// themselves and planted, is refused.
+	planted, err := auth.NewCSRFToken(a.Secret, "")
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	own, err := auth.NewCSRFToken(a.Secret, family)
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	tests := []struct {
+		token  string
+		status int
+		issued bool
+	}{
+		{planted, http.StatusForbidden, true},
+		{own, http.StatusOK, false},
+	}
+	handler := auth.CSRF(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/posts/add", nil)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			req.AddCookie(&http.Cookie{Name: "RefreshToken", Value: tokens.RefreshToken})
+			req.AddCookie(&http.Cookie{Name: auth.CSRFCookie, Value: test.token})
+			req.Header.Set(auth.CSRFHeader, test.token)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if status := rr.Code; status != test.status {
+				t.Fatalf("test failed: %v", status)
+			}
+
+			var issued *http.Cookie
+			for _, cookie := range rr.Result().Cookies() {
+				if cookie.Name == auth.CSRFCookie {
+					issued = cookie
+				}
+			}
+			if (issued != nil) != test.issued {
+				t.Fatalf("test failed: %v", issued)
+			}
+			if issued != nil && !auth.ValidCSRFToken(a.Secret, family, issued.Value) {
+				t.Fatalf("test failed: %v", issued.Value)
+			}
+		})
+	}
+}
+
+func TestCSRFRoutes(t *testing.T) {
+	paths := []string{
+		"/posts/add", "/posts/like/1", "/comments/add/1",
+		"/images/upload", "/auth/login", "/users/update/user",
+	}
+	mux := web.ServeMux(a)
+	for i, path := range paths {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			req, err := http.NewRequest("POST", path, nil)
+			if err != nil {
+				t.Fatalf("test failed: %v", err)
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+			if status := rr.Code; status != http.StatusForbidden {
+				t.Fatalf("test failed: %v", status)
+			}
+		})
+	}
+}
@@ -1,12 +1,28 @@
 package util
 
 import (
-	"blog/config"
+	"blog/app"
+	"blog/db/auth"
+	"blog/db/comments"
+	"blog/db/page"
+	"blog/logging"
+	"blog/ratelimit"
+	"blog/service"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"net/http"
+	"net/url"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -25,31 +41,196 @@ func ParseUrlId(path string) int {
 	return id
 }
 
-func ParseToken(tokenString string) (int, error) {
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int
+}
+
+func RandomString(n int) (string, error) {
+	data := make([]byte, n)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func HashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+func NewAccessToken(a *app.App, userId int, role string, family string) (string, error) {
+	jti, err := RandomString(16)
+	if err != nil {
+		return "", err
+	}
+	now := a.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": userId,
+		"role":    role,
+		"fam":     family,
+		"jti":     jti,
+		"iat":     now.Unix(),
+		"exp":     now.Add(a.Config.AccessTokenTTL).Unix(),
+	})
+	tokenString, err := token.SignedString(a.Secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %v", err)
+	}
+	return tokenString, nil
+}
+
+// NewTokenPair issues an access token together with a refresh token
+// that belongs to the given family. An empty family starts a new one.
+func NewTokenPair(a *app.App, ctx context.Context, user auth.User, family string) (TokenPair, error) {
+	var err error
+	if family == "" {
+		family, err = RandomString(16)
+		if err != nil {
+			return TokenPair{}, err
+		}
+	}
+	refreshToken, err := RandomString(32)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return addTokenPair(a, ctx, user, family, refreshToken)
+}
+
+// RotateTokenPair issues a token pair of the family whose refresh token
+// is the successor of the used one, see NextRefreshToken.
+func RotateTokenPair(a *app.App, ctx context.Context, user auth.User, family, used string) (TokenPair, error) {
+	return addTokenPair(a, ctx, user, family, NextRefreshToken(a, used))
+}
+
+// ReissueTokenPair issues a new access token together with the successor
+// of the used refresh token, which RotateTokenPair already stored.
+func ReissueTokenPair(a *app.App, user auth.User, family, used string) (TokenPair, error) {
+	return tokenPair(a, user, family, NextRefreshToken(a, used))
+}
+
+// NextRefreshToken returns the refresh token that replaces the used one.
+// It is derived from the used one with the secret rather than drawn at
+// random, so that the same successor can be handed out again without
+// keeping it anywhere but as a hash.
+func NextRefreshToken(a *app.App, used string) string {
+	mac := hmac.New(sha256.New, a.Secret)
+	mac.Write([]byte("refresh:" + used))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func addTokenPair(a *app.App, ctx context.Context, user auth.User, family, refreshToken string) (TokenPair, error) {
+	err := auth.AddRefreshToken(a.DB, ctx, auth.RefreshToken{
+		TokenHash: HashToken(refreshToken),
+		Family:    family,
+		UserId:    user.Id,
+		Expires:   a.Now().Add(a.Config.RefreshTokenTTL),
+	})
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return tokenPair(a, user, family, refreshToken)
+}
+
+func tokenPair(a *app.App, user auth.User, family, refreshToken string) (TokenPair, error) {
+	accessToken, err := NewAccessToken(a, user.Id, user.Role, family)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(a.Config.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// ParseClaims returns the claims of an access token. A token that is
+// invalid, expired or revoked, or whose user was deleted, is answered
+// with an ErrUnauthorized *service.Error.
+func ParseClaims(a *app.App, ctx context.Context, tokenString string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
 		_, ok := token.Method.(*jwt.SigningMethodHMAC)
 		if !ok {
 			return nil,
 				fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return config.Secret, nil
+		return a.Secret, nil
 	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse token: %v", err)
+		return nil, service.Unauthorized("Invalid Token")
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !(ok && token.Valid) {
-		return 0, fmt.Errorf("failed to obtain claims: %v", err)
+		return nil, service.Unauthorized("Invalid Token")
+	}
+
+	_, ok = claims["exp"].(float64)
+	if !ok {
+		return nil, service.Unauthorized("Invalid Token")
+	}
+
+	family, ok := claims["fam"].(string)
+	if !ok || family == "" {
+		return nil, service.Unauthorized("Invalid Token")
+	}
+	revoked, err := auth.IsFamilyRevoked(a.DB, ctx, family)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, service.Unauthorized("Invalid Token")
+	}
+	// Deleting a user deletes its refresh tokens rather than revoking
+	// them, so the user must be checked as well.
+	userId, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, service.Unauthorized("Invalid Token")
+	}
+	_, err = auth.GetUserById(a.DB, ctx, int(userId))
+	if err == sql.ErrNoRows {
+		return nil, service.Unauthorized("Invalid Token")
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The access log shows who made the request.
+	logging.SetUser(ctx, int(userId))
+
+	return claims, nil
+}
+
+func ParseToken(a *app.App, ctx context.Context, tokenString string) (int, error) {
+	claims, err := ParseClaims(a, ctx, tokenString)
+	if err != nil {
+		return 0, err
 	}
 
 	val, ok := claims["user_id"].(float64)
 	if !ok {
-		return 0, fmt.Errorf("failed to obtain user_id: %v", err)
+		return 0, service.Unauthorized("Invalid Token")
 	}
 	return int(val), nil
 }
 
+// ParseUser returns the id and role carried by the token. The role
+// is only a hint for rendering; the API authorizes against the database.
+func ParseUser(a *app.App, ctx context.Context, tokenString string) (auth.User, error) {
+	claims, err := ParseClaims(a, ctx, tokenString)
+	if err != nil {
+		return auth.User{}, err
+	}
+
+	val, ok := claims["user_id"].(float64)
+	if !ok {
+		return auth.User{}, service.Unauthorized("Invalid Token")
+	}
+	role, _ := claims["role"].(string)
+	return auth.User{Id: int(val), Role: role}, nil
+}
+
 func ParseAuthHeader(r *http.Request) (string, error) {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
@@ -62,6 +243,37 @@ func ParseAuthHeader(r *http.Request) (string, error) {
 	return token, nil
 }
 
+// Authenticate returns the id of the user of the access token in the
+// Authorization header. It writes the error response and reports false
+// if there is no valid token.
+func Authenticate(a *app.App, w http.ResponseWriter, r *http.Request) (int, bool) {
+	token, err := ParseAuthHeader(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return 0, false
+	}
+	userId, err := ParseToken(a, r.Context(), token)
+	if err != nil {
+		http.Error(w, "Invalid Token", http.StatusUnauthorized)
+		return 0, false
+	}
+	return userId, true
+}
+
+// Viewer returns the id of the user of the access token in the
+// Authorization header, or 0 if there is no valid token.
+func Viewer(a *app.App, r *http.Request) int {
+	token, err := ParseAuthHeader(r)
+	if err != nil {
+		return 0
+	}
+	userId, err := ParseToken(a, r.Context(), token)
+	if err != nil {
+		return 0
+	}
+	return userId
+}
+
 func ParseAuthCookie(r *http.Request) (string, error) {
 	cookie, err := r.Cookie("Token")
 	if err != nil && err != http.ErrNoCookie {
@@ -73,8 +285,18 @@ func ParseAuthCookie(r *http.Request) (string, error) {
 	return cookie.Value, nil
 }
 
-func Template(files []string, funcmap template.FuncMap, wr io.Writer, data any) error {
-	tmpl, err := template.New(path.Base(files[0])).Funcs(funcmap).ParseFiles(files...)
+// Template renders the template files, given relative to the template
+// directory of the App. Besides funcmap, templates can call site for
+// the title of the blog.
+func Template(a *app.App, files []string, funcmap template.FuncMap, wr io.Writer, data any) error {
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = filepath.Join(a.Config.TemplateDir, file)
+	}
+	tmpl, err := template.New(path.Base(files[0])).
+		Funcs(template.FuncMap{"site": func() string { return a.Config.SiteTitle }}).
+		Funcs(funcmap).
+		ParseFiles(paths...)
 	if err != nil {
 		return fmt.Errorf("failed to create template: %v", err)
 	}
@@ -85,27 +307,94 @@ func Template(files []string, funcmap template.FuncMap, wr io.Writer, data any)
 	return nil
 }
 
-func Request(method, url, token string, rbody io.Reader) ([]byte, int, error) {
-	req, err := http.NewRequest(method, url, rbody)
-	if err != nil {
-		return nil, http.StatusInternalServerError,
-			fmt.Errorf("failed to create request: %v", err)
+// Thread is the data of the recursive thread template in
+// templates/comments, which renders comments with their replies.
+type Thread struct {
+	Comments []comments.Comment
+	UserId   int
+	Role     string
+	MaxDepth int
+}
+
+// ThreadFunc returns a template function that wraps comments into a
+// Thread seen by the given user, so that replies can be rendered with
+// {{template "thread" (thread .Replies)}}.
+func ThreadFunc(userId int, role string, maxDepth int) func([]comments.Comment) Thread {
+	return func(list []comments.Comment) Thread {
+		return Thread{list, userId, role, maxDepth}
 	}
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
+}
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, http.StatusInternalServerError,
-			fmt.Errorf("failed to make request: %v", err)
+// statuses maps the kinds of service errors to response statuses.
+var statuses = map[error]int{
+	service.ErrInvalid:      http.StatusBadRequest,
+	service.ErrUnauthorized: http.StatusUnauthorized,
+	service.ErrForbidden:    http.StatusForbidden,
+	service.ErrNotFound:     http.StatusNotFound,
+	service.ErrConflict:     http.StatusConflict,
+	service.ErrTooLarge:     http.StatusRequestEntityTooLarge,
+	service.ErrUnsupported:  http.StatusUnsupportedMediaType,
+	service.ErrTooMany:      http.StatusTooManyRequests,
+}
+
+// WriteError writes the error response for an error of the service
+// layer. Errors that are not a *service.Error are logged and answered
+// with 500 Internal Error.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	var serviceErr *service.Error
+	if !errors.As(err, &serviceErr) {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	if serviceErr.Kind == service.ErrTooMany {
+		ratelimit.TooManyRequests(w, serviceErr.Message, serviceErr.RetryAfter)
+		return
 	}
-	defer res.Body.Close()
+	status, ok := statuses[serviceErr.Kind]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	http.Error(w, serviceErr.Message, status)
+}
 
-	body, err := io.ReadAll(res.Body)
+// ParsePage reads the limit and cursor query parameters. A missing
+// limit defaults to page.DefaultLimit and larger limits are capped
+// at page.MaxLimit.
+func ParsePage(r *http.Request) (page.Cursor, int, error) {
+	query := r.URL.Query()
+	limit := page.DefaultLimit
+	if query.Has("limit") {
+		var err error
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 {
+			return page.Cursor{}, 0, fmt.Errorf("invalid limit")
+		}
+		limit = min(limit, page.MaxLimit)
+	}
+	cursor, err := page.Parse(query.Get("cursor"))
 	if err != nil {
-		return nil, http.StatusInternalServerError,
-			fmt.Errorf("failed to read response body: %v", err)
+		return page.Cursor{}, 0, err
 	}
+	return cursor, limit, nil
+}
 
-	return body, res.StatusCode, nil
+// SetNextLink adds a Link header pointing at the next page,
+// keeping the other query parameters of the request.
+// It does nothing on the last page.
+func SetNextLink(w http.ResponseWriter, r *http.Request, next page.Cursor, limit int) {
+	if next.IsZero() {
+		return
+	}
+	// r.URL.Path has the mux prefixes stripped, RequestURI does not.
+	path := r.URL.Path
+	uri, err := url.ParseRequestURI(r.RequestURI)
+	if err == nil {
+		path = uri.Path
+	}
+	query := r.URL.Query()
+	query.Set("cursor", next.String())
+	query.Set("limit", strconv.Itoa(limit))
+	link := url.URL{Path: path, RawQuery: query.Encode()}
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", link.String()))
 }
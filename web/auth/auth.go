@@ -1,18 +1,24 @@
 package auth
 
 import (
-	"blog/config"
-	"blog/db/auth"
+	"blog/app"
+	"blog/logging"
+	"blog/service"
+	auth_service "blog/service/auth"
 	"blog/util"
-	"bytes"
-	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
+	"net/url"
 	"text/template"
 	"time"
 )
 
-func register(w http.ResponseWriter, r *http.Request) {
+// handler serves the sign in and account pages of an App.
+type handler struct {
+	app *app.App
+}
+
+func (h handler) register(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		token, err := util.ParseAuthCookie(r)
 		if err != nil && err != http.ErrNoCookie {
@@ -24,12 +30,12 @@ func register(w http.ResponseWriter, r *http.Request) {
 		}
 
 		files := []string{
-			"templates/base.html", "templates/auth/register.html",
+			"base.html", "auth/register.html",
 		}
-		err = util.Template(files, template.FuncMap{}, w, nil)
+		err = util.Template(h.app, files, template.FuncMap{}, w, nil)
 		if err != nil {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 
@@ -45,25 +51,9 @@ func register(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		user := auth.User{Username: r.FormValue("username"), Password: r.FormValue("password")}
-		data, err := json.Marshal(user)
+		err = auth_service.Register(h.app, r.Context(), r.FormValue("username"), r.FormValue("password"))
 		if err != nil {
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println("failed to convert to json:", err)
-			return
-		}
-
-		body, status, err := util.Request(
-			"POST", config.Host+"/api/auth/register",
-			"", bytes.NewBuffer(data),
-		)
-		if status == http.StatusInternalServerError {
-			http.Error(w, "Internal Error", status)
-			log.Println(err)
-			return
-		}
-		if status != http.StatusOK {
-			http.Error(w, string(body), status)
+			util.WriteError(w, r, err)
 			return
 		}
 
@@ -73,12 +63,12 @@ func register(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func login(w http.ResponseWriter, r *http.Request) {
+func (h handler) login(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		token, err := util.ParseAuthCookie(r)
 		if err != nil && err != http.ErrNoCookie {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 		if token != "" {
@@ -86,12 +76,12 @@ func login(w http.ResponseWriter, r *http.Request) {
 		}
 
 		files := []string{
-			"templates/base.html", "templates/auth/login.html",
+			"base.html", "auth/login.html",
 		}
-		err = util.Template(files, template.FuncMap{}, w, nil)
+		err = util.Template(h.app, files, template.FuncMap{}, w, nil)
 		if err != nil {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 
@@ -102,65 +92,306 @@ func login(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		userData := auth.User{Username: r.FormValue("username"), Password: r.FormValue("password")}
-		data, err := json.Marshal(userData)
+		tokens, err := auth_service.Login(h.app, r.Context(), r.FormValue("username"), r.FormValue("password"))
 		if err != nil {
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println("failed to convert to json:", err)
+			util.WriteError(w, r, err)
 			return
 		}
 
-		body, status, err := util.Request(
-			"POST", config.Host+"/api/auth/token",
-			"", bytes.NewBuffer(data),
-		)
-		if status == http.StatusInternalServerError {
-			http.Error(w, "Internal Error", status)
-			log.Println(err)
-			return
+		h.setTokenCookies(w, tokens)
+		w.Header().Set("HX-Redirect", "/web/posts/get")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	}
+}
+
+func (h handler) logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cookie, err := r.Cookie("RefreshToken")
+	if err == nil && cookie.Value != "" {
+		// A session that is already gone only needs its cookies cleared.
+		family, err := auth_service.Family(h.app, r.Context(), cookie.Value)
+		if err == nil {
+			err = auth_service.Logout(h.app, r.Context(), family)
 		}
-		if status != http.StatusOK {
-			http.Error(w, string(body), status)
+		if err != nil && !errors.Is(err, service.ErrUnauthorized) {
+			util.WriteError(w, r, err)
 			return
 		}
+	}
 
-		cookie := &http.Cookie{
-			Name:    "Token",
-			Value:   string(body),
-			Expires: time.Now().Add(24 * time.Hour),
-			Path:    "/",
-		}
+	clearTokenCookies(w)
+	w.Header().Set("HX-Redirect", "/web/posts/get")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
 
-		http.SetCookie(w, cookie)
-		w.Header().Set("HX-Redirect", "/web/posts/get")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
+func (h handler) account(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, err := util.ParseAuthCookie(r)
+	if err != nil && err != http.ErrNoCookie {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	if token == "" {
+		http.Redirect(w, r, "/web/auth/login", http.StatusSeeOther)
+		return
+	}
+	userId, err := util.ParseToken(h.app, r.Context(), token)
+	if errors.Is(err, service.ErrUnauthorized) {
+		http.Redirect(w, r, "/web/auth/login", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+
+	files := []string{
+		"base.html", "auth/account.html",
+	}
+	tdata := struct {
+		UserId int
+	}{userId}
+	err = util.Template(h.app, files, template.FuncMap{}, w, tdata)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
 	}
 }
 
-func logout(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
+func (h handler) password(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, err := util.ParseAuthCookie(r)
+	if err != nil && err != http.ErrNoCookie {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	if token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	claims, err := util.ParseClaims(h.app, r.Context(), token)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+	if r.FormValue("password") != r.FormValue("confirm-password") {
+		http.Error(w, "Passwords don't match", http.StatusBadRequest)
+		return
+	}
+
+	userId, _ := claims["user_id"].(float64)
+	family, _ := claims["fam"].(string)
+	err = auth_service.ChangePassword(h.app, r.Context(), int(userId), family,
+		r.FormValue("old-password"), r.FormValue("password"))
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Password changed"))
+}
+
+func (h handler) username(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	cookie := &http.Cookie{
-		Name:   "Token",
-		Value:  "",
-		MaxAge: 0,
-		Path:   "/",
+	token, err := util.ParseAuthCookie(r)
+	if err != nil && err != http.ErrNoCookie {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	if token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userId, err := util.ParseToken(h.app, r.Context(), token)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	username := r.FormValue("username")
+	err = auth_service.Rename(h.app, r.Context(), userId, username)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/web/users/"+url.PathEscape(username))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+func (h handler) delete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, err := util.ParseAuthCookie(r)
+	if err != nil && err != http.ErrNoCookie {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	if token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userId, err := util.ParseToken(h.app, r.Context(), token)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	err = auth_service.DeleteAccount(h.app, r.Context(), userId, r.FormValue("password"), r.FormValue("mode"))
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
 	}
 
-	http.SetCookie(w, cookie)
+	clearTokenCookies(w)
 	w.Header().Set("HX-Redirect", "/web/posts/get")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
 
-func ServeMux() *http.ServeMux {
+func (h handler) setTokenCookies(w http.ResponseWriter, tokens util.TokenPair) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "Token",
+		Value:    tokens.AccessToken,
+		Expires:  time.Now().Add(time.Duration(tokens.ExpiresIn) * time.Second),
+		Path:     "/",
+		HttpOnly: true,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     "RefreshToken",
+		Value:    tokens.RefreshToken,
+		Expires:  time.Now().Add(h.app.Config.RefreshTokenTTL),
+		Path:     "/",
+		HttpOnly: true,
+	})
+}
+
+func clearTokenCookies(w http.ResponseWriter) {
+	for _, name := range []string{"Token", "RefreshToken"} {
+		http.SetCookie(w, &http.Cookie{
+			Name:   name,
+			Value:  "",
+			MaxAge: -1,
+			Path:   "/",
+		})
+	}
+}
+
+// setRequestToken replaces the Token cookie seen by the handlers
+// further down the chain. An empty token removes the cookie.
+func setRequestToken(r *http.Request, token string) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name != "Token" {
+			r.AddCookie(cookie)
+		}
+	}
+	if token != "" {
+		r.AddCookie(&http.Cookie{Name: "Token", Value: token})
+	}
+}
+
+// Refresh renews an expired or missing access token cookie using the
+// refresh token cookie, so that web sessions outlive access tokens.
+// If the session can not be renewed, the request proceeds anonymously.
+func Refresh(a *app.App, next http.Handler) http.Handler {
+	h := handler{a}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ := util.ParseAuthCookie(r)
+		if token != "" {
+			_, err := util.ParseToken(h.app, r.Context(), token)
+			if err == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		cookie, err := r.Cookie("RefreshToken")
+		if err != nil || cookie.Value == "" {
+			if token != "" {
+				clearTokenCookies(w)
+				setRequestToken(r, "")
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		tokens, err := auth_service.Refresh(h.app, r.Context(), cookie.Value)
+		var refused *service.Error
+		if errors.As(err, &refused) {
+			clearTokenCookies(w)
+			setRequestToken(r, "")
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
+			return
+		}
+		h.setTokenCookies(w, tokens)
+		setRequestToken(r, tokens.AccessToken)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ServeMux(a *app.App) *http.ServeMux {
+	h := handler{a}
 	mux := http.NewServeMux()
-	mux.HandleFunc("/register", register)
-	mux.HandleFunc("/login", login)
-	mux.HandleFunc("/logout", logout)
+	mux.HandleFunc("/register", h.register)
+	mux.HandleFunc("/login", h.login)
+	mux.HandleFunc("/logout", h.logout)
+	mux.HandleFunc("/account", h.account)
+	mux.HandleFunc("/password", h.password)
+	mux.HandleFunc("/username", h.username)
+	mux.HandleFunc("/delete", h.delete)
 	return mux
 }
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"blog/app"
+	"blog/logging"
+	"blog/service"
+	auth_service "blog/service/auth"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	// CSRFCookie holds the CSRF token of the browser.
+	CSRFCookie = "CSRFToken"
+	// CSRFHeader must repeat the CSRF token on requests that change
+	// state. base.html adds it to every htmx request.
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// CSRF protects the web interface from cross-site request forgery with
+// signed double-submit cookies. Every browser gets a random token in the
+// CSRFToken cookie, and POST, PUT, PATCH and DELETE requests are rejected
+// unless they send the same token in the X-CSRF-Token header. Other sites
+// can make the browser send the cookie but can not read it to set the
+// header. A site that can plant cookies, such as one on a sibling
+// subdomain, could plant a token it got itself, so tokens are signed for
+// the session they were issued in, the token family of the RefreshToken
+// cookie. A planted token is then refused once the victim is signed in;
+// signed out visitors all share the empty session.
+func CSRF(a *app.App, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := csrfSession(a, r)
+		if err != nil {
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
+			return
+		}
+		var token string
+		cookie, err := r.Cookie(CSRFCookie)
+		if err == nil && ValidCSRFToken(a.Secret, session, cookie.Value) {
+			token = cookie.Value
+		} else {
+			token, err = NewCSRFToken(a.Secret, session)
+			if err != nil {
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				logging.FromContext(r.Context()).Error("request failed", "err", err)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     CSRFCookie,
+				Value:    token,
+				Path:     "/",
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		default:
+			header := r.Header.Get(CSRFHeader)
+			if header == "" || !hmac.Equal([]byte(header), []byte(token)) {
+				http.Error(w, "Invalid CSRF Token", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// csrfSession returns the token family of the RefreshToken cookie, or an
+// empty string if there is no session.
+func csrfSession(a *app.App, r *http.Request) (string, error) {
+	cookie, err := r.Cookie("RefreshToken")
+	if err != nil || cookie.Value == "" {
+		return "", nil
+	}
+	family, err := auth_service.Family(a, r.Context(), cookie.Value)
+	if errors.Is(err, service.ErrUnauthorized) {
+		return "", nil
+	}
+	return family, err
+}
+
+// NewCSRFToken returns a random token signed with the secret for the
+// session.
+func NewCSRFToken(secret []byte, session string) (string, error) {
+	nonce := make([]byte, 32)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(nonce)
+	return encoded + "." + csrfSignature(secret, session, encoded), nil
+}
+
+// ValidCSRFToken reports whether the token was made by NewCSRFToken
+// with the secret for the session.
+func ValidCSRFToken(secret []byte, session, token string) bool {
+	nonce, signature, ok := strings.Cut(token, ".")
+	if !ok || nonce == "" {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(csrfSignature(secret, session, nonce)))
+}
+
+// csrfSignature signs the nonce and the session. The nonce is base64
+// and can not contain the colon that separates them.
+func csrfSignature(secret []byte, session, nonce string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("csrf:" + nonce + ":" + session))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -1,19 +1,26 @@
 package comments
 
 import (
-	"blog/config"
+	"blog/app"
+	"blog/db/auth"
 	"blog/db/comments"
+	"blog/logging"
+	"blog/policy"
+	comments_service "blog/service/comments"
+	posts_service "blog/service/posts"
 	"blog/util"
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
+	"strconv"
 	"text/template"
 	"time"
 )
 
-func add(w http.ResponseWriter, r *http.Request) {
+// handler serves the comment fragments of the post pages of an App.
+type handler struct {
+	app *app.App
+}
+
+func (h handler) add(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
@@ -28,7 +35,7 @@ func add(w http.ResponseWriter, r *http.Request) {
 	token, err := util.ParseAuthCookie(r)
 	if err != nil && err != http.ErrNoCookie {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 	if err == http.ErrNoCookie || token == "" {
@@ -37,77 +44,29 @@ func add(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("unauthorized"))
 		return
 	}
-	userId, err := util.ParseToken(token)
+	user, err := util.ParseUser(h.app, r.Context(), token)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 
 	err = r.ParseForm()
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to parse form:", err)
+		logging.FromContext(r.Context()).Error("failed to parse form", "err", err)
 		return
 	}
 
-	comment := comments.Comment{Text: r.FormValue("comment")}
-	data, err := json.Marshal(comment)
+	commentId, err := comments_service.Add(h.app, r.Context(), user.Id, postId, r.FormValue("comment"))
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to marshal JSON:", err)
-		return
-	}
-
-	url := fmt.Sprintf("%s/api/comments/%d", config.Host, postId)
-	body, status, err := util.Request("POST", url, token, bytes.NewReader(data))
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", status)
-		log.Println(err)
-		return
-	}
-	if status != http.StatusOK {
-		http.Error(w, string(body), status)
-		return
-	}
-
-	url = fmt.Sprintf("%s/api/posts/%d/comments", config.Host, postId)
-	body, status, err = util.Request("GET", url, token, nil)
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", status)
-		log.Println(err)
-		return
-	}
-	if status != http.StatusOK {
-		http.Error(w, string(body), status)
-		return
-	}
-
-	var commentList []comments.Comment
-	err = json.Unmarshal(body, &commentList)
-	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to unmarshal JSON:", err)
-		return
-	}
-
-	files := []string{"templates/comments/comments.html"}
-	funcmap := template.FuncMap{
-		"dateformat": func(t time.Time) string { return t.Format("2006-01-02") },
-	}
-	tdata := struct {
-		Comments []comments.Comment
-		UserId   int
-	}{commentList, userId}
-	err = util.Template(files, funcmap, w, tdata)
-	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		util.WriteError(w, r, err)
 		return
 	}
+	h.writeComment(w, r, user, commentId)
 }
 
-func update(w http.ResponseWriter, r *http.Request) {
+func (h handler) update(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		commentId := util.ParseUrlId(r.URL.Path)
 		if commentId == 0 {
@@ -118,50 +77,36 @@ func update(w http.ResponseWriter, r *http.Request) {
 		token, err := util.ParseAuthCookie(r)
 		if err != nil && err != http.ErrNoCookie {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 		if err == http.ErrNoCookie || token == "" {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		userId, err := util.ParseToken(token)
+		user, err := util.ParseUser(h.app, r.Context(), token)
 		if err != nil {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
-			return
-		}
-
-		url := fmt.Sprintf("%s/api/comments/%d", config.Host, commentId)
-		body, status, err := util.Request("GET", url, token, nil)
-		if status == http.StatusInternalServerError {
-			http.Error(w, "Internal Error", status)
-			log.Println(err)
-			return
-		}
-		if status != http.StatusOK {
-			http.Error(w, string(body), status)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 
-		var comment comments.Comment
-		err = json.Unmarshal(body, &comment)
+		comment, err := comments_service.Get(h.app, r.Context(), user.Id, commentId)
 		if err != nil {
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println("failed to unmarshal JSON:", err)
+			util.WriteError(w, r, err)
 			return
 		}
-		if comment.AuthorId != userId {
+		if !policy.Can(user.Id, user.Role, policy.EditComment, comment.AuthorId) {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
 
-		files := []string{"templates/comments/update.html"}
+		files := []string{"comments/update.html"}
 		tdata := struct{ Comment comments.Comment }{comment}
-		err = util.Template(files, template.FuncMap{}, w, tdata)
+		err = util.Template(h.app, files, template.FuncMap{}, w, tdata)
 		if err != nil {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 
@@ -175,89 +120,59 @@ func update(w http.ResponseWriter, r *http.Request) {
 		token, err := util.ParseAuthCookie(r)
 		if err != nil && err != http.ErrNoCookie {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 		if err == http.ErrNoCookie || token == "" {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		userId, err := util.ParseToken(token)
+		user, err := util.ParseUser(h.app, r.Context(), token)
 		if err != nil {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 
 		err = r.ParseForm()
 		if err != nil {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println("failed to parse form:", err)
+			logging.FromContext(r.Context()).Error("failed to parse form", "err", err)
 			return
 		}
 
-		comment := comments.Comment{Text: r.FormValue("comment")}
-		data, err := json.Marshal(comment)
+		err = comments_service.Update(h.app, r.Context(), user.Id, commentId, r.FormValue("comment"))
 		if err != nil {
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println("failed to marshal JSON:", err)
-			return
-		}
-
-		url := fmt.Sprintf("%s/api/comments/%d", config.Host, commentId)
-		body, status, err := util.Request("PUT", url, token, bytes.NewBuffer(data))
-		if status == http.StatusInternalServerError {
-			http.Error(w, "Internal Error", status)
-			log.Println(err)
+			util.WriteError(w, r, err)
 			return
 		}
-		if status != http.StatusOK {
-			http.Error(w, string(body), status)
-			return
-		}
-
-		url = fmt.Sprintf("%s/api/comments/%d", config.Host, commentId)
-		body, status, err = util.Request("GET", url, token, nil)
-		if status == http.StatusInternalServerError {
-			http.Error(w, "Internal Error", status)
-			log.Println(err)
-			return
-		}
-		if status != http.StatusOK {
-			http.Error(w, string(body), status)
-			return
-		}
-
-		err = json.Unmarshal(body, &comment)
+		comment, err := comments_service.Get(h.app, r.Context(), user.Id, commentId)
 		if err != nil {
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println("failed to unmarshal JSON:", err)
+			util.WriteError(w, r, err)
 			return
 		}
 
 		funcmap := template.FuncMap{
+			"can":        policy.Can,
 			"dateformat": func(t time.Time) string { return t.Format("2006-01-02") },
 		}
-		files := []string{"templates/comments/comment.html"}
+		files := []string{"comments/comment.html"}
 		tdata := struct {
-			Comment comments.Comment
-			UserId  int
-		}{comment, userId}
-		err = util.Template(files, funcmap, w, tdata)
+			Comment  comments.Comment
+			UserId   int
+			Role     string
+			MaxDepth int
+		}{comment, user.Id, user.Role, h.app.Config.CommentDepth}
+		err = util.Template(h.app, files, funcmap, w, tdata)
 		if err != nil {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 	}
 }
 
-func delete(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
+func (h handler) reply(w http.ResponseWriter, r *http.Request) {
 	commentId := util.ParseUrlId(r.URL.Path)
 	if commentId == 0 {
 		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
@@ -267,93 +182,204 @@ func delete(w http.ResponseWriter, r *http.Request) {
 	token, err := util.ParseAuthCookie(r)
 	if err != nil && err != http.ErrNoCookie {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 	if err == http.ErrNoCookie || token == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		w.Header().Set("HX-Redirect", "/web/auth/login")
+		w.WriteHeader(http.StatusSeeOther)
+		w.Write([]byte("unauthorized"))
 		return
 	}
-	userId, err := util.ParseToken(token)
+	user, err := util.ParseUser(h.app, r.Context(), token)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 
-	url := fmt.Sprintf("%s/api/comments/%d", config.Host, commentId)
-	body, status, err := util.Request("GET", url, token, nil)
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", status)
-		log.Println(err)
+	parent, err := comments_service.Get(h.app, r.Context(), user.Id, commentId)
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
-	if status != http.StatusOK {
-		http.Error(w, string(body), status)
+
+	if r.Method == http.MethodGet {
+		files := []string{"comments/reply.html"}
+		tdata := struct{ Comment comments.Comment }{parent}
+		err = util.Template(h.app, files, template.FuncMap{}, w, tdata)
+		if err != nil {
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
+		}
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var comment comments.Comment
-	err = json.Unmarshal(body, &comment)
+	err = r.ParseForm()
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to unmarshal JSON:", err)
+		logging.FromContext(r.Context()).Error("failed to parse form", "err", err)
+		return
+	}
+
+	replyId, err := comments_service.Reply(h.app, r.Context(), user.Id, commentId, r.FormValue("comment"))
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	h.writeComment(w, r, user, replyId)
+}
+
+func (h handler) delete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	url = fmt.Sprintf("%s/api/comments/%d", config.Host, commentId)
-	body, status, err = util.Request("DELETE", url, token, nil)
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", status)
-		log.Println(err)
+	commentId := util.ParseUrlId(r.URL.Path)
+	if commentId == 0 {
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
-	if status != http.StatusOK {
-		http.Error(w, string(body), status)
+
+	token, err := util.ParseAuthCookie(r)
+	if err != nil && err != http.ErrNoCookie {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	if err == http.ErrNoCookie || token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	user, err := util.ParseUser(h.app, r.Context(), token)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 
-	url = fmt.Sprintf("%s/api/posts/%d/comments", config.Host, comment.PostId)
-	body, status, err = util.Request("GET", url, token, nil)
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", status)
-		log.Println(err)
+	comment, err := comments_service.Get(h.app, r.Context(), user.Id, commentId)
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
-	if status != http.StatusOK && status != http.StatusNotFound {
-		http.Error(w, string(body), status)
+	err = comments_service.Delete(h.app, r.Context(), user.Id, commentId)
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
+	// The deleted comment is swapped out with an empty response, leaving
+	// only the comment count to update.
+	h.writeComments(w, r, user, comment.PostId, nil)
+}
 
-	var commentList []comments.Comment
-	if status != http.StatusNotFound {
-		err = json.Unmarshal(body, &commentList)
-		if err != nil {
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println("failed to unmarshal JSON:", err)
-			return
-		}
+// writeComment responds with the new comment as an item of its thread.
+func (h handler) writeComment(w http.ResponseWriter, r *http.Request, user auth.User, commentId int) {
+	comment, err := comments_service.Get(h.app, r.Context(), user.Id, commentId)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	h.writeComments(w, r, user, comment.PostId, []comments.Comment{comment})
+}
+
+// writeComments responds with the comments as thread items and with the
+// comment count of the post, which htmx swaps in out of band. Only the
+// changed comments are rendered, so that the comments loaded on the
+// page stay as they are.
+func (h handler) writeComments(w http.ResponseWriter, r *http.Request, user auth.User, postId int, commentList []comments.Comment) {
+	post, err := posts_service.Get(h.app, r.Context(), user.Id, postId)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
 	}
 
+	files := []string{
+		"comments/comments.html", "comments/thread.html",
+	}
 	funcmap := template.FuncMap{
-		"dateformat": func(t time.Time) string { return t.Format("2006-01-02") },
+		"can":    policy.Can,
+		"thread": util.ThreadFunc(user.Id, user.Role, h.app.Config.CommentDepth),
 	}
-	files := []string{"templates/comments/comments.html"}
 	tdata := struct {
 		Comments []comments.Comment
-		UserId   int
-	}{commentList, userId}
-	err = util.Template(files, funcmap, w, tdata)
+		Count    int
+	}{commentList, post.Comments}
+	err = util.Template(h.app, files, funcmap, w, tdata)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 	}
 }
 
-func ServeMux() *http.ServeMux {
+func (h handler) like(w http.ResponseWriter, r *http.Request) {
+	h.vote(w, r, "like")
+}
+
+func (h handler) dislike(w http.ResponseWriter, r *http.Request) {
+	h.vote(w, r, "dislike")
+}
+
+// vote likes or dislikes the comment and responds with its new score.
+func (h handler) vote(w http.ResponseWriter, r *http.Request, likeType string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	commentId := util.ParseUrlId(r.URL.Path)
+	if commentId == 0 {
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
+		return
+	}
+
+	token, err := util.ParseAuthCookie(r)
+	if err != nil && err != http.ErrNoCookie {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	if err == http.ErrNoCookie || token == "" {
+		w.Header().Set("HX-Redirect", "/web/auth/login")
+		w.WriteHeader(http.StatusSeeOther)
+		w.Write([]byte("unauthorized"))
+		return
+	}
+	userId, err := util.ParseToken(h.app, r.Context(), token)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+
+	err = comments_service.Vote(h.app, r.Context(), userId, commentId, likeType)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	score, err := comments_service.Score(h.app, r.Context(), userId, commentId)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(strconv.Itoa(score)))
+}
+
+func ServeMux(a *app.App) *http.ServeMux {
+	h := handler{a}
 	mux := http.NewServeMux()
-	mux.HandleFunc("/add/", add)
-	mux.HandleFunc("/update/", update)
-	mux.HandleFunc("/delete/", delete)
+	mux.HandleFunc("/add/", h.add)
+	mux.HandleFunc("/update/", h.update)
+	mux.HandleFunc("/reply/", h.reply)
+	mux.HandleFunc("/like/", h.like)
+	mux.HandleFunc("/dislike/", h.dislike)
+	mux.HandleFunc("/delete/", h.delete)
 	return mux
 }
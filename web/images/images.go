@@ -1,20 +1,34 @@
 package images
 
 import (
-	"blog/config"
+	"blog/app"
+	"blog/db/auth"
 	"blog/db/images"
+	"blog/db/page"
+	"blog/logging"
+	"blog/policy"
+	images_service "blog/service/images"
 	"blog/util"
-	"bytes"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"html/template"
 	"io"
-	"log"
-	"mime/multipart"
 	"net/http"
 )
 
-func upload(w http.ResponseWriter, r *http.Request) {
+// handler serves the gallery of an App.
+type handler struct {
+	app *app.App
+}
+
+const (
+	// formOverhead is how much larger than the image an upload form
+	// can be, for the headers and boundaries of the form.
+	formOverhead = 64 << 10
+	// formMemory is how much of an upload form is kept in memory.
+	formMemory = 1 << 20
+)
+
+func (h handler) upload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
@@ -23,7 +37,7 @@ func upload(w http.ResponseWriter, r *http.Request) {
 	token, err := util.ParseAuthCookie(r)
 	if err != nil && err != http.ErrNoCookie {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 	if err == http.ErrNoCookie || token == "" {
@@ -32,167 +46,117 @@ func upload(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("unauthorized"))
 		return
 	}
-	userId, err := util.ParseToken(token)
+	user, err := util.ParseUser(h.app, r.Context(), token)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 
-	err = r.ParseMultipartForm(10 << 20)
-	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to parse form:", err)
+	r.Body = http.MaxBytesReader(w, r.Body, h.app.Config.MaxImageSize+formOverhead)
+	err = r.ParseMultipartForm(formMemory)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Image Too Large", http.StatusRequestEntityTooLarge)
 		return
 	}
-
-	file, header, err := r.FormFile("image")
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to get file:", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
 
-	var b bytes.Buffer
-	writer := multipart.NewWriter(&b)
-
-	part, err := writer.CreateFormFile("image", header.Filename)
-	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to create form file:", err)
-		return
-	}
-
-	_, err = io.Copy(part, file)
+	file, header, err := r.FormFile("image")
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to copy form file:", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
-	writer.Close()
+	defer file.Close()
 
-	url := fmt.Sprintf("%s/api/images/", config.Host)
-	req, err := http.NewRequest("POST", url, &b)
+	data, err := io.ReadAll(file)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to create request:", err)
+		logging.FromContext(r.Context()).Error("failed to read file", "err", err)
 		return
 	}
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	res, err := http.DefaultClient.Do(req)
+	_, err = images_service.Upload(h.app, r.Context(), user.Id, header.Filename, data)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to upload file:", err)
+		util.WriteError(w, r, err)
 		return
 	}
-	defer res.Body.Close()
 
-	body, err := io.ReadAll(res.Body)
+	imageList, next, err := images_service.Page(h.app, r.Context(), page.Cursor{}, page.DefaultLimit)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to upload file:", err)
-		return
-	}
-
-	if res.StatusCode != http.StatusOK {
-		http.Error(w, string(body), res.StatusCode)
+		util.WriteError(w, r, err)
 		return
 	}
 
-	url = fmt.Sprintf("%s/api/images/", config.Host)
-	body, status, err := util.Request("GET", url, token, nil)
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", status)
-		log.Println(err)
-		return
-	}
-	if status != http.StatusOK {
-		http.Error(w, string(body), status)
-		return
-	}
-
-	var imageList []images.Image
-	err = json.Unmarshal(body, &imageList)
-	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to unmarshal JSON:", err)
-		return
-	}
-
-	files := []string{"templates/images/images.html"}
+	files := []string{"images/images.html"}
 	tdata := struct {
 		Images []images.Image
 		UserId int
-	}{imageList, userId}
-	err = util.Template(files, template.FuncMap{}, w, tdata)
+		Role   string
+		Next   string
+	}{imageList, user.Id, user.Role, next.String()}
+	err = util.Template(h.app, files, template.FuncMap{"can": policy.Can}, w, tdata)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 }
 
-func gallery(w http.ResponseWriter, r *http.Request) {
+func (h handler) gallery(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var userId int
+	var user auth.User
 	token, err := util.ParseAuthCookie(r)
 	if err != nil && err != http.ErrNoCookie {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 	if token != "" {
-		userId, err = util.ParseToken(token)
+		user, err = util.ParseUser(h.app, r.Context(), token)
 		if err != nil {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 	}
 
-	url := fmt.Sprintf("%s/api/images/", config.Host)
-	body, status, err := util.Request("GET", url, token, nil)
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", status)
-		log.Println(err)
-		return
-	}
-	if status != http.StatusOK {
-		http.Error(w, string(body), status)
+	after, limit, err := util.ParsePage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	var imageList []images.Image
-	err = json.Unmarshal(body, &imageList)
+	imageList, next, err := images_service.Page(h.app, r.Context(), after, limit)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to unmarshal JSON:", err)
+		util.WriteError(w, r, err)
 		return
 	}
 
 	files := []string{
-		"templates/base.html", "templates/images/gallery.html",
+		"base.html", "images/gallery.html",
 	}
 	tdata := struct {
 		Images []images.Image
 		UserId int
-	}{imageList, userId}
-	err = util.Template(files, template.FuncMap{}, w, tdata)
+		Role   string
+		Next   string
+	}{imageList, user.Id, user.Role, next.String()}
+	err = util.Template(h.app, files, template.FuncMap{"can": policy.Can}, w, tdata)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 }
 
-func delete(w http.ResponseWriter, r *http.Request) {
+func (h handler) delete(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
@@ -204,73 +168,56 @@ func delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var userId int
+	var user auth.User
 	token, err := util.ParseAuthCookie(r)
 	if err != nil && err != http.ErrNoCookie {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 	if err == http.ErrNoCookie || token == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	userId, err = util.ParseToken(token)
+	user, err = util.ParseUser(h.app, r.Context(), token)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-
-	url := fmt.Sprintf("%s/api/images/%d", config.Host, imageId)
-	body, status, err := util.Request("DELETE", url, token, nil)
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-	if status != http.StatusOK {
-		http.Error(w, string(body), status)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 
-	url = fmt.Sprintf("%s/api/images/", config.Host)
-	body, status, err = util.Request("GET", url, token, nil)
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", status)
-		log.Println(err)
-		return
-	}
-	if status != http.StatusOK {
-		http.Error(w, string(body), status)
+	err = images_service.Delete(h.app, r.Context(), user.Id, imageId)
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
 
-	var imageList []images.Image
-	err = json.Unmarshal(body, &imageList)
+	imageList, next, err := images_service.Page(h.app, r.Context(), page.Cursor{}, page.DefaultLimit)
 	if err != nil {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to unmarshal JSON:", err)
+		util.WriteError(w, r, err)
 		return
 	}
 
-	files := []string{"templates/images/images.html"}
+	files := []string{"images/images.html"}
 	tdata := struct {
 		Images []images.Image
 		UserId int
-	}{imageList, userId}
-	err = util.Template(files, template.FuncMap{}, w, tdata)
+		Role   string
+		Next   string
+	}{imageList, user.Id, user.Role, next.String()}
+	err = util.Template(h.app, files, template.FuncMap{"can": policy.Can}, w, tdata)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 }
 
-func ServeMux() *http.ServeMux {
+func ServeMux(a *app.App) *http.ServeMux {
+	h := handler{a}
 	mux := http.NewServeMux()
-	mux.HandleFunc("/upload", upload)
-	mux.HandleFunc("/gallery", gallery)
-	mux.HandleFunc("/delete/", delete)
+	mux.HandleFunc("/upload", h.upload)
+	mux.HandleFunc("/gallery", h.gallery)
+	mux.HandleFunc("/delete/", h.delete)
 	return mux
 }
@@ -0,0 +1,137 @@
+package posts
+
+import (
+	"blog/db/albums"
+	"blog/db/images"
+	"blog/db/page"
+	"blog/logging"
+	albums_service "blog/service/albums"
+	images_service "blog/service/images"
+	"blog/util"
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+// pickerImages is how many of the newest images the picker offers when
+// no album is chosen.
+const pickerImages = 24
+
+// postSizes tells browsers how wide images are shown in a post, so that
+// they pick the smallest copy from the srcset that fits.
+const postSizes = "(min-width: 1400px) 1296px, 100vw"
+
+// uploaded matches the images uploaded to the blog in a rendered post,
+// at their current or their legacy address.
+var uploaded = regexp.MustCompile(`<img src="(?:` + regexp.QuoteMeta(images.URLPrefix) +
+	`|` + regexp.QuoteMeta(images.LegacyURLPrefix) + `)([0-9a-f]{64}\.[a-z]+)"`)
+
+// responsive gives the uploaded images in a rendered post their scaled
+// down copies, so that browsers load the one that fits the screen.
+// Images the blog does not know about are left as they are.
+func (h handler) responsive(ctx context.Context, html string) (string, error) {
+	matches := uploaded.FindAllStringSubmatch(html, page.MaxLimit)
+	if len(matches) == 0 {
+		return html, nil
+	}
+	names := make([]string, len(matches))
+	for i, match := range matches {
+		names[i] = match[1]
+	}
+	imageList, err := images_service.ByName(h.app, ctx, names)
+	if err != nil {
+		return html, err
+	}
+
+	byName := make(map[string]images.Image, len(imageList))
+	for _, image := range imageList {
+		byName[image.Name] = image
+	}
+	return uploaded.ReplaceAllStringFunc(html, func(tag string) string {
+		image, ok := byName[uploaded.FindStringSubmatch(tag)[1]]
+		if !ok {
+			return tag
+		}
+		src := image.URL()
+		if image.Medium.Name != "" {
+			src = images.URLPrefix + image.Medium.Name
+		}
+		return fmt.Sprintf(`<img src="%s" srcset="%s" sizes="%s" loading="lazy"`,
+			src, image.SrcSet(), postSizes)
+	}), nil
+}
+
+// picker renders the images that can be inserted into a post: the
+// newest images of the gallery or the images of one of the user's
+// albums.
+func (h handler) picker(w http.ResponseWriter, r *http.Request) {
+	token, err := util.ParseAuthCookie(r)
+	if err != nil && err != http.ErrNoCookie {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	if err == http.ErrNoCookie || token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userId, err := util.ParseToken(h.app, r.Context(), token)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+
+	albumList, err := albums_service.ForUser(h.app, r.Context(), userId)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	var albumId int
+	if r.FormValue("album") != "" {
+		albumId, err = strconv.Atoi(r.FormValue("album"))
+		if err != nil {
+			http.Error(w, "Invalid Album", http.StatusBadRequest)
+			return
+		}
+	}
+	var imageList []images.Image
+	if albumId != 0 {
+		imageList, err = albums_service.Images(h.app, r.Context(), albumId)
+	} else {
+		imageList, _, err = images_service.Page(h.app, r.Context(), page.Cursor{}, pickerImages)
+	}
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+
+	files := []string{"posts/picker.html"}
+	tdata := struct {
+		Albums  []albums.Album
+		AlbumId int
+		Images  []images.Image
+	}{albumList, albumId, imageList}
+	err = util.Template(h.app, files, template.FuncMap{}, w, tdata)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+}
+
+// attached returns the ids of the images attached in the post form.
+func attached(r *http.Request) ([]int, error) {
+	ids := make([]int, 0, len(r.Form["images"]))
+	for _, value := range r.Form["images"] {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
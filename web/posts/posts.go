@@ -1,16 +1,21 @@
 package posts
 
 import (
-	"blog/config"
+	"blog/app"
+	"blog/db/auth"
 	"blog/db/comments"
+	"blog/db/images"
+	"blog/db/page"
 	"blog/db/posts"
+	"blog/db/revisions"
 	"blog/db/tags"
+	"blog/logging"
+	"blog/policy"
+	comments_service "blog/service/comments"
+	posts_service "blog/service/posts"
 	"blog/util"
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"html/template"
-	"log"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -20,7 +25,12 @@ import (
 	"github.com/russross/blackfriday/v2"
 )
 
-func get(w http.ResponseWriter, r *http.Request) {
+// handler serves the post pages of an App.
+type handler struct {
+	app *app.App
+}
+
+func (h handler) get(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
@@ -30,38 +40,29 @@ func get(w http.ResponseWriter, r *http.Request) {
 	token, err := util.ParseAuthCookie(r)
 	if err != nil && err != http.ErrNoCookie {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 	if token != "" {
-		userId, err = util.ParseToken(token)
+		userId, err = util.ParseToken(h.app, r.Context(), token)
 		if err != nil {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 	}
 
-	url := fmt.Sprintf("%s/api/posts/", config.Host)
-	body, status, err := util.Request("GET", url, token, nil)
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", status)
-		log.Println(err)
+	after, limit, err := util.ParsePage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if status != http.StatusOK && status != http.StatusNotFound {
-		http.Error(w, string(body), status)
+	postPage, err := posts_service.Page(h.app, r.Context(), after, limit)
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
-
-	var postList []posts.Post
-	if status != http.StatusNotFound {
-		err = json.Unmarshal(body, &postList)
-		if err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
-			return
-		}
-	}
+	postList := postPage.Posts
 
 	for i, post := range postList {
 		lines := strings.Split(post.Text, "\n")
@@ -85,7 +86,7 @@ func get(w http.ResponseWriter, r *http.Request) {
 	path := "/web/posts" + r.URL.String()
 
 	files := []string{
-		"templates/base.html", "templates/posts/posts.html",
+		"base.html", "posts/posts.html",
 	}
 	funcmap := template.FuncMap{
 		"dateformat": func(t time.Time) string { return t.Format("January 2, 2006") },
@@ -95,16 +96,18 @@ func get(w http.ResponseWriter, r *http.Request) {
 		Posts  []posts.Post
 		UserId int
 		Path   string
-	}{postList, userId, path}
-	err = util.Template(files, funcmap, w, tdata)
+		Next   string
+		Feed   string
+	}{postList, userId, path, postPage.Next.String(), "/feed"}
+	err = util.Template(h.app, files, funcmap, w, tdata)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 }
 
-func getId(w http.ResponseWriter, r *http.Request) {
+func (h handler) getId(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
@@ -121,38 +124,25 @@ func getId(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var userId int
+	var user auth.User
 	token, err := util.ParseAuthCookie(r)
 	if err != nil && err != http.ErrNoCookie {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 	if token != "" {
-		userId, err = util.ParseToken(token)
+		user, err = util.ParseUser(h.app, r.Context(), token)
 		if err != nil {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 	}
 
-	path := fmt.Sprintf("%s/api/posts/%d", config.Host, postId)
-	body, status, err := util.Request("GET", path, token, nil)
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", status)
-		log.Println(err)
-		return
-	}
-	if status != http.StatusOK {
-		http.Error(w, string(body), status)
-		return
-	}
-
-	var post posts.Post
-	err = json.Unmarshal(body, &post)
+	post, err := posts_service.Get(h.app, r.Context(), user.Id, postId)
 	if err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		util.WriteError(w, r, err)
 		return
 	}
 	post.Text = strings.ReplaceAll(post.Text, "\r\n", "\n")
@@ -163,56 +153,32 @@ func getId(w http.ResponseWriter, r *http.Request) {
 				blackfriday.HardLineBreak,
 		),
 	)
-	post.Text = string(markdown)
-
-	path = fmt.Sprintf("%s/api/posts/%d/comments", config.Host, postId)
-	body, status, err = util.Request("GET", path, token, nil)
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-	if status != http.StatusOK && status != http.StatusNotFound {
-		http.Error(w, string(body), status)
-		return
-	}
-
-	var commentList []comments.Comment
-	if status != http.StatusNotFound {
-		err = json.Unmarshal(body, &commentList)
-		if err != nil {
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println("failed to unmarshal JSON:", err)
-			return
-		}
+	post.Text, err = h.responsive(r.Context(), string(markdown))
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to add image variants", "err", err)
 	}
 
-	path = fmt.Sprintf("%s/api/posts/%d/tags", config.Host, postId)
-	body, status, err = util.Request("GET", path, token, nil)
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-	if status != http.StatusOK && status != http.StatusNotFound {
-		http.Error(w, string(body), status)
+	sort := r.URL.Query().Get("sort")
+	commentList, _, err := comments_service.Page(h.app, r.Context(), user.Id, postId,
+		page.Cursor{}, page.MaxLimit, comments.Order(sort))
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
 
-	var tagList []tags.Tag
-	if status != http.StatusNotFound {
-		err = json.Unmarshal(body, &tagList)
-		if err != nil {
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println("failed to unmarshal JSON:", err)
-			return
-		}
+	tagList, err := posts_service.Tags(h.app, r.Context(), user.Id, postId)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
 	}
 
 	files := []string{
-		"templates/base.html", "templates/posts/post.html",
+		"base.html", "posts/post.html",
+		"comments/thread.html",
 	}
 	funcmap := template.FuncMap{
+		"can":        policy.Can,
+		"thread":     util.ThreadFunc(user.Id, user.Role, h.app.Config.CommentDepth),
 		"split":      func(text string) []string { return strings.Split(text, "\n") },
 		"dateformat": func(t time.Time, format string) string { return t.Format(format) },
 		"escape":     func(s string) string { return url.QueryEscape(s) },
@@ -221,44 +187,49 @@ func getId(w http.ResponseWriter, r *http.Request) {
 	tdata := struct {
 		Post     posts.Post
 		Comments []comments.Comment
+		Sort     string
 		Tags     []tags.Tag
 		UserId   int
-	}{post, commentList, tagList, userId}
-	err = util.Template(files, funcmap, w, tdata)
+		Role     string
+	}{post, commentList, sort, tagList, user.Id, user.Role}
+	err = util.Template(h.app, files, funcmap, w, tdata)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 }
 
-func add(w http.ResponseWriter, r *http.Request) {
+func (h handler) add(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		token, err := util.ParseAuthCookie(r)
 		if err != nil && err != http.ErrNoCookie {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 		if err == http.ErrNoCookie || token == "" {
 			http.Redirect(w, r, "/web/auth/login", http.StatusSeeOther)
 			return
 		}
-		userId, err := util.ParseToken(token)
+		userId, err := util.ParseToken(h.app, r.Context(), token)
 		if err != nil {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 
 		files := []string{
-			"templates/base.html", "templates/posts/add.html",
+			"base.html", "posts/add.html", "posts/images.html",
 		}
-		tdata := struct{ UserId int }{userId}
-		err = util.Template(files, template.FuncMap{}, w, tdata)
+		tdata := struct {
+			UserId   int
+			Attached []images.Image
+		}{userId, nil}
+		err = util.Template(h.app, files, template.FuncMap{}, w, tdata)
 		if err != nil {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 
@@ -266,18 +237,24 @@ func add(w http.ResponseWriter, r *http.Request) {
 		token, err := util.ParseAuthCookie(r)
 		if err != nil && err != http.ErrNoCookie {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 		if err == http.ErrNoCookie || token == "" {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		userId, err := util.ParseToken(h.app, r.Context(), token)
+		if err != nil {
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
+			return
+		}
 
 		err = r.ParseForm()
 		if err != nil {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println("failed to parse form:", err)
+			logging.FromContext(r.Context()).Error("failed to parse form", "err", err)
 			return
 		}
 
@@ -288,34 +265,35 @@ func add(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		post := posts.Post{Title: r.FormValue("title"), Text: r.FormValue("text"),
-			Tags: tagList}
-		data, err := json.Marshal(post)
+		publishAt, err := formPublishAt(r)
 		if err != nil {
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println("failed to convert to json:", err)
+			http.Error(w, "Invalid Publish Time", http.StatusBadRequest)
 			return
 		}
-
-		url := fmt.Sprintf("%s/api/posts/", config.Host)
-		body, status, err := util.Request("POST", url, token, bytes.NewBuffer(data))
-		if status == http.StatusInternalServerError {
-			http.Error(w, "Internal Error", status)
-			log.Println(err)
+		imageIds, err := attached(r)
+		if err != nil {
+			http.Error(w, "Invalid Image", http.StatusBadRequest)
 			return
 		}
-		if status != http.StatusOK {
-			http.Error(w, string(body), status)
+		post := posts.Post{Title: r.FormValue("title"), Text: r.FormValue("text"),
+			Tags: tagList, Images: imageIds, Status: r.FormValue("status"), PublishAt: publishAt}
+		_, err = posts_service.Add(h.app, r.Context(), userId, post)
+		if err != nil {
+			util.WriteError(w, r, err)
 			return
 		}
 
-		w.Header().Set("HX-Redirect", "/web/posts/get")
+		if post.Status == posts.StatusDraft || post.Status == posts.StatusScheduled {
+			w.Header().Set("HX-Redirect", "/web/posts/drafts")
+		} else {
+			w.Header().Set("HX-Redirect", "/web/posts/get")
+		}
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	}
 }
 
-func update(w http.ResponseWriter, r *http.Request) {
+func (h handler) update(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		pathVal := r.PathValue("id")
 		if pathVal == "" {
@@ -331,68 +309,43 @@ func update(w http.ResponseWriter, r *http.Request) {
 		token, err := util.ParseAuthCookie(r)
 		if err != nil && err != http.ErrNoCookie {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 		if err == http.ErrNoCookie || token == "" {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		userId, err := util.ParseToken(token)
+		user, err := util.ParseUser(h.app, r.Context(), token)
 		if err != nil {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
-			return
-		}
-
-		url := fmt.Sprintf("%s/api/posts/%d", config.Host, postId)
-		body, status, err := util.Request("GET", url, token, nil)
-		if status == http.StatusInternalServerError {
-			http.Error(w, "Internal Error", status)
-			log.Println(err)
-			return
-		}
-		if status != http.StatusOK {
-			http.Error(w, string(body), status)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 
-		var post posts.Post
-		err = json.Unmarshal(body, &post)
+		post, err := posts_service.Get(h.app, r.Context(), user.Id, postId)
 		if err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			util.WriteError(w, r, err)
 			return
 		}
-		if post.AuthorId != userId {
+		if !policy.Can(user.Id, user.Role, policy.EditPost, post.AuthorId) {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
 
-		url = fmt.Sprintf("%s/api/posts/%d/tags", config.Host, postId)
-		body, status, err = util.Request("GET", url, token, nil)
-		if status == http.StatusInternalServerError {
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+		post.Tags, err = posts_service.Tags(h.app, r.Context(), user.Id, postId)
+		if err != nil {
+			util.WriteError(w, r, err)
 			return
 		}
-		if status != http.StatusOK && status != http.StatusNotFound {
-			http.Error(w, string(body), status)
+		imageList, err := posts_service.Images(h.app, r.Context(), user.Id, postId)
+		if err != nil {
+			util.WriteError(w, r, err)
 			return
 		}
 
-		var tagList []tags.Tag
-		if status != http.StatusNotFound {
-			err = json.Unmarshal(body, &tagList)
-			if err != nil {
-				http.Error(w, "Internal Error", http.StatusInternalServerError)
-				log.Println("failed to unmarshal JSON:", err)
-				return
-			}
-		}
-		post.Tags = tagList
-
 		files := []string{
-			"templates/base.html", "templates/posts/update.html",
+			"base.html", "posts/update.html", "posts/images.html",
 		}
 		funcmap := template.FuncMap{
 			"join": func(tagList []tags.Tag) string {
@@ -404,13 +357,15 @@ func update(w http.ResponseWriter, r *http.Request) {
 			},
 		}
 		tdata := struct {
-			Post   posts.Post
-			UserId int
-		}{post, userId}
-		err = util.Template(files, funcmap, w, tdata)
+			Post     posts.Post
+			UserId   int
+			Role     string
+			Attached []images.Image
+		}{post, user.Id, user.Role, imageList}
+		err = util.Template(h.app, files, funcmap, w, tdata)
 		if err != nil {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 
@@ -429,13 +384,19 @@ func update(w http.ResponseWriter, r *http.Request) {
 		token, err := util.ParseAuthCookie(r)
 		if err != nil && err != http.ErrNoCookie {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 		if err == http.ErrNoCookie || token == "" {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		userId, err := util.ParseToken(h.app, r.Context(), token)
+		if err != nil {
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
+			return
+		}
 
 		err = r.ParseForm()
 		if err != nil {
@@ -451,35 +412,37 @@ func update(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		post := posts.Post{Title: r.FormValue("title"), Text: r.FormValue("text"),
-			Tags: tagList}
-		data, err := json.Marshal(post)
+		publishAt, err := formPublishAt(r)
 		if err != nil {
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println("failed to convert to json:", err)
+			http.Error(w, "Invalid Publish Time", http.StatusBadRequest)
 			return
 		}
-
-		url := fmt.Sprintf("%s/api/posts/%d", config.Host, postId)
-		body, status, err := util.Request("PUT", url, token, bytes.NewBuffer(data))
-		if status == http.StatusInternalServerError {
-			http.Error(w, "Internal Error", status)
-			log.Println(err)
-			return
-		}
-		if status != http.StatusOK {
-			http.Error(w, string(body), status)
+		imageIds, err := attached(r)
+		if err != nil {
+			http.Error(w, "Invalid Image", http.StatusBadRequest)
+			return
+		}
+		err = posts_service.Update(h.app, r.Context(), userId, postId, func(post *posts.Post) error {
+			post.Title = r.FormValue("title")
+			post.Text = r.FormValue("text")
+			post.Tags = tagList
+			post.Images = imageIds
+			post.Status = r.FormValue("status")
+			post.PublishAt = publishAt
+			return nil
+		})
+		if err != nil {
+			util.WriteError(w, r, err)
 			return
 		}
 
-		url = fmt.Sprintf("/web/posts/get/%d", postId)
-		w.Header().Set("HX-Redirect", url)
+		w.Header().Set("HX-Redirect", fmt.Sprintf("/web/posts/get/%d", postId))
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	}
 }
 
-func delete(w http.ResponseWriter, r *http.Request) {
+func (h handler) delete(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
@@ -499,46 +462,263 @@ func delete(w http.ResponseWriter, r *http.Request) {
 	token, err := util.ParseAuthCookie(r)
 	if err != nil && err != http.ErrNoCookie {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 	if err == http.ErrNoCookie || token == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	userId, err := util.ParseToken(h.app, r.Context(), token)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+
+	err = posts_service.Delete(h.app, r.Context(), userId, postId)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/web/posts/get")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// formPublishAt reads the publish time of a scheduled post from the
+// post form. The datetime-local input is interpreted as UTC.
+func formPublishAt(r *http.Request) (*time.Time, error) {
+	if r.FormValue("status") != posts.StatusScheduled {
+		return nil, nil
+	}
+	publishAt, err := time.Parse("2006-01-02T15:04", r.FormValue("publish_at"))
+	if err != nil {
+		return nil, err
+	}
+	return &publishAt, nil
+}
 
-	err = r.ParseForm()
+func (h handler) unpublish(w http.ResponseWriter, r *http.Request) {
+	pathVal := r.PathValue("id")
+	if pathVal == "" {
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
+		return
+	}
+	postId, err := strconv.Atoi(pathVal)
 	if err != nil {
-		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
 
-	post := posts.Post{Title: r.FormValue("title"), Text: r.FormValue("text")}
-	data, err := json.Marshal(post)
+	token, err := util.ParseAuthCookie(r)
+	if err != nil && err != http.ErrNoCookie {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	if err == http.ErrNoCookie || token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userId, err := util.ParseToken(h.app, r.Context(), token)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println("failed to convert to json:", err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+
+	err = posts_service.Unpublish(h.app, r.Context(), userId, postId)
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
 
-	url := fmt.Sprintf("%s/api/posts/%d", config.Host, postId)
-	body, status, err := util.Request("DELETE", url, token, bytes.NewBuffer(data))
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", status)
-		log.Println(err)
+	w.Header().Set("HX-Redirect", fmt.Sprintf("/web/posts/get/%d", postId))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+func (h handler) drafts(w http.ResponseWriter, r *http.Request) {
+	token, err := util.ParseAuthCookie(r)
+	if err != nil && err != http.ErrNoCookie {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	if err == http.ErrNoCookie || token == "" {
+		http.Redirect(w, r, "/web/auth/login", http.StatusSeeOther)
 		return
 	}
-	if status != http.StatusOK {
-		http.Error(w, string(body), status)
+	userId, err := util.ParseToken(h.app, r.Context(), token)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 
-	w.Header().Set("HX-Redirect", "/web/posts/get")
+	postList, err := posts_service.Drafts(h.app, r.Context(), userId)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+
+	files := []string{
+		"base.html", "posts/drafts.html",
+	}
+	funcmap := template.FuncMap{
+		"dateformat": func(t time.Time) string { return t.Format("January 2, 2006 15:04 UTC") },
+	}
+	tdata := struct {
+		Posts  []posts.Post
+		UserId int
+	}{postList, userId}
+	err = util.Template(h.app, files, funcmap, w, tdata)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+}
+
+func (h handler) history(w http.ResponseWriter, r *http.Request) {
+	pathVal := r.PathValue("id")
+	if pathVal == "" {
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
+		return
+	}
+	postId, err := strconv.Atoi(pathVal)
+	if err != nil {
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
+		return
+	}
+
+	var user auth.User
+	token, err := util.ParseAuthCookie(r)
+	if err != nil && err != http.ErrNoCookie {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	if token != "" {
+		user, err = util.ParseUser(h.app, r.Context(), token)
+		if err != nil {
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
+			return
+		}
+	}
+
+	post, err := posts_service.Get(h.app, r.Context(), user.Id, postId)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	revisionList, err := posts_service.Revisions(h.app, r.Context(), user.Id, postId)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+
+	// Revisions are listed newest first, so the previous
+	// revision of each one is the next in the list.
+	type entry struct {
+		revisions.Revision
+		Prev int
+	}
+	entries := make([]entry, len(revisionList))
+	for i, revision := range revisionList {
+		entries[i].Revision = revision
+		if i+1 < len(revisionList) {
+			entries[i].Prev = revisionList[i+1].Id
+		}
+	}
+
+	var changes *posts_service.RevisionDiff
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if from != "" && to != "" {
+		fromId, err := strconv.Atoi(from)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		toId, err := strconv.Atoi(to)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		revisionDiff, err := posts_service.Diff(h.app, r.Context(), user.Id, postId, fromId, toId)
+		if err != nil {
+			util.WriteError(w, r, err)
+			return
+		}
+		changes = &revisionDiff
+	}
+
+	files := []string{
+		"base.html", "posts/history.html",
+	}
+	funcmap := template.FuncMap{
+		"can":        policy.Can,
+		"dateformat": func(t time.Time) string { return t.Format("January 2, 2006 15:04 UTC") },
+	}
+	tdata := struct {
+		Post      posts.Post
+		Revisions []entry
+		Changes   *posts_service.RevisionDiff
+		UserId    int
+		Role      string
+	}{post, entries, changes, user.Id, user.Role}
+	err = util.Template(h.app, files, funcmap, w, tdata)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+}
+
+func (h handler) restore(w http.ResponseWriter, r *http.Request) {
+	postId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
+		return
+	}
+	revisionId, err := strconv.Atoi(r.PathValue("rev"))
+	if err != nil {
+		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
+		return
+	}
+
+	token, err := util.ParseAuthCookie(r)
+	if err != nil && err != http.ErrNoCookie {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	if err == http.ErrNoCookie || token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userId, err := util.ParseToken(h.app, r.Context(), token)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+
+	err = posts_service.Restore(h.app, r.Context(), userId, postId, revisionId)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", fmt.Sprintf("/web/posts/history/%d", postId))
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
 
-func like(w http.ResponseWriter, r *http.Request) {
+func (h handler) like(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
@@ -558,7 +738,7 @@ func like(w http.ResponseWriter, r *http.Request) {
 	token, err := util.ParseAuthCookie(r)
 	if err != nil && err != http.ErrNoCookie {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 	if err == http.ErrNoCookie || token == "" {
@@ -567,36 +747,29 @@ func like(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("unauthorized"))
 		return
 	}
-
-	url := fmt.Sprintf("%s/api/posts/%d/like", config.Host, postId)
-	body, status, err := util.Request("POST", url, token, nil)
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", status)
-		log.Println(err)
-		return
-	}
-	if status != http.StatusOK {
-		http.Error(w, string(body), status)
+	userId, err := util.ParseToken(h.app, r.Context(), token)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 
-	url = fmt.Sprintf("%s/api/posts/%d/likes", config.Host, postId)
-	body, status, err = util.Request("GET", url, token, nil)
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", status)
-		log.Println(err)
+	err = posts_service.Vote(h.app, r.Context(), userId, postId, "like")
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
-	if status != http.StatusOK {
-		http.Error(w, string(body), status)
+	score, err := posts_service.Score(h.app, r.Context(), userId, postId)
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(body))
+	w.Write([]byte(strconv.Itoa(score)))
 }
 
-func dislike(w http.ResponseWriter, r *http.Request) {
+func (h handler) dislike(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
@@ -616,7 +789,7 @@ func dislike(w http.ResponseWriter, r *http.Request) {
 	token, err := util.ParseAuthCookie(r)
 	if err != nil && err != http.ErrNoCookie {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 	if err == http.ErrNoCookie || token == "" {
@@ -625,36 +798,29 @@ func dislike(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("unauthorized"))
 		return
 	}
-
-	url := fmt.Sprintf("%s/api/posts/%d/dislike", config.Host, postId)
-	body, status, err := util.Request("POST", url, token, nil)
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", status)
-		log.Println(err)
-		return
-	}
-	if status != http.StatusOK {
-		http.Error(w, string(body), status)
+	userId, err := util.ParseToken(h.app, r.Context(), token)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 
-	url = fmt.Sprintf("%s/api/posts/%d/likes", config.Host, postId)
-	body, status, err = util.Request("GET", url, token, nil)
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", status)
-		log.Println(err)
+	err = posts_service.Vote(h.app, r.Context(), userId, postId, "dislike")
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
-	if status != http.StatusOK {
-		http.Error(w, string(body), status)
+	score, err := posts_service.Score(h.app, r.Context(), userId, postId)
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(body))
+	w.Write([]byte(strconv.Itoa(score)))
 }
 
-func tag(w http.ResponseWriter, r *http.Request) {
+func (h handler) tag(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
@@ -670,39 +836,24 @@ func tag(w http.ResponseWriter, r *http.Request) {
 	token, err := util.ParseAuthCookie(r)
 	if err != nil && err != http.ErrNoCookie {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 	if token != "" {
-		userId, err = util.ParseToken(token)
+		userId, err = util.ParseToken(h.app, r.Context(), token)
 		if err != nil {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 	}
 
-	url := fmt.Sprintf("%s/api/posts/tags/t/%s", config.Host, tagName)
-	body, status, err := util.Request("GET", url, token, nil)
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-	if status != http.StatusOK && status != http.StatusNotFound {
-		http.Error(w, string(body), status)
+	postList, err := posts_service.Tagged(h.app, r.Context(), tagName)
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
 
-	var postList []posts.Post
-	if status != http.StatusNotFound {
-		err = json.Unmarshal(body, &postList)
-		if err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
-			return
-		}
-	}
-
 	for i, post := range postList {
 		lines := strings.Split(post.Text, "\n")
 		var text string
@@ -725,7 +876,7 @@ func tag(w http.ResponseWriter, r *http.Request) {
 	path := "/web/posts" + r.URL.String()
 
 	files := []string{
-		"templates/base.html", "templates/posts/posts.html",
+		"base.html", "posts/posts.html",
 	}
 	funcmap := template.FuncMap{
 		"dateformat": func(t time.Time) string { return t.Format("January 2, 2006") },
@@ -735,16 +886,18 @@ func tag(w http.ResponseWriter, r *http.Request) {
 		Posts  []posts.Post
 		UserId int
 		Path   string
-	}{postList, userId, path}
-	err = util.Template(files, funcmap, w, tdata)
+		Next   string
+		Feed   string
+	}{postList, userId, path, "", "/feed/tag/" + tagName}
+	err = util.Template(h.app, files, funcmap, w, tdata)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 }
 
-func search(w http.ResponseWriter, r *http.Request) {
+func (h handler) search(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
@@ -754,47 +907,38 @@ func search(w http.ResponseWriter, r *http.Request) {
 	token, err := util.ParseAuthCookie(r)
 	if err != nil && err != http.ErrNoCookie {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 	if token != "" {
-		userId, err = util.ParseToken(token)
+		userId, err = util.ParseToken(h.app, r.Context(), token)
 		if err != nil {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
 			return
 		}
 	}
 
-	query := r.URL.Query().Get("query")
+	query := r.URL.Query().Get("q")
 	if query == "" {
 		http.Error(w, "Invalid URL Format", http.StatusBadRequest)
 		return
 	}
 
-	url := fmt.Sprintf("%s/api/posts/search/q/%s", config.Host, query)
-	body, status, err := util.Request("GET", url, token, nil)
-	if status == http.StatusInternalServerError {
-		http.Error(w, "Internal Error", status)
-		log.Println(err)
-		return
-	}
-	if status != http.StatusOK && status != http.StatusNotFound {
-		http.Error(w, string(body), status)
+	results, err := posts_service.Search(h.app, r.Context(), query, page.DefaultLimit)
+	if err != nil {
+		util.WriteError(w, r, err)
 		return
 	}
 
-	var postList []posts.Post
-	if status != http.StatusNotFound {
-		err = json.Unmarshal(body, &postList)
-		if err != nil {
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			log.Println("failed to unmarshal JSON:", err)
-			return
+	postList := make([]posts.Post, len(results))
+	for i, result := range results {
+		postList[i] = result.Post
+		if result.Snippet != "" {
+			postList[i].Text = "<p>" + result.Snippet + "</p>"
+			continue
 		}
-	}
-
-	for i, post := range postList {
+		post := result.Post
 		lines := strings.Split(post.Text, "\n")
 		var text string
 		if len(lines) > 5 {
@@ -816,7 +960,7 @@ func search(w http.ResponseWriter, r *http.Request) {
 	path := "/web/posts" + r.URL.String()
 
 	files := []string{
-		"templates/base.html", "templates/posts/posts.html",
+		"base.html", "posts/posts.html",
 	}
 	funcmap := template.FuncMap{
 		"dateformat": func(t time.Time) string { return t.Format("January 2, 2006") },
@@ -826,25 +970,33 @@ func search(w http.ResponseWriter, r *http.Request) {
 		Posts  []posts.Post
 		UserId int
 		Path   string
-	}{postList, userId, path}
-	err = util.Template(files, funcmap, w, tdata)
+		Next   string
+		Feed   string
+	}{postList, userId, path, "", ""}
+	err = util.Template(h.app, files, funcmap, w, tdata)
 	if err != nil {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		return
 	}
 }
 
-func ServeMux() *http.ServeMux {
+func ServeMux(a *app.App) *http.ServeMux {
+	h := handler{a}
 	mux := http.NewServeMux()
-	mux.HandleFunc("/add", add)
-	mux.HandleFunc("/update/{id}", update)
-	mux.HandleFunc("GET /get", get)
-	mux.HandleFunc("GET /get/{id}", getId)
-	mux.HandleFunc("DELETE /delete/{id}", delete)
-	mux.HandleFunc("POST /like/{id}", like)
-	mux.HandleFunc("POST /dislike/{id}", dislike)
-	mux.HandleFunc("GET /tag/{name}", tag)
-	mux.HandleFunc("GET /search", search)
+	mux.HandleFunc("/add", h.add)
+	mux.HandleFunc("/update/{id}", h.update)
+	mux.HandleFunc("GET /get", h.get)
+	mux.HandleFunc("GET /get/{id}", h.getId)
+	mux.HandleFunc("DELETE /delete/{id}", h.delete)
+	mux.HandleFunc("POST /unpublish/{id}", h.unpublish)
+	mux.HandleFunc("GET /drafts", h.drafts)
+	mux.HandleFunc("GET /history/{id}", h.history)
+	mux.HandleFunc("POST /restore/{id}/{rev}", h.restore)
+	mux.HandleFunc("POST /like/{id}", h.like)
+	mux.HandleFunc("POST /dislike/{id}", h.dislike)
+	mux.HandleFunc("GET /tag/{name}", h.tag)
+	mux.HandleFunc("GET /search", h.search)
+	mux.HandleFunc("GET /picker", h.picker)
 	return mux
 }
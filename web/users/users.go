@@ -0,0 +1,175 @@
+package users
+
+import (
+	"blog/app"
+	"blog/db/auth"
+	"blog/db/comments"
+	"blog/db/images"
+	"blog/db/posts"
+	"blog/db/profiles"
+	"blog/logging"
+	"blog/policy"
+	users_service "blog/service/users"
+	"blog/util"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// handler serves the profile pages of an App.
+type handler struct {
+	app *app.App
+}
+
+// recentComments is the number of comments shown on a profile page.
+const recentComments = 10
+
+func (h handler) profile(w http.ResponseWriter, r *http.Request) {
+	var user auth.User
+	token, err := util.ParseAuthCookie(r)
+	if err != nil && err != http.ErrNoCookie {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	if token != "" {
+		user, err = util.ParseUser(h.app, r.Context(), token)
+		if err != nil {
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
+			return
+		}
+	}
+
+	username := r.PathValue("username")
+	prof, err := users_service.Profile(h.app, r.Context(), username)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	postList, err := users_service.Posts(h.app, r.Context(), username)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+	commentList, err := users_service.Comments(h.app, r.Context(), username, recentComments)
+	if err != nil {
+		util.WriteError(w, r, err)
+		return
+	}
+
+	files := []string{
+		"base.html", "users/profile.html",
+	}
+	funcmap := template.FuncMap{
+		"can":        policy.Can,
+		"dateformat": func(t time.Time) string { return t.Format("January 2, 2006") },
+	}
+	tdata := struct {
+		Profile  profiles.Profile
+		Posts    []posts.Post
+		Comments []comments.Comment
+		UserId   int
+		Role     string
+	}{prof, postList, commentList, user.Id, user.Role}
+	err = util.Template(h.app, files, funcmap, w, tdata)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+}
+
+func (h handler) update(w http.ResponseWriter, r *http.Request) {
+	token, err := util.ParseAuthCookie(r)
+	if err != nil && err != http.ErrNoCookie {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	if err == http.ErrNoCookie || token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	user, err := util.ParseUser(h.app, r.Context(), token)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		return
+	}
+	username := r.PathValue("username")
+
+	if r.Method == http.MethodGet {
+		prof, err := users_service.Profile(h.app, r.Context(), username)
+		if err != nil {
+			util.WriteError(w, r, err)
+			return
+		}
+		if !policy.Can(user.Id, user.Role, policy.EditProfile, prof.UserId) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		imageList, err := users_service.Images(h.app, r.Context(), username)
+		if err != nil {
+			util.WriteError(w, r, err)
+			return
+		}
+
+		files := []string{
+			"base.html", "users/update.html",
+		}
+		tdata := struct {
+			Profile profiles.Profile
+			Images  []images.Image
+			UserId  int
+			Role    string
+		}{prof, imageList, user.Id, user.Role}
+		err = util.Template(h.app, files, template.FuncMap{}, w, tdata)
+		if err != nil {
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			logging.FromContext(r.Context()).Error("request failed", "err", err)
+			return
+		}
+
+	} else if r.Method == http.MethodPost {
+		err = r.ParseForm()
+		if err != nil {
+			http.Error(w, "Unable to parse form", http.StatusBadRequest)
+			return
+		}
+
+		var avatarId int
+		if r.FormValue("avatar") != "" {
+			avatarId, err = strconv.Atoi(r.FormValue("avatar"))
+			if err != nil {
+				http.Error(w, "Invalid Avatar", http.StatusBadRequest)
+				return
+			}
+		}
+		prof := profiles.Profile{
+			DisplayName: r.FormValue("display_name"),
+			Bio:         r.FormValue("bio"),
+			AvatarId:    avatarId,
+			Website:     r.FormValue("website"),
+		}
+		err = users_service.Update(h.app, r.Context(), user.Id, username, prof)
+		if err != nil {
+			util.WriteError(w, r, err)
+			return
+		}
+
+		w.Header().Set("HX-Redirect", "/web/users/"+url.PathEscape(username))
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	}
+}
+
+func ServeMux(a *app.App) *http.ServeMux {
+	h := handler{a}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{username}", h.profile)
+	mux.HandleFunc("/update/{username}", h.update)
+	return mux
+}
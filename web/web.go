@@ -1,23 +1,60 @@
 package web
 
 import (
+	"blog/app"
+	images_db "blog/db/images"
+	"blog/ratelimit"
+	"blog/util"
 	"blog/web/auth"
 	"blog/web/comments"
 	"blog/web/images"
 	"blog/web/posts"
+	"blog/web/users"
 	"net/http"
+	"net/url"
+	"strconv"
 )
 
-func ServeMux() *http.ServeMux {
+// user returns the rate limiting key of a request with a valid access
+// token cookie.
+func user(a *app.App) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		token, err := util.ParseAuthCookie(r)
+		if err != nil || token == "" {
+			return ""
+		}
+		userId, err := util.ParseToken(a, r.Context(), token)
+		if err != nil {
+			return ""
+		}
+		return strconv.Itoa(userId)
+	}
+}
+
+// limit applies the write rate limit of the App to the handler.
+func limit(a *app.App, next http.Handler) http.Handler {
+	return ratelimit.Middleware(a.Limiter, a.Proxies, user(a), next)
+}
+
+func ServeMux(a *app.App) *http.ServeMux {
 	mux := http.NewServeMux()
-	postsMux := posts.ServeMux()
-	authMux := auth.ServeMux()
-	commentsMux := comments.ServeMux()
-	imagesMux := images.ServeMux()
-	mux.Handle("/posts/", http.StripPrefix("/posts", postsMux))
-	mux.Handle("/auth/", http.StripPrefix("/auth", authMux))
-	mux.Handle("/comments/", http.StripPrefix("/comments", commentsMux))
-	mux.Handle("/images/", http.StripPrefix("/images", imagesMux))
-	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+	postsMux := posts.ServeMux(a)
+	authMux := auth.ServeMux(a)
+	commentsMux := comments.ServeMux(a)
+	imagesMux := images.ServeMux(a)
+	usersMux := users.ServeMux(a)
+	mux.Handle("/posts/", limit(a, auth.CSRF(a, auth.Refresh(a, http.StripPrefix("/posts", postsMux)))))
+	mux.Handle("/auth/", limit(a, auth.CSRF(a, auth.Refresh(a, http.StripPrefix("/auth", authMux)))))
+	mux.Handle("/comments/", limit(a, auth.CSRF(a, auth.Refresh(a, http.StripPrefix("/comments", commentsMux)))))
+	mux.Handle("/images/", limit(a, auth.CSRF(a, auth.Refresh(a, http.StripPrefix("/images", imagesMux)))))
+	mux.Handle("/users/", limit(a, auth.CSRF(a, auth.Refresh(a, http.StripPrefix("/users", usersMux)))))
+	mux.HandleFunc("GET /static/images/{name}", legacyImage)
 	return mux
 }
+
+// legacyImage redirects the old addresses of image files, which posts
+// may still link to, to where the API serves them now.
+func legacyImage(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, images_db.URLPrefix+url.PathEscape(r.PathValue("name")),
+		http.StatusMovedPermanently)
+}